@@ -1,6 +1,9 @@
 package analyzer
 
 import (
+	"sort"
+	"strings"
+
 	"github.com/shopspring/decimal"
 
 	"github.com/juev/hledger-lsp/internal/ast"
@@ -9,55 +12,233 @@ import (
 // AccountBalances maps account name -> commodity -> balance
 type AccountBalances map[string]map[string]decimal.Decimal
 
+// BalanceAssignments maps each posting written as `ACCOUNT = AMOUNT`, with no
+// amount of its own, to the amount that brings the account to that balance.
+type BalanceAssignments map[*ast.Posting]ast.Amount
+
 // CalculateAccountBalances computes the balance for each account across all transactions.
 // Returns a map of account name to commodity to balance.
 // Postings with inferred amounts (nil Amount) are skipped.
 func CalculateAccountBalances(journal *ast.Journal) AccountBalances {
+	return CalculateAccountBalancesFromTransactions(journal.Transactions, journal.AutoPostingRules)
+}
+
+// CalculateAccountBalancesFromTransactions computes account balances for the
+// given transactions, including the postings generated by the auto posting
+// rules and the amounts implied by balance assignments.
+func CalculateAccountBalancesFromTransactions(transactions []ast.Transaction, rules []ast.AutoPostingRule) AccountBalances {
+	return runBalances(transactions, rules, false).balances
+}
+
+// ComputeBalanceAssignments computes the amount of every balance assignment
+// in transactions from the running balance of its account. Postings are
+// looked up by address, so the result applies to the postings of the given
+// transactions.
+func ComputeBalanceAssignments(transactions []ast.Transaction, rules []ast.AutoPostingRule) BalanceAssignments {
+	return runBalances(transactions, rules, true).assigned
+}
+
+// CheckBalanceAssertions checks every balance assertion in transactions
+// against the running balance of its account and returns those that fail.
+func CheckBalanceAssertions(transactions []ast.Transaction, rules []ast.AutoPostingRule) []BalanceAssertionFailure {
+	return runBalances(transactions, rules, true).failures
+}
+
+type balanceRun struct {
+	balances AccountBalances
+	assigned BalanceAssignments
+	failures []BalanceAssertionFailure
+}
+
+// runBalances walks the postings in date order, keeping a running balance
+// per account, as hledger does when it processes balance assignments and
+// assertions. A posting is dated by its `date:` tag or its transaction;
+// postings on the same date keep their given order, and each assertion sees
+// the postings before it. With infer set, the amount of a transaction's one
+// amountless posting is inferred and counted after the rest of the
+// transaction on its date.
+func runBalances(transactions []ast.Transaction, rules []ast.AutoPostingRule, infer bool) balanceRun {
 	balances := make(AccountBalances)
+	assigned := make(BalanceAssignments)
+	var failures []BalanceAssertionFailure
+	autoPoster := NewAutoPoster(rules)
+
+	type datedPosting struct {
+		tx      *ast.Transaction
+		posting *ast.Posting
+		date    ast.Date
+	}
 
-	for i := range journal.Transactions {
-		tx := &journal.Transactions[i]
+	var postings []datedPosting
+	generated := make(map[*ast.Posting][]ast.Posting)
+	for i := range transactions {
+		tx := &transactions[i]
+		var amountless []datedPosting
 		for j := range tx.Postings {
 			p := &tx.Postings[j]
-			if p.Amount == nil {
+			dp := datedPosting{tx: tx, posting: p, date: tx.PostingDate(p)}
+			if p.Amount == nil && p.BalanceAssertion == nil {
+				amountless = append(amountless, dp)
 				continue
 			}
+			postings = append(postings, dp)
+		}
+		postings = append(postings, amountless...)
+		for _, g := range autoPoster.Generate(tx) {
+			generated[g.Matched] = append(generated[g.Matched], g.Posting)
+		}
+	}
 
-			accountName := p.Account.Name
-			commodity := p.Amount.Commodity.Symbol
+	sort.SliceStable(postings, func(a, b int) bool {
+		return dateBefore(postings[a].date, postings[b].date)
+	})
 
-			if balances[accountName] == nil {
-				balances[accountName] = make(map[string]decimal.Decimal)
+	for _, dp := range postings {
+		p := dp.posting
+		switch amount, ok := balances.assign(p); {
+		case ok:
+			assigned[p] = amount
+		case p.Amount == nil:
+			if infer && p.Virtual != ast.VirtualUnbalanced {
+				balances.addInferred(dp.tx, p, assigned)
 			}
-
-			balances[accountName][commodity] = balances[accountName][commodity].Add(p.Amount.Quantity)
+		default:
+			balances.add(p)
+			failures = append(failures, balances.check(p)...)
+		}
+		for i := range generated[p] {
+			balances.add(&generated[p][i])
 		}
 	}
 
-	return balances
+	return balanceRun{balances: balances, assigned: assigned, failures: failures}
 }
 
-func CalculateAccountBalancesFromTransactions(transactions []ast.Transaction) AccountBalances {
-	balances := make(AccountBalances)
+// check returns the failures of a posting's balance assertion. A strict
+// assertion (`==`) also requires every other commodity to be zero, and an
+// inclusive one (`=*`) counts the balances of subaccounts.
+func (b AccountBalances) check(p *ast.Posting) []BalanceAssertionFailure {
+	ba := p.BalanceAssertion
+	if ba == nil {
+		return nil
+	}
 
-	for i := range transactions {
-		tx := &transactions[i]
-		for j := range tx.Postings {
-			p := &tx.Postings[j]
-			if p.Amount == nil {
-				continue
-			}
+	actual := b[p.Account.Name]
+	if ba.IsInclusive {
+		actual = b.inclusive(p.Account.Name)
+	}
 
-			accountName := p.Account.Name
-			commodity := p.Amount.Commodity.Symbol
+	var failures []BalanceAssertionFailure
+	fail := func(commodity string, expected decimal.Decimal) {
+		if !actual[commodity].Equal(expected) {
+			failures = append(failures, BalanceAssertionFailure{
+				Posting:   p,
+				Commodity: commodity,
+				Expected:  expected,
+				Actual:    actual[commodity],
+			})
+		}
+	}
 
-			if balances[accountName] == nil {
-				balances[accountName] = make(map[string]decimal.Decimal)
+	fail(ba.Amount.Commodity.Symbol, ba.Amount.Quantity)
+	if ba.IsStrict {
+		commodities := make([]string, 0, len(actual))
+		for c := range actual {
+			if c != ba.Amount.Commodity.Symbol {
+				commodities = append(commodities, c)
 			}
+		}
+		sort.Strings(commodities)
+		for _, c := range commodities {
+			fail(c, decimal.Zero)
+		}
+	}
+
+	return failures
+}
+
+// inclusive returns the balance of an account together with its subaccounts.
+func (b AccountBalances) inclusive(account string) map[string]decimal.Decimal {
+	total := make(map[string]decimal.Decimal)
+	for name, commodities := range b {
+		if name != account && !strings.HasPrefix(name, account+":") {
+			continue
+		}
+		for c, q := range commodities {
+			total[c] = total[c].Add(q)
+		}
+	}
+	return total
+}
+
+// assign applies a balance assignment: it sets the account's balance in the
+// assigned commodity and returns the amount that took it there. A strict
+// assignment (`==`) also sets every other commodity of the account to zero.
+func (b AccountBalances) assign(p *ast.Posting) (ast.Amount, bool) {
+	if p.Amount != nil || p.BalanceAssertion == nil {
+		return ast.Amount{}, false
+	}
+
+	target := p.BalanceAssertion.Amount
+	accountName := p.Account.Name
+	commodity := target.Commodity.Symbol
 
-			balances[accountName][commodity] = balances[accountName][commodity].Add(p.Amount.Quantity)
+	if b[accountName] == nil {
+		b[accountName] = make(map[string]decimal.Decimal)
+	}
+
+	amount := target
+	amount.Quantity = target.Quantity.Sub(b[accountName][commodity])
+	amount.RawQuantity = ""
+	b[accountName][commodity] = target.Quantity
+	if p.BalanceAssertion.IsStrict {
+		for c := range b[accountName] {
+			if c != commodity {
+				b[accountName][c] = decimal.Zero
+			}
 		}
 	}
 
-	return balances
+	return amount, true
+}
+
+// addInferred adds the amount that balances tx to its amountless posting p.
+// Nothing is added when the amount cannot be inferred.
+func (b AccountBalances) addInferred(tx *ast.Transaction, p *ast.Posting, assigned BalanceAssignments) {
+	realPostings := filterRealPostings(withAssignedAmounts(tx.Postings, assigned))
+	if count, _ := countInferredPostings(realPostings); count != 1 {
+		return
+	}
+
+	if b[p.Account.Name] == nil {
+		b[p.Account.Name] = make(map[string]decimal.Decimal)
+	}
+	for commodity, sum := range sumByCommodity(realPostings) {
+		b[p.Account.Name][commodity] = b[p.Account.Name][commodity].Sub(sum)
+	}
+}
+
+func (b AccountBalances) add(p *ast.Posting) {
+	if p.Amount == nil {
+		return
+	}
+
+	accountName := p.Account.Name
+	commodity := p.Amount.Commodity.Symbol
+
+	if b[accountName] == nil {
+		b[accountName] = make(map[string]decimal.Decimal)
+	}
+
+	b[accountName][commodity] = b[accountName][commodity].Add(p.Amount.Quantity)
+}
+
+func dateBefore(a, b ast.Date) bool {
+	if a.Year != b.Year {
+		return a.Year < b.Year
+	}
+	if a.Month != b.Month {
+		return a.Month < b.Month
+	}
+	return a.Day < b.Day
 }
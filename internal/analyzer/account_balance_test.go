@@ -116,3 +116,150 @@ func TestCalculateAccountBalances_ZeroBalance(t *testing.T) {
 	assert.True(t, balances["expenses:food"]["$"].IsZero())
 	assert.True(t, balances["assets:cash"]["$"].IsZero())
 }
+
+func TestCalculateAccountBalances_BalanceAssignment(t *testing.T) {
+	input := `2024-01-20 reconcile
+    assets:checking  = $1000
+    equity:adjustments
+
+2024-01-15 deposit
+    assets:checking  $800
+    income:salary  $-800`
+
+	journal, errs := parser.Parse(input)
+	require.Empty(t, errs)
+
+	balances := CalculateAccountBalances(journal)
+
+	assert.True(t, balances["assets:checking"]["$"].Equal(decimal.NewFromInt(1000)))
+
+	assigned := ComputeBalanceAssignments(journal.Transactions, nil)
+	amount, ok := assigned[&journal.Transactions[0].Postings[0]]
+	require.True(t, ok)
+	assert.True(t, amount.Quantity.Equal(decimal.NewFromInt(200)), "got %s", amount.Quantity)
+	assert.Equal(t, "$", amount.Commodity.Symbol)
+}
+
+func TestCalculateAccountBalances_StrictBalanceAssignment(t *testing.T) {
+	input := `2024-01-15 deposit
+    assets:checking  $800
+    assets:checking  10 EUR
+    income:salary
+
+2024-01-20 reconcile
+    assets:checking  == $1000
+    equity:adjustments
+
+2024-01-25 check
+    assets:checking  $0 == $1000`
+
+	journal, errs := parser.Parse(input)
+	require.Empty(t, errs)
+
+	balances := CalculateAccountBalances(journal)
+	assert.True(t, balances["assets:checking"]["$"].Equal(decimal.NewFromInt(1000)))
+	assert.True(t, balances["assets:checking"]["EUR"].IsZero(), "got %s", balances["assets:checking"]["EUR"])
+
+	assert.Empty(t, CheckBalanceAssertions(journal.Transactions, nil))
+}
+
+func TestCheckBalanceAssertions(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		failures int
+	}{
+		{
+			name: "holds after inferred posting",
+			input: `2024-01-15 deposit
+    income:salary  $-800
+    assets:checking
+
+2024-01-16 check
+    assets:checking  $0 = $800`,
+		},
+		{
+			name: "wrong balance",
+			input: `2024-01-15 deposit
+    assets:checking  $800
+    income:salary
+
+2024-01-16 check
+    assets:checking  $0 = $500`,
+			failures: 1,
+		},
+		{
+			name: "date order, not file order",
+			input: `2024-01-16 check
+    assets:checking  $0 = $800
+
+2024-01-15 deposit
+    assets:checking  $800
+    income:salary`,
+		},
+		{
+			name: "non-strict ignores other commodities",
+			input: `2024-01-15 deposit
+    assets:checking  $800
+    assets:checking  10 EUR
+    income:salary
+
+2024-01-16 check
+    assets:checking  $0 = $800`,
+		},
+		{
+			name: "strict requires other commodities to be zero",
+			input: `2024-01-15 deposit
+    assets:checking  $800
+    assets:checking  10 EUR
+    income:salary
+
+2024-01-16 check
+    assets:checking  $0 == $800`,
+			failures: 1,
+		},
+		{
+			name: "inclusive counts subaccounts",
+			input: `2024-01-15 deposit
+    assets:bank:checking  $800
+    assets:bank:savings  $200
+    income:salary
+
+2024-01-16 check
+    assets:bank  $0 =* $1000`,
+		},
+		{
+			name: "assignment always holds",
+			input: `2024-01-15 reconcile
+    assets:checking  = $1000
+    equity:adjustments`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			journal, errs := parser.Parse(tt.input)
+			require.Empty(t, errs)
+
+			failures := CheckBalanceAssertions(journal.Transactions, nil)
+			assert.Len(t, failures, tt.failures)
+		})
+	}
+}
+
+func TestCheckBalanceAssertions_PostingDates(t *testing.T) {
+	input := `2024-01-30 purchase
+    expenses:food  $50
+    liabilities:card  $-50  ; date:2024-02-03
+
+2024-02-01 statement
+    liabilities:card  $0 = $0
+
+2024-02-05 after clearing
+    liabilities:card  $0 = $-50`
+
+	journal, errs := parser.Parse(input)
+	require.Empty(t, errs)
+
+	assert.Empty(t, CheckBalanceAssertions(journal.Transactions, nil))
+}
@@ -0,0 +1,225 @@
+package analyzer
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/juev/hledger-lsp/internal/ast"
+)
+
+// CheckUniqueLeafNames reports the accounts of journal whose leaf name is
+// also the leaf name of another account, like `hledger check
+// uniqueleafnames`. Other accounts are those of accounts and of journal
+// itself. Each account is reported once, where it first appears.
+func CheckUniqueLeafNames(journal *ast.Journal, accounts *AccountIndex) []Diagnostic {
+	occurrences := firstAccountOccurrences(journal)
+	byLeaf := make(map[string][]string)
+	for _, name := range knownAccounts(occurrences, accounts) {
+		leaf := accountLeaf(name)
+		byLeaf[leaf] = append(byLeaf[leaf], name)
+	}
+
+	var diags []Diagnostic
+	for _, account := range occurrences {
+		leaf := accountLeaf(account.Name)
+		var others []string
+		for _, name := range byLeaf[leaf] {
+			if name != account.Name {
+				others = append(others, name)
+			}
+		}
+		if len(others) == 0 {
+			continue
+		}
+		diags = append(diags, Diagnostic{
+			Range:    account.Range,
+			Severity: SeverityWarning,
+			Code:     "NON_UNIQUE_LEAF_NAME",
+			Message:  fmt.Sprintf("account leaf name %q is also used by %s", leaf, strings.Join(others, ", ")),
+		})
+	}
+	return diags
+}
+
+// CheckSimilarAccounts reports the accounts of journal that look like a
+// misspelling of an account posted to more often: the same name in
+// another case or spacing, or a sibling whose leaf name is a few edits
+// away. counts holds the number of postings per account; accounts of
+// journal it does not know count as unused elsewhere.
+func CheckSimilarAccounts(journal *ast.Journal, counts map[string]int) []Diagnostic {
+	occurrences := firstAccountOccurrences(journal)
+	local := CollectAccountCounts(journal)
+	usage := func(name string) int {
+		if count, ok := counts[name]; ok {
+			return count
+		}
+		return local[name]
+	}
+
+	bySibling := make(map[string][]string)
+	for _, name := range knownAccounts(occurrences, &AccountIndex{All: sortedAccountNames(counts)}) {
+		parent := normalizeAccountName(accountParent(name))
+		bySibling[parent] = append(bySibling[parent], name)
+	}
+
+	var diags []Diagnostic
+	for _, account := range occurrences {
+		count := usage(account.Name)
+		normalized := normalizeAccountName(account.Name)
+		leaf := normalizeAccountName(accountLeaf(account.Name))
+		best, bestCount := "", -1
+		for _, name := range bySibling[normalizeAccountName(accountParent(account.Name))] {
+			if name == account.Name || usage(name) <= count || usage(name) <= bestCount {
+				continue
+			}
+			if normalizeAccountName(name) != normalized && !similarLeaves(leaf, normalizeAccountName(accountLeaf(name))) {
+				continue
+			}
+			best, bestCount = name, usage(name)
+		}
+		if best == "" {
+			continue
+		}
+		diags = append(diags, Diagnostic{
+			Range:    account.Range,
+			Severity: SeverityWarning,
+			Code:     "SIMILAR_ACCOUNT",
+			Message:  fmt.Sprintf("account %s looks like a misspelling of %s (%d postings)", account.Name, best, bestCount),
+		})
+	}
+	return diags
+}
+
+// firstAccountOccurrences returns the first account directive or posting
+// of each account of journal, in source order.
+func firstAccountOccurrences(journal *ast.Journal) []ast.Account {
+	first := make(map[string]ast.Account)
+	add := func(account ast.Account) {
+		if account.Name == "" {
+			return
+		}
+		if existing, ok := first[account.Name]; !ok || account.Range.Start.Offset < existing.Range.Start.Offset {
+			first[account.Name] = account
+		}
+	}
+	for _, dir := range journal.Directives {
+		if accDir, ok := dir.(ast.AccountDirective); ok {
+			add(accDir.Account)
+		}
+	}
+	for _, tx := range journal.Transactions {
+		for _, posting := range tx.Postings {
+			add(posting.Account)
+		}
+	}
+
+	occurrences := make([]ast.Account, 0, len(first))
+	for _, account := range first {
+		occurrences = append(occurrences, account)
+	}
+	sort.Slice(occurrences, func(i, j int) bool {
+		return occurrences[i].Range.Start.Offset < occurrences[j].Range.Start.Offset
+	})
+	return occurrences
+}
+
+// knownAccounts returns the accounts of accounts and occurrences, sorted
+// and without repeats.
+func knownAccounts(occurrences []ast.Account, accounts *AccountIndex) []string {
+	seen := make(map[string]bool)
+	var names []string
+	if accounts != nil {
+		for _, name := range accounts.All {
+			if !seen[name] {
+				seen[name] = true
+				names = append(names, name)
+			}
+		}
+	}
+	for _, account := range occurrences {
+		if !seen[account.Name] {
+			seen[account.Name] = true
+			names = append(names, account.Name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+func sortedAccountNames(counts map[string]int) []string {
+	names := make([]string, 0, len(counts))
+	for name := range counts {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func accountLeaf(name string) string {
+	return name[strings.LastIndex(name, ":")+1:]
+}
+
+func accountParent(name string) string {
+	if i := strings.LastIndex(name, ":"); i >= 0 {
+		return name[:i]
+	}
+	return ""
+}
+
+// normalizeAccountName lowercases name and drops its whitespace, so that
+// names differing only in case or spacing compare equal.
+func normalizeAccountName(name string) string {
+	return strings.Map(func(r rune) rune {
+		if unicode.IsSpace(r) {
+			return -1
+		}
+		return unicode.ToLower(r)
+	}, name)
+}
+
+// similarLeaves reports whether two different leaf names are close enough
+// to be a misspelling of one another: within one edit per three
+// characters of the longer name. Names shorter than four characters are
+// too short to tell, and names that differ only in digits, like checking1
+// and checking2, are told apart on purpose.
+func similarLeaves(a, b string) bool {
+	if a == b || onlyDigitsDiffer(a, b) {
+		return false
+	}
+	ra, rb := []rune(a), []rune(b)
+	longest := max(len(ra), len(rb))
+	return longest >= 4 && editDistance(ra, rb) <= (longest+1)/3
+}
+
+func onlyDigitsDiffer(a, b string) bool {
+	stripDigits := func(r rune) rune {
+		if unicode.IsDigit(r) {
+			return -1
+		}
+		return r
+	}
+	return strings.Map(stripDigits, a) == strings.Map(stripDigits, b)
+}
+
+// editDistance returns the Levenshtein distance between a and b.
+func editDistance(a, b []rune) int {
+	prev := make([]int, len(b)+1)
+	curr := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		curr[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			curr[j] = min(prev[j]+1, curr[j-1]+1, prev[j-1]+cost)
+		}
+		prev, curr = curr, prev
+	}
+	return prev[len(b)]
+}
@@ -0,0 +1,103 @@
+package analyzer
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/juev/hledger-lsp/internal/parser"
+)
+
+func TestCheckUniqueLeafNames(t *testing.T) {
+	journal, errs := parser.Parse(`account expenses:fees
+
+2024-01-01 bank
+    expenses:fees  $1
+    assets:bank:checking
+
+2024-01-02 fees
+    expenses:fees  $2
+    assets:bank:checking
+`)
+	require.Empty(t, errs)
+
+	accounts := &AccountIndex{All: []string{"assets:bank:checking", "assets:bank:fees", "expenses:fees"}}
+	diags := CheckUniqueLeafNames(journal, accounts)
+	require.Len(t, diags, 1)
+	assert.Equal(t, "NON_UNIQUE_LEAF_NAME", diags[0].Code)
+	assert.Equal(t, SeverityWarning, diags[0].Severity)
+	assert.Equal(t, `account leaf name "fees" is also used by assets:bank:fees`, diags[0].Message)
+	assert.Equal(t, 1, diags[0].Range.Start.Line, "reported at the account directive")
+
+	assert.Empty(t, CheckUniqueLeafNames(journal, nil))
+}
+
+func TestCheckSimilarAccounts(t *testing.T) {
+	journal, errs := parser.Parse(`2024-01-01 market
+    expenses:grocery  $10
+    Expenses:Dining Out  $5
+    assets:checking2  $-15
+
+2024-01-02 market
+    expenses:grocery  $3
+    assets:checking2
+`)
+	require.Empty(t, errs)
+
+	counts := map[string]int{
+		"expenses:groceries": 40,
+		"expenses:diningout": 12,
+		"expenses:fuel":      9,
+		"assets:checking1":   50,
+		"assets:checking2":   2,
+	}
+	diags := CheckSimilarAccounts(journal, counts)
+	require.Len(t, diags, 2)
+	assert.Equal(t, "SIMILAR_ACCOUNT", diags[0].Code)
+	assert.Equal(t, "account expenses:grocery looks like a misspelling of expenses:groceries (40 postings)", diags[0].Message)
+	assert.Equal(t, 2, diags[0].Range.Start.Line)
+	assert.Equal(t, "account Expenses:Dining Out looks like a misspelling of expenses:diningout (12 postings)", diags[1].Message)
+	assert.Equal(t, 3, diags[1].Range.Start.Line)
+
+	// The more used spelling is not reported.
+	counts["expenses:grocery"] = 100
+	counts["Expenses:Dining Out"] = 100
+	assert.Empty(t, CheckSimilarAccounts(journal, counts))
+}
+
+func TestCheckSimilarAccounts_EqualUsage(t *testing.T) {
+	journal, errs := parser.Parse(`2024-01-01 shop
+    expenses:books  $10
+    expenses:boots  $20
+    assets:cash
+
+2024-01-02 trip
+    expenses:hotel  $50
+    expenses:hostel  $30
+    assets:cash
+`)
+	require.Empty(t, errs)
+
+	assert.Empty(t, CheckSimilarAccounts(journal, nil), "neither of two equally used accounts is the misspelling")
+}
+
+func TestSimilarLeaves(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want bool
+	}{
+		{"grocery", "groceries", true},
+		{"salary", "salaries", true},
+		{"food", "fool", true},
+		{"food", "fuel", false},
+		{"checking1", "checking2", false},
+		{"car", "tax", false},
+		{"ab", "ac", false},
+		{"tax", "fax", false},
+		{"rent", "rent", false},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, similarLeaves(tt.a, tt.b), "%s vs %s", tt.a, tt.b)
+	}
+}
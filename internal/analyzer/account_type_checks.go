@@ -0,0 +1,55 @@
+package analyzer
+
+import (
+	"fmt"
+
+	"github.com/juev/hledger-lsp/internal/ast"
+)
+
+// CheckPositiveIncome reports positive amounts posted to revenue accounts.
+// Income is negative in hledger, so a positive one is usually a sign
+// mistake; refunds of income are the exception.
+func CheckPositiveIncome(transactions []ast.Transaction, types *AccountTypes) []Diagnostic {
+	var diags []Diagnostic
+	for i := range transactions {
+		for j := range transactions[i].Postings {
+			posting := &transactions[i].Postings[j]
+			if posting.Amount == nil || posting.Invalid || !posting.Amount.Quantity.IsPositive() {
+				continue
+			}
+			if !types.Type(posting.Account.Name).Is(AccountTypeRevenue) {
+				continue
+			}
+			diags = append(diags, Diagnostic{
+				Range:    posting.Amount.Range,
+				Severity: SeverityWarning,
+				Code:     "POSITIVE_INCOME",
+				Message:  fmt.Sprintf("revenue account %s is posted a positive amount; income is normally negative", posting.Account.Name),
+			})
+		}
+	}
+	return diags
+}
+
+// CheckMissingAssertions reports the asset accounts that have no balance
+// assertion in transactions or others, at their latest posting when it
+// is one of transactions.
+func CheckMissingAssertions(transactions, others []ast.Transaction, types *AccountTypes) []Diagnostic {
+	isAsset := func(account string) bool {
+		return types.Type(account).Is(AccountTypeAsset)
+	}
+	var diags []Diagnostic
+	for name, a := range collectAssertionActivity(transactions, others, isAsset) {
+		if a.asserted != nil || a.latestLocal == nil {
+			continue
+		}
+		diags = append(diags, Diagnostic{
+			Range:    a.latestLocal.Account.Range,
+			Severity: SeverityWarning,
+			Code:     "MISSING_BALANCE_ASSERTION",
+			Message:  fmt.Sprintf("asset account %s has no balance assertion", name),
+		})
+	}
+	sortDiagnostics(diags)
+	return diags
+}
@@ -0,0 +1,63 @@
+package analyzer
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/juev/hledger-lsp/internal/parser"
+)
+
+func TestCheckPositiveIncome(t *testing.T) {
+	journal, errs := parser.Parse(`account work:pay  ; type: R
+
+2024-01-31 employer
+    assets:checking  $1000
+    income:salary  $-1000
+
+2024-02-01 refund
+    income:salary  $50
+    assets:checking
+
+2024-02-02 side job
+    assets:checking  $20
+    work:pay:tips  $20
+`)
+	require.Empty(t, errs)
+
+	diags := CheckPositiveIncome(journal.Transactions, CollectAccountTypes(journal.Directives))
+	require.Len(t, diags, 2)
+	assert.Equal(t, "POSITIVE_INCOME", diags[0].Code)
+	assert.Equal(t, SeverityWarning, diags[0].Severity)
+	assert.Equal(t, "revenue account income:salary is posted a positive amount; income is normally negative", diags[0].Message)
+	assert.Equal(t, 8, diags[0].Range.Start.Line)
+	assert.Equal(t, 13, diags[1].Range.Start.Line, "type inherited from a declared parent")
+}
+
+func TestCheckMissingAssertions(t *testing.T) {
+	others, errs := parser.Parse(`2024-01-01 count
+    assets:checking  $0 = $100
+    equity:adjustments
+`)
+	require.Empty(t, errs)
+	journal, errs := parser.Parse(`2024-01-05 coffee
+    expenses:food  $5
+    assets:checking
+
+2024-01-06 coffee
+    expenses:food  $5
+    assets:wallet
+
+2024-01-07 coffee
+    expenses:food  $5
+    assets:wallet
+`)
+	require.Empty(t, errs)
+
+	diags := CheckMissingAssertions(journal.Transactions, others.Transactions, nil)
+	require.Len(t, diags, 1)
+	assert.Equal(t, "MISSING_BALANCE_ASSERTION", diags[0].Code)
+	assert.Equal(t, "asset account assets:wallet has no balance assertion", diags[0].Message)
+	assert.Equal(t, 11, diags[0].Range.Start.Line, "points at the latest posting")
+}
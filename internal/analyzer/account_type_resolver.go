@@ -0,0 +1,46 @@
+package analyzer
+
+import (
+	"strings"
+
+	"github.com/juev/hledger-lsp/internal/ast"
+)
+
+// AccountTypes resolves account types from the `type:` tags of account
+// directives.
+type AccountTypes struct {
+	declared map[string]AccountType
+}
+
+// CollectAccountTypes gathers the account types declared by account
+// directives. When an account is declared more than once, the last type
+// wins.
+func CollectAccountTypes(directives []ast.Directive) *AccountTypes {
+	types := &AccountTypes{declared: make(map[string]AccountType)}
+	for _, dir := range directives {
+		accDir, ok := dir.(ast.AccountDirective)
+		if !ok {
+			continue
+		}
+		for _, tag := range accDir.Tags {
+			if t, ok := ParseAccountType(tag.Value); ok && strings.EqualFold(tag.Name, "type") {
+				types.declared[accDir.Account.Name] = t
+			}
+		}
+	}
+	return types
+}
+
+// Type returns the type of account: its declared type, else the type
+// declared for its nearest parent, else the type hledger infers from its
+// name. It returns AccountTypeNone when none applies.
+func (t *AccountTypes) Type(account string) AccountType {
+	if t != nil {
+		for name := account; name != ""; name = accountParent(name) {
+			if typ, ok := t.declared[name]; ok {
+				return typ
+			}
+		}
+	}
+	return InferAccountType(account)
+}
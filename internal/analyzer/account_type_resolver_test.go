@@ -0,0 +1,39 @@
+package analyzer
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/juev/hledger-lsp/internal/parser"
+)
+
+func TestAccountTypes_Type(t *testing.T) {
+	journal, errs := parser.Parse(`account personal:wallet  ; type: C
+account personal:card  ; type:Liability
+account assets:receivable  ; type: X, note: odd on purpose
+account income  ; type: bogus
+`)
+	require.Empty(t, errs)
+	types := CollectAccountTypes(journal.Directives)
+
+	tests := []struct {
+		account string
+		want    AccountType
+	}{
+		{"personal:wallet", AccountTypeCash},
+		{"personal:wallet:coins", AccountTypeCash},
+		{"personal:card", AccountTypeLiability},
+		{"assets:receivable:acme", AccountTypeExpense},
+		{"assets:broker", AccountTypeAsset},
+		{"income", AccountTypeRevenue},
+		{"personal", AccountTypeNone},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, types.Type(tt.account), tt.account)
+	}
+
+	var none *AccountTypes
+	assert.Equal(t, AccountTypeAsset, none.Type("assets:broker"))
+}
@@ -0,0 +1,94 @@
+package analyzer
+
+import (
+	"regexp"
+	"strings"
+)
+
+// AccountType is an hledger account type, written as in `type:` tags of
+// account directives.
+type AccountType string
+
+const (
+	AccountTypeNone       AccountType = ""
+	AccountTypeAsset      AccountType = "A"
+	AccountTypeLiability  AccountType = "L"
+	AccountTypeEquity     AccountType = "E"
+	AccountTypeRevenue    AccountType = "R"
+	AccountTypeExpense    AccountType = "X"
+	AccountTypeCash       AccountType = "C"
+	AccountTypeConversion AccountType = "V"
+)
+
+var accountTypeNames = map[string]AccountType{
+	"asset":      AccountTypeAsset,
+	"liability":  AccountTypeLiability,
+	"equity":     AccountTypeEquity,
+	"revenue":    AccountTypeRevenue,
+	"expense":    AccountTypeExpense,
+	"cash":       AccountTypeCash,
+	"conversion": AccountTypeConversion,
+}
+
+// ParseAccountType reads a `type:` tag value: a type letter or name in any
+// case, like `A` or `Asset`.
+func ParseAccountType(s string) (AccountType, bool) {
+	s = strings.ToLower(strings.TrimSpace(s))
+	for name, t := range accountTypeNames {
+		if s == name || s == strings.ToLower(string(t)) {
+			return t, true
+		}
+	}
+	return AccountTypeNone, false
+}
+
+// Name returns the type's full name, like "Asset".
+func (t AccountType) Name() string {
+	for name, typ := range accountTypeNames {
+		if typ == t {
+			return strings.ToUpper(name[:1]) + name[1:]
+		}
+	}
+	return ""
+}
+
+// Is reports whether t is other or one of its subtypes: cash accounts are
+// assets and conversion accounts are equity.
+func (t AccountType) Is(other AccountType) bool {
+	switch {
+	case t == other:
+		return true
+	case t == AccountTypeCash:
+		return other == AccountTypeAsset
+	case t == AccountTypeConversion:
+		return other == AccountTypeEquity
+	default:
+		return false
+	}
+}
+
+// accountTypePatterns infer the type of an account from its name, as
+// hledger does. More specific patterns come first.
+var accountTypePatterns = []struct {
+	pattern *regexp.Regexp
+	typ     AccountType
+}{
+	{regexp.MustCompile(`(?i)^assets?(:.+)?:(cash|bank|che(ck|que)ing|savings?|current)(:|$)`), AccountTypeCash},
+	{regexp.MustCompile(`(?i)^assets?(:|$)`), AccountTypeAsset},
+	{regexp.MustCompile(`(?i)^(debts?|liabilit(y|ies))(:|$)`), AccountTypeLiability},
+	{regexp.MustCompile(`(?i)^equity:(trade|trades|trading|conversion)(:|$)`), AccountTypeConversion},
+	{regexp.MustCompile(`(?i)^equity(:|$)`), AccountTypeEquity},
+	{regexp.MustCompile(`(?i)^(income|revenue)s?(:|$)`), AccountTypeRevenue},
+	{regexp.MustCompile(`(?i)^expenses?(:|$)`), AccountTypeExpense},
+}
+
+// InferAccountType returns the type hledger infers for account from its
+// name, or AccountTypeNone when the name does not tell.
+func InferAccountType(account string) AccountType {
+	for _, p := range accountTypePatterns {
+		if p.pattern.MatchString(account) {
+			return p.typ
+		}
+	}
+	return AccountTypeNone
+}
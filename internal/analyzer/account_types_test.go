@@ -0,0 +1,40 @@
+package analyzer
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestInferAccountType(t *testing.T) {
+	tests := []struct {
+		account string
+		want    AccountType
+	}{
+		{"assets:broker", AccountTypeAsset},
+		{"Assets:Bank:Checking", AccountTypeCash},
+		{"assets:savings", AccountTypeCash},
+		{"liabilities:mortgage", AccountTypeLiability},
+		{"debts", AccountTypeLiability},
+		{"equity:opening balances", AccountTypeEquity},
+		{"equity:conversion", AccountTypeConversion},
+		{"income:salary", AccountTypeRevenue},
+		{"revenues", AccountTypeRevenue},
+		{"expenses:food", AccountTypeExpense},
+		{"personal", AccountTypeNone},
+		{"assetsfoo", AccountTypeNone},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, InferAccountType(tt.account), tt.account)
+	}
+}
+
+func TestAccountType_Is(t *testing.T) {
+	assert.True(t, AccountTypeCash.Is(AccountTypeAsset))
+	assert.True(t, AccountTypeConversion.Is(AccountTypeEquity))
+	assert.True(t, AccountTypeAsset.Is(AccountTypeAsset))
+	assert.False(t, AccountTypeAsset.Is(AccountTypeCash))
+	assert.False(t, AccountTypeNone.Is(AccountTypeAsset))
+	assert.Equal(t, "Cash", AccountTypeCash.Name())
+	assert.Equal(t, "", AccountTypeNone.Name())
+}
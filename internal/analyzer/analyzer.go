@@ -4,8 +4,11 @@ import (
 	"fmt"
 	"strings"
 
+	"github.com/shopspring/decimal"
+
 	"github.com/juev/hledger-lsp/internal/ast"
 	"github.com/juev/hledger-lsp/internal/include"
+	"github.com/juev/hledger-lsp/internal/lsputil"
 )
 
 type Analyzer struct{}
@@ -31,6 +34,7 @@ func (a *Analyzer) analyzeInternal(journal *ast.Journal, external ExternalDeclar
 		TagValues:       CollectTagValues(journal),
 		Dates:           CollectDates(journal),
 		PayeeTemplates:  CollectPayeeTemplates(journal),
+		AccountTypes:    CollectAccountTypes(journal.Directives),
 		Diagnostics:     make([]Diagnostic, 0),
 		AccountCounts:   CollectAccountCounts(journal),
 		PayeeCounts:     CollectPayeeCounts(journal),
@@ -48,13 +52,34 @@ func (a *Analyzer) analyzeInternal(journal *ast.Journal, external ExternalDeclar
 		declaredCommodities[k] = true
 	}
 
+	declaredPayees := collectDeclaredPayees(journal)
+	for k := range external.Payees {
+		declaredPayees[k] = true
+	}
+
+	declaredTags := collectDeclaredTags(journal)
+	for k := range external.Tags {
+		declaredTags[k] = true
+	}
+
+	transactions := external.ParseOrder
+	if transactions == nil {
+		transactions = append(append([]ast.Transaction(nil), journal.Transactions...), external.Transactions...)
+	}
+	run := runBalances(transactions, journal.AutoPostingRules, true)
+	assigned := run.assigned
+	result.Diagnostics = append(result.Diagnostics, balanceAssertionDiagnostics(journal, run.failures)...)
+
 	for i := range journal.Transactions {
 		tx := &journal.Transactions[i]
-		balanceResult := CheckBalance(tx)
-
-		if !balanceResult.Balanced {
-			diag := a.createBalanceDiagnostic(tx, balanceResult)
-			result.Diagnostics = append(result.Diagnostics, diag)
+		// A transaction with a broken posting already has a parse error;
+		// its balance would only be reported wrong.
+		if !ast.HasInvalidPosting(tx.Postings) {
+			balanceResult := CheckBalanceWithAssignments(tx, assigned)
+			if !balanceResult.Balanced {
+				diag := a.createBalanceDiagnostic(tx, balanceResult)
+				result.Diagnostics = append(result.Diagnostics, diag)
+			}
 		}
 
 		if len(declaredAccounts) > 0 {
@@ -67,6 +92,14 @@ func (a *Analyzer) analyzeInternal(journal *ast.Journal, external ExternalDeclar
 			result.Diagnostics = append(result.Diagnostics, undeclaredCommodityDiags...)
 		}
 
+		if external.CheckPayees || len(declaredPayees) > 0 {
+			result.Diagnostics = append(result.Diagnostics, checkUndeclaredPayee(tx, declaredPayees)...)
+		}
+
+		if external.CheckTags || len(declaredTags) > 0 {
+			result.Diagnostics = append(result.Diagnostics, checkUndeclaredTags(tx, declaredTags)...)
+		}
+
 		dateTagDiags := validateDateTags(tx)
 		result.Diagnostics = append(result.Diagnostics, dateTagDiags...)
 	}
@@ -83,6 +116,7 @@ func (a *Analyzer) AnalyzeResolved(resolved *include.ResolvedJournal) *AnalysisR
 		TagValues:       make(map[string][]string),
 		Dates:           []string{},
 		PayeeTemplates:  make(map[string][]PostingTemplate),
+		AccountTypes:    CollectAccountTypes(nil),
 		Diagnostics:     make([]Diagnostic, 0),
 		AccountCounts:   make(map[string]int),
 		PayeeCounts:     make(map[string]int),
@@ -101,6 +135,7 @@ func (a *Analyzer) AnalyzeResolved(resolved *include.ResolvedJournal) *AnalysisR
 	result.TagValues = collectTagValuesFromResolved(resolved)
 	result.Dates = collectDatesFromResolved(resolved)
 	result.PayeeTemplates = collectPayeeTemplatesFromResolved(resolved)
+	result.AccountTypes = CollectAccountTypes(resolved.AllDirectives())
 	result.AccountCounts = collectAccountCountsFromResolved(resolved)
 	result.PayeeCounts = collectPayeeCountsFromResolved(resolved)
 	result.CommodityCounts = collectCommodityCountsFromResolved(resolved)
@@ -108,14 +143,23 @@ func (a *Analyzer) AnalyzeResolved(resolved *include.ResolvedJournal) *AnalysisR
 
 	declaredAccounts := collectDeclaredAccountsFromResolved(resolved)
 	declaredCommodities := collectDeclaredCommoditiesFromResolved(resolved)
+	declaredPayees := collectDeclaredPayeesFromResolved(resolved)
+	declaredTags := collectDeclaredTagsFromResolved(resolved)
+
+	run := runBalances(resolved.AllTransactions(), resolved.AllAutoPostingRules(), true)
+	assigned := run.assigned
+	result.Diagnostics = append(result.Diagnostics, balanceAssertionDiagnostics(resolved.Primary, run.failures)...)
 
 	for i := range resolved.Primary.Transactions {
 		tx := &resolved.Primary.Transactions[i]
-		balanceResult := CheckBalance(tx)
-
-		if !balanceResult.Balanced {
-			diag := a.createBalanceDiagnostic(tx, balanceResult)
-			result.Diagnostics = append(result.Diagnostics, diag)
+		// A transaction with a broken posting already has a parse error;
+		// its balance would only be reported wrong.
+		if !ast.HasInvalidPosting(tx.Postings) {
+			balanceResult := CheckBalanceWithAssignments(tx, assigned)
+			if !balanceResult.Balanced {
+				diag := a.createBalanceDiagnostic(tx, balanceResult)
+				result.Diagnostics = append(result.Diagnostics, diag)
+			}
 		}
 
 		if len(declaredAccounts) > 0 {
@@ -128,6 +172,14 @@ func (a *Analyzer) AnalyzeResolved(resolved *include.ResolvedJournal) *AnalysisR
 			result.Diagnostics = append(result.Diagnostics, undeclaredCommodityDiags...)
 		}
 
+		if len(declaredPayees) > 0 {
+			result.Diagnostics = append(result.Diagnostics, checkUndeclaredPayee(tx, declaredPayees)...)
+		}
+
+		if len(declaredTags) > 0 {
+			result.Diagnostics = append(result.Diagnostics, checkUndeclaredTags(tx, declaredTags)...)
+		}
+
 		dateTagDiags := validateDateTags(tx)
 		result.Diagnostics = append(result.Diagnostics, dateTagDiags...)
 	}
@@ -442,6 +494,9 @@ func isAccountDeclared(accountName string, declared map[string]bool) bool {
 func checkUndeclaredAccounts(tx *ast.Transaction, declared map[string]bool) []Diagnostic {
 	var diags []Diagnostic
 	for _, posting := range tx.Postings {
+		if posting.Account.Name == "" {
+			continue
+		}
 		if !isAccountDeclared(posting.Account.Name, declared) {
 			diags = append(diags, Diagnostic{
 				Range:    posting.Range,
@@ -480,6 +535,60 @@ func (a *Analyzer) createBalanceDiagnostic(tx *ast.Transaction, br *BalanceResul
 	}
 }
 
+// balanceAssertionDiagnostics reports the failed balance assertions that are
+// written in journal.
+func balanceAssertionDiagnostics(journal *ast.Journal, failures []BalanceAssertionFailure) []Diagnostic {
+	if len(failures) == 0 {
+		return nil
+	}
+
+	own := make(map[*ast.Posting]bool)
+	for i := range journal.Transactions {
+		for j := range journal.Transactions[i].Postings {
+			own[&journal.Transactions[i].Postings[j]] = true
+		}
+	}
+
+	var diags []Diagnostic
+	for _, f := range failures {
+		if !own[f.Posting] {
+			continue
+		}
+		diags = append(diags, Diagnostic{
+			Range:    f.Posting.BalanceAssertion.Range,
+			Severity: SeverityError,
+			Code:     "BALANCE_ASSERTION_FAILED",
+			Message: fmt.Sprintf("balance assertion failed for %s: expected %s, actual %s, difference %s",
+				f.Posting.Account.Name,
+				writtenLike(f.Expected, f.Commodity, f.Posting.BalanceAssertion.Amount),
+				writtenLike(f.Actual, f.Commodity, f.Posting.BalanceAssertion.Amount),
+				writtenLike(f.Expected.Sub(f.Actual), f.Commodity, f.Posting.BalanceAssertion.Amount)),
+		})
+	}
+	return diags
+}
+
+// writtenLike writes quantity in commodity the way amount is written, when
+// amount is in that commodity, and with the commodity on the right
+// otherwise.
+func writtenLike(quantity decimal.Decimal, commodity string, amount ast.Amount) string {
+	if commodity == "" {
+		return quantity.String()
+	}
+	if commodity != amount.Commodity.Symbol || amount.Commodity.Position != ast.CommodityLeft {
+		return quantity.String() + " " + commodity
+	}
+
+	symbol := amount.Commodity.Written()
+	if amount.SpaceAfterCommodity {
+		symbol += " "
+	}
+	if amount.SignBeforeCommodity && quantity.IsNegative() {
+		return "-" + symbol + quantity.Neg().String()
+	}
+	return symbol + quantity.String()
+}
+
 func collectDeclaredCommodities(journal *ast.Journal) map[string]bool {
 	declared := make(map[string]bool)
 	for _, dir := range journal.Directives {
@@ -528,6 +637,9 @@ func checkUndeclaredCommodities(tx *ast.Transaction, declared map[string]bool) [
 		if posting.Cost != nil {
 			checkCommodity(posting.Cost.Amount.Commodity.Symbol, posting.Cost.Amount.Commodity.Range)
 		}
+		if posting.LotCost != nil {
+			checkCommodity(posting.LotCost.Amount.Commodity.Symbol, posting.LotCost.Amount.Commodity.Range)
+		}
 		if posting.BalanceAssertion != nil {
 			checkCommodity(posting.BalanceAssertion.Amount.Commodity.Symbol, posting.BalanceAssertion.Amount.Commodity.Range)
 		}
@@ -535,6 +647,135 @@ func checkUndeclaredCommodities(tx *ast.Transaction, declared map[string]bool) [
 	return diags
 }
 
+func collectDeclaredPayees(journal *ast.Journal) map[string]bool {
+	declared := make(map[string]bool)
+	for _, dir := range journal.Directives {
+		if pd, ok := dir.(ast.PayeeDirective); ok {
+			declared[pd.Name] = true
+		}
+	}
+	return declared
+}
+
+func collectDeclaredPayeesFromResolved(resolved *include.ResolvedJournal) map[string]bool {
+	declared := make(map[string]bool)
+	if resolved.Primary != nil {
+		for k := range collectDeclaredPayees(resolved.Primary) {
+			declared[k] = true
+		}
+	}
+	for _, journal := range resolved.Files {
+		for k := range collectDeclaredPayees(journal) {
+			declared[k] = true
+		}
+	}
+	return declared
+}
+
+// checkUndeclaredPayee reports a transaction whose payee has no `payee`
+// directive, like `hledger check payees`. Without an explicit payee the
+// description is the payee.
+func checkUndeclaredPayee(tx *ast.Transaction, declared map[string]bool) []Diagnostic {
+	payee := tx.Payee
+	if payee == "" {
+		payee = tx.Description
+	}
+	if payee == "" || declared[payee] {
+		return nil
+	}
+	return []Diagnostic{{
+		Range:    EstimatePayeeRange(tx, payee),
+		Severity: SeverityWarning,
+		Code:     "UNDECLARED_PAYEE",
+		Message:  fmt.Sprintf("payee '%s' is not declared", payee),
+	}}
+}
+
+// EstimatePayeeRange returns the range of payee on the first line of tx,
+// assuming it follows the date and status mark after a single space.
+func EstimatePayeeRange(tx *ast.Transaction, payee string) ast.Range {
+	startCol := tx.Date.Range.End.Column + 1
+	if tx.Status != ast.StatusNone {
+		startCol += 2
+	}
+
+	payeeLen := lsputil.UTF16Len(payee)
+	return ast.Range{
+		Start: ast.Position{
+			Line:   tx.Date.Range.Start.Line,
+			Column: startCol,
+		},
+		End: ast.Position{
+			Line:   tx.Date.Range.Start.Line,
+			Column: startCol + payeeLen,
+		},
+	}
+}
+
+func collectDeclaredTags(journal *ast.Journal) map[string]bool {
+	declared := make(map[string]bool)
+	for _, dir := range journal.Directives {
+		if td, ok := dir.(ast.TagDirective); ok {
+			declared[td.Name] = true
+		}
+	}
+	return declared
+}
+
+func collectDeclaredTagsFromResolved(resolved *include.ResolvedJournal) map[string]bool {
+	declared := make(map[string]bool)
+	if resolved.Primary != nil {
+		for k := range collectDeclaredTags(resolved.Primary) {
+			declared[k] = true
+		}
+	}
+	for _, journal := range resolved.Files {
+		for k := range collectDeclaredTags(journal) {
+			declared[k] = true
+		}
+	}
+	return declared
+}
+
+// builtinTags are tags hledger gives a meaning to and does not require to be
+// declared.
+var builtinTags = map[string]bool{
+	"date":  true,
+	"date2": true,
+	"type":  true,
+}
+
+func isTagDeclared(name string, declared map[string]bool) bool {
+	return declared[name] || builtinTags[strings.ToLower(name)] || strings.HasPrefix(name, "_")
+}
+
+func checkUndeclaredTags(tx *ast.Transaction, declared map[string]bool) []Diagnostic {
+	var diags []Diagnostic
+
+	checkTags := func(tags []ast.Tag) {
+		for _, tag := range tags {
+			if tag.Name == "" || isTagDeclared(tag.Name, declared) {
+				continue
+			}
+			diags = append(diags, Diagnostic{
+				Range:    tag.Range,
+				Severity: SeverityWarning,
+				Code:     "UNDECLARED_TAG",
+				Message:  fmt.Sprintf("tag '%s' is not declared", tag.Name),
+			})
+		}
+	}
+
+	for _, comment := range tx.Comments {
+		checkTags(comment.Tags)
+	}
+	for _, posting := range tx.Postings {
+		checkTags(posting.Tags)
+	}
+
+	return diags
+}
+
 func validateDateTags(tx *ast.Transaction) []Diagnostic {
 	var diags []Diagnostic
 
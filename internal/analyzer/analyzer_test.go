@@ -86,6 +86,104 @@ func TestAnalyzer_DiagnosticsForMultipleInferred(t *testing.T) {
 	assert.Equal(t, SeverityError, result.Diagnostics[0].Severity, "MULTIPLE_INFERRED should have Error severity")
 }
 
+func TestAnalyzer_BalanceAssignmentIsNotInferred(t *testing.T) {
+	input := `2024-01-15 deposit
+    assets:checking  $800
+    income:salary  $-800
+
+2024-01-20 reconcile
+    assets:checking  = $1000
+    income:interest`
+
+	journal, errs := parser.Parse(input)
+	require.Empty(t, errs)
+
+	result := New().Analyze(journal)
+	assert.Empty(t, result.Diagnostics)
+}
+
+func TestAnalyzer_BalanceAssignmentFromExternalTransactions(t *testing.T) {
+	other, errs := parser.Parse(`2024-01-15 deposit
+    assets:checking  $800
+    income:salary  $-800`)
+	require.Empty(t, errs)
+
+	journal, errs := parser.Parse(`2024-01-20 reconcile
+    assets:checking  = $1000
+    income:interest  $-200`)
+	require.Empty(t, errs)
+
+	result := New().AnalyzeWithExternalDeclarations(journal, ExternalDeclarations{Transactions: other.Transactions})
+	assert.Empty(t, result.Diagnostics)
+}
+
+func TestAnalyzer_BalanceAssertionFailed(t *testing.T) {
+	input := `2024-01-15 deposit
+    assets:checking  $800
+    income:salary
+
+2024-01-16 check
+    assets:checking  $0 = $500`
+
+	journal, errs := parser.Parse(input)
+	require.Empty(t, errs)
+
+	result := New().Analyze(journal)
+
+	require.Len(t, result.Diagnostics, 1)
+	diag := result.Diagnostics[0]
+	assert.Equal(t, "BALANCE_ASSERTION_FAILED", diag.Code)
+	assert.Equal(t, SeverityError, diag.Severity)
+	assert.Equal(t, "balance assertion failed for assets:checking: expected $500, actual $800, difference $-300", diag.Message)
+	assert.Equal(t, journal.Transactions[1].Postings[0].BalanceAssertion.Range, diag.Range)
+}
+
+func TestAnalyzer_BalanceAssertionFromExternalTransactions(t *testing.T) {
+	other, errs := parser.Parse(`2024-01-15 deposit
+    assets:checking  $800
+    income:salary`)
+	require.Empty(t, errs)
+
+	journal, errs := parser.Parse(`2024-01-16 check
+    assets:checking  $0 = $800`)
+	require.Empty(t, errs)
+
+	result := New().AnalyzeWithExternalDeclarations(journal, ExternalDeclarations{Transactions: other.Transactions})
+	assert.Empty(t, result.Diagnostics)
+}
+
+func TestAnalyzer_BalanceAssertionAfterIncludeOnSameDate(t *testing.T) {
+	opening, errs := parser.Parse(`2024-01-01 opening balances
+    assets:checking  $1000
+    equity:opening`)
+	require.Empty(t, errs)
+
+	primary, errs := parser.Parse(`include opening.journal
+
+2024-01-01 check
+    assets:checking  $0 = $1000
+    equity:opening`)
+	require.Empty(t, errs)
+
+	resolved := &include.ResolvedJournal{
+		Primary:     primary,
+		PrimaryPath: "/ledger/main.journal",
+		Files:       map[string]*ast.Journal{"/ledger/opening.journal": opening},
+		FileOrder:   []string{"/ledger/opening.journal"},
+	}
+
+	result := New().AnalyzeResolved(resolved)
+	for _, d := range result.Diagnostics {
+		assert.NotEqual(t, "BALANCE_ASSERTION_FAILED", d.Code, d.Message)
+	}
+
+	result = New().AnalyzeWithExternalDeclarations(primary, ExternalDeclarations{
+		Transactions: opening.Transactions,
+		ParseOrder:   resolved.AllTransactions(),
+	})
+	assert.Empty(t, result.Diagnostics)
+}
+
 func TestAnalyzer_NoDiagnosticsForBalanced(t *testing.T) {
 	input := `2024-01-15 test
     expenses:food  $50
@@ -816,3 +914,113 @@ func TestAnalyzer_DateTag_DiagnosticRangePointsToTag(t *testing.T) {
 	assert.Equal(t, 2, diag.Range.Start.Line, "diagnostic should point to posting line")
 	assert.Equal(t, 27, diag.Range.Start.Column, "diagnostic should start at tag position, not posting start")
 }
+
+func TestAnalyzer_UndeclaredPayee(t *testing.T) {
+	input := `payee Grocery Store
+
+2024-01-15 Grocery Store
+    expenses:food  $50
+    assets:cash
+
+2024-01-16 Coffee Shop | latte
+    expenses:food  $5
+    assets:cash`
+
+	journal, errs := parser.Parse(input)
+	require.Empty(t, errs)
+
+	result := New().Analyze(journal)
+
+	var payees []string
+	for _, d := range result.Diagnostics {
+		if d.Code == "UNDECLARED_PAYEE" {
+			payees = append(payees, d.Message)
+			assert.Equal(t, SeverityWarning, d.Severity)
+		}
+	}
+	assert.Equal(t, []string{"payee 'Coffee Shop' is not declared"}, payees)
+	assert.Contains(t, result.Payees, "Grocery Store")
+}
+
+func TestAnalyzer_UndeclaredPayee_NoDeclarations(t *testing.T) {
+	input := `2024-01-15 Grocery Store
+    expenses:food  $50
+    assets:cash`
+
+	journal, errs := parser.Parse(input)
+	require.Empty(t, errs)
+
+	result := New().Analyze(journal)
+	for _, d := range result.Diagnostics {
+		assert.NotEqual(t, "UNDECLARED_PAYEE", d.Code)
+	}
+}
+
+func TestAnalyzer_UndeclaredPayee_CheckWithoutDeclarations(t *testing.T) {
+	input := `2024-01-15 * Grocery Store  ; shop:main
+    expenses:food  $50
+    assets:cash`
+
+	journal, errs := parser.Parse(input)
+	require.Empty(t, errs)
+
+	result := New().AnalyzeWithExternalDeclarations(journal, ExternalDeclarations{CheckPayees: true, CheckTags: true})
+
+	var payees, tags []Diagnostic
+	for _, d := range result.Diagnostics {
+		switch d.Code {
+		case "UNDECLARED_PAYEE":
+			payees = append(payees, d)
+		case "UNDECLARED_TAG":
+			tags = append(tags, d)
+		}
+	}
+	require.Len(t, payees, 1)
+	assert.Equal(t, ast.Range{
+		Start: ast.Position{Line: 1, Column: 14},
+		End:   ast.Position{Line: 1, Column: 27},
+	}, payees[0].Range, "the range covers the payee only")
+	assert.Len(t, tags, 1)
+}
+
+func TestAnalyzer_UndeclaredTag(t *testing.T) {
+	input := `tag project
+
+2024-01-15 test  ; project:home, trip:rome
+    expenses:food  $50  ; date:2024-01-20, _hidden:x
+    assets:cash  ; client:acme`
+
+	journal, errs := parser.Parse(input)
+	require.Empty(t, errs)
+
+	result := New().Analyze(journal)
+
+	var tags []string
+	for _, d := range result.Diagnostics {
+		if d.Code == "UNDECLARED_TAG" {
+			tags = append(tags, d.Message)
+		}
+	}
+	assert.Equal(t, []string{
+		"tag 'trip' is not declared",
+		"tag 'client' is not declared",
+	}, tags)
+}
+
+func TestAnalyzer_UndeclaredPayeeAndTag_External(t *testing.T) {
+	input := `2024-01-15 Grocery Store  ; project:home
+    expenses:food  $50
+    assets:cash`
+
+	journal, errs := parser.Parse(input)
+	require.Empty(t, errs)
+
+	result := New().AnalyzeWithExternalDeclarations(journal, ExternalDeclarations{
+		Payees: map[string]bool{"Grocery Store": true},
+		Tags:   map[string]bool{"project": true},
+	})
+	for _, d := range result.Diagnostics {
+		assert.NotEqual(t, "UNDECLARED_PAYEE", d.Code)
+		assert.NotEqual(t, "UNDECLARED_TAG", d.Code)
+	}
+}
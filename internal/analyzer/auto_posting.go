@@ -0,0 +1,327 @@
+package analyzer
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/shopspring/decimal"
+
+	"github.com/juev/hledger-lsp/internal/ast"
+)
+
+// GeneratedPosting is a posting added to a transaction by an auto posting rule.
+// RuleIndex points into the rules the AutoPoster was built from and Matched
+// is the posting of the transaction that triggered the rule.
+type GeneratedPosting struct {
+	Posting   ast.Posting
+	RuleIndex int
+	Matched   *ast.Posting
+}
+
+// AutoPoster applies auto posting rules (`= QUERY`) to transactions the way
+// hledger does with --auto. Generated postings never trigger other rules.
+type AutoPoster struct {
+	rules   []ast.AutoPostingRule
+	queries []postingQuery
+}
+
+func NewAutoPoster(rules []ast.AutoPostingRule) *AutoPoster {
+	a := &AutoPoster{
+		rules:   rules,
+		queries: make([]postingQuery, len(rules)),
+	}
+	for i := range rules {
+		a.queries[i] = parsePostingQuery(rules[i].Query)
+	}
+	return a
+}
+
+// Generate returns the postings the rules add to tx, in rule order and then
+// in the order of the matched postings.
+func (a *AutoPoster) Generate(tx *ast.Transaction) []GeneratedPosting {
+	if a == nil || len(a.rules) == 0 {
+		return nil
+	}
+
+	var generated []GeneratedPosting
+	for i := range a.rules {
+		rule := &a.rules[i]
+		for j := range tx.Postings {
+			matched := &tx.Postings[j]
+			if !a.queries[i].matches(tx, matched) {
+				continue
+			}
+			for k := range rule.Postings {
+				posting, ok := instantiateAutoPosting(&rule.Postings[k], matched)
+				if !ok {
+					continue
+				}
+				generated = append(generated, GeneratedPosting{
+					Posting:   posting,
+					RuleIndex: i,
+					Matched:   matched,
+				})
+			}
+		}
+	}
+	return generated
+}
+
+// instantiateAutoPosting builds the posting a rule posting produces for a
+// matched posting. Multiplier amounts take the matched commodity unless the
+// rule names one; they are skipped when the matched amount is inferred.
+func instantiateAutoPosting(template, matched *ast.Posting) (ast.Posting, bool) {
+	posting := *template
+	if template.Amount == nil || !template.Amount.Multiplier {
+		return posting, true
+	}
+	if matched.Amount == nil {
+		return posting, false
+	}
+
+	amount := *template.Amount
+	amount.Multiplier = false
+	amount.Quantity = matched.Amount.Quantity.Mul(template.Amount.Quantity)
+	amount.RawQuantity = ""
+	if amount.Commodity.Symbol == "" {
+		amount.Commodity = matched.Amount.Commodity
+	}
+	posting.Amount = &amount
+	return posting, true
+}
+
+// postingQuery is a compiled hledger query. Terms on the same field are
+// OR'ed, terms on different fields are AND'ed and every negated term must
+// fail to match.
+type postingQuery struct {
+	fields   map[string][]queryTerm
+	negative []queryTerm
+}
+
+type queryTerm struct {
+	field    string
+	pattern  *regexp.Regexp
+	tagValue *regexp.Regexp
+	amount   amountComparison
+}
+
+type amountComparison struct {
+	op       string
+	value    decimal.Decimal
+	absolute bool
+}
+
+var queryFields = map[string]bool{
+	"acct": true, "desc": true, "payee": true, "note": true,
+	"tag": true, "cur": true, "amt": true,
+}
+
+func parsePostingQuery(query string) postingQuery {
+	q := postingQuery{fields: make(map[string][]queryTerm)}
+
+	for _, word := range splitQueryWords(query) {
+		negate := false
+		if rest, ok := strings.CutPrefix(word, "not:"); ok {
+			negate = true
+			word = rest
+		}
+
+		field := "acct"
+		if prefix, rest, ok := strings.Cut(word, ":"); ok && queryFields[prefix] {
+			field = prefix
+			word = rest
+		}
+
+		term, ok := newQueryTerm(field, word)
+		if !ok {
+			continue
+		}
+		if negate {
+			q.negative = append(q.negative, term)
+		} else {
+			q.fields[field] = append(q.fields[field], term)
+		}
+	}
+
+	return q
+}
+
+func newQueryTerm(field, value string) (queryTerm, bool) {
+	term := queryTerm{field: field}
+
+	switch field {
+	case "amt":
+		cmp, ok := parseAmountComparison(value)
+		if !ok {
+			return term, false
+		}
+		term.amount = cmp
+	case "tag":
+		name, tagValue, hasValue := strings.Cut(value, "=")
+		term.pattern = compileQueryRegexp(name, false)
+		if hasValue {
+			term.tagValue = compileQueryRegexp(tagValue, false)
+		}
+	case "cur":
+		term.pattern = compileQueryRegexp(value, true)
+	default:
+		term.pattern = compileQueryRegexp(value, false)
+	}
+
+	return term, true
+}
+
+// compileQueryRegexp compiles a case-insensitive query regexp. Invalid
+// patterns are matched literally rather than rejected.
+func compileQueryRegexp(pattern string, anchored bool) *regexp.Regexp {
+	if _, err := regexp.Compile(pattern); err != nil {
+		pattern = regexp.QuoteMeta(pattern)
+	}
+	if anchored {
+		pattern = "^(?:" + pattern + ")$"
+	}
+	return regexp.MustCompile("(?i)" + pattern)
+}
+
+func parseAmountComparison(value string) (amountComparison, bool) {
+	cmp := amountComparison{op: "="}
+	for _, op := range []string{"<=", ">=", "<", ">", "="} {
+		if rest, ok := strings.CutPrefix(value, op); ok {
+			cmp.op = op
+			value = rest
+			break
+		}
+	}
+
+	cmp.absolute = !strings.HasPrefix(value, "-") && !strings.HasPrefix(value, "+")
+	n, err := decimal.NewFromString(value)
+	if err != nil {
+		return cmp, false
+	}
+	cmp.value = n
+	return cmp, true
+}
+
+func (q postingQuery) matches(tx *ast.Transaction, p *ast.Posting) bool {
+	for _, terms := range q.fields {
+		matched := false
+		for _, term := range terms {
+			if term.matches(tx, p) {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return false
+		}
+	}
+
+	for _, term := range q.negative {
+		if term.matches(tx, p) {
+			return false
+		}
+	}
+
+	return true
+}
+
+func (t queryTerm) matches(tx *ast.Transaction, p *ast.Posting) bool {
+	switch t.field {
+	case "acct":
+		return t.pattern.MatchString(p.Account.Name)
+	case "desc":
+		return t.pattern.MatchString(tx.Description)
+	case "payee":
+		payee := tx.Payee
+		if payee == "" {
+			payee = tx.Description
+		}
+		return t.pattern.MatchString(payee)
+	case "note":
+		return t.pattern.MatchString(tx.Note)
+	case "cur":
+		return p.Amount != nil && t.pattern.MatchString(p.Amount.Commodity.Symbol)
+	case "amt":
+		return p.Amount != nil && t.amount.matches(p.Amount.Quantity)
+	case "tag":
+		if t.matchesTags(p.Tags) {
+			return true
+		}
+		for _, c := range tx.Comments {
+			if t.matchesTags(c.Tags) {
+				return true
+			}
+		}
+		return false
+	default:
+		return false
+	}
+}
+
+func (t queryTerm) matchesTags(tags []ast.Tag) bool {
+	for _, tag := range tags {
+		if !t.pattern.MatchString(tag.Name) {
+			continue
+		}
+		if t.tagValue == nil || t.tagValue.MatchString(tag.Value) {
+			return true
+		}
+	}
+	return false
+}
+
+func (c amountComparison) matches(q decimal.Decimal) bool {
+	if c.absolute {
+		q = q.Abs()
+	}
+	r := q.Cmp(c.value)
+	switch c.op {
+	case "<":
+		return r < 0
+	case "<=":
+		return r <= 0
+	case ">":
+		return r > 0
+	case ">=":
+		return r >= 0
+	default:
+		return r == 0
+	}
+}
+
+// splitQueryWords splits a query on spaces, keeping single- or
+// double-quoted parts together and dropping the quotes.
+func splitQueryWords(query string) []string {
+	var words []string
+	var sb strings.Builder
+	var quote rune
+	inWord := false
+
+	for _, r := range query {
+		switch {
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			} else {
+				sb.WriteRune(r)
+			}
+		case r == '\'' || r == '"':
+			quote = r
+			inWord = true
+		case r == ' ' || r == '\t':
+			if inWord {
+				words = append(words, sb.String())
+				sb.Reset()
+				inWord = false
+			}
+		default:
+			sb.WriteRune(r)
+			inWord = true
+		}
+	}
+	if inWord {
+		words = append(words, sb.String())
+	}
+
+	return words
+}
@@ -0,0 +1,130 @@
+package analyzer
+
+import (
+	"testing"
+
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/juev/hledger-lsp/internal/parser"
+)
+
+func TestCalculateAccountBalances_AutoPostingRule(t *testing.T) {
+	input := `= expenses:food
+    liabilities:tax  *-0.25
+    assets:savings  *0.25
+
+2024-01-15 grocery
+    expenses:food  $40
+    assets:cash  $-40
+
+2024-01-16 rent
+    expenses:rent  $1000
+    assets:cash  $-1000`
+
+	journal, errs := parser.Parse(input)
+	require.Empty(t, errs)
+
+	balances := CalculateAccountBalances(journal)
+
+	assert.True(t, decimal.NewFromInt(-10).Equal(balances["liabilities:tax"]["$"]))
+	assert.True(t, decimal.NewFromInt(10).Equal(balances["assets:savings"]["$"]))
+	assert.True(t, decimal.NewFromInt(40).Equal(balances["expenses:food"]["$"]))
+}
+
+func TestCalculateAccountBalances_AutoPostingFixedAmountAndCommodity(t *testing.T) {
+	input := `= assets:cash
+    (fees:count)  1 FEE
+    (rewards:points)  *2 PTS
+
+2024-01-15 grocery
+    expenses:food  $40
+    assets:cash  $-40`
+
+	journal, errs := parser.Parse(input)
+	require.Empty(t, errs)
+
+	balances := CalculateAccountBalances(journal)
+
+	assert.True(t, decimal.NewFromInt(1).Equal(balances["fees:count"]["FEE"]))
+	assert.True(t, decimal.NewFromInt(-80).Equal(balances["rewards:points"]["PTS"]))
+}
+
+func TestAutoPoster_InferredAmountSkipsMultiplier(t *testing.T) {
+	input := `= assets:cash
+    (liabilities:tax)  *0.1
+
+2024-01-15 grocery
+    expenses:food  $40
+    assets:cash`
+
+	journal, errs := parser.Parse(input)
+	require.Empty(t, errs)
+
+	generated := NewAutoPoster(journal.AutoPostingRules).Generate(&journal.Transactions[0])
+	assert.Empty(t, generated)
+}
+
+func TestAutoPoster_GeneratedPostingsDoNotChain(t *testing.T) {
+	input := `= expenses
+    (expenses:tax)  *0.1
+
+2024-01-15 grocery
+    expenses:food  $40
+    assets:cash  $-40`
+
+	journal, errs := parser.Parse(input)
+	require.Empty(t, errs)
+
+	generated := NewAutoPoster(journal.AutoPostingRules).Generate(&journal.Transactions[0])
+	require.Len(t, generated, 1)
+	assert.Equal(t, "expenses:tax", generated[0].Posting.Account.Name)
+	assert.Equal(t, 0, generated[0].RuleIndex)
+	assert.Same(t, &journal.Transactions[0].Postings[0], generated[0].Matched)
+}
+
+func TestPostingQuery_Matches(t *testing.T) {
+	input := `2024-01-15 Whole Foods | weekly shop  ; trip:japan
+    expenses:food  $40
+    assets:cash  $-40  ; method:cash`
+
+	journal, errs := parser.Parse(input)
+	require.Empty(t, errs)
+	tx := &journal.Transactions[0]
+
+	tests := []struct {
+		query   string
+		posting int
+		want    bool
+	}{
+		{"expenses:food", 0, true},
+		{"EXPENSES", 0, true},
+		{"expenses", 1, false},
+		{"^food", 0, false},
+		{"acct:food acct:cash", 1, true},
+		{"not:expenses", 1, true},
+		{"not:expenses", 0, false},
+		{"food desc:whole", 0, true},
+		{"food desc:amazon", 0, false},
+		{"payee:'whole foods'", 0, true},
+		{"note:weekly", 1, true},
+		{"tag:trip=jap", 0, true},
+		{"tag:trip=usa", 0, false},
+		{"tag:method", 1, true},
+		{"tag:method", 0, false},
+		{"cur:\\$", 0, true},
+		{"cur:USD", 0, false},
+		{"amt:>30", 1, true},
+		{"amt:<0", 1, false},
+		{"amt:<-30", 1, true},
+		{"", 0, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			q := parsePostingQuery(tt.query)
+			assert.Equal(t, tt.want, q.matches(tx, &tx.Postings[tt.posting]))
+		})
+	}
+}
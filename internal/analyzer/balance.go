@@ -1,15 +1,25 @@
 package analyzer
 
 import (
+	"sort"
+
 	"github.com/shopspring/decimal"
 
 	"github.com/juev/hledger-lsp/internal/ast"
 )
 
+// CheckBalance checks that a transaction balances on its own. Balance
+// assignments are taken to start from an empty account.
 func CheckBalance(tx *ast.Transaction) *BalanceResult {
+	return CheckBalanceWithAssignments(tx, ComputeBalanceAssignments([]ast.Transaction{*tx}, nil))
+}
+
+// CheckBalanceWithAssignments checks that a transaction balances, using the
+// amounts in assigned for its balance assignments.
+func CheckBalanceWithAssignments(tx *ast.Transaction, assigned BalanceAssignments) *BalanceResult {
 	result := NewBalanceResult()
 
-	realPostings := filterRealPostings(tx.Postings)
+	realPostings := filterRealPostings(withAssignedAmounts(tx.Postings, assigned))
 	inferredCount, inferredIdx := countInferredPostings(realPostings)
 
 	if inferredCount > 1 {
@@ -36,6 +46,47 @@ func CheckBalance(tx *ast.Transaction) *BalanceResult {
 	return result
 }
 
+// InferAmounts returns postings with the amount of the one real posting
+// written without an amount filled in, as hledger infers it. A posting that
+// balances several commodities becomes one posting per commodity. The
+// postings are returned as they are when no amount can be inferred.
+func InferAmounts(postings []ast.Posting) []ast.Posting {
+	realPostings := filterRealPostings(postings)
+	count, idx := countInferredPostings(realPostings)
+	if count != 1 || realPostings[idx].BalanceAssertion != nil {
+		return postings
+	}
+
+	sums := sumByCommodity(realPostings)
+	commodities := make([]string, 0, len(sums))
+	for c, sum := range sums {
+		if !sum.IsZero() {
+			commodities = append(commodities, c)
+		}
+	}
+	if len(commodities) == 0 {
+		return postings
+	}
+	sort.Strings(commodities)
+
+	result := make([]ast.Posting, 0, len(postings)+len(commodities)-1)
+	for _, p := range postings {
+		if p.Amount != nil || p.Virtual == ast.VirtualUnbalanced {
+			result = append(result, p)
+			continue
+		}
+		for _, c := range commodities {
+			inferred := p
+			inferred.Amount = &ast.Amount{
+				Quantity:  sums[c].Neg(),
+				Commodity: ast.Commodity{Symbol: c},
+			}
+			result = append(result, inferred)
+		}
+	}
+	return result
+}
+
 func filterRealPostings(postings []ast.Posting) []ast.Posting {
 	var real []ast.Posting
 	for _, p := range postings {
@@ -46,6 +97,19 @@ func filterRealPostings(postings []ast.Posting) []ast.Posting {
 	return real
 }
 
+// withAssignedAmounts returns the postings with the amounts of their balance
+// assignments filled in, so they are not mistaken for inferred postings.
+func withAssignedAmounts(postings []ast.Posting, assigned BalanceAssignments) []ast.Posting {
+	result := make([]ast.Posting, len(postings))
+	for i := range postings {
+		result[i] = postings[i]
+		if amount, ok := assigned[&postings[i]]; ok {
+			result[i].Amount = &amount
+		}
+	}
+	return result
+}
+
 func countInferredPostings(postings []ast.Posting) (count int, lastIdx int) {
 	lastIdx = -1
 	for i, p := range postings {
@@ -57,6 +121,9 @@ func countInferredPostings(postings []ast.Posting) (count int, lastIdx int) {
 	return
 }
 
+// sumByCommodity sums postings in the commodity they are balanced in. A
+// posting with a lot cost is balanced at its cost basis rather than at its
+// @ price, so the difference of a sale can be booked as a capital gain.
 func sumByCommodity(postings []ast.Posting) map[string]decimal.Decimal {
 	balances := make(map[string]decimal.Decimal)
 
@@ -65,13 +132,18 @@ func sumByCommodity(postings []ast.Posting) map[string]decimal.Decimal {
 			continue
 		}
 
-		if p.Cost != nil {
-			commodity := p.Cost.Amount.Commodity.Symbol
+		cost := p.Cost
+		if p.LotCost != nil {
+			cost = p.LotCost
+		}
+
+		if cost != nil {
+			commodity := cost.Amount.Commodity.Symbol
 			var quantity decimal.Decimal
-			if p.Cost.IsTotal {
-				quantity = p.Cost.Amount.Quantity
+			if cost.IsTotal {
+				quantity = cost.Amount.Quantity
 			} else {
-				quantity = p.Cost.Amount.Quantity.Mul(p.Amount.Quantity.Abs())
+				quantity = cost.Amount.Quantity.Mul(p.Amount.Quantity.Abs())
 			}
 			if p.Amount.Quantity.IsNegative() {
 				quantity = quantity.Neg()
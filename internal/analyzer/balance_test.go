@@ -258,3 +258,90 @@ func TestCheckBalance_MultiCurrencyExplicitlyBalanced(t *testing.T) {
 
 	assert.True(t, result.Balanced, "explicitly balanced multi-currency should be balanced")
 }
+
+func TestCheckBalance_LotCostCapitalGains(t *testing.T) {
+	input := `2024-03-01 sell
+    assets:broker  -10 AAPL {150 USD} [2024-01-02] @ 180 USD
+    assets:cash  1800 USD
+    income:gains  -300 USD`
+
+	journal, errs := parser.Parse(input)
+	require.Empty(t, errs)
+
+	result := CheckBalance(&journal.Transactions[0])
+	assert.True(t, result.Balanced, "differences: %v", result.Differences)
+}
+
+func TestCheckBalance_LotCostOnly(t *testing.T) {
+	input := `2024-01-02 buy
+    assets:broker  10 AAPL {{1500 USD}}
+    assets:cash  -1500 USD`
+
+	journal, errs := parser.Parse(input)
+	require.Empty(t, errs)
+
+	result := CheckBalance(&journal.Transactions[0])
+	assert.True(t, result.Balanced, "differences: %v", result.Differences)
+}
+
+func TestCheckBalance_BalanceAssignmentWithInferred(t *testing.T) {
+	input := `2024-01-15 opening
+    assets:checking  = $1,234.00
+    equity:opening`
+
+	journal, errs := parser.Parse(input)
+	require.Empty(t, errs)
+
+	result := CheckBalance(&journal.Transactions[0])
+	assert.True(t, result.Balanced)
+}
+
+func TestCheckBalance_BalanceAssignmentUsesRunningBalance(t *testing.T) {
+	input := `2024-01-15 deposit
+    assets:checking  $800
+    income:salary  $-800
+
+2024-01-20 reconcile
+    assets:checking  = $1000
+    income:interest  $-200`
+
+	journal, errs := parser.Parse(input)
+	require.Empty(t, errs)
+
+	assigned := ComputeBalanceAssignments(journal.Transactions, nil)
+	result := CheckBalanceWithAssignments(&journal.Transactions[1], assigned)
+	assert.True(t, result.Balanced, "differences: %v", result.Differences)
+
+	// On its own the assignment starts from an empty account.
+	result = CheckBalance(&journal.Transactions[1])
+	assert.False(t, result.Balanced)
+}
+
+func TestInferAmounts(t *testing.T) {
+	input := `2024-01-15 exchange
+    assets:usd  $10
+    assets:eur  EUR 5
+    (budget:food)  $3
+    equity:conversion`
+
+	journal, errs := parser.Parse(input)
+	require.Empty(t, errs)
+
+	postings := InferAmounts(journal.Transactions[0].Postings)
+	require.Len(t, postings, 5)
+	assert.Nil(t, journal.Transactions[0].Postings[3].Amount, "the journal is left as it is")
+
+	for i, want := range []string{"$ -10", "EUR -5"} {
+		p := postings[3+i]
+		assert.Equal(t, "equity:conversion", p.Account.Name)
+		require.NotNil(t, p.Amount)
+		assert.Equal(t, want, p.Amount.Commodity.Symbol+" "+p.Amount.Quantity.String())
+	}
+
+	multiple, errs := parser.Parse(`2024-01-15 split
+    expenses:food  $10
+    assets:cash
+    assets:bank`)
+	require.Empty(t, errs)
+	assert.Equal(t, multiple.Transactions[0].Postings, InferAmounts(multiple.Transactions[0].Postings))
+}
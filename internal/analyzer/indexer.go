@@ -24,6 +24,18 @@ func CollectAccounts(journal *ast.Journal) *AccountIndex {
 		}
 	}
 
+	for _, ptx := range journal.PeriodicTransactions {
+		for _, posting := range ptx.Postings {
+			addAccount(idx, seen, posting.Account.Name)
+		}
+	}
+
+	for _, rule := range journal.AutoPostingRules {
+		for _, posting := range rule.Postings {
+			addAccount(idx, seen, posting.Account.Name)
+		}
+	}
+
 	return idx
 }
 
@@ -49,6 +61,13 @@ func CollectPayees(journal *ast.Journal) []string {
 	seen := make(map[string]bool)
 	var payees []string
 
+	for _, dir := range journal.Directives {
+		if pd, ok := dir.(ast.PayeeDirective); ok && !seen[pd.Name] {
+			seen[pd.Name] = true
+			payees = append(payees, pd.Name)
+		}
+	}
+
 	for _, tx := range journal.Transactions {
 		name := tx.Payee
 		if name == "" {
@@ -77,8 +96,8 @@ func CollectCommodities(journal *ast.Journal) []string {
 		}
 	}
 
-	for _, tx := range journal.Transactions {
-		for _, posting := range tx.Postings {
+	addPostingCommodities := func(postings []ast.Posting) {
+		for _, posting := range postings {
 			if posting.Amount != nil {
 				symbol := posting.Amount.Commodity.Symbol
 				if symbol != "" && !seen[symbol] {
@@ -93,9 +112,26 @@ func CollectCommodities(journal *ast.Journal) []string {
 					commodities = append(commodities, symbol)
 				}
 			}
+			if posting.LotCost != nil {
+				symbol := posting.LotCost.Amount.Commodity.Symbol
+				if symbol != "" && !seen[symbol] {
+					seen[symbol] = true
+					commodities = append(commodities, symbol)
+				}
+			}
 		}
 	}
 
+	for _, tx := range journal.Transactions {
+		addPostingCommodities(tx.Postings)
+	}
+	for _, ptx := range journal.PeriodicTransactions {
+		addPostingCommodities(ptx.Postings)
+	}
+	for _, rule := range journal.AutoPostingRules {
+		addPostingCommodities(rule.Postings)
+	}
+
 	return commodities
 }
 
@@ -112,6 +148,13 @@ func CollectTags(journal *ast.Journal) []string {
 		}
 	}
 
+	for _, dir := range journal.Directives {
+		if td, ok := dir.(ast.TagDirective); ok && !seen[td.Name] {
+			seen[td.Name] = true
+			tags = append(tags, td.Name)
+		}
+	}
+
 	for _, tx := range journal.Transactions {
 		collectTagsFrom(tx.Tags)
 		for _, comment := range tx.Comments {
@@ -142,7 +185,7 @@ func CollectPayeeTemplates(journal *ast.Journal) map[string][]PostingTemplate {
 			continue
 		}
 
-		if len(tx.Postings) == 0 {
+		if len(tx.Postings) == 0 || ast.HasInvalidPosting(tx.Postings) {
 			continue
 		}
 
@@ -322,6 +365,9 @@ func CollectCommodityCounts(journal *ast.Journal) map[string]int {
 			if posting.Cost != nil && posting.Cost.Amount.Commodity.Symbol != "" {
 				counts[posting.Cost.Amount.Commodity.Symbol]++
 			}
+			if posting.LotCost != nil && posting.LotCost.Amount.Commodity.Symbol != "" {
+				counts[posting.LotCost.Amount.Commodity.Symbol]++
+			}
 		}
 	}
 	return counts
@@ -0,0 +1,53 @@
+package analyzer
+
+import (
+	"fmt"
+
+	"github.com/juev/hledger-lsp/internal/ast"
+)
+
+// CheckOrderedDates reports the transactions of a file dated before the
+// transaction written just above them, like `hledger check ordereddates`.
+// With useDate2 the secondary dates are compared, falling back to the
+// primary date of a transaction that has none.
+func CheckOrderedDates(transactions []ast.Transaction, useDate2 bool) []Diagnostic {
+	var diags []Diagnostic
+	for i := 1; i < len(transactions); i++ {
+		prev := checkedDate(&transactions[i-1], useDate2)
+		date := checkedDate(&transactions[i], useDate2)
+		if !dateBefore(date, prev) {
+			continue
+		}
+		diags = append(diags, Diagnostic{
+			Range:    date.Range,
+			Severity: SeverityWarning,
+			Code:     "DATE_OUT_OF_ORDER",
+			Message:  fmt.Sprintf("transaction date %s is before the previous transaction's date %s", formatDate(date), formatDate(prev)),
+		})
+	}
+	return diags
+}
+
+// OrderedSlot returns the index of the transaction that the transaction at
+// index i should be moved before to be in date order: the first one above
+// it with a later date. It returns i when the transaction is not dated
+// before the one above it.
+func OrderedSlot(transactions []ast.Transaction, i int, useDate2 bool) int {
+	date := checkedDate(&transactions[i], useDate2)
+	if i == 0 || !dateBefore(date, checkedDate(&transactions[i-1], useDate2)) {
+		return i
+	}
+	for j := 0; j < i; j++ {
+		if dateBefore(date, checkedDate(&transactions[j], useDate2)) {
+			return j
+		}
+	}
+	return i
+}
+
+func checkedDate(tx *ast.Transaction, useDate2 bool) ast.Date {
+	if useDate2 && tx.Date2 != nil {
+		return *tx.Date2
+	}
+	return tx.Date
+}
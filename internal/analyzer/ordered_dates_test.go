@@ -0,0 +1,61 @@
+package analyzer
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/juev/hledger-lsp/internal/parser"
+)
+
+func TestCheckOrderedDates(t *testing.T) {
+	journal, errs := parser.Parse(`2024-01-01 a
+    expenses:food  $1
+    assets:cash
+
+2024-01-05=2024-01-02 b
+    expenses:food  $1
+    assets:cash
+
+2024-01-03 c
+    expenses:food  $1
+    assets:cash
+
+2024-01-04 d
+    expenses:food  $1
+    assets:cash
+`)
+	require.Empty(t, errs)
+
+	diags := CheckOrderedDates(journal.Transactions, false)
+	require.Len(t, diags, 1)
+	assert.Equal(t, "DATE_OUT_OF_ORDER", diags[0].Code)
+	assert.Equal(t, SeverityWarning, diags[0].Severity)
+	assert.Equal(t, "transaction date 2024-01-03 is before the previous transaction's date 2024-01-05", diags[0].Message)
+	assert.Equal(t, 9, diags[0].Range.Start.Line)
+	assert.Equal(t, 11, diags[0].Range.End.Column)
+
+	assert.Equal(t, 1, OrderedSlot(journal.Transactions, 2, false))
+	assert.Equal(t, 3, OrderedSlot(journal.Transactions, 3, false))
+
+	assert.Empty(t, CheckOrderedDates(journal.Transactions, true))
+}
+
+func TestCheckOrderedDates_Date2(t *testing.T) {
+	journal, errs := parser.Parse(`2024-01-01=2024-02-01 a
+    expenses:food  $1
+    assets:cash
+
+2024-01-02 b
+    expenses:food  $1
+    assets:cash
+`)
+	require.Empty(t, errs)
+
+	assert.Empty(t, CheckOrderedDates(journal.Transactions, false))
+	diags := CheckOrderedDates(journal.Transactions, true)
+	require.Len(t, diags, 1)
+	assert.Equal(t, "transaction date 2024-01-02 is before the previous transaction's date 2024-02-01", diags[0].Message)
+	assert.Equal(t, 0, OrderedSlot(journal.Transactions, 1, true))
+}
@@ -0,0 +1,150 @@
+package analyzer
+
+import (
+	"sort"
+
+	"github.com/shopspring/decimal"
+
+	"github.com/juev/hledger-lsp/internal/ast"
+)
+
+// PriceDB holds the market prices of a journal: those of its `P`
+// directives and those implied by the `@` and `@@` costs of its postings.
+// Each price converts one commodity into another from its date on.
+type PriceDB struct {
+	// rates maps from -> to -> prices sorted by date. Each price is also
+	// recorded in reverse, so a commodity can be converted either way.
+	rates map[string]map[string][]price
+}
+
+type price struct {
+	date ast.Date
+	rate decimal.Decimal
+	// declared marks a price from a `P` directive, which wins over one
+	// implied by a cost on the same date.
+	declared bool
+}
+
+// NewPriceDB returns an empty price database.
+func NewPriceDB() *PriceDB {
+	return &PriceDB{rates: make(map[string]map[string][]price)}
+}
+
+// BuildPriceDB collects the prices of the given directives and transactions,
+// dating the prices implied by costs by their posting date.
+func BuildPriceDB(directives []ast.Directive, transactions []ast.Transaction) *PriceDB {
+	db := NewPriceDB()
+	for _, d := range directives {
+		if p, ok := d.(ast.PriceDirective); ok {
+			db.add(p.Date, p.Commodity.Symbol, p.Price.Commodity.Symbol, p.Price.Quantity, true)
+		}
+	}
+	for i := range transactions {
+		tx := &transactions[i]
+		for j := range tx.Postings {
+			posting := &tx.Postings[j]
+			if posting.Amount == nil || posting.Cost == nil || posting.Amount.Quantity.IsZero() {
+				continue
+			}
+			rate := posting.Cost.Amount.Quantity.Abs()
+			if posting.Cost.IsTotal {
+				rate = rate.Div(posting.Amount.Quantity.Abs())
+			}
+			db.add(tx.PostingDate(posting), posting.Amount.Commodity.Symbol, posting.Cost.Amount.Commodity.Symbol, rate, false)
+		}
+	}
+	for _, targets := range db.rates {
+		for _, prices := range targets {
+			sort.SliceStable(prices, func(i, j int) bool {
+				return dateBefore(prices[i].date, prices[j].date)
+			})
+		}
+	}
+	return db
+}
+
+func (db *PriceDB) add(date ast.Date, from, to string, rate decimal.Decimal, declared bool) {
+	if from == to || rate.IsZero() {
+		return
+	}
+	db.addRate(date, from, to, rate, declared)
+	db.addRate(date, to, from, decimal.NewFromInt(1).DivRound(rate, 16), declared)
+}
+
+func (db *PriceDB) addRate(date ast.Date, from, to string, rate decimal.Decimal, declared bool) {
+	if db.rates[from] == nil {
+		db.rates[from] = make(map[string][]price)
+	}
+	db.rates[from][to] = append(db.rates[from][to], price{date: date, rate: rate, declared: declared})
+}
+
+// rateOn returns the latest direct price from one commodity to another on
+// or before date, or the latest of all when date is nil.
+func (db *PriceDB) rateOn(from, to string, date *ast.Date) (decimal.Decimal, bool) {
+	prices := db.rates[from][to]
+	found := -1
+	for i, p := range prices {
+		if date != nil && dateBefore(*date, p.date) {
+			break
+		}
+		if found < 0 || !sameDate(prices[found].date, p.date) || p.declared || !prices[found].declared {
+			found = i
+		}
+	}
+	if found < 0 {
+		return decimal.Zero, false
+	}
+	return prices[found].rate, true
+}
+
+// Rate returns how many units of to one unit of from is worth on date,
+// following a chain of prices through other commodities when there is no
+// direct one. Each step uses its latest price on or before date; the
+// chain with the fewest steps wins.
+func (db *PriceDB) Rate(from, to string, date ast.Date) (decimal.Decimal, bool) {
+	return db.rate(from, to, &date)
+}
+
+// LatestRate is like Rate but uses the latest known prices.
+func (db *PriceDB) LatestRate(from, to string) (decimal.Decimal, bool) {
+	return db.rate(from, to, nil)
+}
+
+func (db *PriceDB) rate(from, to string, date *ast.Date) (decimal.Decimal, bool) {
+	if from == to {
+		return decimal.NewFromInt(1), true
+	}
+
+	rates := map[string]decimal.Decimal{from: decimal.NewFromInt(1)}
+	queue := []string{from}
+	for len(queue) > 0 {
+		current := queue[0]
+		queue = queue[1:]
+
+		targets := make([]string, 0, len(db.rates[current]))
+		for target := range db.rates[current] {
+			targets = append(targets, target)
+		}
+		sort.Strings(targets)
+
+		for _, target := range targets {
+			if _, seen := rates[target]; seen {
+				continue
+			}
+			rate, ok := db.rateOn(current, target, date)
+			if !ok {
+				continue
+			}
+			rates[target] = rates[current].Mul(rate)
+			if target == to {
+				return rates[target], true
+			}
+			queue = append(queue, target)
+		}
+	}
+	return decimal.Zero, false
+}
+
+func sameDate(a, b ast.Date) bool {
+	return a.Year == b.Year && a.Month == b.Month && a.Day == b.Day
+}
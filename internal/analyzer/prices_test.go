@@ -0,0 +1,87 @@
+package analyzer
+
+import (
+	"testing"
+
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/juev/hledger-lsp/internal/ast"
+	"github.com/juev/hledger-lsp/internal/parser"
+)
+
+func buildTestPriceDB(t *testing.T, content string) *PriceDB {
+	t.Helper()
+	journal, errs := parser.Parse(content)
+	require.Empty(t, errs)
+	return BuildPriceDB(journal.Directives, journal.Transactions)
+}
+
+func assertRate(t *testing.T, want string, got decimal.Decimal, ok bool) {
+	t.Helper()
+	require.True(t, ok)
+	assert.True(t, decimal.RequireFromString(want).Equal(got), "want %s, got %s", want, got)
+}
+
+func TestPriceDB_Directives(t *testing.T) {
+	db := buildTestPriceDB(t, `P 2024-01-01 AAPL $100
+P 2024-03-01 AAPL $150
+`)
+
+	rate, ok := db.Rate("AAPL", "$", ast.Date{Year: 2024, Month: 2, Day: 15})
+	assertRate(t, "100", rate, ok)
+	rate, ok = db.Rate("AAPL", "$", ast.Date{Year: 2024, Month: 3, Day: 1})
+	assertRate(t, "150", rate, ok)
+	rate, ok = db.LatestRate("AAPL", "$")
+	assertRate(t, "150", rate, ok)
+
+	_, ok = db.Rate("AAPL", "$", ast.Date{Year: 2023, Month: 12, Day: 31})
+	assert.False(t, ok)
+
+	rate, ok = db.LatestRate("$", "AAPL")
+	require.True(t, ok)
+	assert.Equal(t, "0.0067", rate.StringFixed(4))
+}
+
+func TestPriceDB_Costs(t *testing.T) {
+	db := buildTestPriceDB(t, `2024-01-10 Buy
+    assets:broker  10 AAPL @ $120
+    assets:cash
+
+2024-01-20 Buy
+    assets:broker  4 AAPL @@ $600
+    assets:cash
+
+P 2024-01-20 AAPL $140
+`)
+
+	rate, ok := db.Rate("AAPL", "$", ast.Date{Year: 2024, Month: 1, Day: 15})
+	assertRate(t, "120", rate, ok)
+	rate, ok = db.Rate("AAPL", "$", ast.Date{Year: 2024, Month: 1, Day: 20})
+	assertRate(t, "140", rate, ok)
+}
+
+func TestPriceDB_CostPostingDate(t *testing.T) {
+	db := buildTestPriceDB(t, `2024-01-10 Buy
+    assets:broker  10 AAPL @ $120  ; date:2024-01-15
+    assets:cash
+`)
+
+	_, ok := db.Rate("AAPL", "$", ast.Date{Year: 2024, Month: 1, Day: 12})
+	assert.False(t, ok, "the price is dated by the posting")
+	rate, ok := db.Rate("AAPL", "$", ast.Date{Year: 2024, Month: 1, Day: 15})
+	assertRate(t, "120", rate, ok)
+}
+
+func TestPriceDB_Transitive(t *testing.T) {
+	db := buildTestPriceDB(t, `P 2024-01-01 AAPL USD 200
+P 2024-01-01 EUR USD 1.25
+`)
+
+	rate, ok := db.LatestRate("AAPL", "EUR")
+	assertRate(t, "160", rate, ok)
+
+	_, ok = db.LatestRate("AAPL", "GBP")
+	assert.False(t, ok)
+}
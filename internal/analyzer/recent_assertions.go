@@ -0,0 +1,127 @@
+package analyzer
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"sort"
+	"time"
+
+	"github.com/juev/hledger-lsp/internal/ast"
+)
+
+// RecentAssertionsOptions configures CheckRecentAssertions.
+type RecentAssertionsOptions struct {
+	// Days is how long an account may have postings after its latest
+	// balance assertion.
+	Days int
+	// Accounts and Types select the accounts checked: those matching
+	// Accounts or of one of Types. With neither set, every account is.
+	Accounts *regexp.Regexp
+	Types    []AccountType
+	// AccountTypes resolves the declared account types matched against
+	// Types. When nil, types are inferred from account names alone.
+	AccountTypes *AccountTypes
+}
+
+// CheckRecentAssertions reports the accounts posted to more than
+// opts.Days days after their latest balance assertion, like `hledger check
+// recentassertions`. Postings of both transactions and others count, but
+// an account is only reported when its latest posting without an assertion
+// is one of transactions, and the diagnostic points at that posting.
+// Accounts that never had a balance assertion are not checked.
+func CheckRecentAssertions(transactions, others []ast.Transaction, opts RecentAssertionsOptions) []Diagnostic {
+	var diags []Diagnostic
+	for name, a := range collectAssertionActivity(transactions, others, opts.covers) {
+		if a.asserted == nil || a.latestLocal == nil {
+			continue
+		}
+		days := daysBetween(*a.asserted, *a.latest)
+		if days <= opts.Days {
+			continue
+		}
+		diags = append(diags, Diagnostic{
+			Range:    a.latestLocal.Account.Range,
+			Severity: SeverityWarning,
+			Code:     "STALE_BALANCE_ASSERTION",
+			Message: fmt.Sprintf("account %s has postings %d days after its latest balance assertion on %s",
+				name, days, formatDate(*a.asserted)),
+		})
+	}
+	sortDiagnostics(diags)
+	return diags
+}
+
+// assertionActivity is the date of an account's latest balance assertion
+// and of its latest posting without one, with that posting when it
+// belongs to the transactions being checked.
+type assertionActivity struct {
+	asserted    *ast.Date
+	latest      *ast.Date
+	latestLocal *ast.Posting
+}
+
+// collectAssertionActivity gathers the assertion activity of the accounts
+// that covers accepts, from the postings of transactions and others, each
+// dated by its posting date. On a date tie the posting of transactions is
+// the latest.
+func collectAssertionActivity(transactions, others []ast.Transaction, covers func(string) bool) map[string]*assertionActivity {
+	accounts := make(map[string]*assertionActivity)
+	visit := func(txs []ast.Transaction, local bool) {
+		for i := range txs {
+			tx := &txs[i]
+			for j := range tx.Postings {
+				posting := &tx.Postings[j]
+				name := posting.Account.Name
+				if name == "" || posting.Invalid || !covers(name) {
+					continue
+				}
+				a := accounts[name]
+				if a == nil {
+					a = &assertionActivity{}
+					accounts[name] = a
+				}
+				date := tx.PostingDate(posting)
+				if posting.BalanceAssertion != nil {
+					if a.asserted == nil || !dateBefore(date, *a.asserted) {
+						a.asserted = &date
+					}
+					continue
+				}
+				if a.latest == nil || !dateBefore(date, *a.latest) {
+					a.latest = &date
+					a.latestLocal = nil
+					if local {
+						a.latestLocal = posting
+					}
+				}
+			}
+		}
+	}
+	visit(others, false)
+	visit(transactions, true)
+	return accounts
+}
+
+func sortDiagnostics(diags []Diagnostic) {
+	sort.Slice(diags, func(i, j int) bool {
+		return diags[i].Range.Start.Offset < diags[j].Range.Start.Offset
+	})
+}
+
+func (opts RecentAssertionsOptions) covers(account string) bool {
+	if opts.Accounts == nil && len(opts.Types) == 0 {
+		return true
+	}
+	if opts.Accounts != nil && opts.Accounts.MatchString(account) {
+		return true
+	}
+	typ := opts.AccountTypes.Type(account)
+	return slices.ContainsFunc(opts.Types, typ.Is)
+}
+
+func daysBetween(from, to ast.Date) int {
+	start := time.Date(from.Year, time.Month(from.Month), from.Day, 0, 0, 0, 0, time.UTC)
+	end := time.Date(to.Year, time.Month(to.Month), to.Day, 0, 0, 0, 0, time.UTC)
+	return int(end.Sub(start).Hours() / 24)
+}
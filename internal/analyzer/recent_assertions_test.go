@@ -0,0 +1,91 @@
+package analyzer
+
+import (
+	"regexp"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/juev/hledger-lsp/internal/parser"
+)
+
+func TestCheckRecentAssertions(t *testing.T) {
+	others, errs := parser.Parse(`2024-01-01 opening
+    assets:checking  $100 = $100
+    liabilities:card  $-50 = $-50
+    equity:opening
+`)
+	require.Empty(t, errs)
+	journal, errs := parser.Parse(`2024-01-05 coffee
+    expenses:food  $5
+    assets:checking
+
+2024-01-20 rent
+    expenses:rent  $50
+    assets:checking
+
+2024-01-15 groceries
+    expenses:food  $10
+    liabilities:card
+`)
+	require.Empty(t, errs)
+
+	opts := RecentAssertionsOptions{Days: 7, Types: []AccountType{AccountTypeAsset}}
+	diags := CheckRecentAssertions(journal.Transactions, others.Transactions, opts)
+	require.Len(t, diags, 1)
+	assert.Equal(t, "STALE_BALANCE_ASSERTION", diags[0].Code)
+	assert.Equal(t, SeverityWarning, diags[0].Severity)
+	assert.Equal(t, "account assets:checking has postings 19 days after its latest balance assertion on 2024-01-01", diags[0].Message)
+	assert.Equal(t, 7, diags[0].Range.Start.Line, "points at the latest posting")
+
+	opts.Days = 30
+	assert.Empty(t, CheckRecentAssertions(journal.Transactions, others.Transactions, opts))
+
+	opts = RecentAssertionsOptions{Days: 7, Accounts: regexp.MustCompile(`(?i)^liabilities`)}
+	diags = CheckRecentAssertions(journal.Transactions, others.Transactions, opts)
+	require.Len(t, diags, 1)
+	assert.Equal(t, 11, diags[0].Range.Start.Line)
+
+	// Postings in other files are counted but not reported.
+	assert.Empty(t, CheckRecentAssertions(others.Transactions, journal.Transactions, RecentAssertionsOptions{Days: 7}))
+
+	// A later assertion covers the postings before it.
+	asserted, errs := parser.Parse(`2024-01-21 check
+    assets:checking  $0 = $45
+    equity:adjustments
+`)
+	require.Empty(t, errs)
+	all := append(others.Transactions, asserted.Transactions...)
+	opts = RecentAssertionsOptions{Days: 7, Types: []AccountType{AccountTypeAsset}}
+	assert.Empty(t, CheckRecentAssertions(journal.Transactions, all, opts))
+}
+
+func TestCheckRecentAssertions_PostingDates(t *testing.T) {
+	journal, errs := parser.Parse(`2024-01-01 opening
+    assets:checking  $100 = $100  ; date:2024-01-20
+    equity:opening
+
+2024-01-25 coffee
+    expenses:food  $5
+    assets:checking
+`)
+	require.Empty(t, errs)
+
+	opts := RecentAssertionsOptions{Days: 7}
+	assert.Empty(t, CheckRecentAssertions(journal.Transactions, nil, opts), "the assertion is dated 2024-01-20")
+
+	journal, errs = parser.Parse(`2024-01-01 opening
+    assets:checking  $100 = $100
+    equity:opening
+
+2024-01-05 coffee
+    expenses:food  $5
+    assets:checking  ; date:2024-02-01
+`)
+	require.Empty(t, errs)
+
+	diags := CheckRecentAssertions(journal.Transactions, nil, opts)
+	require.Len(t, diags, 1)
+	assert.Equal(t, "account assets:checking has postings 31 days after its latest balance assertion on 2024-01-01", diags[0].Message)
+}
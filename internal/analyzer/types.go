@@ -30,6 +30,7 @@ type AnalysisResult struct {
 	TagValues      map[string][]string
 	Dates          []string
 	PayeeTemplates map[string][]PostingTemplate
+	AccountTypes   *AccountTypes
 	Diagnostics    []Diagnostic
 
 	AccountCounts   map[string]int
@@ -71,7 +72,33 @@ func NewBalanceResult() *BalanceResult {
 	}
 }
 
+// BalanceAssertionFailure is a balance assertion whose account does not have
+// the asserted balance in Commodity.
+type BalanceAssertionFailure struct {
+	Posting   *ast.Posting
+	Commodity string
+	Expected  decimal.Decimal
+	Actual    decimal.Decimal
+}
+
 type ExternalDeclarations struct {
 	Accounts    map[string]bool
 	Commodities map[string]bool
+	Payees      map[string]bool
+	Tags        map[string]bool
+
+	// CheckPayees and CheckTags report undeclared payees and tags even
+	// when none is declared, like `hledger check payees` and `tags`.
+	CheckPayees bool
+	CheckTags   bool
+
+	// Transactions are the transactions of the other files of the journal.
+	// They carry running account balances into balance assignments.
+	Transactions []ast.Transaction
+
+	// ParseOrder, when set, holds the transactions of the whole journal,
+	// the analyzed file's own included, in the order hledger reads them.
+	// Running balances follow it instead of the analyzed file's
+	// transactions followed by Transactions.
+	ParseOrder []ast.Transaction
 }
@@ -1,6 +1,10 @@
 package ast
 
-import "github.com/shopspring/decimal"
+import (
+	"strings"
+
+	"github.com/shopspring/decimal"
+)
 
 type Range struct {
 	Start Position
@@ -14,10 +18,12 @@ type Position struct {
 }
 
 type Journal struct {
-	Transactions []Transaction
-	Directives   []Directive
-	Comments     []Comment
-	Includes     []Include
+	Transactions         []Transaction
+	PeriodicTransactions []PeriodicTransaction
+	AutoPostingRules     []AutoPostingRule
+	Directives           []Directive
+	Comments             []Comment
+	Includes             []Include
 }
 
 type Transaction struct {
@@ -34,6 +40,58 @@ type Transaction struct {
 	Range       Range
 }
 
+// PeriodicTransaction is a `~ PERIODEXPR` rule used by hledger for
+// forecasting and budgeting. Its postings are never part of real balances.
+type PeriodicTransaction struct {
+	Period      PeriodExpr
+	Status      Status
+	Code        string
+	Description string
+	Payee       string
+	Note        string
+	Postings    []Posting
+	Comments    []Comment
+	Range       Range
+}
+
+// AutoPostingRule is a `= QUERY` rule. hledger adds its postings to every
+// transaction that has a posting matched by the query; amounts marked as
+// Multiplier are scaled by the matched posting's amount.
+type AutoPostingRule struct {
+	Query      string
+	QueryRange Range
+	Postings   []Posting
+	Comments   []Comment
+	Range      Range
+}
+
+// PeriodExpr is a parsed hledger period expression such as
+// "monthly from 2024-01 to 2024-07". Start is inclusive, End is exclusive;
+// either may be nil when the span is open.
+type PeriodExpr struct {
+	Text     string
+	Interval Interval
+	Start    *Date
+	End      *Date
+	Range    Range
+}
+
+type Interval struct {
+	Unit  IntervalUnit
+	Count int
+}
+
+type IntervalUnit int
+
+const (
+	IntervalNone IntervalUnit = iota
+	IntervalDay
+	IntervalWeek
+	IntervalMonth
+	IntervalQuarter
+	IntervalYear
+)
+
 type Date struct {
 	Year  int
 	Month int
@@ -55,10 +113,51 @@ type Posting struct {
 	Amount           *Amount
 	BalanceAssertion *BalanceAssertion
 	Cost             *Cost
-	Comment          string
-	Tags             []Tag
-	Virtual          VirtualType
-	Range            Range
+	// LotCost is the `{PRICE}` or `{{TOTAL}}` lot annotation: the cost basis
+	// of the lot the amount belongs to. LotDate is the `[DATE]` annotation.
+	LotCost *Cost
+	LotDate *Date
+	// Date and Date2 come from the posting's `date:` and `date2:` tags. They
+	// are nil when the posting has no such tag and uses its transaction's.
+	Date    *Date
+	Date2   *Date
+	Comment string
+	Tags    []Tag
+	Virtual VirtualType
+	Range   Range
+	// Invalid marks a posting line with a syntax error. The parts parsed
+	// before the error are kept; the rest of the line is skipped. Missing
+	// tells which expected part was not found, if any.
+	Invalid bool
+	Missing PostingPart
+}
+
+// HasInvalidPosting reports whether any of postings has a syntax error.
+func HasInvalidPosting(postings []Posting) bool {
+	for i := range postings {
+		if postings[i].Invalid {
+			return true
+		}
+	}
+	return false
+}
+
+// PostingPart is a part of a posting line that the parser may find missing.
+type PostingPart int
+
+const (
+	PostingPartNone PostingPart = iota
+	PostingPartAccount
+	PostingPartAmount
+)
+
+// PostingDate returns the date a posting takes effect: its own `date:` tag
+// if it has one, or else the date of its transaction.
+func (t *Transaction) PostingDate(p *Posting) Date {
+	if p.Date != nil {
+		return *p.Date
+	}
+	return t.Date
 }
 
 type VirtualType int
@@ -69,9 +168,21 @@ const (
 	VirtualUnbalanced
 )
 
+// Account is an account name as used by hledger, after `apply account`
+// prefixes and aliases have been applied. RawName keeps the name as written
+// in the source.
 type Account struct {
-	Name  string
-	Range Range
+	Name    string
+	RawName string
+	Range   Range
+}
+
+// Written returns the account name as it appears in the source.
+func (a Account) Written() string {
+	if a.RawName != "" {
+		return a.RawName
+	}
+	return a.Name
 }
 
 type Amount struct {
@@ -79,6 +190,8 @@ type Amount struct {
 	RawQuantity         string
 	Commodity           Commodity
 	SignBeforeCommodity bool
+	SpaceAfterCommodity bool // a left commodity is followed by a space, as in EUR 10
+	Multiplier          bool // written as *N in an auto posting rule
 	Range               Range
 }
 
@@ -88,6 +201,16 @@ type Commodity struct {
 	Range    Range
 }
 
+// Written returns the commodity symbol as it must appear in a journal:
+// enclosed in double quotes when it contains digits, spaces or characters
+// that are part of the amount syntax.
+func (c Commodity) Written() string {
+	if strings.ContainsAny(c.Symbol, "0123456789-+.,@*;=\"{} \t") {
+		return `"` + c.Symbol + `"`
+	}
+	return c.Symbol
+}
+
 type CommodityPosition int
 
 const (
@@ -131,19 +254,58 @@ type CommodityDirective struct {
 	Note      string
 	Subdirs   map[string]string
 	Range     Range
+	// DecimalMark is the mark set by a preceding decimal-mark directive, or
+	// zero when Format has to be interpreted heuristically.
+	DecimalMark rune
 }
 
 func (CommodityDirective) directive()        {}
 func (d CommodityDirective) GetRange() Range { return d.Range }
 
 type Include struct {
-	Path  string
-	Range Range
+	Path string
+	// Prefix is the reader prefix written before the path, such as
+	// "timeclock" in `include timeclock:hours.txt`. It is not part of Path.
+	Prefix string
+	Range  Range
 }
 
 func (Include) directive()        {}
 func (i Include) GetRange() Range { return i.Range }
 
+// DecimalMarkDirective is a `decimal-mark .` or `decimal-mark ,` directive.
+// It decides how amounts after it, including those in included files, are
+// read.
+type DecimalMarkDirective struct {
+	Mark  rune
+	Range Range
+}
+
+func (DecimalMarkDirective) directive()        {}
+func (d DecimalMarkDirective) GetRange() Range { return d.Range }
+
+// PayeeDirective is a `payee NAME` directive declaring a payee for
+// `hledger check payees`.
+type PayeeDirective struct {
+	Name    string
+	Comment string
+	Range   Range
+}
+
+func (PayeeDirective) directive()        {}
+func (d PayeeDirective) GetRange() Range { return d.Range }
+
+// TagDirective is a `tag NAME` directive declaring a tag for
+// `hledger check tags`.
+type TagDirective struct {
+	Name    string
+	Comment string
+	Range   Range
+}
+
+func (TagDirective) directive()        {}
+func (d TagDirective) GetRange() Range { return d.Range }
+
 type PriceDirective struct {
 	Date      Date
 	Commodity Commodity
@@ -163,18 +325,62 @@ func (YearDirective) directive()        {}
 func (d YearDirective) GetRange() Range { return d.Range }
 
 type DefaultCommodityDirective struct {
-	Symbol string
-	Format string
-	Range  Range
+	Symbol      string
+	Format      string
+	DecimalMark rune
+	Range       Range
 }
 
 func (DefaultCommodityDirective) directive()        {}
 func (d DefaultCommodityDirective) GetRange() Range { return d.Range }
 
+// AliasDirective is an `alias OLD = NEW` or `alias /REGEX/ = REPLACEMENT`
+// directive. It rewrites the account names of everything after it in the
+// same file and in files included from there, until `end aliases`.
+type AliasDirective struct {
+	Original    string
+	Replacement string
+	IsRegex     bool
+	Range       Range
+}
+
+func (AliasDirective) directive()        {}
+func (d AliasDirective) GetRange() Range { return d.Range }
+
+// EndAliasesDirective is an `end aliases` directive, which forgets all
+// aliases seen so far.
+type EndAliasesDirective struct {
+	Range Range
+}
+
+func (EndAliasesDirective) directive()        {}
+func (d EndAliasesDirective) GetRange() Range { return d.Range }
+
+// ApplyAccountDirective is an `apply account PREFIX` directive. Account names
+// after it, including those in included files, get PREFIX prepended until
+// the matching `end apply account`.
+type ApplyAccountDirective struct {
+	Account string
+	Range   Range
+}
+
+func (ApplyAccountDirective) directive()        {}
+func (d ApplyAccountDirective) GetRange() Range { return d.Range }
+
+type EndApplyAccountDirective struct {
+	Range Range
+}
+
+func (EndApplyAccountDirective) directive()        {}
+func (d EndApplyAccountDirective) GetRange() Range { return d.Range }
+
 type Comment struct {
 	Text  string
 	Tags  []Tag
 	Range Range
+	// Block is set for a `comment` ... `end comment` block. Text then holds
+	// the lines between the two directives and Range covers both.
+	Block bool
 }
 
 type Tag struct {
@@ -1,6 +1,7 @@
 package formatter
 
 import (
+	"fmt"
 	"strings"
 	"unicode/utf8"
 
@@ -53,21 +54,38 @@ func FormatDocumentWithOptions(journal *ast.Journal, content string, commodityFo
 
 	postingLines := make(map[int]bool)
 
-	if len(journal.Transactions) > 0 {
+	// Postings are rewritten from the AST, so a group with a syntax error is
+	// left as written rather than lose the unparsed text.
+	postingGroups := make([][]ast.Posting, 0, len(journal.Transactions)+len(journal.PeriodicTransactions)+len(journal.AutoPostingRules))
+	addGroup := func(postings []ast.Posting) {
+		if !ast.HasInvalidPosting(postings) {
+			postingGroups = append(postingGroups, postings)
+		}
+	}
+	for i := range journal.Transactions {
+		addGroup(journal.Transactions[i].Postings)
+	}
+	for i := range journal.PeriodicTransactions {
+		addGroup(journal.PeriodicTransactions[i].Postings)
+	}
+	for i := range journal.AutoPostingRules {
+		addGroup(journal.AutoPostingRules[i].Postings)
+	}
+
+	if len(postingGroups) > 0 {
 		globalAccountCol := 0
 		if opts.AlignAmounts {
-			globalAccountCol = calculateGlobalAlignmentColumnWithIndent(journal.Transactions, opts.IndentSize)
+			globalAccountCol = calculateGlobalAlignmentColumnWithIndent(postingGroups, opts.IndentSize)
 			if opts.MinAlignmentColumn > 0 && globalAccountCol < opts.MinAlignmentColumn {
 				globalAccountCol = opts.MinAlignmentColumn
 			}
 		}
 
-		for i := range journal.Transactions {
-			tx := &journal.Transactions[i]
-			for j := range tx.Postings {
-				postingLines[tx.Postings[j].Range.Start.Line-1] = true
+		for _, postings := range postingGroups {
+			for j := range postings {
+				postingLines[postings[j].Range.Start.Line-1] = true
 			}
-			txEdits := formatTransactionWithOpts(tx, mapper, commodityFormats, globalAccountCol, opts)
+			txEdits := formatPostingsWithOpts(postings, mapper, commodityFormats, globalAccountCol, opts)
 			edits = append(edits, txEdits...)
 		}
 	}
@@ -122,11 +140,11 @@ func extractCommodityFormats(journal *ast.Journal) map[string]NumberFormat {
 		switch d := dir.(type) {
 		case ast.CommodityDirective:
 			if d.Format != "" {
-				formats[d.Commodity.Symbol] = ParseNumberFormat(d.Format)
+				formats[d.Commodity.Symbol] = ParseNumberFormatWithMark(d.Format, d.DecimalMark)
 			}
 		case ast.DefaultCommodityDirective:
 			if d.Format != "" {
-				nf := ParseNumberFormat(d.Format)
+				nf := ParseNumberFormatWithMark(d.Format, d.DecimalMark)
 				defaultFormat = &nf
 				if d.Symbol != "" {
 					formats[d.Symbol] = nf
@@ -142,8 +160,8 @@ func extractCommodityFormats(journal *ast.Journal) map[string]NumberFormat {
 	return formats
 }
 
-func formatTransactionWithOpts(tx *ast.Transaction, mapper *lsputil.PositionMapper, commodityFormats map[string]NumberFormat, globalAccountCol int, opts Options) []protocol.TextEdit {
-	if len(tx.Postings) == 0 {
+func formatPostingsWithOpts(postings []ast.Posting, mapper *lsputil.PositionMapper, commodityFormats map[string]NumberFormat, globalAccountCol int, opts Options) []protocol.TextEdit {
+	if len(postings) == 0 {
 		return nil
 	}
 
@@ -152,11 +170,11 @@ func formatTransactionWithOpts(tx *ast.Transaction, mapper *lsputil.PositionMapp
 
 	var alignment AlignmentInfo
 	if opts.AlignAmounts {
-		alignment = CalculateAlignmentWithGlobal(tx.Postings, commodityFormats, globalAccountCol)
+		alignment = CalculateAlignmentWithGlobal(postings, commodityFormats, globalAccountCol)
 	}
 
-	for i := range tx.Postings {
-		posting := &tx.Postings[i]
+	for i := range postings {
+		posting := &postings[i]
 		formatted := formatPostingWithOpts(posting, alignment, commodityFormats, indent, opts.AlignAmounts)
 		line := posting.Range.Start.Line - 1
 
@@ -180,7 +198,7 @@ func formatTransactionWithOpts(tx *ast.Transaction, mapper *lsputil.PositionMapp
 }
 
 func calculateAccountDisplayLength(p *ast.Posting) int {
-	accountLen := utf8.RuneCountInString(p.Account.Name)
+	accountLen := utf8.RuneCountInString(p.Account.Written())
 	switch p.Virtual {
 	case ast.VirtualBalanced, ast.VirtualUnbalanced:
 		accountLen += 2
@@ -210,11 +228,11 @@ func CalculateGlobalAlignmentColumn(transactions []ast.Transaction) int {
 	return utf8.RuneCountInString(defaultIndent) + maxLen + minSpaces
 }
 
-func calculateGlobalAlignmentColumnWithIndent(transactions []ast.Transaction, indentSize int) int {
+func calculateGlobalAlignmentColumnWithIndent(postingGroups [][]ast.Posting, indentSize int) int {
 	maxLen := 0
-	for i := range transactions {
-		for j := range transactions[i].Postings {
-			if accountLen := calculateAccountDisplayLength(&transactions[i].Postings[j]); accountLen > maxLen {
+	for _, postings := range postingGroups {
+		for j := range postings {
+			if accountLen := calculateAccountDisplayLength(&postings[j]); accountLen > maxLen {
 				maxLen = accountLen
 			}
 		}
@@ -264,16 +282,25 @@ func calculateAmountCostLen(posting *ast.Posting, commodityFormats map[string]Nu
 
 	length := 0
 
+	if posting.Amount.Multiplier {
+		length++
+	}
+
 	if posting.Amount.Commodity.Position == ast.CommodityLeft {
-		length += utf8.RuneCountInString(posting.Amount.Commodity.Symbol)
+		length += utf8.RuneCountInString(posting.Amount.Commodity.Written())
+		if posting.Amount.SpaceAfterCommodity {
+			length++
+		}
 	}
 
 	length += utf8.RuneCountInString(formatAmountQuantity(posting.Amount, commodityFormats))
 
 	if posting.Amount.Commodity.Position == ast.CommodityRight {
-		length += 1 + utf8.RuneCountInString(posting.Amount.Commodity.Symbol)
+		length += 1 + utf8.RuneCountInString(posting.Amount.Commodity.Written())
 	}
 
+	length += utf8.RuneCountInString(formatLotAnnotations(posting, commodityFormats))
+
 	if posting.Cost != nil {
 		if posting.Cost.IsTotal {
 			length += 4 // " @@ "
@@ -281,11 +308,14 @@ func calculateAmountCostLen(posting *ast.Posting, commodityFormats map[string]Nu
 			length += 3 // " @ "
 		}
 		if posting.Cost.Amount.Commodity.Position == ast.CommodityLeft {
-			length += utf8.RuneCountInString(posting.Cost.Amount.Commodity.Symbol)
+			length += utf8.RuneCountInString(posting.Cost.Amount.Commodity.Written())
+			if posting.Cost.Amount.SpaceAfterCommodity {
+				length++
+			}
 		}
 		length += utf8.RuneCountInString(formatAmountQuantity(&posting.Cost.Amount, commodityFormats))
 		if posting.Cost.Amount.Commodity.Position == ast.CommodityRight {
-			length += 1 + utf8.RuneCountInString(posting.Cost.Amount.Commodity.Symbol)
+			length += 1 + utf8.RuneCountInString(posting.Cost.Amount.Commodity.Written())
 		}
 	}
 
@@ -319,7 +349,7 @@ func formatPostingWithOpts(posting *ast.Posting, alignment AlignmentInfo, commod
 		sb.WriteString("[")
 	}
 
-	sb.WriteString(posting.Account.Name)
+	sb.WriteString(posting.Account.Written())
 
 	switch posting.Virtual {
 	case ast.VirtualUnbalanced:
@@ -337,6 +367,7 @@ func formatPostingWithOpts(posting *ast.Posting, alignment AlignmentInfo, commod
 		sb.WriteString(strings.Repeat(" ", spaces))
 
 		writeAmountWithSign(&sb, posting.Amount, commodityFormats)
+		sb.WriteString(formatLotAnnotations(posting, commodityFormats))
 	}
 
 	if posting.Cost != nil {
@@ -358,10 +389,14 @@ func formatPostingWithOpts(posting *ast.Posting, alignment AlignmentInfo, commod
 		}
 
 		if posting.BalanceAssertion.IsStrict {
-			sb.WriteString("== ")
+			sb.WriteString("==")
 		} else {
-			sb.WriteString("= ")
+			sb.WriteString("=")
 		}
+		if posting.BalanceAssertion.IsInclusive {
+			sb.WriteString("*")
+		}
+		sb.WriteString(" ")
 		writeAmountWithSign(&sb, &posting.BalanceAssertion.Amount, commodityFormats)
 	}
 
@@ -376,30 +411,59 @@ func formatPostingWithOpts(posting *ast.Posting, alignment AlignmentInfo, commod
 func writeAmountWithSign(sb *strings.Builder, amount *ast.Amount, commodityFormats map[string]NumberFormat) {
 	qty := formatAmountQuantity(amount, commodityFormats)
 
+	if amount.Multiplier {
+		sb.WriteByte('*')
+	}
+
 	if amount.Commodity.Position == ast.CommodityLeft {
 		if amount.SignBeforeCommodity && len(qty) > 0 && (qty[0] == '-' || qty[0] == '+') {
 			sb.WriteByte(qty[0])
-			sb.WriteString(amount.Commodity.Symbol)
-			sb.WriteString(qty[1:])
-		} else {
-			sb.WriteString(amount.Commodity.Symbol)
-			sb.WriteString(qty)
+			qty = qty[1:]
 		}
+		sb.WriteString(amount.Commodity.Written())
+		if amount.SpaceAfterCommodity {
+			sb.WriteByte(' ')
+		}
+		sb.WriteString(qty)
 	} else {
 		sb.WriteString(qty)
 		if amount.Commodity.Symbol != "" {
 			sb.WriteString(" ")
-			sb.WriteString(amount.Commodity.Symbol)
+			sb.WriteString(amount.Commodity.Written())
 		}
 	}
 }
 
+// formatLotAnnotations returns the lot cost and lot date written after a
+// posting amount, each preceded by a space.
+func formatLotAnnotations(posting *ast.Posting, commodityFormats map[string]NumberFormat) string {
+	var sb strings.Builder
+	if lot := posting.LotCost; lot != nil {
+		open, closing := " {", "}"
+		if lot.IsTotal {
+			open, closing = " {{", "}}"
+		}
+		sb.WriteString(open)
+		writeAmountWithSign(&sb, &lot.Amount, commodityFormats)
+		sb.WriteString(closing)
+	}
+	if date := posting.LotDate; date != nil {
+		fmt.Fprintf(&sb, " [%04d-%02d-%02d]", date.Year, date.Month, date.Day)
+	}
+	return sb.String()
+}
+
 // formatAmountQuantity returns formatted quantity string.
 // Priority: commodity directive format > default format > original raw format > decimal string.
 func formatAmountQuantity(amount *ast.Amount, commodityFormats map[string]NumberFormat) string {
 	if amount == nil {
 		return ""
 	}
+	// Multipliers are factors, not amounts of the commodity, so display
+	// precision must not round them.
+	if amount.Multiplier && amount.RawQuantity != "" {
+		return amount.RawQuantity
+	}
 	if commodityFormats != nil {
 		// First try specific commodity format
 		if format, ok := commodityFormats[amount.Commodity.Symbol]; ok {
@@ -62,6 +62,14 @@ func TestFormatPosting(t *testing.T) {
 			alignCol: 20,
 			expected: "    expenses:food   $50",
 		},
+		{
+			name: "quoted commodity keeps its quotes",
+			input: `2024-01-15 test
+    assets:shares  "ABC123" 10
+    assets:cash`,
+			alignCol: 20,
+			expected: `    assets:shares   "ABC123" 10`,
+		},
 	}
 
 	for _, tt := range tests {
@@ -117,6 +125,25 @@ func TestFormatDocument_MultipleTransactions(t *testing.T) {
 	assert.NotNil(t, edits)
 }
 
+func TestFormatDocument_LeavesInvalidPostingsAsWritten(t *testing.T) {
+	input := `2024-01-15 broken
+    expenses:food    $5 garbage
+    assets:cash
+
+2024-01-16 valid
+    expenses:rent    $1000
+    assets:bank`
+
+	journal, errs := parser.Parse(input)
+	require.Len(t, errs, 1)
+
+	edits := FormatDocument(journal, input)
+	require.NotEmpty(t, edits)
+	for _, edit := range edits {
+		assert.GreaterOrEqual(t, edit.Range.Start.Line, uint32(4), "edit in broken transaction: %+v", edit)
+	}
+}
+
 func TestFormatDocument_EmptyDocument(t *testing.T) {
 	journal, _ := parser.Parse("")
 	edits := FormatDocument(journal, "")
@@ -223,7 +250,7 @@ func TestFormatDocument_WithBalanceAssertionCommodityFormat(t *testing.T) {
 	found := false
 	for _, edit := range edits {
 		if edit.NewText != "" && len(edit.NewText) > 0 {
-			if edit.NewText == "    assets:bank    EUR100,00  = 1 000,00 EUR" {
+			if edit.NewText == "    assets:bank    EUR 100,00  = 1 000,00 EUR" {
 				found = true
 				break
 			}
@@ -265,6 +292,23 @@ func TestFormatDocument_BalanceAssertionAlignment(t *testing.T) {
 	assert.Equal(t, idx1, idx2, "= signs should be aligned at the same column, got %d and %d", idx1, idx2)
 }
 
+func TestFormatDocument_LeftCommoditySpaceAlignment(t *testing.T) {
+	input := `2024-01-15 opening
+    assets:bank:checking  EUR 100 = EUR 1000
+    assets:cash  50 EUR = 50 EUR
+    equity:opening`
+
+	journal, errs := parser.Parse(input)
+	require.Empty(t, errs)
+
+	edits := FormatDocument(journal, input)
+	require.Len(t, edits, 3)
+
+	assert.Equal(t, "    assets:bank:checking  EUR 100  = EUR 1000", edits[0].NewText, "the space after a left commodity is kept")
+	assert.Equal(t, findEqualSignIndex(edits[0].NewText), findEqualSignIndex(edits[1].NewText),
+		"the space counts toward the amount width")
+}
+
 func findEqualSignIndex(s string) int {
 	for i, r := range s {
 		if r == '=' {
@@ -883,3 +927,132 @@ func applyEdits(content string, edits []protocol.TextEdit) string {
 	}
 	return result
 }
+
+func TestFormatDocument_PeriodicTransaction(t *testing.T) {
+	input := `~ monthly  rent
+  expenses:rent   $1000
+  assets:checking
+
+2024-01-15 test
+    expenses:food  $50
+    assets:cash`
+
+	journal, errs := parser.Parse(input)
+	require.Empty(t, errs)
+
+	edits := FormatDocument(journal, input)
+	result := applyEdits(input, edits)
+
+	expected := `~ monthly  rent
+    expenses:rent    $1000
+    assets:checking
+
+2024-01-15 test
+    expenses:food    $50
+    assets:cash`
+	assert.Equal(t, expected, result)
+}
+
+func TestFormatDocument_AutoPostingRule(t *testing.T) {
+	input := `commodity $1,000.00
+
+= expenses:food
+  liabilities:tax  *-0.25
+  (budget:tax)   *0.25
+
+2024-01-15 test
+    expenses:food  $50
+    assets:cash`
+
+	journal, errs := parser.Parse(input)
+	require.Empty(t, errs)
+
+	edits := FormatDocument(journal, input)
+	result := applyEdits(input, edits)
+
+	expected := `commodity $1,000.00
+
+= expenses:food
+    liabilities:tax  *-0.25
+    (budget:tax)     *0.25
+
+2024-01-15 test
+    expenses:food    $50.00
+    assets:cash`
+	assert.Equal(t, expected, result)
+}
+
+func TestFormatDocument_KeepsAliasedAccountNames(t *testing.T) {
+	input := `alias bank:old = assets:bank:checking
+
+2024-01-15 test
+    bank:old  $50
+    expenses:food`
+
+	journal, errs := parser.Parse(input)
+	require.Empty(t, errs)
+	require.Equal(t, "assets:bank:checking", journal.Transactions[0].Postings[0].Account.Name)
+
+	edits := FormatDocument(journal, input)
+	result := applyEdits(input, edits)
+
+	expected := `alias bank:old = assets:bank:checking
+
+2024-01-15 test
+    bank:old       $50
+    expenses:food`
+	assert.Equal(t, expected, result)
+}
+
+func TestFormatDocument_DecimalMarkDirective(t *testing.T) {
+	input := `decimal-mark .
+commodity 1,000 EUR
+
+2024-01-15 test
+    expenses:food  1,234 EUR
+    assets:cash  -50 EUR
+    equity:opening`
+
+	journal, errs := parser.Parse(input)
+	require.Empty(t, errs)
+
+	edits := FormatDocument(journal, input)
+	result := applyEdits(input, edits)
+
+	expected := `decimal-mark .
+commodity 1,000 EUR
+
+2024-01-15 test
+    expenses:food   1,234 EUR
+    assets:cash     -50 EUR
+    equity:opening`
+	assert.Equal(t, expected, result)
+}
+
+func TestFormatDocument_KeepsLotAnnotations(t *testing.T) {
+	input := `2024-03-01 sell
+    assets:broker  -10 AAPL {150 USD} [2024-01-02] @ 180 USD
+    assets:cash  1800 USD
+    income:gains`
+
+	journal, errs := parser.Parse(input)
+	require.Empty(t, errs)
+
+	edits := FormatDocument(journal, input)
+	result := applyEdits(input, edits)
+
+	assert.Contains(t, result, "-10 AAPL {150 USD} [2024-01-02] @ 180 USD")
+}
+
+func TestFormatDocument_KeepsInclusiveBalanceAssertion(t *testing.T) {
+	input := `2024-01-16 check
+    assets:bank  $0 ==* $1000`
+
+	journal, errs := parser.Parse(input)
+	require.Empty(t, errs)
+
+	edits := FormatDocument(journal, input)
+	result := applyEdits(input, edits)
+
+	assert.Contains(t, result, "==* $1000")
+}
@@ -1,6 +1,7 @@
 package formatter
 
 import (
+	"strconv"
 	"strings"
 	"unicode"
 	"unicode/utf8"
@@ -23,7 +24,7 @@ func ParseNumberFormat(formatStr string) NumberFormat {
 		HasDecimal:    false,
 	}
 
-	numberPart := extractNumberPart(formatStr)
+	numberPart, exponent := extractNumberPart(formatStr)
 	if numberPart == "" {
 		return nf
 	}
@@ -31,7 +32,13 @@ func ParseNumberFormat(formatStr string) NumberFormat {
 	lastDot := strings.LastIndex(numberPart, ".")
 	lastComma := strings.LastIndex(numberPart, ",")
 
-	if lastDot > lastComma {
+	// A mark repeated without the other one separates digit groups.
+	if lastComma < 0 && strings.Count(numberPart, ".") > 1 {
+		nf.DecimalMark = ','
+		nf.ThousandsSep = "."
+	} else if lastDot < 0 && strings.Count(numberPart, ",") > 1 {
+		nf.ThousandsSep = ","
+	} else if lastDot > lastComma {
 		nf.DecimalMark = '.'
 		nf.HasDecimal = true
 		if lastComma >= 0 {
@@ -55,10 +62,46 @@ func ParseNumberFormat(formatStr string) NumberFormat {
 		}
 	}
 
+	applyExponent(&nf, exponent)
 	return nf
 }
 
-func extractNumberPart(formatStr string) string {
+// ParseNumberFormatWithMark parses a commodity format written in a file with
+// a decimal-mark directive. mark decides which separator is the decimal one;
+// zero falls back to ParseNumberFormat's guess.
+func ParseNumberFormatWithMark(formatStr string, mark rune) NumberFormat {
+	if mark == 0 {
+		return ParseNumberFormat(formatStr)
+	}
+
+	nf := NumberFormat{DecimalMark: mark}
+
+	numberPart, exponent := extractNumberPart(formatStr)
+	if numberPart == "" {
+		return nf
+	}
+
+	intPart := numberPart
+	if idx := strings.LastIndexByte(numberPart, byte(mark)); idx >= 0 {
+		nf.HasDecimal = true
+		nf.DecimalPlaces = len(numberPart) - idx - 1
+		intPart = numberPart[:idx]
+	}
+
+	for _, sep := range []string{".", ",", " "} {
+		if sep != string(mark) && strings.Contains(intPart, sep) {
+			nf.ThousandsSep = sep
+			break
+		}
+	}
+
+	applyExponent(&nf, exponent)
+	return nf
+}
+
+// extractNumberPart returns the first number in formatStr and the E
+// notation exponent written after it, if any.
+func extractNumberPart(formatStr string) (string, int) {
 	var start, end int
 	inNumber := false
 	lastDigitPos := -1
@@ -80,11 +123,31 @@ func extractNumberPart(formatStr string) string {
 	}
 
 	if !inNumber || lastDigitPos < 0 {
-		return ""
+		return "", 0
 	}
 
-	result := formatStr[start:end]
-	return strings.TrimSpace(result)
+	result := strings.TrimSpace(formatStr[start:end])
+	exponent := 0
+	if rest := formatStr[start+len(result):]; len(rest) > 1 && (rest[0] == 'E' || rest[0] == 'e') {
+		digits := rest[1:]
+		if idx := strings.IndexFunc(digits, func(r rune) bool { return !unicode.IsDigit(r) && r != '-' && r != '+' }); idx >= 0 {
+			digits = digits[:idx]
+		}
+		if n, err := strconv.Atoi(digits); err == nil {
+			exponent = n
+		}
+	}
+	return result, exponent
+}
+
+// applyExponent turns the format of a number written in E notation into
+// that of the same number written out in full, the way hledger displays it.
+func applyExponent(nf *NumberFormat, exponent int) {
+	if exponent == 0 {
+		return
+	}
+	nf.DecimalPlaces = max(nf.DecimalPlaces-exponent, 0)
+	nf.HasDecimal = nf.DecimalPlaces > 0
 }
 
 func FormatNumber(qty decimal.Decimal, format NumberFormat) string {
@@ -108,7 +171,14 @@ func FormatNumber(qty decimal.Decimal, format NumberFormat) string {
 		intPart = intPart[1:]
 	}
 
-	if format.ThousandsSep != "" && len(intPart) > 3 {
+	// A group separator equal to the decimal mark would change the value
+	// when the number is read back.
+	thousandsSep := format.ThousandsSep
+	if thousandsSep == string(format.DecimalMark) {
+		thousandsSep = ""
+	}
+
+	if thousandsSep != "" && len(intPart) > 3 {
 		var groups []string
 		for len(intPart) > 3 {
 			groups = append([]string{intPart[len(intPart)-3:]}, groups...)
@@ -117,7 +187,7 @@ func FormatNumber(qty decimal.Decimal, format NumberFormat) string {
 		if len(intPart) > 0 {
 			groups = append([]string{intPart}, groups...)
 		}
-		intPart = strings.Join(groups, format.ThousandsSep)
+		intPart = strings.Join(groups, thousandsSep)
 	}
 
 	var result strings.Builder
@@ -126,7 +196,7 @@ func FormatNumber(qty decimal.Decimal, format NumberFormat) string {
 	}
 	result.WriteString(intPart)
 
-	if format.HasDecimal && format.DecimalPlaces > 0 {
+	if format.HasDecimal {
 		result.WriteRune(format.DecimalMark)
 		result.WriteString(decPart)
 	}
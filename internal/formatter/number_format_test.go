@@ -5,6 +5,9 @@ import (
 
 	"github.com/shopspring/decimal"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/juev/hledger-lsp/internal/parser"
 )
 
 func TestParseNumberFormat(t *testing.T) {
@@ -96,6 +99,51 @@ func TestParseNumberFormat(t *testing.T) {
 	}
 }
 
+func TestParseNumberFormatWithMark(t *testing.T) {
+	tests := []struct {
+		name     string
+		format   string
+		mark     rune
+		expected NumberFormat
+	}{
+		{
+			name:     "comma grouping with dot mark",
+			format:   "1,000 EUR",
+			mark:     '.',
+			expected: NumberFormat{DecimalMark: '.', ThousandsSep: ","},
+		},
+		{
+			name:     "dot grouping with comma mark",
+			format:   "1.000 EUR",
+			mark:     ',',
+			expected: NumberFormat{DecimalMark: ',', ThousandsSep: "."},
+		},
+		{
+			name:     "comma decimals with comma mark",
+			format:   "1 000,000 BTC",
+			mark:     ',',
+			expected: NumberFormat{DecimalMark: ',', ThousandsSep: " ", DecimalPlaces: 3, HasDecimal: true},
+		},
+		{
+			name:     "no mark falls back to heuristics",
+			format:   "1,000 EUR",
+			mark:     0,
+			expected: ParseNumberFormat("1,000 EUR"),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, ParseNumberFormatWithMark(tt.format, tt.mark))
+		})
+	}
+}
+
+func TestFormatNumber_NeverGroupsWithDecimalMark(t *testing.T) {
+	format := NumberFormat{DecimalMark: ',', ThousandsSep: ",", DecimalPlaces: 2, HasDecimal: true}
+	assert.Equal(t, "1234,50", FormatNumber(decimal.RequireFromString("1234.5"), format))
+}
+
 func TestFormatNumber(t *testing.T) {
 	tests := []struct {
 		name     string
@@ -200,3 +248,39 @@ func TestFormatNumber(t *testing.T) {
 		})
 	}
 }
+
+// TestFormatNumber_RoundTrip formats amounts seen in real journals with the
+// format of their own raw quantity, as the formatter does for a commodity
+// declared with that amount. Numbers in E notation come back written out.
+func TestFormatNumber_RoundTrip(t *testing.T) {
+	tests := []struct {
+		amount   string
+		expected string
+	}{
+		{amount: "$1,234.56", expected: "1,234.56"},
+		{amount: "1.234,56 EUR", expected: "1.234,56"},
+		{amount: "1 234 567,89 RUB", expected: "1 234 567,89"},
+		{amount: "1 000 RUB", expected: "1 000"},
+		{amount: "1,000,000 USD", expected: "1,000,000"},
+		{amount: "1.000.000 EUR", expected: "1.000.000"},
+		{amount: "$-5.00", expected: "-5.00"},
+		{amount: "-$5", expected: "-5"},
+		{amount: "0.00012345 BTC", expected: "0.00012345"},
+		{amount: "5. USD", expected: "5."},
+		{amount: `10 "ABC123"`, expected: "10"},
+		{amount: "1E3 USD", expected: "1000"},
+		{amount: "1.5E3 EUR", expected: "1500"},
+		{amount: "-1.5e-2 BTC", expected: "-0.015"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.amount, func(t *testing.T) {
+			journal, errs := parser.Parse("2024-01-15 test\n    expenses:food  " + tt.amount + "\n    assets:cash\n")
+			require.Empty(t, errs)
+			amount := journal.Transactions[0].Postings[0].Amount
+			require.NotNil(t, amount)
+
+			assert.Equal(t, tt.expected, FormatNumber(amount.Quantity, ParseNumberFormat(amount.RawQuantity)))
+		})
+	}
+}
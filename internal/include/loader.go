@@ -94,7 +94,7 @@ func (l *Loader) Load(path string) (*ResolvedJournal, []LoadError) {
 		}}
 	}
 
-	return l.loadWithContent(path, string(content), make(map[string]bool))
+	return l.loadWithContent(path, string(content), make(map[string]bool), parser.Options{Format: parser.FormatForPath(path)})
 }
 
 func (l *Loader) LoadFromContent(path, content string) (*ResolvedJournal, []LoadError) {
@@ -106,10 +106,10 @@ func (l *Loader) LoadFromContent(path, content string) (*ResolvedJournal, []Load
 			Message: fmt.Sprintf("file too large: %d bytes (max %d)", len(content), limits.MaxFileSizeBytes),
 		}}
 	}
-	return l.loadWithContent(path, content, make(map[string]bool))
+	return l.loadWithContent(path, content, make(map[string]bool), parser.Options{Format: parser.FormatForPath(path)})
 }
 
-func (l *Loader) loadWithContent(path, content string, visited map[string]bool) (*ResolvedJournal, []LoadError) {
+func (l *Loader) loadWithContent(path, content string, visited map[string]bool, opts parser.Options) (*ResolvedJournal, []LoadError) {
 	var errors []LoadError
 	limits := l.getLimits()
 
@@ -121,25 +121,23 @@ func (l *Loader) loadWithContent(path, content string, visited map[string]bool)
 		}}
 	}
 
-	journal, parseErrs := parser.Parse(content)
+	journal, parseErrs := parser.ParseWithOptions(content, opts)
 	for _, e := range parseErrs {
-		pos := ast.Position{
-			Line:   e.Pos.Line,
-			Column: e.Pos.Column,
-			Offset: e.Pos.Offset,
-		}
 		errors = append(errors, LoadError{
 			Kind:    ErrorParseError,
 			Path:    path,
 			Message: e.Message,
-			Range:   ast.Range{Start: pos, End: pos},
+			Range:   e.Range(),
 		})
 	}
 
 	result := NewResolvedJournal(journal)
+	result.PrimaryPath = path
 	visited[path] = true
 
 	for _, inc := range journal.Includes {
+		incOpts := OptionsAt(opts, journal.Directives, inc.Range.Start)
+
 		if IsGlobPattern(inc.Path) {
 			matches, err := l.expandGlob(path, inc.Path)
 			if err != nil {
@@ -153,7 +151,8 @@ func (l *Loader) loadWithContent(path, content string, visited map[string]bool)
 			}
 
 			for _, matchPath := range matches {
-				subErrors := l.loadSingleInclude(path, matchPath, inc.Range, visited, result)
+				incOpts.Format = parser.FormatForInclude(inc, matchPath)
+				subErrors := l.loadSingleInclude(path, matchPath, inc.Range, incOpts, visited, result)
 				errors = append(errors, subErrors...)
 			}
 			continue
@@ -170,7 +169,8 @@ func (l *Loader) loadWithContent(path, content string, visited map[string]bool)
 			continue
 		}
 
-		subErrors := l.loadSingleInclude(path, includePath, inc.Range, visited, result)
+		incOpts.Format = parser.FormatForInclude(inc, includePath)
+		subErrors := l.loadSingleInclude(path, includePath, inc.Range, incOpts, visited, result)
 		errors = append(errors, subErrors...)
 	}
 
@@ -180,6 +180,7 @@ func (l *Loader) loadWithContent(path, content string, visited map[string]bool)
 func (l *Loader) loadSingleInclude(
 	basePath, includePath string,
 	incRange ast.Range,
+	opts parser.Options,
 	visited map[string]bool,
 	result *ResolvedJournal,
 ) []LoadError {
@@ -196,10 +197,16 @@ func (l *Loader) loadSingleInclude(
 		return errors
 	}
 
+	// The cache only holds files parsed without inherited state, since
+	// aliases and parent accounts change the account names in the journal.
+	// Files read in another format are kept out too, so that their format
+	// is recorded in Inherited.
+	cacheable := opts.IsZero()
+
 	l.mu.RLock()
 	cached, ok := l.cache[includePath]
 	l.mu.RUnlock()
-	if ok {
+	if ok && cacheable {
 		result.Files[includePath] = cached
 		result.FileOrder = append(result.FileOrder, includePath)
 		return errors
@@ -237,22 +244,55 @@ func (l *Loader) loadSingleInclude(
 		return errors
 	}
 
-	subResult, subErrors := l.loadWithContent(includePath, string(incContent), visited)
+	subResult, subErrors := l.loadWithContent(includePath, string(incContent), visited, opts)
 	errors = append(errors, subErrors...)
 
 	if subResult != nil && subResult.Primary != nil {
-		l.mu.Lock()
-		l.cache[includePath] = subResult.Primary
-		l.mu.Unlock()
+		if cacheable {
+			l.mu.Lock()
+			l.cache[includePath] = subResult.Primary
+			l.mu.Unlock()
+		} else {
+			result.Inherited[includePath] = opts
+		}
 		result.Files[includePath] = subResult.Primary
 		result.FileOrder = append(result.FileOrder, includePath)
 		maps.Copy(result.Files, subResult.Files)
+		maps.Copy(result.Inherited, subResult.Inherited)
 		result.FileOrder = append(result.FileOrder, subResult.FileOrder...)
 	}
 
 	return errors
 }
 
+// OptionsAt returns the parser state in effect at pos: the inherited state
+// updated by the alias, `apply account` and decimal-mark directives above pos.
+func OptionsAt(inherited parser.Options, directives []ast.Directive, pos ast.Position) parser.Options {
+	opts := inherited
+	for _, dir := range directives {
+		if dir.GetRange().Start.Offset >= pos.Offset {
+			break
+		}
+		switch d := dir.(type) {
+		case ast.AliasDirective:
+			opts.Aliases = append(opts.Aliases[:len(opts.Aliases):len(opts.Aliases)], d)
+		case ast.EndAliasesDirective:
+			opts.Aliases = nil
+		case ast.ApplyAccountDirective:
+			opts.ParentAccounts = append(opts.ParentAccounts[:len(opts.ParentAccounts):len(opts.ParentAccounts)], d.Account)
+		case ast.EndApplyAccountDirective:
+			if n := len(opts.ParentAccounts); n > 0 {
+				opts.ParentAccounts = opts.ParentAccounts[:n-1]
+			}
+		case ast.DecimalMarkDirective:
+			opts.DecimalMark = d.Mark
+		case ast.YearDirective:
+			opts.DefaultYear = d.Year
+		}
+	}
+	return opts
+}
+
 func (l *Loader) expandGlob(basePath, pattern string) ([]string, error) {
 	dir := filepath.Dir(basePath)
 
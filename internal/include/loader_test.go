@@ -5,6 +5,9 @@ import (
 	"path/filepath"
 	"strings"
 	"testing"
+
+	"github.com/juev/hledger-lsp/internal/ast"
+	"github.com/juev/hledger-lsp/internal/parser"
 )
 
 func TestLoader_LoadSingleFile(t *testing.T) {
@@ -559,3 +562,353 @@ func TestLoader_MaxIncludeDepthLimit(t *testing.T) {
 		t.Fatalf("expected include depth limit error, got: %v", errs)
 	}
 }
+
+func TestLoader_AliasScopeFollowsIncludeOrder(t *testing.T) {
+	dir := t.TempDir()
+	mainFile := filepath.Join(dir, "main.journal")
+	beforeFile := filepath.Join(dir, "before.journal")
+	afterFile := filepath.Join(dir, "after.journal")
+	nestedFile := filepath.Join(dir, "nested.journal")
+
+	mainContent := `include before.journal
+alias bank:old = assets:bank
+include after.journal
+
+2024-01-15 * main
+    bank:old  $1
+    equity:opening
+`
+	txContent := `2024-01-15 * tx
+    bank:old  $1
+    equity:opening
+`
+	afterContent := `alias /^equity:(.*)$/ = equity:\1:imported
+include nested.journal
+end aliases
+
+2024-01-16 * after
+    bank:old  $1
+    equity:opening
+`
+	for path, content := range map[string]string{
+		mainFile:   mainContent,
+		beforeFile: txContent,
+		afterFile:  afterContent,
+		nestedFile: txContent,
+	} {
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	loader := NewLoader()
+	result, errs := loader.Load(mainFile)
+	if len(errs) > 0 {
+		t.Fatalf("unexpected errors: %v", errs)
+	}
+
+	accounts := func(path string) []string {
+		j := result.Primary
+		if path != mainFile {
+			j = result.Files[path]
+		}
+		if j == nil || len(j.Transactions) != 1 {
+			t.Fatalf("expected 1 transaction in %s", path)
+		}
+		var names []string
+		for _, p := range j.Transactions[0].Postings {
+			names = append(names, p.Account.Name)
+		}
+		return names
+	}
+
+	tests := []struct {
+		path string
+		want string
+	}{
+		{mainFile, "assets:bank equity:opening"},
+		{beforeFile, "bank:old equity:opening"},
+		{afterFile, "bank:old equity:opening"},
+		{nestedFile, "assets:bank equity:opening:imported"},
+	}
+	for _, tt := range tests {
+		if got := strings.Join(accounts(tt.path), " "); got != tt.want {
+			t.Errorf("%s: expected %q, got %q", filepath.Base(tt.path), tt.want, got)
+		}
+	}
+
+	if got := len(result.OptionsFor(nestedFile).Aliases); got != 2 {
+		t.Errorf("expected nested.journal to inherit 2 aliases, got %d", got)
+	}
+	if got := len(result.OptionsFor(beforeFile).Aliases); got != 0 {
+		t.Errorf("expected before.journal to inherit no aliases, got %d", got)
+	}
+}
+
+func TestLoader_ApplyAccountPrefixesIncludedFiles(t *testing.T) {
+	dir := t.TempDir()
+	mainFile := filepath.Join(dir, "main.journal")
+	businessFile := filepath.Join(dir, "business.journal")
+
+	mainContent := `apply account business
+include business.journal
+end apply account
+
+2024-01-15 * main
+    expenses:food  $1
+    assets:cash
+`
+	businessContent := `2024-01-15 * business
+    expenses:food  $1
+    assets:cash
+`
+	if err := os.WriteFile(mainFile, []byte(mainContent), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(businessFile, []byte(businessContent), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	loader := NewLoader()
+	result, errs := loader.Load(mainFile)
+	if len(errs) > 0 {
+		t.Fatalf("unexpected errors: %v", errs)
+	}
+
+	business := result.Files[businessFile]
+	if business == nil || len(business.Transactions) != 1 {
+		t.Fatalf("expected 1 transaction in business.journal")
+	}
+	posting := business.Transactions[0].Postings[0]
+	if posting.Account.Name != "business:expenses:food" {
+		t.Errorf("expected prefixed account, got %q", posting.Account.Name)
+	}
+	if posting.Account.Written() != "expenses:food" {
+		t.Errorf("expected written name to be kept, got %q", posting.Account.Written())
+	}
+
+	if got := result.Primary.Transactions[0].Postings[0].Account.Name; got != "expenses:food" {
+		t.Errorf("expected main.journal posting to be unprefixed, got %q", got)
+	}
+	if got := result.OptionsFor(businessFile).ParentAccounts; len(got) != 1 || got[0] != "business" {
+		t.Errorf("expected business.journal to inherit prefix, got %v", got)
+	}
+}
+
+func TestLoader_YearDirectiveAppliesToIncludes(t *testing.T) {
+	dir := t.TempDir()
+	mainFile := filepath.Join(dir, "main.journal")
+	partialFile := filepath.Join(dir, "partial.journal")
+
+	mainContent := `Y 2023
+include partial.journal
+`
+	partialContent := `03/15 * groceries
+    expenses:food  $10
+    assets:cash
+`
+	if err := os.WriteFile(mainFile, []byte(mainContent), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(partialFile, []byte(partialContent), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	loader := NewLoader()
+	result, errs := loader.Load(mainFile)
+	if len(errs) > 0 {
+		t.Fatalf("unexpected errors: %v", errs)
+	}
+
+	partial := result.Files[partialFile]
+	if partial == nil || len(partial.Transactions) != 1 {
+		t.Fatalf("expected 1 transaction in partial.journal")
+	}
+	date := partial.Transactions[0].Date
+	if date.Year != 2023 || date.Month != 3 || date.Day != 15 {
+		t.Errorf("expected 03/15 to read as 2023-03-15, got %04d-%02d-%02d", date.Year, date.Month, date.Day)
+	}
+	if got := result.OptionsFor(partialFile).DefaultYear; got != 2023 {
+		t.Errorf("expected partial.journal to inherit year 2023, got %d", got)
+	}
+}
+
+func TestLoader_DecimalMarkAppliesToIncludes(t *testing.T) {
+	dir := t.TempDir()
+	mainFile := filepath.Join(dir, "main.journal")
+	euFile := filepath.Join(dir, "eu.journal")
+
+	mainContent := `decimal-mark ,
+include eu.journal
+`
+	euContent := `2024-01-15 * eu
+    expenses:food  1.234 EUR
+    assets:cash
+`
+	if err := os.WriteFile(mainFile, []byte(mainContent), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(euFile, []byte(euContent), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	loader := NewLoader()
+	result, errs := loader.Load(mainFile)
+	if len(errs) > 0 {
+		t.Fatalf("unexpected errors: %v", errs)
+	}
+
+	eu := result.Files[euFile]
+	if eu == nil || len(eu.Transactions) != 1 {
+		t.Fatalf("expected 1 transaction in eu.journal")
+	}
+	if got := eu.Transactions[0].Postings[0].Amount.Quantity.String(); got != "1234" {
+		t.Errorf("expected 1.234 to read as 1234 under decimal-mark ',', got %s", got)
+	}
+	if got := result.OptionsFor(euFile).DecimalMark; got != ',' {
+		t.Errorf("expected eu.journal to inherit decimal mark ',', got %q", got)
+	}
+}
+
+func TestLoader_TimeclockIncludes(t *testing.T) {
+	dir := t.TempDir()
+	mainFile := filepath.Join(dir, "main.journal")
+	hoursFile := filepath.Join(dir, "hours.txt")
+	workFile := filepath.Join(dir, "work.timeclock")
+
+	mainContent := `include timeclock:hours.txt
+include work.timeclock
+`
+	hoursContent := `i 2024-01-15 09:00 client:acme  design review
+o 2024-01-15 12:30
+`
+	workContent := `i 2024-01-16 10:00 client:globex
+o 2024-01-16 11:00
+`
+	for path, content := range map[string]string{
+		mainFile:  mainContent,
+		hoursFile: hoursContent,
+		workFile:  workContent,
+	} {
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	loader := NewLoader()
+	result, errs := loader.Load(mainFile)
+	if len(errs) > 0 {
+		t.Fatalf("unexpected errors: %v", errs)
+	}
+
+	for _, tt := range []struct {
+		path    string
+		account string
+		hours   string
+	}{
+		{hoursFile, "client:acme", "3.5"},
+		{workFile, "client:globex", "1"},
+	} {
+		journal := result.Files[tt.path]
+		if journal == nil || len(journal.Transactions) != 1 {
+			t.Fatalf("expected 1 session in %s", filepath.Base(tt.path))
+		}
+		p := journal.Transactions[0].Postings[0]
+		if p.Account.Name != tt.account || p.Amount == nil || p.Amount.Quantity.String() != tt.hours {
+			t.Errorf("%s: expected %s h on %s, got %+v", filepath.Base(tt.path), tt.hours, tt.account, p)
+		}
+		if got := result.OptionsFor(tt.path).Format; got != parser.FormatTimeclock {
+			t.Errorf("%s: expected timeclock format, got %v", filepath.Base(tt.path), got)
+		}
+	}
+}
+
+func TestLoader_TimedotInclude(t *testing.T) {
+	dir := t.TempDir()
+	mainFile := filepath.Join(dir, "main.journal")
+	timeFile := filepath.Join(dir, "2024.timedot")
+
+	if err := os.WriteFile(mainFile, []byte("Y 2024\ninclude 2024.timedot\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(timeFile, []byte("01/15\nfos:hledger  .... ..\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	loader := NewLoader()
+	result, errs := loader.Load(mainFile)
+	if len(errs) > 0 {
+		t.Fatalf("unexpected errors: %v", errs)
+	}
+
+	journal := result.Files[timeFile]
+	if journal == nil || len(journal.Transactions) != 1 {
+		t.Fatalf("expected 1 entry in 2024.timedot")
+	}
+	tx := journal.Transactions[0]
+	if tx.Date.Year != 2024 || tx.Postings[0].Amount.Quantity.String() != "1.5" {
+		t.Errorf("expected 1.5 h on 2024-01-15, got %+v", tx)
+	}
+	if got := result.OptionsFor(timeFile).Format; got != parser.FormatTimedot {
+		t.Errorf("expected timedot format, got %v", got)
+	}
+}
+
+func TestResolvedJournal_TransactionsInParseOrder(t *testing.T) {
+	dir := t.TempDir()
+	mainFile := filepath.Join(dir, "main.journal")
+	openingFile := filepath.Join(dir, "opening.journal")
+	monthFile := filepath.Join(dir, "months", "01.journal")
+
+	mainContent := `2024-01-01 first
+    assets:cash  $1
+    equity:opening
+
+include opening.journal
+
+2024-01-01 middle
+    assets:cash  $2
+    equity:opening
+
+include months/*.journal
+
+2024-01-01 last
+    assets:cash  $3
+    equity:opening
+`
+	for path, content := range map[string]string{
+		mainFile:    mainContent,
+		openingFile: "2024-01-01 opening\n    assets:cash  $10\n    equity:opening\n",
+		monthFile:   "2024-01-01 january\n    assets:cash  $20\n    equity:opening\n",
+	} {
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	loader := NewLoader()
+	result, errs := loader.Load(mainFile)
+	if len(errs) > 0 {
+		t.Fatalf("unexpected errors: %v", errs)
+	}
+
+	payees := func(transactions []ast.Transaction) string {
+		var names []string
+		for _, tx := range transactions {
+			names = append(names, tx.Description)
+		}
+		return strings.Join(names, ",")
+	}
+
+	if got, want := payees(result.AllTransactions()), "first,opening,middle,january,last"; got != want {
+		t.Errorf("expected %s, got %s", want, got)
+	}
+
+	live, _ := parser.Parse("2024-01-01 edited\n    assets:cash  $5\n    equity:opening\n")
+	if got, want := payees(result.TransactionsInParseOrder(openingFile, live)), "first,edited,middle,january,last"; got != want {
+		t.Errorf("expected %s, got %s", want, got)
+	}
+}
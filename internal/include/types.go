@@ -1,6 +1,14 @@
 package include
 
-import "github.com/juev/hledger-lsp/internal/ast"
+import (
+	"path/filepath"
+	"sort"
+
+	"github.com/bmatcuk/doublestar/v4"
+
+	"github.com/juev/hledger-lsp/internal/ast"
+	"github.com/juev/hledger-lsp/internal/parser"
+)
 
 type ErrorKind int
 
@@ -30,27 +38,131 @@ type FileSource struct {
 }
 
 type ResolvedJournal struct {
-	Primary   *ast.Journal
-	Files     map[string]*ast.Journal
-	FileOrder []string
-	Errors    []LoadError
+	Primary *ast.Journal
+	// PrimaryPath is the path of the primary file, which its include
+	// directives are resolved against.
+	PrimaryPath string
+	Files       map[string]*ast.Journal
+	FileOrder   []string
+	Errors      []LoadError
+	// Inherited holds, for included files, the aliases and `apply account`
+	// prefixes in effect at the include directive that pulled them in.
+	Inherited map[string]parser.Options
 }
 
 func NewResolvedJournal(primary *ast.Journal) *ResolvedJournal {
 	return &ResolvedJournal{
-		Primary: primary,
-		Files:   make(map[string]*ast.Journal),
+		Primary:   primary,
+		Files:     make(map[string]*ast.Journal),
+		Inherited: make(map[string]parser.Options),
+	}
+}
+
+// OptionsFor returns the parser options a file inherits from the files
+// including it.
+func (r *ResolvedJournal) OptionsFor(path string) parser.Options {
+	if r == nil {
+		return parser.Options{}
 	}
+	return r.Inherited[path]
 }
 
+// AllTransactions returns the transactions of every file in parse order.
 func (r *ResolvedJournal) AllTransactions() []ast.Transaction {
+	return r.TransactionsInParseOrder("", nil)
+}
+
+// TransactionsInParseOrder returns the transactions of every file in the
+// order hledger reads them: the transactions of an included file take the
+// place of its include directive. When path is set, the file at path is
+// read from live instead, so that an open document's content stands in
+// for the loaded copy. Files no include directive reaches come last.
+func (r *ResolvedJournal) TransactionsInParseOrder(path string, live *ast.Journal) []ast.Transaction {
 	var result []ast.Transaction
+	visited := make(map[string]bool)
+
+	var read func(filePath string, journal *ast.Journal)
+	read = func(filePath string, journal *ast.Journal) {
+		visited[filePath] = true
+		if path != "" && filePath == path && live != nil {
+			journal = live
+		}
+		transactions := journal.Transactions
+		i := 0
+		for _, inc := range journal.Includes {
+			for i < len(transactions) && transactions[i].Range.Start.Offset < inc.Range.Start.Offset {
+				result = append(result, transactions[i])
+				i++
+			}
+			for _, target := range r.includeTargets(filePath, inc) {
+				if j, ok := r.Files[target]; ok && !visited[target] {
+					read(target, j)
+				}
+			}
+		}
+		result = append(result, transactions[i:]...)
+	}
+
+	if r.Primary != nil {
+		read(r.PrimaryPath, r.Primary)
+	}
+	for _, p := range r.FileOrder {
+		if j, ok := r.Files[p]; ok && !visited[p] {
+			read(p, j)
+		}
+	}
+	return result
+}
+
+// includeTargets returns the loaded files an include directive in the file
+// at basePath refers to, in the order the loader reads them.
+func (r *ResolvedJournal) includeTargets(basePath string, inc ast.Include) []string {
+	if !IsGlobPattern(inc.Path) {
+		target, err := ResolvePathSafe(basePath, inc.Path)
+		if err != nil {
+			return nil
+		}
+		return []string{target}
+	}
+
+	pattern := ConvertHledgerGlob(inc.Path)
+	if !filepath.IsAbs(pattern) {
+		pattern = filepath.Join(filepath.Dir(basePath), pattern)
+	}
+	var matches []string
+	for p := range r.Files {
+		if p == basePath {
+			continue
+		}
+		if ok, _ := doublestar.PathMatch(pattern, p); ok {
+			matches = append(matches, p)
+		}
+	}
+	sort.Strings(matches)
+	return matches
+}
+
+func (r *ResolvedJournal) AllPeriodicTransactions() []ast.PeriodicTransaction {
+	var result []ast.PeriodicTransaction
+	if r.Primary != nil {
+		result = append(result, r.Primary.PeriodicTransactions...)
+	}
+	for _, path := range r.FileOrder {
+		if j, ok := r.Files[path]; ok {
+			result = append(result, j.PeriodicTransactions...)
+		}
+	}
+	return result
+}
+
+func (r *ResolvedJournal) AllAutoPostingRules() []ast.AutoPostingRule {
+	var result []ast.AutoPostingRule
 	if r.Primary != nil {
-		result = append(result, r.Primary.Transactions...)
+		result = append(result, r.Primary.AutoPostingRules...)
 	}
 	for _, path := range r.FileOrder {
 		if j, ok := r.Files[path]; ok {
-			result = append(result, j.Transactions...)
+			result = append(result, j.AutoPostingRules...)
 		}
 	}
 	return result
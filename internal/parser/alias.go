@@ -0,0 +1,110 @@
+package parser
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/juev/hledger-lsp/internal/ast"
+)
+
+// accountAlias is an alias directive ready to be applied to account names.
+type accountAlias struct {
+	dir         ast.AliasDirective
+	re          *regexp.Regexp
+	replacement string
+}
+
+func compileAlias(dir ast.AliasDirective) (accountAlias, error) {
+	alias := accountAlias{dir: dir}
+	if !dir.IsRegex {
+		return alias, nil
+	}
+
+	re, err := regexp.Compile("(?i)" + dir.Original)
+	if err != nil {
+		return alias, err
+	}
+	alias.re = re
+	alias.replacement = convertBackreferences(dir.Replacement)
+	return alias, nil
+}
+
+// convertBackreferences turns hledger's \1 style group references into Go's
+// ${1} and escapes literal dollar signs.
+func convertBackreferences(replacement string) string {
+	var sb strings.Builder
+	for i := 0; i < len(replacement); i++ {
+		ch := replacement[i]
+		switch {
+		case ch == '$':
+			sb.WriteString("$$")
+		case ch == '\\' && i+1 < len(replacement) && replacement[i+1] >= '0' && replacement[i+1] <= '9':
+			j := i + 1
+			for j < len(replacement) && replacement[j] >= '0' && replacement[j] <= '9' {
+				j++
+			}
+			sb.WriteString("${" + replacement[i+1:j] + "}")
+			i = j - 1
+		default:
+			sb.WriteByte(ch)
+		}
+	}
+	return sb.String()
+}
+
+func (a accountAlias) apply(name string) string {
+	if a.re != nil {
+		return a.re.ReplaceAllString(name, a.replacement)
+	}
+	if name == a.dir.Original {
+		return a.dir.Replacement
+	}
+	if rest, ok := strings.CutPrefix(name, a.dir.Original+":"); ok {
+		return a.dir.Replacement + ":" + rest
+	}
+	return name
+}
+
+// applyAliases rewrites an account name the way hledger does: the most
+// recently defined alias is applied first and each alias sees the result of
+// the previous one.
+func applyAliases(aliases []accountAlias, name string) string {
+	for i := len(aliases) - 1; i >= 0; i-- {
+		name = aliases[i].apply(name)
+	}
+	return name
+}
+
+// parseAliasText splits the text after `alias` into its original and
+// replacement parts.
+func parseAliasText(text string) (ast.AliasDirective, error) {
+	dir := ast.AliasDirective{}
+
+	if strings.HasPrefix(text, "/") {
+		for i := 1; i < len(text); i++ {
+			if text[i] != '/' || text[i-1] == '\\' {
+				continue
+			}
+			rest := strings.TrimLeft(text[i+1:], " \t")
+			if replacement, ok := strings.CutPrefix(rest, "="); ok {
+				dir.Original = text[1:i]
+				dir.Replacement = strings.TrimSpace(replacement)
+				dir.IsRegex = true
+				return dir, nil
+			}
+		}
+		return dir, fmt.Errorf("expected /REGEX/ = REPLACEMENT")
+	}
+
+	original, replacement, ok := strings.Cut(text, "=")
+	if !ok {
+		return dir, fmt.Errorf("expected OLD = NEW")
+	}
+	dir.Original = strings.TrimSpace(original)
+	dir.Replacement = strings.TrimSpace(replacement)
+	if dir.Original == "" {
+		return dir, fmt.Errorf("expected account name before =")
+	}
+	return dir, nil
+}
@@ -0,0 +1,60 @@
+package parser
+
+import (
+	"path/filepath"
+	"strings"
+
+	"github.com/juev/hledger-lsp/internal/ast"
+)
+
+// Format is the syntax an hledger input file is read in.
+type Format int
+
+const (
+	FormatJournal Format = iota
+	FormatTimeclock
+	FormatTimedot
+)
+
+var formatPrefixes = map[string]Format{
+	"journal":   FormatJournal,
+	"timeclock": FormatTimeclock,
+	"timedot":   FormatTimedot,
+}
+
+// splitFormatPrefix splits a reader prefix such as `timeclock:` off an
+// include path. The prefix is empty when the path has no known prefix.
+func splitFormatPrefix(path string) (prefix, rest string) {
+	name, rest, found := strings.Cut(path, ":")
+	if _, known := formatPrefixes[name]; !found || !known {
+		return "", path
+	}
+	return name, rest
+}
+
+// FormatForPath returns the format hledger reads a file in, judging by its
+// extension.
+func FormatForPath(path string) Format {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".timeclock":
+		return FormatTimeclock
+	case ".timedot":
+		return FormatTimedot
+	default:
+		return FormatJournal
+	}
+}
+
+// FormatForInclude returns the format of a file pulled in by an include
+// directive: the one its reader prefix names, or else the one its extension
+// implies.
+func FormatForInclude(inc ast.Include, path string) Format {
+	if format, ok := formatPrefixes[inc.Prefix]; ok {
+		return format
+	}
+	return FormatForPath(path)
+}
+
+// HoursCommodity is the commodity of the hours timeclock sessions and timedot
+// entries add to their accounts.
+const HoursCommodity = "h"
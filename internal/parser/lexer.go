@@ -7,11 +7,13 @@ import (
 )
 
 type Lexer struct {
-	input   string
-	pos     int
-	line    int
-	column  int
-	atStart bool
+	input      string
+	pos        int
+	line       int
+	column     int
+	atStart    bool
+	periodNext bool
+	queryNext  bool
 }
 
 func NewLexer(input string) *Lexer {
@@ -33,6 +35,16 @@ func (l *Lexer) Next() Token {
 		return l.scanLineStart()
 	}
 
+	if l.periodNext {
+		l.periodNext = false
+		return l.scanPeriod()
+	}
+
+	if l.queryNext {
+		l.queryNext = false
+		return l.scanQuery()
+	}
+
 	return l.scanInLine()
 }
 
@@ -43,6 +55,20 @@ func (l *Lexer) scanLineStart() Token {
 		return l.scanComment()
 	}
 
+	if l.peek() == '~' {
+		startPos := l.position()
+		l.advance()
+		l.periodNext = true
+		return Token{Type: TokenTilde, Value: "~", Pos: startPos, End: l.position()}
+	}
+
+	if l.peek() == '=' {
+		startPos := l.position()
+		l.advance()
+		l.queryNext = true
+		return Token{Type: TokenEquals, Value: "=", Pos: startPos, End: l.position()}
+	}
+
 	if l.isWhitespace(l.peek()) && l.peek() != '\n' {
 		return l.scanIndent()
 	}
@@ -91,6 +117,10 @@ func (l *Lexer) scanInLine() Token {
 	case ch == '|':
 		l.advance()
 		return l.makeToken(TokenPipe, "|")
+	case ch == '{':
+		return l.scanBrace(TokenLBrace, TokenLDoubleBrace)
+	case ch == '}':
+		return l.scanBrace(TokenRBrace, TokenRDoubleBrace)
 	case ch == '@':
 		return l.scanAt()
 	case ch == '=':
@@ -102,7 +132,7 @@ func (l *Lexer) scanInLine() Token {
 	case ch == '"':
 		return l.scanQuotedCommodity()
 	case ch == '-' || ch == '+':
-		if l.nextIsCurrencySymbol() || l.nextIsLetterCommodity() || l.nextIsDigit() {
+		if l.nextIsCurrencySymbol() || l.nextIsLetterCommodity() || l.nextIsDigit() || l.nextIs('"') {
 			return l.scanSign()
 		}
 		return l.scanText()
@@ -138,6 +168,55 @@ func (l *Lexer) scanDate() Token {
 	return Token{Type: TokenDate, Value: value, Pos: startPos, End: l.position()}
 }
 
+// scanPeriod scans the period expression of a periodic transaction header.
+// The expression ends at two spaces, a tab, a comment or the end of line;
+// anything after it is the transaction description.
+func (l *Lexer) scanPeriod() Token {
+	l.skipSpaces()
+
+	start := l.pos
+	startPos := l.position()
+
+	for l.pos < len(l.input) {
+		ch := l.peek()
+		if ch == '\n' || ch == '\t' || ch == ';' {
+			break
+		}
+		if ch == ' ' && l.pos+1 < len(l.input) && l.input[l.pos+1] == ' ' {
+			break
+		}
+		l.advance()
+	}
+
+	value := strings.TrimRight(l.input[start:l.pos], " \r")
+	if value == "" {
+		return l.scanInLine()
+	}
+	return Token{Type: TokenPeriod, Value: value, Pos: startPos, End: l.position()}
+}
+
+// scanQuery scans the query of an auto posting rule header, which runs up to
+// a comment or the end of line.
+func (l *Lexer) scanQuery() Token {
+	l.skipSpaces()
+
+	start := l.pos
+	startPos := l.position()
+
+	for l.pos < len(l.input) && l.peek() != '\n' && l.peek() != ';' {
+		l.advance()
+	}
+
+	value := strings.TrimRight(l.input[start:l.pos], " \t\r")
+	if value == "" {
+		return l.scanInLine()
+	}
+	end := startPos
+	end.Column += utf8.RuneCountInString(value)
+	end.Offset += len(value)
+	return Token{Type: TokenQuery, Value: value, Pos: startPos, End: end}
+}
+
 func (l *Lexer) scanStatus() Token {
 	startPos := l.position()
 	ch := l.peek()
@@ -175,6 +254,53 @@ func (l *Lexer) scanComment() Token {
 	return Token{Type: TokenComment, Value: value, Pos: startPos, End: l.position()}
 }
 
+// scanCommentBlock consumes a `comment` directive and every line up to and
+// including the matching `end comment`, or the rest of the input if there is
+// none. The whole block is a single token so its content is never lexed.
+func (l *Lexer) scanCommentBlock(start int, startPos Position) Token {
+	for l.pos < len(l.input) && l.peek() != '\n' {
+		l.advance()
+	}
+
+	for l.pos < len(l.input) {
+		lineStart := l.pos + 1
+		lineEnd := strings.IndexByte(l.input[lineStart:], '\n')
+		if lineEnd < 0 {
+			lineEnd = len(l.input)
+		} else {
+			lineEnd += lineStart
+		}
+
+		l.pos = lineStart
+		l.line++
+		l.column = 1
+		for l.pos < lineEnd {
+			l.advance()
+		}
+
+		if strings.TrimSpace(l.input[lineStart:lineEnd]) == "end comment" {
+			break
+		}
+	}
+
+	return Token{Type: TokenCommentBlock, Value: l.input[start:l.pos], Pos: startPos, End: l.position()}
+}
+
+// atLineEnd reports whether only blanks remain on the current line.
+func (l *Lexer) atLineEnd() bool {
+	for i := l.pos; i < len(l.input); i++ {
+		switch l.input[i] {
+		case ' ', '\t', '\r':
+			continue
+		case '\n':
+			return true
+		default:
+			return false
+		}
+	}
+	return true
+}
+
 func (l *Lexer) scanIndent() Token {
 	start := l.pos
 	startPos := l.position()
@@ -288,12 +414,15 @@ func (l *Lexer) scanCurrencySymbol() Token {
 	return Token{Type: TokenCommodity, Value: string(r), Pos: startPos, End: l.position()}
 }
 
+// scanQuotedCommodity scans a commodity symbol in double quotes, which may
+// hold digits, spaces and punctuation but, as in hledger, no semicolon: an
+// unterminated quote stops before a following comment.
 func (l *Lexer) scanQuotedCommodity() Token {
 	startPos := l.position()
 	l.advance()
 
 	start := l.pos
-	for l.pos < len(l.input) && l.peek() != '"' && l.peek() != '\n' {
+	for l.pos < len(l.input) && l.peek() != '"' && l.peek() != '\n' && l.peek() != ';' {
 		l.advance()
 	}
 	value := l.input[start:l.pos]
@@ -317,16 +446,37 @@ func (l *Lexer) scanAt() Token {
 	return Token{Type: TokenAt, Value: "@", Pos: startPos, End: l.position()}
 }
 
+// scanBrace scans a single or doubled lot cost brace.
+func (l *Lexer) scanBrace(single, double TokenType) Token {
+	startPos := l.position()
+	ch := l.peek()
+	l.advance()
+
+	if l.peek() == ch {
+		l.advance()
+		return Token{Type: double, Value: string([]byte{ch, ch}), Pos: startPos, End: l.position()}
+	}
+
+	return Token{Type: single, Value: string(ch), Pos: startPos, End: l.position()}
+}
+
 func (l *Lexer) scanEquals() Token {
 	startPos := l.position()
 	l.advance()
 
+	tokenType, value := TokenEquals, "="
 	if l.pos < len(l.input) && l.peek() == '=' {
 		l.advance()
-		return Token{Type: TokenDoubleEquals, Value: "==", Pos: startPos, End: l.position()}
+		tokenType, value = TokenDoubleEquals, "=="
 	}
 
-	return Token{Type: TokenEquals, Value: "=", Pos: startPos, End: l.position()}
+	// `=*` and `==*` are subaccount-inclusive balance assertions.
+	if l.pos < len(l.input) && l.peek() == '*' {
+		l.advance()
+		value += "*"
+	}
+
+	return Token{Type: tokenType, Value: value, Pos: startPos, End: l.position()}
 }
 
 func (l *Lexer) scanDirectiveOrAccount() Token {
@@ -341,10 +491,28 @@ func (l *Lexer) scanDirectiveOrAccount() Token {
 	word := l.input[start:l.pos]
 
 	// Check for single-letter directives first (Y, P, D)
+	if word == "comment" && l.atLineEnd() {
+		return l.scanCommentBlock(start, startPos)
+	}
+
 	if isDirective(word) {
 		return Token{Type: TokenDirective, Value: word, Pos: startPos, End: l.position()}
 	}
 
+	// Hyphenated directives like decimal-mark
+	if l.pos < len(l.input) && l.peek() == '-' {
+		end := l.pos + 1
+		for end < len(l.input) && l.isLetter(l.input[end]) {
+			end++
+		}
+		if isDirective(l.input[start:end]) {
+			for l.pos < end {
+				l.advance()
+			}
+			return Token{Type: TokenDirective, Value: l.input[start:end], Pos: startPos, End: l.position()}
+		}
+	}
+
 	// If not a directive, continue scanning with digits for potential account
 	for l.pos < len(l.input) && l.isDigit(l.peek()) {
 		l.advance()
@@ -485,6 +653,10 @@ func (l *Lexer) nextIsCurrencySymbol() bool {
 	return l.isCurrencySymbol(r)
 }
 
+func (l *Lexer) nextIs(ch byte) bool {
+	return l.pos+1 < len(l.input) && l.input[l.pos+1] == ch
+}
+
 func (l *Lexer) nextIsDigit() bool {
 	if l.pos+1 >= len(l.input) {
 		return false
@@ -503,6 +675,9 @@ func (l *Lexer) nextIsLetterCommodity() bool {
 	for pos < len(l.input) && l.isLetter(l.input[pos]) {
 		pos++
 	}
+	for pos < len(l.input) && l.input[pos] == ' ' {
+		pos++
+	}
 	if pos >= len(l.input) {
 		return false
 	}
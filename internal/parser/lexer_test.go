@@ -345,6 +345,22 @@ func TestLexer_QuotedCommodity(t *testing.T) {
 	assertTokenTypesAndValues(t, expected, tokens)
 }
 
+func TestLexer_UnterminatedQuotedCommodity(t *testing.T) {
+	input := `    assets:items  3 "ABC1 ; note`
+	lexer := NewLexer(input)
+	tokens := collectTokens(lexer)
+
+	expected := []Token{
+		{Type: TokenIndent, Value: "    "},
+		{Type: TokenAccount, Value: "assets:items"},
+		{Type: TokenNumber, Value: "3"},
+		{Type: TokenCommodity, Value: "ABC1 "},
+		{Type: TokenComment, Value: " note"},
+		{Type: TokenEOF},
+	}
+	assertTokenTypesAndValues(t, expected, tokens)
+}
+
 func TestLexer_LowercaseCommodity(t *testing.T) {
 	tests := []struct {
 		name   string
@@ -1347,3 +1363,73 @@ func TestLexer_DateBoundaryConditions(t *testing.T) {
 		})
 	}
 }
+
+func TestLexer_PeriodicTransactionHeader(t *testing.T) {
+	input := "~ every 2 weeks from 2024-01-01  * paycheck ; note\n    assets:bank  $100"
+	lexer := NewLexer(input)
+	tokens := collectTokens(lexer)
+
+	expected := []Token{
+		{Type: TokenTilde, Value: "~"},
+		{Type: TokenPeriod, Value: "every 2 weeks from 2024-01-01"},
+		{Type: TokenStatus, Value: "*"},
+		{Type: TokenText, Value: "paycheck"},
+		{Type: TokenComment, Value: " note"},
+		{Type: TokenNewline, Value: "\n"},
+		{Type: TokenIndent, Value: "    "},
+		{Type: TokenAccount, Value: "assets:bank"},
+		{Type: TokenCommodity, Value: "$"},
+		{Type: TokenNumber, Value: "100"},
+		{Type: TokenEOF},
+	}
+	assertTokenTypesAndValues(t, expected, tokens)
+}
+
+func TestLexer_AutoPostingRuleHeader(t *testing.T) {
+	input := "= expenses:food  ; note\n    liabilities:tax  *-0.25"
+	lexer := NewLexer(input)
+	tokens := collectTokens(lexer)
+
+	expected := []Token{
+		{Type: TokenEquals, Value: "="},
+		{Type: TokenQuery, Value: "expenses:food"},
+		{Type: TokenComment, Value: " note"},
+		{Type: TokenNewline, Value: "\n"},
+		{Type: TokenIndent, Value: "    "},
+		{Type: TokenAccount, Value: "liabilities:tax"},
+		{Type: TokenStatus, Value: "*"},
+		{Type: TokenSign, Value: "-"},
+		{Type: TokenNumber, Value: "0.25"},
+		{Type: TokenEOF},
+	}
+	assertTokenTypesAndValues(t, expected, tokens)
+}
+
+func TestLexer_CommentBlock(t *testing.T) {
+	input := "comment\nnot: lexed ; at all\nend comment\ncomment:account  $1"
+	lexer := NewLexer(input)
+
+	tok := lexer.Next()
+	require.Equal(t, TokenCommentBlock, tok.Type)
+	assert.Equal(t, "comment\nnot: lexed ; at all\nend comment", tok.Value)
+	assert.Equal(t, 3, tok.End.Line)
+
+	assert.Equal(t, TokenNewline, lexer.Next().Type)
+
+	// A word that merely starts with "comment" does not open a block.
+	assert.NotEqual(t, TokenCommentBlock, lexer.Next().Type)
+}
+
+func TestLexer_LotBraces(t *testing.T) {
+	input := "    assets:broker  10 AAPL {{1500 USD}} {150 USD}"
+	lexer := NewLexer(input)
+
+	var types []TokenType
+	for tok := lexer.Next(); tok.Type != TokenEOF; tok = lexer.Next() {
+		types = append(types, tok.Type)
+	}
+	assert.Contains(t, types, TokenLDoubleBrace)
+	assert.Contains(t, types, TokenRDoubleBrace)
+	assert.Contains(t, types, TokenLBrace)
+	assert.Contains(t, types, TokenRBrace)
+}
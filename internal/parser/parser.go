@@ -11,9 +11,19 @@ import (
 	"github.com/juev/hledger-lsp/internal/ast"
 )
 
+// ParseError is a syntax error spanning from Pos to End. Code identifies
+// the kind of error, such as PARSE_EXPECTED_AMOUNT, independently of the
+// wording of Message.
 type ParseError struct {
+	Code    string
 	Message string
 	Pos     Position
+	End     Position
+}
+
+// Range returns the span of the error.
+func (e ParseError) Range() ast.Range {
+	return ast.Range{Start: toASTPosition(e.Pos), End: toASTPosition(e.End)}
 }
 
 func (e ParseError) Error() string {
@@ -21,17 +31,66 @@ func (e ParseError) Error() string {
 }
 
 type Parser struct {
-	lexer       *Lexer
-	current     Token
-	errors      []ParseError
-	defaultYear int
-	inputLen    int
+	lexer          *Lexer
+	current        Token
+	errors         []ParseError
+	defaultYear    int
+	aliases        []accountAlias
+	parentAccounts []string
+	decimalMark    rune
+	inputLen       int
+	// inAutoPostingRule is set while parsing the postings of an auto
+	// posting rule, the only place `*N` multipliers are allowed.
+	inAutoPostingRule bool
+}
+
+// Options carries parser state inherited from the file that includes the
+// one being parsed.
+type Options struct {
+	// Aliases are the alias directives in effect at the include directive,
+	// oldest first.
+	Aliases []ast.AliasDirective
+	// ParentAccounts is the stack of `apply account` prefixes in effect at
+	// the include directive, outermost first.
+	ParentAccounts []string
+	// DecimalMark is the mark set by a decimal-mark directive before the
+	// include directive, or zero if there was none.
+	DecimalMark rune
+	// DefaultYear is the year set by a Y directive before the include
+	// directive, or zero if there was none.
+	DefaultYear int
+	// Format is the syntax the file is read in, from its include prefix or
+	// its extension.
+	Format Format
+}
+
+// IsZero reports whether the options carry no inherited state.
+func (o Options) IsZero() bool {
+	return len(o.Aliases) == 0 && len(o.ParentAccounts) == 0 && o.DecimalMark == 0 && o.DefaultYear == 0 && o.Format == FormatJournal
 }
 
 func Parse(input string) (*ast.Journal, []ParseError) {
+	return ParseWithOptions(input, Options{})
+}
+
+func ParseWithOptions(input string, opts Options) (*ast.Journal, []ParseError) {
+	switch opts.Format {
+	case FormatTimeclock:
+		return parseTimeclock(input)
+	case FormatTimedot:
+		return parseTimedot(input, opts.DefaultYear)
+	}
 	p := &Parser{
-		lexer:    NewLexer(input),
-		inputLen: len(input),
+		lexer:          NewLexer(input),
+		inputLen:       len(input),
+		parentAccounts: append([]string(nil), opts.ParentAccounts...),
+		decimalMark:    opts.DecimalMark,
+		defaultYear:    opts.DefaultYear,
+	}
+	for _, dir := range opts.Aliases {
+		if alias, err := compileAlias(dir); err == nil {
+			p.aliases = append(p.aliases, alias)
+		}
 	}
 	p.advance()
 	return p.parseJournal(), p.errors
@@ -49,11 +108,19 @@ func (p *Parser) parseJournal() *ast.Journal {
 			p.advance()
 		case TokenComment:
 			journal.Comments = append(journal.Comments, p.parseComment())
+		case TokenCommentBlock:
+			journal.Comments = append(journal.Comments, p.parseCommentBlock())
 		case TokenDate:
 			tx := p.parseTransaction()
 			if tx != nil {
 				journal.Transactions = append(journal.Transactions, *tx)
 			}
+		case TokenTilde:
+			ptx := p.parsePeriodicTransaction()
+			journal.PeriodicTransactions = append(journal.PeriodicTransactions, *ptx)
+		case TokenEquals:
+			rule := p.parseAutoPostingRule()
+			journal.AutoPostingRules = append(journal.AutoPostingRules, *rule)
 		case TokenDirective:
 			dir := p.parseDirective()
 			if dir != nil {
@@ -64,7 +131,7 @@ func (p *Parser) parseJournal() *ast.Journal {
 				}
 			}
 		default:
-			p.error("unexpected token: %s", p.current.Type)
+			p.unexpectedToken()
 			p.skipToNextLine()
 		}
 	}
@@ -80,7 +147,12 @@ func (p *Parser) parseTransaction() *ast.Transaction {
 
 	date := p.parseDate()
 	if date == nil {
+		// Without a date the transaction is dropped, but its postings are
+		// skipped with it rather than reported one by one.
 		p.skipToNextLine()
+		for p.current.Type == TokenIndent {
+			p.skipToNextLine()
+		}
 		return nil
 	}
 	tx.Date = *date
@@ -93,6 +165,72 @@ func (p *Parser) parseTransaction() *ast.Transaction {
 		}
 	}
 
+	p.parseTransactionBody(tx)
+	for i := range tx.Postings {
+		p.resolvePostingDates(tx, &tx.Postings[i])
+	}
+
+	tx.Range.End = toASTPosition(p.current.Pos)
+	return tx
+}
+
+// resolvePostingDates sets a posting's dates from its `date:` and `date2:`
+// tags. Partial dates take the year of the Y directive, or else that of the
+// transaction. Invalid values are left to the analyzer to report.
+func (p *Parser) resolvePostingDates(tx *ast.Transaction, posting *ast.Posting) {
+	year := p.defaultYear
+	if year == 0 {
+		year = tx.Date.Year
+	}
+	for _, tag := range posting.Tags {
+		date, ok := parseTagDate(tag.Value, year)
+		if !ok {
+			continue
+		}
+		date.Range = tag.Range
+		switch strings.ToLower(tag.Name) {
+		case "date":
+			posting.Date = &date
+		case "date2":
+			posting.Date2 = &date
+		}
+	}
+}
+
+// parseTagDate parses the value of a date tag: a full date, or a partial
+// MONTH-DAY date in the given year.
+func parseTagDate(value string, year int) (ast.Date, bool) {
+	parts := strings.FieldsFunc(strings.TrimSpace(value), func(r rune) bool {
+		return r == '-' || r == '/' || r == '.'
+	})
+
+	nums := make([]int, len(parts))
+	for i, part := range parts {
+		n, err := strconv.Atoi(part)
+		if err != nil {
+			return ast.Date{}, false
+		}
+		nums[i] = n
+	}
+
+	var date ast.Date
+	switch len(nums) {
+	case 2:
+		date = ast.Date{Year: year, Month: nums[0], Day: nums[1]}
+	case 3:
+		date = ast.Date{Year: nums[0], Month: nums[1], Day: nums[2]}
+	default:
+		return ast.Date{}, false
+	}
+	if date.Month < 1 || date.Month > 12 || date.Day < 1 || date.Day > 31 {
+		return ast.Date{}, false
+	}
+	return date, true
+}
+
+// parseTransactionBody parses everything after the date(s) of a transaction
+// header: status, code, description, header comment and the postings.
+func (p *Parser) parseTransactionBody(tx *ast.Transaction) {
 	if p.current.Type == TokenStatus {
 		tx.Status = p.parseStatus()
 	}
@@ -126,6 +264,10 @@ func (p *Parser) parseTransaction() *ast.Transaction {
 		tx.Comments = append(tx.Comments, p.parseComment())
 	}
 
+	if p.current.Type != TokenNewline && p.current.Type != TokenEOF {
+		p.unexpectedToken()
+	}
+
 	if p.current.Type == TokenNewline {
 		p.advance()
 	}
@@ -139,14 +281,66 @@ func (p *Parser) parseTransaction() *ast.Transaction {
 			p.advance()
 		}
 	}
+}
 
-	tx.Range.End = toASTPosition(p.current.Pos)
-	return tx
+func (p *Parser) parsePeriodicTransaction() *ast.PeriodicTransaction {
+	ptx := &ast.PeriodicTransaction{}
+	ptx.Range.Start = toASTPosition(p.current.Pos)
+	p.advance()
+
+	if p.current.Type == TokenPeriod {
+		rng := ast.Range{Start: toASTPosition(p.current.Pos), End: toASTPosition(p.current.End)}
+		period, err := parsePeriodExpr(p.current.Value, rng, p.defaultYear)
+		if err != nil {
+			p.errorAt("PARSE_INVALID_PERIOD", p.current.Pos, p.current.End, "invalid period expression: %s", err)
+		}
+		ptx.Period = period
+		p.advance()
+	} else {
+		p.error("PARSE_EXPECTED_PERIOD", "expected period expression")
+	}
+
+	tx := &ast.Transaction{Postings: make([]ast.Posting, 0, 3)}
+	p.parseTransactionBody(tx)
+
+	ptx.Status = tx.Status
+	ptx.Code = tx.Code
+	ptx.Description = tx.Description
+	ptx.Payee = tx.Payee
+	ptx.Note = tx.Note
+	ptx.Postings = tx.Postings
+	ptx.Comments = tx.Comments
+	ptx.Range.End = toASTPosition(p.current.Pos)
+	return ptx
+}
+
+func (p *Parser) parseAutoPostingRule() *ast.AutoPostingRule {
+	rule := &ast.AutoPostingRule{}
+	rule.Range.Start = toASTPosition(p.current.Pos)
+	p.advance()
+
+	if p.current.Type == TokenQuery {
+		rule.Query = p.current.Value
+		rule.QueryRange = ast.Range{Start: toASTPosition(p.current.Pos), End: toASTPosition(p.current.End)}
+		p.advance()
+	} else {
+		p.error("PARSE_EXPECTED_QUERY", "expected query")
+	}
+
+	tx := &ast.Transaction{Postings: make([]ast.Posting, 0, 2)}
+	p.inAutoPostingRule = true
+	p.parseTransactionBody(tx)
+	p.inAutoPostingRule = false
+
+	rule.Postings = tx.Postings
+	rule.Comments = tx.Comments
+	rule.Range.End = toASTPosition(p.current.Pos)
+	return rule
 }
 
 func (p *Parser) parseDate() *ast.Date {
 	if p.current.Type != TokenDate {
-		p.error("expected date")
+		p.error("PARSE_EXPECTED_DATE", "expected date")
 		return nil
 	}
 
@@ -168,17 +362,17 @@ func (p *Parser) parseDate() *ast.Date {
 	switch len(parts) {
 	case 2:
 		if p.defaultYear == 0 {
-			p.errorAt(pos, "partial date requires Y directive: %s", value)
+			p.errorAt("PARSE_PARTIAL_DATE", pos, end, "partial date requires Y directive: %s", value)
 			return nil
 		}
 		month, err := strconv.Atoi(parts[0])
 		if err != nil {
-			p.errorAt(pos, "invalid month: %s", parts[0])
+			p.errorAt("PARSE_INVALID_DATE", pos, end, "invalid month: %s", parts[0])
 			return nil
 		}
 		day, err := strconv.Atoi(parts[1])
 		if err != nil {
-			p.errorAt(pos, "invalid day: %s", parts[1])
+			p.errorAt("PARSE_INVALID_DATE", pos, end, "invalid day: %s", parts[1])
 			return nil
 		}
 		return &ast.Date{
@@ -190,17 +384,17 @@ func (p *Parser) parseDate() *ast.Date {
 	case 3:
 		year, err := strconv.Atoi(parts[0])
 		if err != nil {
-			p.errorAt(pos, "invalid year: %s", parts[0])
+			p.errorAt("PARSE_INVALID_DATE", pos, end, "invalid year: %s", parts[0])
 			return nil
 		}
 		month, err := strconv.Atoi(parts[1])
 		if err != nil {
-			p.errorAt(pos, "invalid month: %s", parts[1])
+			p.errorAt("PARSE_INVALID_DATE", pos, end, "invalid month: %s", parts[1])
 			return nil
 		}
 		day, err := strconv.Atoi(parts[2])
 		if err != nil {
-			p.errorAt(pos, "invalid day: %s", parts[2])
+			p.errorAt("PARSE_INVALID_DATE", pos, end, "invalid day: %s", parts[2])
 			return nil
 		}
 		return &ast.Date{
@@ -210,7 +404,7 @@ func (p *Parser) parseDate() *ast.Date {
 			Range: ast.Range{Start: toASTPosition(pos), End: toASTPosition(end)},
 		}
 	default:
-		p.errorAt(pos, "invalid date format: %s", value)
+		p.errorAt("PARSE_INVALID_DATE", pos, end, "invalid date format: %s", value)
 		return nil
 	}
 }
@@ -246,6 +440,7 @@ func (p *Parser) parsePosting() *ast.Posting {
 
 	posting := &ast.Posting{}
 	posting.Range.Start = toASTPosition(p.current.Pos)
+	errCount := len(p.errors)
 
 	if p.current.Type == TokenStatus {
 		posting.Status = p.parseStatus()
@@ -264,14 +459,15 @@ func (p *Parser) parsePosting() *ast.Posting {
 	}
 
 	if p.current.Type != TokenAccount {
-		p.error("expected account name")
-		p.skipToNextLine()
-		return nil
+		p.error("PARSE_EXPECTED_ACCOUNT", "expected account name")
+		posting.Missing = ast.PostingPartAccount
+		return p.recoverPosting(posting)
 	}
 
 	posting.Account = ast.Account{
-		Name:  p.current.Value,
-		Range: ast.Range{Start: toASTPosition(p.current.Pos), End: toASTPosition(p.current.End)},
+		Name:    p.resolveAccountName(p.current.Value),
+		RawName: p.current.Value,
+		Range:   ast.Range{Start: toASTPosition(p.current.Pos), End: toASTPosition(p.current.End)},
 	}
 	p.advance()
 
@@ -279,19 +475,47 @@ func (p *Parser) parsePosting() *ast.Posting {
 		p.advance()
 	}
 
-	if p.current.Type == TokenCommodity || p.current.Type == TokenNumber || p.current.Type == TokenSign {
+	if p.current.Type == TokenStatus && p.current.Value == "*" {
+		multiplierPos := p.current.Pos
+		if !p.inAutoPostingRule {
+			p.errorAt("PARSE_UNEXPECTED_MULTIPLIER", p.current.Pos, p.current.End,
+				"amount multipliers are only allowed in auto posting rules")
+		}
+		p.advance()
 		amount := p.parseAmount()
-		if amount != nil {
-			posting.Amount = amount
+		if amount == nil {
+			posting.Missing = ast.PostingPartAmount
+			return p.recoverPosting(posting)
+		}
+		if p.inAutoPostingRule {
+			amount.Multiplier = true
+			amount.Range.Start = toASTPosition(multiplierPos)
+		}
+		posting.Amount = amount
+	} else if p.current.Type == TokenCommodity || p.current.Type == TokenNumber || p.current.Type == TokenSign {
+		posting.Amount = p.parseAmount()
+		if posting.Amount == nil {
+			posting.Missing = ast.PostingPartAmount
+			return p.recoverPosting(posting)
 		}
 	}
 
+	if posting.Amount != nil {
+		p.parseLotAnnotations(posting)
+	}
+
 	if p.current.Type == TokenAt || p.current.Type == TokenAtAt {
-		posting.Cost = p.parseCost()
+		if posting.Cost = p.parseCost(); posting.Cost == nil {
+			posting.Missing = ast.PostingPartAmount
+			return p.recoverPosting(posting)
+		}
 	}
 
 	if p.current.Type == TokenEquals || p.current.Type == TokenDoubleEquals {
-		posting.BalanceAssertion = p.parseBalanceAssertion()
+		if posting.BalanceAssertion = p.parseBalanceAssertion(); posting.BalanceAssertion == nil {
+			posting.Missing = ast.PostingPartAmount
+			return p.recoverPosting(posting)
+		}
 	}
 
 	if p.current.Type == TokenComment {
@@ -300,13 +524,34 @@ func (p *Parser) parsePosting() *ast.Posting {
 		p.advance()
 	}
 
+	if len(p.errors) > errCount {
+		return p.recoverPosting(posting)
+	}
+	if p.current.Type != TokenNewline && p.current.Type != TokenEOF {
+		p.unexpectedToken()
+		return p.recoverPosting(posting)
+	}
+
+	posting.Range.End = toASTPosition(p.current.Pos)
+	return posting
+}
+
+// recoverPosting marks a posting with a syntax error as invalid and skips
+// the rest of its line, so the postings after it still belong to the
+// transaction.
+func (p *Parser) recoverPosting(posting *ast.Posting) *ast.Posting {
+	posting.Invalid = true
+	for p.current.Type != TokenNewline && p.current.Type != TokenEOF {
+		p.advance()
+	}
 	posting.Range.End = toASTPosition(p.current.Pos)
 	return posting
 }
 
 func (p *Parser) parseAmount() *ast.Amount {
 	amount := &ast.Amount{}
-	amount.Range.Start = toASTPosition(p.current.Pos)
+	start := p.current.Pos
+	amount.Range.Start = toASTPosition(start)
 
 	sign := ""
 	signBeforeCommodity := false
@@ -328,7 +573,9 @@ func (p *Parser) parseAmount() *ast.Amount {
 		if signBeforeCommodity && (sign == "-" || sign == "+") {
 			amount.SignBeforeCommodity = true
 		}
+		commodityEnd := p.current.End.Offset
 		p.advance()
+		amount.SpaceAfterCommodity = p.current.Pos.Offset > commodityEnd
 	}
 
 	if p.current.Type == TokenSign {
@@ -339,22 +586,32 @@ func (p *Parser) parseAmount() *ast.Amount {
 	}
 
 	if p.current.Type != TokenNumber {
-		p.error("expected number")
+		if p.current.Type == TokenNewline || p.current.Type == TokenEOF {
+			// Span the sign and commodity written so far.
+			p.errorAt("PARSE_EXPECTED_AMOUNT", start, p.current.Pos, "expected number")
+		} else {
+			p.error("PARSE_EXPECTED_AMOUNT", "expected number")
+		}
 		return nil
 	}
 
 	rawNumberStr := p.current.Value
-	if sign == "-" && !strings.HasPrefix(rawNumberStr, "-") {
-		rawNumberStr = "-" + rawNumberStr
+	if sign != "" && !strings.HasPrefix(rawNumberStr, "-") && !strings.HasPrefix(rawNumberStr, "+") {
+		rawNumberStr = sign + rawNumberStr
 	}
 	numberStr := rawNumberStr
 
 	numberStr = strings.ReplaceAll(numberStr, " ", "")
-	numberStr = normalizeNumber(numberStr)
+	mantissa, exponent := splitExponent(numberStr)
+	if p.decimalMark != 0 {
+		numberStr = normalizeNumberWithMark(mantissa, p.decimalMark) + exponent
+	} else {
+		numberStr = normalizeNumber(mantissa) + exponent
+	}
 
 	qty, err := decimal.NewFromString(numberStr)
 	if err != nil {
-		p.error("invalid number: %s", p.current.Value)
+		p.error("PARSE_INVALID_AMOUNT", "invalid number: %s", p.current.Value)
 		return nil
 	}
 	amount.Quantity = qty
@@ -399,6 +656,72 @@ func (p *Parser) parseCost() *ast.Cost {
 	return cost
 }
 
+// parseLotAnnotations parses the `{PRICE}`, `{{TOTAL}}` and `[DATE]` lot
+// annotations that may follow a posting amount, in any order.
+func (p *Parser) parseLotAnnotations(posting *ast.Posting) {
+	for {
+		switch p.current.Type {
+		case TokenLBrace, TokenLDoubleBrace:
+			if posting.LotCost != nil {
+				p.error("PARSE_DUPLICATE_LOT_COST", "duplicate lot cost")
+			}
+			lot := p.parseLotCost()
+			if lot == nil {
+				return
+			}
+			posting.LotCost = lot
+		case TokenLBracket:
+			if posting.LotDate != nil {
+				p.error("PARSE_DUPLICATE_LOT_DATE", "duplicate lot date")
+			}
+			p.advance()
+			date := p.parseDate()
+			if date == nil {
+				return
+			}
+			if p.current.Type != TokenRBracket {
+				p.error("PARSE_EXPECTED_CLOSING_BRACKET", "expected ]")
+				return
+			}
+			p.advance()
+			posting.LotDate = date
+		default:
+			return
+		}
+	}
+}
+
+func (p *Parser) parseLotCost() *ast.Cost {
+	lot := &ast.Cost{}
+	lot.Range.Start = toASTPosition(p.current.Pos)
+
+	closing, closingText := TokenRBrace, "}"
+	if p.current.Type == TokenLDoubleBrace {
+		lot.IsTotal = true
+		closing, closingText = TokenRDoubleBrace, "}}"
+	}
+	p.advance()
+
+	// Ledger's fixated lot price {=PRICE} means the same for balancing.
+	if p.current.Type == TokenEquals {
+		p.advance()
+	}
+
+	amount := p.parseAmount()
+	if amount == nil {
+		return nil
+	}
+	lot.Amount = *amount
+
+	if p.current.Type != closing {
+		p.error("PARSE_EXPECTED_CLOSING_BRACKET", "expected %s", closingText)
+		return nil
+	}
+	lot.Range.End = toASTPosition(p.current.End)
+	p.advance()
+	return lot
+}
+
 func (p *Parser) parseBalanceAssertion() *ast.BalanceAssertion {
 	ba := &ast.BalanceAssertion{}
 	ba.Range.Start = toASTPosition(p.current.Pos)
@@ -406,6 +729,7 @@ func (p *Parser) parseBalanceAssertion() *ast.BalanceAssertion {
 	if p.current.Type == TokenDoubleEquals {
 		ba.IsStrict = true
 	}
+	ba.IsInclusive = strings.HasSuffix(p.current.Value, "*")
 	p.advance()
 
 	amount := p.parseAmount()
@@ -435,6 +759,18 @@ func (p *Parser) parseDirective() ast.Directive {
 		return p.parseYearDirective(pos)
 	case "D":
 		return p.parseDefaultCommodityDirective(pos)
+	case "decimal-mark":
+		return p.parseDecimalMarkDirective(pos)
+	case "payee":
+		return p.parsePayeeDirective(pos)
+	case "tag":
+		return p.parseTagDirective(pos)
+	case "alias":
+		return p.parseAliasDirective(pos)
+	case "apply":
+		return p.parseApplyDirective(pos)
+	case "end":
+		return p.parseEndDirective(pos)
 	default:
 		p.skipToNextLine()
 		return nil
@@ -443,7 +779,7 @@ func (p *Parser) parseDirective() ast.Directive {
 
 func (p *Parser) parseAccountDirective(startPos Position) ast.Directive {
 	if p.current.Type != TokenAccount && p.current.Type != TokenText {
-		p.error("expected account name")
+		p.error("PARSE_EXPECTED_ACCOUNT", "expected account name")
 		p.skipToNextLine()
 		return nil
 	}
@@ -459,8 +795,9 @@ func (p *Parser) parseAccountDirective(startPos Position) ast.Directive {
 
 	dir := ast.AccountDirective{
 		Account: ast.Account{
-			Name:  accountName,
-			Range: ast.Range{Start: toASTPosition(accountPos)},
+			Name:    p.resolveAccountName(accountName),
+			RawName: accountName,
+			Range:   ast.Range{Start: toASTPosition(accountPos)},
 		},
 		Range: ast.Range{Start: toASTPosition(startPos)},
 	}
@@ -483,7 +820,8 @@ func (p *Parser) parseAccountDirective(startPos Position) ast.Directive {
 
 func (p *Parser) parseCommodityDirective(startPos Position) ast.Directive {
 	dir := ast.CommodityDirective{
-		Range: ast.Range{Start: toASTPosition(startPos)},
+		DecimalMark: p.decimalMark,
+		Range:       ast.Range{Start: toASTPosition(startPos)},
 	}
 
 	// Handle inline format: "commodity $1000.00" (symbol first, then number)
@@ -552,14 +890,16 @@ func (p *Parser) parseIncludeDirective(startPos Position) ast.Directive {
 
 	pathStr := strings.TrimSpace(path.String())
 	if pathStr == "" {
-		p.error("expected file path")
+		p.error("PARSE_EXPECTED_FILE_PATH", "expected file path")
 		p.skipToNextLine()
 		return nil
 	}
 
+	prefix, pathStr := splitFormatPrefix(pathStr)
 	inc := ast.Include{
-		Path:  pathStr,
-		Range: ast.Range{Start: toASTPosition(startPos)},
+		Path:   pathStr,
+		Prefix: prefix,
+		Range:  ast.Range{Start: toASTPosition(startPos)},
 	}
 	inc.Range.End = toASTPosition(p.current.Pos)
 	p.skipToNextLine()
@@ -585,7 +925,7 @@ func (p *Parser) parsePriceDirective(startPos Position) ast.Directive {
 		}
 		p.advance()
 	} else {
-		p.error("expected commodity")
+		p.error("PARSE_EXPECTED_COMMODITY", "expected commodity")
 		p.skipToNextLine()
 		return nil
 	}
@@ -663,7 +1003,8 @@ func (p *Parser) parseSubdirectives() map[string]string {
 
 func (p *Parser) parseDefaultCommodityDirective(startPos Position) ast.Directive {
 	dir := ast.DefaultCommodityDirective{
-		Range: ast.Range{Start: toASTPosition(startPos)},
+		DecimalMark: p.decimalMark,
+		Range:       ast.Range{Start: toASTPosition(startPos)},
 	}
 
 	// Handle "D $1,000.00" (symbol first, then number)
@@ -694,16 +1035,33 @@ func (p *Parser) parseDefaultCommodityDirective(startPos Position) ast.Directive
 	return dir
 }
 
+func (p *Parser) parseDecimalMarkDirective(startPos Position) ast.Directive {
+	text, textPos, end := p.restOfLine()
+	p.skipToNextLine()
+
+	text = strings.TrimSpace(text)
+	if text != "." && text != "," {
+		p.errorAt("PARSE_INVALID_DECIMAL_MARK", textPos, end, "expected decimal mark . or ,")
+		return nil
+	}
+
+	p.decimalMark = rune(text[0])
+	return ast.DecimalMarkDirective{
+		Mark:  p.decimalMark,
+		Range: ast.Range{Start: toASTPosition(startPos), End: toASTPosition(end)},
+	}
+}
+
 func (p *Parser) parseYearDirective(startPos Position) ast.Directive {
 	if p.current.Type != TokenNumber {
-		p.error("expected year")
+		p.error("PARSE_EXPECTED_YEAR", "expected year")
 		p.skipToNextLine()
 		return nil
 	}
 
 	year, err := strconv.Atoi(p.current.Value)
 	if err != nil || year < 1 || year > 9999 {
-		p.error("invalid year: %s", p.current.Value)
+		p.error("PARSE_INVALID_DATE", "invalid year: %s", p.current.Value)
 		p.skipToNextLine()
 		return nil
 	}
@@ -719,6 +1077,142 @@ func (p *Parser) parseYearDirective(startPos Position) ast.Directive {
 	return dir
 }
 
+func (p *Parser) parsePayeeDirective(startPos Position) ast.Directive {
+	name, comment, end, ok := p.parseDeclaration("payee name")
+	if !ok {
+		return nil
+	}
+	return ast.PayeeDirective{
+		Name:    name,
+		Comment: comment,
+		Range:   ast.Range{Start: toASTPosition(startPos), End: toASTPosition(end)},
+	}
+}
+
+func (p *Parser) parseTagDirective(startPos Position) ast.Directive {
+	name, comment, end, ok := p.parseDeclaration("tag name")
+	if !ok {
+		return nil
+	}
+	if fields := strings.Fields(name); len(fields) > 1 {
+		name = fields[0]
+	}
+	return ast.TagDirective{
+		Name:    name,
+		Comment: comment,
+		Range:   ast.Range{Start: toASTPosition(startPos), End: toASTPosition(end)},
+	}
+}
+
+// parseDeclaration reads the name and optional comment of a `payee` or `tag`
+// directive and skips its indented subdirectives.
+func (p *Parser) parseDeclaration(what string) (name, comment string, end Position, ok bool) {
+	name, _, end = p.restOfLine()
+	name = strings.TrimSpace(name)
+	if name == "" {
+		p.error("PARSE_EXPECTED_NAME", "expected %s", what)
+		p.skipToNextLine()
+		return "", "", end, false
+	}
+
+	if p.current.Type == TokenComment {
+		comment = p.current.Value
+		p.advance()
+	}
+	for p.current.Type != TokenNewline && p.current.Type != TokenEOF {
+		p.advance()
+	}
+	p.parseSubdirectives()
+
+	return name, comment, end, true
+}
+
+func (p *Parser) parseAliasDirective(startPos Position) ast.Directive {
+	text, textPos, end := p.restOfLine()
+	p.skipToNextLine()
+
+	dir, err := parseAliasText(text)
+	if err != nil {
+		p.errorAt("PARSE_INVALID_ALIAS", textPos, end, "invalid alias: %s", err)
+		return nil
+	}
+	dir.Range = ast.Range{Start: toASTPosition(startPos), End: toASTPosition(end)}
+
+	alias, err := compileAlias(dir)
+	if err != nil {
+		p.errorAt("PARSE_INVALID_ALIAS", textPos, end, "invalid alias regex: %s", err)
+		return nil
+	}
+	p.aliases = append(p.aliases, alias)
+	return dir
+}
+
+func (p *Parser) parseEndDirective(startPos Position) ast.Directive {
+	text, _, end := p.restOfLine()
+	p.skipToNextLine()
+
+	rng := ast.Range{Start: toASTPosition(startPos), End: toASTPosition(end)}
+	switch strings.Join(strings.Fields(text), " ") {
+	case "aliases":
+		p.aliases = nil
+		return ast.EndAliasesDirective{Range: rng}
+	case "apply account":
+		if len(p.parentAccounts) > 0 {
+			p.parentAccounts = p.parentAccounts[:len(p.parentAccounts)-1]
+		}
+		return ast.EndApplyAccountDirective{Range: rng}
+	default:
+		return nil
+	}
+}
+
+// parseApplyDirective handles `apply account PREFIX`; other apply
+// directives are skipped.
+func (p *Parser) parseApplyDirective(startPos Position) ast.Directive {
+	text, textPos, end := p.restOfLine()
+	p.skipToNextLine()
+
+	kind, prefix, _ := strings.Cut(text, " ")
+	if kind != "account" {
+		return nil
+	}
+	prefix = strings.Trim(strings.TrimSpace(prefix), ":")
+	if prefix == "" {
+		p.errorAt("PARSE_EXPECTED_ACCOUNT", textPos, end, "expected account name")
+		return nil
+	}
+
+	p.parentAccounts = append(p.parentAccounts, prefix)
+	return ast.ApplyAccountDirective{
+		Account: prefix,
+		Range:   ast.Range{Start: toASTPosition(startPos), End: toASTPosition(end)},
+	}
+}
+
+// resolveAccountName turns an account name as written into the one hledger
+// uses: the `apply account` prefixes are prepended, then aliases applied.
+func (p *Parser) resolveAccountName(name string) string {
+	if len(p.parentAccounts) > 0 {
+		name = strings.Join(p.parentAccounts, ":") + ":" + name
+	}
+	return applyAliases(p.aliases, name)
+}
+
+// restOfLine consumes the tokens up to a comment or the end of line and
+// returns the source text they cover, with its start and end positions.
+func (p *Parser) restOfLine() (string, Position, Position) {
+	start := p.current.Pos
+	end := start
+	for p.current.Type != TokenNewline && p.current.Type != TokenEOF && p.current.Type != TokenComment {
+		end = p.current.End
+		p.advance()
+	}
+	if end.Offset <= start.Offset {
+		return "", start, start
+	}
+	return p.lexer.input[start.Offset:end.Offset], start, end
+}
+
 func (p *Parser) parseComment() ast.Comment {
 	comment := ast.Comment{
 		Text:  p.current.Value,
@@ -729,6 +1223,24 @@ func (p *Parser) parseComment() ast.Comment {
 	return comment
 }
 
+func (p *Parser) parseCommentBlock() ast.Comment {
+	lines := strings.Split(p.current.Value, "\n")[1:]
+	if n := len(lines); n > 0 && strings.TrimSpace(lines[n-1]) == "end comment" {
+		lines = lines[:n-1]
+	}
+
+	comment := ast.Comment{
+		Text: strings.Join(lines, "\n"),
+		Range: ast.Range{
+			Start: toASTPosition(p.current.Pos),
+			End:   toASTPosition(p.current.End),
+		},
+		Block: true,
+	}
+	p.advance()
+	return comment
+}
+
 func parseTags(text string, basePos Position) []ast.Tag {
 	if !strings.Contains(text, ":") {
 		return nil
@@ -813,17 +1325,36 @@ func (p *Parser) skipToNextLine() {
 	}
 }
 
-func (p *Parser) error(format string, args ...any) {
-	p.errorAt(p.current.Pos, format, args...)
+// error reports a syntax error spanning the current token. At a line end
+// the span is empty rather than reaching into the next line.
+func (p *Parser) error(code, format string, args ...any) {
+	end := p.current.End
+	if p.current.Type == TokenNewline {
+		end = p.current.Pos
+	}
+	p.errorAt(code, p.current.Pos, end, format, args...)
 }
 
-func (p *Parser) errorAt(pos Position, format string, args ...any) {
+func (p *Parser) errorAt(code string, pos, end Position, format string, args ...any) {
 	p.errors = append(p.errors, ParseError{
+		Code:    code,
 		Message: fmt.Sprintf(format, args...),
 		Pos:     pos,
+		End:     end,
 	})
 }
 
+// unexpectedToken reports the current token as unexpected, spanning it and
+// the rest of its line, and skips to the end of the line.
+func (p *Parser) unexpectedToken() {
+	typ, start, end := p.current.Type, p.current.Pos, p.current.End
+	for p.current.Type != TokenNewline && p.current.Type != TokenEOF {
+		end = p.current.End
+		p.advance()
+	}
+	p.errorAt("PARSE_UNEXPECTED_TOKEN", start, end, "unexpected token: %s", typ)
+}
+
 func toASTPosition(pos Position) ast.Position {
 	return ast.Position{
 		Line:   pos.Line,
@@ -832,6 +1363,15 @@ func toASTPosition(pos Position) ast.Position {
 	}
 }
 
+// splitExponent splits the E notation exponent off a number, so its digits
+// are not mistaken for the digits after a decimal mark.
+func splitExponent(s string) (mantissa, exponent string) {
+	if idx := strings.IndexAny(s, "Ee"); idx >= 0 {
+		return s[:idx], s[idx:]
+	}
+	return s, ""
+}
+
 func normalizeNumber(s string) string {
 	var dotCount, commaCount int
 	var lastDot, lastComma int
@@ -855,7 +1395,7 @@ func normalizeNumber(s string) string {
 		if lastComma >= 1 && len(s)-lastComma-1 == 3 {
 			hasNonZero := false
 			for i := 0; i < lastComma; i++ {
-				if s[i] != '0' && s[i] != '-' {
+				if s[i] != '0' && s[i] != '-' && s[i] != '+' {
 					hasNonZero = true
 					break
 				}
@@ -871,7 +1411,7 @@ func normalizeNumber(s string) string {
 		if lastDot >= 1 && len(s)-lastDot-1 == 3 {
 			hasNonZero := false
 			for i := 0; i < lastDot; i++ {
-				if s[i] != '0' && s[i] != '-' {
+				if s[i] != '0' && s[i] != '-' && s[i] != '+' {
 					hasNonZero = true
 					break
 				}
@@ -919,6 +1459,24 @@ func normalizeNumber(s string) string {
 	return b.String()
 }
 
+// normalizeNumberWithMark converts a number written with the given decimal
+// mark to the form decimal.NewFromString expects. Every other separator is a
+// digit group separator.
+func normalizeNumberWithMark(s string, mark rune) string {
+	var b strings.Builder
+	b.Grow(len(s))
+	for i := 0; i < len(s); i++ {
+		switch ch := s[i]; {
+		case rune(ch) == mark:
+			b.WriteByte('.')
+		case ch == '.' || ch == ',':
+		default:
+			b.WriteByte(ch)
+		}
+	}
+	return b.String()
+}
+
 func removeSeparator(s string, sep byte) string {
 	var b strings.Builder
 	b.Grow(len(s))
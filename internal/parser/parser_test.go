@@ -158,6 +158,29 @@ func TestParser_StrictBalanceAssertion(t *testing.T) {
 	assert.True(t, p.BalanceAssertion.IsStrict)
 }
 
+func TestParser_InclusiveBalanceAssertion(t *testing.T) {
+	tests := []struct {
+		input  string
+		strict bool
+	}{
+		{"    assets:bank  $0 =* $1000", false},
+		{"    assets:bank  $0 ==* $1000", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			journal, errs := Parse("2024-01-15 check\n" + tt.input)
+			require.Empty(t, errs)
+
+			ba := journal.Transactions[0].Postings[0].BalanceAssertion
+			require.NotNil(t, ba)
+			assert.True(t, ba.IsInclusive)
+			assert.Equal(t, tt.strict, ba.IsStrict)
+			assert.True(t, ba.Amount.Quantity.Equal(decimal.NewFromInt(1000)))
+		})
+	}
+}
+
 func TestParser_AccountDirective(t *testing.T) {
 	input := `account expenses:food`
 
@@ -219,6 +242,50 @@ func TestParser_NegativeAmount(t *testing.T) {
 	assert.True(t, p.Amount.Quantity.Equal(decimal.NewFromInt(-50)))
 }
 
+func TestParser_AmountSyntax(t *testing.T) {
+	tests := []struct {
+		amount              string
+		wantQty             string
+		wantRaw             string
+		wantComm            string
+		wantPosition        ast.CommodityPosition
+		signBeforeCommodity bool
+		spaceAfterCommodity bool
+	}{
+		{amount: "1E3 USD", wantQty: "1000", wantRaw: "1E3", wantComm: "USD", wantPosition: ast.CommodityRight},
+		{amount: "1.5E3 EUR", wantQty: "1500", wantRaw: "1.5E3", wantComm: "EUR", wantPosition: ast.CommodityRight},
+		{amount: "1,5E3 EUR", wantQty: "1500", wantRaw: "1,5E3", wantComm: "EUR", wantPosition: ast.CommodityRight},
+		{amount: "-1e-2 BTC", wantQty: "-0.01", wantRaw: "-1e-2", wantComm: "BTC", wantPosition: ast.CommodityRight},
+		{amount: "1 000 000,50 RUB", wantQty: "1000000.5", wantRaw: "1 000 000,50", wantComm: "RUB", wantPosition: ast.CommodityRight},
+		{amount: `3 "ABC123"`, wantQty: "3", wantRaw: "3", wantComm: "ABC123", wantPosition: ast.CommodityRight},
+		{amount: `"ABC 1" 10`, wantQty: "10", wantRaw: "10", wantComm: "ABC 1", wantPosition: ast.CommodityLeft, spaceAfterCommodity: true},
+		{amount: `-"ABC 1" 10`, wantQty: "-10", wantRaw: "-10", wantComm: "ABC 1", wantPosition: ast.CommodityLeft, signBeforeCommodity: true, spaceAfterCommodity: true},
+		{amount: "$-5", wantQty: "-5", wantRaw: "-5", wantComm: "$", wantPosition: ast.CommodityLeft},
+		{amount: "-$5", wantQty: "-5", wantRaw: "-5", wantComm: "$", wantPosition: ast.CommodityLeft, signBeforeCommodity: true},
+		{amount: "+$5", wantQty: "5", wantRaw: "+5", wantComm: "$", wantPosition: ast.CommodityLeft, signBeforeCommodity: true},
+		{amount: "$ -5", wantQty: "-5", wantRaw: "-5", wantComm: "$", wantPosition: ast.CommodityLeft, spaceAfterCommodity: true},
+		{amount: "-USD 5", wantQty: "-5", wantRaw: "-5", wantComm: "USD", wantPosition: ast.CommodityLeft, signBeforeCommodity: true, spaceAfterCommodity: true},
+		{amount: "5. USD", wantQty: "5", wantRaw: "5.", wantComm: "USD", wantPosition: ast.CommodityRight},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.amount, func(t *testing.T) {
+			journal, errs := Parse("2024-01-15 test\n    expenses:food  " + tt.amount + "\n    assets:cash\n")
+			require.Empty(t, errs)
+			require.Len(t, journal.Transactions, 1)
+
+			amount := journal.Transactions[0].Postings[0].Amount
+			require.NotNil(t, amount)
+			assert.Equal(t, tt.wantQty, amount.Quantity.String())
+			assert.Equal(t, tt.wantRaw, amount.RawQuantity)
+			assert.Equal(t, tt.wantComm, amount.Commodity.Symbol)
+			assert.Equal(t, tt.wantPosition, amount.Commodity.Position)
+			assert.Equal(t, tt.signBeforeCommodity, amount.SignBeforeCommodity)
+			assert.Equal(t, tt.spaceAfterCommodity, amount.SpaceAfterCommodity)
+		})
+	}
+}
+
 func TestParser_MultipleTransactions(t *testing.T) {
 	input := `2024-01-15 first
     expenses:food  $50
@@ -310,6 +377,124 @@ invalid line without date
 	assert.Len(t, journal.Transactions, 2)
 }
 
+func TestParser_PostingErrorRecovery(t *testing.T) {
+	input := `2024-01-15 shop
+    expenses:food  $
+    assets:bank  $5 garbage
+    $10
+    expenses:misc  $3
+
+2024-01-16 next
+    expenses:misc  $1
+    assets:cash`
+
+	journal, errs := Parse(input)
+	require.Len(t, errs, 3)
+	assert.Equal(t, "expected number", errs[0].Message)
+	assert.Equal(t, "PARSE_EXPECTED_AMOUNT", errs[0].Code)
+	assert.Equal(t, Position{Line: 2, Column: 21, Offset: 36}, errs[0].End)
+	assert.Equal(t, "unexpected token: Text", errs[1].Message)
+	assert.Equal(t, "PARSE_UNEXPECTED_TOKEN", errs[1].Code)
+	assert.Equal(t, 21, errs[1].Pos.Column)
+	assert.Equal(t, 28, errs[1].End.Column)
+	assert.Equal(t, "expected account name", errs[2].Message)
+	assert.Equal(t, "PARSE_EXPECTED_ACCOUNT", errs[2].Code)
+
+	require.Len(t, journal.Transactions, 2)
+	postings := journal.Transactions[0].Postings
+	require.Len(t, postings, 4)
+
+	assert.Equal(t, "expenses:food", postings[0].Account.Name)
+	assert.True(t, postings[0].Invalid)
+	assert.Equal(t, ast.PostingPartAmount, postings[0].Missing)
+	assert.Nil(t, postings[0].Amount)
+
+	assert.True(t, postings[1].Invalid)
+	assert.Equal(t, ast.PostingPartNone, postings[1].Missing)
+	require.NotNil(t, postings[1].Amount)
+	assert.Equal(t, "5", postings[1].Amount.Quantity.String())
+	assert.Equal(t, 28, postings[1].Range.End.Column)
+
+	assert.True(t, postings[2].Invalid)
+	assert.Equal(t, ast.PostingPartAccount, postings[2].Missing)
+
+	assert.False(t, postings[3].Invalid)
+	assert.Equal(t, "expenses:misc", postings[3].Account.Name)
+
+	assert.False(t, ast.HasInvalidPosting(journal.Transactions[1].Postings))
+}
+
+func TestParser_ErrorRanges(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		code  string
+		want  ast.Range
+	}{
+		{
+			name:  "unexpected tokens span the rest of the line",
+			input: "2024-01-15 shop\n    assets:bank  $5 foo bar ; x\n",
+			code:  "PARSE_UNEXPECTED_TOKEN",
+			want: ast.Range{
+				Start: ast.Position{Line: 2, Column: 21, Offset: 36},
+				End:   ast.Position{Line: 2, Column: 32, Offset: 47},
+			},
+		},
+		{
+			name:  "invalid date spans the date",
+			input: "2024-01-15-3 shop\n",
+			code:  "PARSE_INVALID_DATE",
+			want: ast.Range{
+				Start: ast.Position{Line: 1, Column: 1, Offset: 0},
+				End:   ast.Position{Line: 1, Column: 13, Offset: 12},
+			},
+		},
+		{
+			name:  "missing amount spans the commodity",
+			input: "2024-01-15 shop\n    assets:bank  $\n",
+			code:  "PARSE_EXPECTED_AMOUNT",
+			want: ast.Range{
+				Start: ast.Position{Line: 2, Column: 18, Offset: 33},
+				End:   ast.Position{Line: 2, Column: 19, Offset: 34},
+			},
+		},
+		{
+			name:  "stray indented line spans the line",
+			input: "    assets:bank  $5\n",
+			code:  "PARSE_UNEXPECTED_TOKEN",
+			want: ast.Range{
+				Start: ast.Position{Line: 1, Column: 1, Offset: 0},
+				End:   ast.Position{Line: 1, Column: 20, Offset: 19},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, errs := Parse(tt.input)
+			require.NotEmpty(t, errs)
+			assert.Equal(t, tt.code, errs[0].Code)
+			assert.Equal(t, tt.want, errs[0].Range())
+		})
+	}
+}
+
+func TestParser_InvalidDateSkipsPostings(t *testing.T) {
+	input := `2024-13 shop
+    expenses:food  $5
+    assets:bank
+
+2024-01-16 next
+    expenses:misc  $1
+    assets:cash`
+
+	journal, errs := Parse(input)
+	require.Len(t, errs, 1)
+	assert.Equal(t, "partial date requires Y directive: 2024-13", errs[0].Message)
+	require.Len(t, journal.Transactions, 1)
+	assert.Equal(t, "next", journal.Transactions[0].Description)
+}
+
 func TestParser_Date2(t *testing.T) {
 	input := `2024-01-15=2024-01-20 transaction with date2
     expenses:food  $50
@@ -1396,3 +1581,633 @@ func Test_normalizeNumber(t *testing.T) {
 		})
 	}
 }
+
+func TestParser_PeriodicTransaction(t *testing.T) {
+	input := `~ monthly from 2024-01 to 2024-07  rent budget
+    expenses:rent  $1000
+    assets:checking
+
+2024-01-15 grocery store
+    expenses:food  $50
+    assets:cash`
+
+	journal, errs := Parse(input)
+	require.Empty(t, errs)
+	require.Len(t, journal.PeriodicTransactions, 1)
+	require.Len(t, journal.Transactions, 1)
+
+	ptx := journal.PeriodicTransactions[0]
+	assert.Equal(t, "monthly from 2024-01 to 2024-07", ptx.Period.Text)
+	assert.Equal(t, ast.Interval{Unit: ast.IntervalMonth, Count: 1}, ptx.Period.Interval)
+	require.NotNil(t, ptx.Period.Start)
+	require.NotNil(t, ptx.Period.End)
+	assert.Equal(t, 2024, ptx.Period.Start.Year)
+	assert.Equal(t, 1, ptx.Period.Start.Month)
+	assert.Equal(t, 7, ptx.Period.End.Month)
+	assert.Equal(t, "rent budget", ptx.Description)
+	assert.Equal(t, 1, ptx.Range.Start.Line)
+	assert.Equal(t, 3, ptx.Period.Range.Start.Column)
+
+	require.Len(t, ptx.Postings, 2)
+	assert.Equal(t, "expenses:rent", ptx.Postings[0].Account.Name)
+	require.NotNil(t, ptx.Postings[0].Amount)
+	assert.Equal(t, "$", ptx.Postings[0].Amount.Commodity.Symbol)
+	assert.Nil(t, ptx.Postings[1].Amount)
+}
+
+func TestParser_PeriodExpressions(t *testing.T) {
+	tests := []struct {
+		name      string
+		expr      string
+		interval  ast.Interval
+		startYear int
+		startMon  int
+		endYear   int
+		endMon    int
+	}{
+		{name: "interval only", expr: "weekly", interval: ast.Interval{Unit: ast.IntervalWeek, Count: 1}},
+		{name: "biweekly", expr: "biweekly", interval: ast.Interval{Unit: ast.IntervalWeek, Count: 2}},
+		{name: "every n units", expr: "every 3 months", interval: ast.Interval{Unit: ast.IntervalMonth, Count: 3}},
+		{name: "every nth day of month", expr: "every 15th day of month", interval: ast.Interval{Unit: ast.IntervalMonth, Count: 1}},
+		{name: "every weekday", expr: "every tuesday", interval: ast.Interval{Unit: ast.IntervalWeek, Count: 1}},
+		{name: "fortnightly", expr: "fortnightly", interval: ast.Interval{Unit: ast.IntervalWeek, Count: 2}},
+		{name: "bimonthly", expr: "bimonthly", interval: ast.Interval{Unit: ast.IntervalMonth, Count: 2}},
+		{name: "annually", expr: "Annually", interval: ast.Interval{Unit: ast.IntervalYear, Count: 1}},
+		{name: "every n weeks", expr: "every 2 weeks", interval: ast.Interval{Unit: ast.IntervalWeek, Count: 2}},
+		{name: "every nth day", expr: "every 2nd day", interval: ast.Interval{Unit: ast.IntervalMonth, Count: 1}},
+		{name: "every nth weekday of month", expr: "every 2nd monday of month", interval: ast.Interval{Unit: ast.IntervalMonth, Count: 1}},
+		{name: "every nth month", expr: "every 15th march of year", interval: ast.Interval{Unit: ast.IntervalYear, Count: 1}},
+		{name: "every month nth", expr: "every mar 15th", interval: ast.Interval{Unit: ast.IntervalYear, Count: 1}},
+		{name: "every month day", expr: "every 12/31", interval: ast.Interval{Unit: ast.IntervalYear, Count: 1}},
+		{
+			name:      "bimonthly in year",
+			expr:      "bimonthly in 2024",
+			interval:  ast.Interval{Unit: ast.IntervalMonth, Count: 2},
+			startYear: 2024, startMon: 1, endYear: 2025, endMon: 1,
+		},
+		{
+			name:      "in year",
+			expr:      "yearly in 2024",
+			interval:  ast.Interval{Unit: ast.IntervalYear, Count: 1},
+			startYear: 2024, startMon: 1, endYear: 2025, endMon: 1,
+		},
+		{
+			name:      "bare month span",
+			expr:      "quarterly 2024-03",
+			interval:  ast.Interval{Unit: ast.IntervalQuarter, Count: 1},
+			startYear: 2024, startMon: 3, endYear: 2024, endMon: 4,
+		},
+		{
+			name:      "double dot span",
+			expr:      "monthly 2024-01..2024-06",
+			interval:  ast.Interval{Unit: ast.IntervalMonth, Count: 1},
+			startYear: 2024, startMon: 1, endYear: 2024, endMon: 6,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			journal, errs := Parse("~ " + tt.expr + "\n    expenses:a  $1\n    assets:b\n")
+			require.Empty(t, errs)
+			require.Len(t, journal.PeriodicTransactions, 1)
+
+			period := journal.PeriodicTransactions[0].Period
+			assert.Equal(t, tt.interval, period.Interval)
+			if tt.startYear == 0 {
+				assert.Nil(t, period.Start)
+				assert.Nil(t, period.End)
+				return
+			}
+			require.NotNil(t, period.Start)
+			require.NotNil(t, period.End)
+			assert.Equal(t, tt.startYear, period.Start.Year)
+			assert.Equal(t, tt.startMon, period.Start.Month)
+			assert.Equal(t, tt.endYear, period.End.Year)
+			assert.Equal(t, tt.endMon, period.End.Month)
+		})
+	}
+}
+
+func TestParser_PeriodicTransactionInvalidPeriod(t *testing.T) {
+	input := `~ fortnightly-ish
+    expenses:rent  $1000
+    assets:checking`
+
+	journal, errs := Parse(input)
+	require.Len(t, errs, 1)
+	assert.Contains(t, errs[0].Message, "invalid period expression")
+	require.Len(t, journal.PeriodicTransactions, 1)
+	assert.Len(t, journal.PeriodicTransactions[0].Postings, 2)
+}
+
+func TestParser_AutoPostingRule(t *testing.T) {
+	input := `= expenses:food desc:'whole foods'  ; tax set-aside
+    liabilities:tax  *-0.25
+    (budget:tax)  *0.25 EUR
+    assets:fixed  $5
+
+2024-01-15 grocery store
+    expenses:food  $50
+    assets:cash`
+
+	journal, errs := Parse(input)
+	require.Empty(t, errs)
+	require.Len(t, journal.AutoPostingRules, 1)
+	require.Len(t, journal.Transactions, 1)
+
+	rule := journal.AutoPostingRules[0]
+	assert.Equal(t, "expenses:food desc:'whole foods'", rule.Query)
+	assert.Equal(t, 3, rule.QueryRange.Start.Column)
+	assert.Equal(t, 35, rule.QueryRange.End.Column)
+	require.Len(t, rule.Comments, 1)
+	assert.Equal(t, 1, rule.Range.Start.Line)
+
+	require.Len(t, rule.Postings, 3)
+	assert.Equal(t, "liabilities:tax", rule.Postings[0].Account.Name)
+	require.NotNil(t, rule.Postings[0].Amount)
+	assert.True(t, rule.Postings[0].Amount.Multiplier)
+	assert.Equal(t, "-0.25", rule.Postings[0].Amount.Quantity.String())
+	assert.Equal(t, 22, rule.Postings[0].Amount.Range.Start.Column)
+
+	assert.Equal(t, ast.VirtualUnbalanced, rule.Postings[1].Virtual)
+	assert.True(t, rule.Postings[1].Amount.Multiplier)
+	assert.Equal(t, "EUR", rule.Postings[1].Amount.Commodity.Symbol)
+
+	assert.False(t, rule.Postings[2].Amount.Multiplier)
+	assert.Equal(t, "$", rule.Postings[2].Amount.Commodity.Symbol)
+}
+
+func TestParser_AutoPostingRuleMissingQuery(t *testing.T) {
+	input := `=
+    liabilities:tax  *-0.25`
+
+	journal, errs := Parse(input)
+	require.Len(t, errs, 1)
+	assert.Contains(t, errs[0].Message, "expected query")
+	require.Len(t, journal.AutoPostingRules, 1)
+	assert.Len(t, journal.AutoPostingRules[0].Postings, 1)
+}
+
+func TestParser_MultiplierOutsideAutoPostingRule(t *testing.T) {
+	input := `2024-01-15 grocery store
+    expenses:food  *2
+    assets:cash  *-1
+
+~ monthly
+    expenses:rent  *3
+    assets:cash`
+
+	journal, errs := Parse(input)
+	require.Len(t, errs, 3)
+	for _, e := range errs {
+		assert.Equal(t, "PARSE_UNEXPECTED_MULTIPLIER", e.Code)
+	}
+	assert.Equal(t, 2, errs[0].Pos.Line)
+	assert.Equal(t, 20, errs[0].Pos.Column)
+
+	require.Len(t, journal.Transactions, 1)
+	for _, posting := range journal.Transactions[0].Postings {
+		assert.True(t, posting.Invalid)
+		require.NotNil(t, posting.Amount)
+		assert.False(t, posting.Amount.Multiplier)
+	}
+}
+
+func TestParser_AliasDirective(t *testing.T) {
+	input := `alias checking:old = assets:bank:checking
+alias /^expenses:(\w+)$/ = expenses:daily:\1
+account checking:old
+
+2024-01-15 grocery
+    expenses:food  $50
+    checking:old:sub
+
+end aliases
+
+2024-01-16 after
+    checking:old  $1
+    expenses:food`
+
+	journal, errs := Parse(input)
+	require.Empty(t, errs)
+	require.Len(t, journal.Directives, 4)
+
+	plain, ok := journal.Directives[0].(ast.AliasDirective)
+	require.True(t, ok)
+	assert.Equal(t, "checking:old", plain.Original)
+	assert.Equal(t, "assets:bank:checking", plain.Replacement)
+	assert.False(t, plain.IsRegex)
+
+	regex, ok := journal.Directives[1].(ast.AliasDirective)
+	require.True(t, ok)
+	assert.Equal(t, `^expenses:(\w+)$`, regex.Original)
+	assert.True(t, regex.IsRegex)
+
+	account, ok := journal.Directives[2].(ast.AccountDirective)
+	require.True(t, ok)
+	assert.Equal(t, "assets:bank:checking", account.Account.Name)
+
+	_, ok = journal.Directives[3].(ast.EndAliasesDirective)
+	assert.True(t, ok)
+
+	require.Len(t, journal.Transactions, 2)
+	assert.Equal(t, "expenses:daily:food", journal.Transactions[0].Postings[0].Account.Name)
+	assert.Equal(t, "assets:bank:checking:sub", journal.Transactions[0].Postings[1].Account.Name)
+	assert.Equal(t, "checking:old", journal.Transactions[1].Postings[0].Account.Name)
+	assert.Equal(t, "expenses:food", journal.Transactions[1].Postings[1].Account.Name)
+}
+
+func TestParser_AliasOrder(t *testing.T) {
+	input := `alias a:b = c:d
+alias c:d = e:f
+alias x:y = a:b
+
+2024-01-15 test
+    a:b  $1
+    x:y`
+
+	journal, errs := Parse(input)
+	require.Empty(t, errs)
+	require.Len(t, journal.Transactions, 1)
+
+	// Most recent alias first, each seeing the previous result.
+	assert.Equal(t, "c:d", journal.Transactions[0].Postings[0].Account.Name)
+	assert.Equal(t, "c:d", journal.Transactions[0].Postings[1].Account.Name)
+}
+
+func TestParser_AliasInherited(t *testing.T) {
+	input := `2024-01-15 test
+    bank:old  $1
+    equity:opening`
+
+	opts := Options{Aliases: []ast.AliasDirective{
+		{Original: "bank:old", Replacement: "assets:bank"},
+		{Original: "(?i)^EQUITY", Replacement: "eq", IsRegex: true},
+	}}
+	journal, errs := ParseWithOptions(input, opts)
+	require.Empty(t, errs)
+	require.Len(t, journal.Transactions, 1)
+	assert.Equal(t, "assets:bank", journal.Transactions[0].Postings[0].Account.Name)
+	assert.Equal(t, "eq:opening", journal.Transactions[0].Postings[1].Account.Name)
+}
+
+func TestParser_InvalidAlias(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		msg   string
+	}{
+		{"missing equals", "alias foo:bar", "invalid alias"},
+		{"unterminated regex", "alias /foo = bar", "invalid alias"},
+		{"bad regex", "alias /fo(o/ = bar", "invalid alias regex"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			journal, errs := Parse(tt.input)
+			require.Len(t, errs, 1)
+			assert.Contains(t, errs[0].Message, tt.msg)
+			assert.Empty(t, journal.Directives)
+		})
+	}
+}
+
+func TestParser_ApplyAccount(t *testing.T) {
+	input := `apply account business
+alias expenses:food = expenses:meals
+account expenses:food
+
+2024-01-15 lunch
+    expenses:food  $50
+    assets:cash
+
+apply account travel:
+2024-01-16 taxi
+    expenses:taxi  $20
+    assets:cash
+end apply account
+
+end apply account
+end aliases
+
+2024-01-17 personal
+    expenses:food  $5
+    assets:cash`
+
+	journal, errs := Parse(input)
+	require.Empty(t, errs)
+
+	apply, ok := journal.Directives[0].(ast.ApplyAccountDirective)
+	require.True(t, ok)
+	assert.Equal(t, "business", apply.Account)
+
+	// The parent prefix is added before aliases are applied, so the alias
+	// written without the prefix does not match.
+	account, ok := journal.Directives[2].(ast.AccountDirective)
+	require.True(t, ok)
+	assert.Equal(t, "business:expenses:food", account.Account.Name)
+	assert.Equal(t, "expenses:food", account.Account.RawName)
+
+	require.Len(t, journal.Transactions, 3)
+	first := journal.Transactions[0].Postings[0].Account
+	assert.Equal(t, "business:expenses:food", first.Name)
+	assert.Equal(t, "expenses:food", first.Written())
+
+	assert.Equal(t, "business:travel:expenses:taxi", journal.Transactions[1].Postings[0].Account.Name)
+	assert.Equal(t, "expenses:food", journal.Transactions[2].Postings[0].Account.Name)
+}
+
+func TestParser_ApplyAccountInherited(t *testing.T) {
+	input := `2024-01-15 test
+    expenses:food  $1
+    assets:cash`
+
+	opts := Options{
+		ParentAccounts: []string{"business"},
+		Aliases:        []ast.AliasDirective{{Original: "business:assets", Replacement: "company:assets"}},
+	}
+	journal, errs := ParseWithOptions(input, opts)
+	require.Empty(t, errs)
+	require.Len(t, journal.Transactions, 1)
+	assert.Equal(t, "business:expenses:food", journal.Transactions[0].Postings[0].Account.Name)
+	assert.Equal(t, "company:assets:cash", journal.Transactions[0].Postings[1].Account.Name)
+}
+
+func TestParser_ApplyAccountMissingName(t *testing.T) {
+	journal, errs := Parse("apply account\n")
+	require.Len(t, errs, 1)
+	assert.Contains(t, errs[0].Message, "expected account name")
+	assert.Empty(t, journal.Directives)
+}
+
+func TestParser_PayeeAndTagDirectives(t *testing.T) {
+	input := `payee Whole Foods Market  ; groceries
+  ; indented comment
+tag project
+    ; describes the project
+tag client  extra words
+
+2024-01-15 Whole Foods Market
+    expenses:food  $50
+    assets:cash`
+
+	journal, errs := Parse(input)
+	require.Empty(t, errs)
+	require.Len(t, journal.Directives, 3)
+	require.Len(t, journal.Transactions, 1)
+
+	payee, ok := journal.Directives[0].(ast.PayeeDirective)
+	require.True(t, ok)
+	assert.Equal(t, "Whole Foods Market", payee.Name)
+	assert.Contains(t, payee.Comment, "groceries")
+	assert.Equal(t, 1, payee.Range.Start.Line)
+
+	tag, ok := journal.Directives[1].(ast.TagDirective)
+	require.True(t, ok)
+	assert.Equal(t, "project", tag.Name)
+	assert.Equal(t, 3, tag.Range.Start.Line)
+
+	tag, ok = journal.Directives[2].(ast.TagDirective)
+	require.True(t, ok)
+	assert.Equal(t, "client", tag.Name)
+}
+
+func TestParser_PayeeAndTagDirectivesMissingName(t *testing.T) {
+	tests := []struct {
+		input string
+		msg   string
+	}{
+		{"payee\n", "expected payee name"},
+		{"tag  ; comment\n", "expected tag name"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			journal, errs := Parse(tt.input)
+			require.Len(t, errs, 1)
+			assert.Contains(t, errs[0].Message, tt.msg)
+			assert.Empty(t, journal.Directives)
+		})
+	}
+}
+
+func TestParser_DecimalMarkDirective(t *testing.T) {
+	input := `2024-01-14 before
+    expenses:food  1,234 EUR
+    assets:cash
+
+decimal-mark ,
+commodity 1.000,00 EUR
+
+2024-01-15 after
+    expenses:food  1,234 EUR
+    expenses:rent  1.234 EUR
+    assets:cash`
+
+	journal, errs := Parse(input)
+	require.Empty(t, errs)
+
+	mark, ok := journal.Directives[0].(ast.DecimalMarkDirective)
+	require.True(t, ok)
+	assert.Equal(t, ',', mark.Mark)
+
+	commodity, ok := journal.Directives[1].(ast.CommodityDirective)
+	require.True(t, ok)
+	assert.Equal(t, ',', commodity.DecimalMark)
+
+	require.Len(t, journal.Transactions, 2)
+	assert.Equal(t, "1234", journal.Transactions[0].Postings[0].Amount.Quantity.String())
+	assert.Equal(t, "1.234", journal.Transactions[1].Postings[0].Amount.Quantity.String())
+	assert.Equal(t, "1234", journal.Transactions[1].Postings[1].Amount.Quantity.String())
+}
+
+func TestParser_DecimalMarkInherited(t *testing.T) {
+	input := `2024-01-15 test
+    expenses:food  1,234 EUR
+    assets:cash  -1.234,5 EUR`
+
+	journal, errs := ParseWithOptions(input, Options{DecimalMark: ','})
+	require.Empty(t, errs)
+	require.Len(t, journal.Transactions, 1)
+	assert.Equal(t, "1.234", journal.Transactions[0].Postings[0].Amount.Quantity.String())
+	assert.Equal(t, "-1234.5", journal.Transactions[0].Postings[1].Amount.Quantity.String())
+}
+
+func TestParser_DefaultYearInherited(t *testing.T) {
+	input := `03/15 test
+    expenses:food  $10
+    assets:cash
+
+Y 2024
+
+03/16 later
+    expenses:food  $10
+    assets:cash`
+
+	journal, errs := ParseWithOptions(input, Options{DefaultYear: 2023})
+	require.Empty(t, errs)
+	require.Len(t, journal.Transactions, 2)
+	assert.Equal(t, 2023, journal.Transactions[0].Date.Year)
+	assert.Equal(t, 2024, journal.Transactions[1].Date.Year)
+}
+
+func TestParser_InvalidDecimalMark(t *testing.T) {
+	journal, errs := Parse("decimal-mark ;\n")
+	require.Len(t, errs, 1)
+	assert.Contains(t, errs[0].Message, "expected decimal mark")
+	assert.Empty(t, journal.Directives)
+}
+
+func Test_normalizeNumberWithMark(t *testing.T) {
+	tests := []struct {
+		input string
+		mark  rune
+		want  string
+	}{
+		{"1,234", '.', "1234"},
+		{"1,234", ',', "1.234"},
+		{"1.234.567,89", ',', "1234567.89"},
+		{"-1,234.5", '.', "-1234.5"},
+		{"100", ',', "100"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input+string(tt.mark), func(t *testing.T) {
+			assert.Equal(t, tt.want, normalizeNumberWithMark(tt.input, tt.mark))
+		})
+	}
+}
+
+func TestParser_CommentBlock(t *testing.T) {
+	input := `comment
+2024-01-15 half-written
+    expenses:food  $
+    ) broken
+end comment
+
+2024-01-16 real
+    expenses:food  $50
+    assets:cash`
+
+	journal, errs := Parse(input)
+	require.Empty(t, errs)
+	require.Len(t, journal.Transactions, 1)
+	assert.Equal(t, "real", journal.Transactions[0].Description)
+
+	require.Len(t, journal.Comments, 1)
+	block := journal.Comments[0]
+	assert.True(t, block.Block)
+	assert.Equal(t, "2024-01-15 half-written\n    expenses:food  $\n    ) broken", block.Text)
+	assert.Equal(t, 1, block.Range.Start.Line)
+	assert.Equal(t, 5, block.Range.End.Line)
+}
+
+func TestParser_CommentBlockUnterminated(t *testing.T) {
+	input := `2024-01-16 real
+    expenses:food  $50
+    assets:cash
+
+comment
+2024-01-17 parked
+    expenses:food  $5`
+
+	journal, errs := Parse(input)
+	require.Empty(t, errs)
+	require.Len(t, journal.Transactions, 1)
+	require.Len(t, journal.Comments, 1)
+	assert.True(t, journal.Comments[0].Block)
+	assert.Equal(t, 7, journal.Comments[0].Range.End.Line)
+}
+
+func TestParser_LotCostAndDate(t *testing.T) {
+	input := `2024-03-01 sell
+    assets:broker  -10 AAPL {150 USD} [2024-01-02] @ 180 USD
+    assets:cash  1800 USD
+    income:gains  -300 USD`
+
+	journal, errs := Parse(input)
+	require.Empty(t, errs)
+	require.Len(t, journal.Transactions, 1)
+
+	p := journal.Transactions[0].Postings[0]
+	require.NotNil(t, p.LotCost)
+	assert.False(t, p.LotCost.IsTotal)
+	assert.True(t, p.LotCost.Amount.Quantity.Equal(decimal.NewFromInt(150)))
+	assert.Equal(t, "USD", p.LotCost.Amount.Commodity.Symbol)
+	require.NotNil(t, p.LotDate)
+	assert.Equal(t, 2024, p.LotDate.Year)
+	assert.Equal(t, 1, p.LotDate.Month)
+	assert.Equal(t, 2, p.LotDate.Day)
+	require.NotNil(t, p.Cost)
+	assert.True(t, p.Cost.Amount.Quantity.Equal(decimal.NewFromInt(180)))
+}
+
+func TestParser_LotTotalCostDateFirst(t *testing.T) {
+	input := `2024-01-02 buy
+    assets:broker  10 AAPL [2024-01-02] {{1500 USD}}
+    assets:cash`
+
+	journal, errs := Parse(input)
+	require.Empty(t, errs)
+
+	p := journal.Transactions[0].Postings[0]
+	require.NotNil(t, p.LotCost)
+	assert.True(t, p.LotCost.IsTotal)
+	assert.True(t, p.LotCost.Amount.Quantity.Equal(decimal.NewFromInt(1500)))
+	require.NotNil(t, p.LotDate)
+	assert.Equal(t, 2, p.LotDate.Day)
+}
+
+func TestParser_LotCostErrors(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		err   string
+	}{
+		{"unclosed", "2024-01-02 buy\n    assets:broker  10 AAPL {150 USD\n    assets:cash", "expected }"},
+		{"unclosed total", "2024-01-02 buy\n    assets:broker  10 AAPL {{1500 USD}\n    assets:cash", "expected }}"},
+		{"duplicate", "2024-01-02 buy\n    assets:broker  10 AAPL {150 USD} {151 USD}\n    assets:cash", "duplicate lot cost"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, errs := Parse(tt.input)
+			require.NotEmpty(t, errs)
+			assert.Contains(t, errs[0].Message, tt.err)
+		})
+	}
+}
+
+func TestParser_PostingDateTags(t *testing.T) {
+	input := `2024-01-30 purchase
+    expenses:food  $50
+    liabilities:card  $-50  ; date:2024-02-02, date2:02-05
+    assets:cash  $0  ; date:not-a-date
+
+Y 2023
+
+2023-12-30 late
+    expenses:food  $5  ; date:01-03
+    assets:cash`
+
+	journal, errs := Parse(input)
+	require.Empty(t, errs)
+	require.Len(t, journal.Transactions, 2)
+
+	tx := &journal.Transactions[0]
+	assert.Nil(t, tx.Postings[0].Date)
+	assert.Equal(t, tx.Date, tx.PostingDate(&tx.Postings[0]))
+
+	card := &tx.Postings[1]
+	require.NotNil(t, card.Date)
+	assert.Equal(t, []int{2024, 2, 2}, []int{card.Date.Year, card.Date.Month, card.Date.Day})
+	require.NotNil(t, card.Date2)
+	assert.Equal(t, []int{2024, 2, 5}, []int{card.Date2.Year, card.Date2.Month, card.Date2.Day})
+	assert.Equal(t, 2, tx.PostingDate(card).Day)
+
+	assert.Nil(t, tx.Postings[2].Date)
+
+	// Partial dates take the year of the Y directive.
+	late := journal.Transactions[1].Postings[0]
+	require.NotNil(t, late.Date)
+	assert.Equal(t, []int{2023, 1, 3}, []int{late.Date.Year, late.Date.Month, late.Date.Day})
+}
@@ -0,0 +1,323 @@
+package parser
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/juev/hledger-lsp/internal/ast"
+)
+
+type periodWord struct {
+	text   string
+	offset int
+}
+
+var periodIntervals = map[string]ast.Interval{
+	"daily":       {Unit: ast.IntervalDay, Count: 1},
+	"weekly":      {Unit: ast.IntervalWeek, Count: 1},
+	"biweekly":    {Unit: ast.IntervalWeek, Count: 2},
+	"fortnightly": {Unit: ast.IntervalWeek, Count: 2},
+	"monthly":     {Unit: ast.IntervalMonth, Count: 1},
+	"bimonthly":   {Unit: ast.IntervalMonth, Count: 2},
+	"quarterly":   {Unit: ast.IntervalQuarter, Count: 1},
+	"yearly":      {Unit: ast.IntervalYear, Count: 1},
+	"annually":    {Unit: ast.IntervalYear, Count: 1},
+}
+
+var periodUnits = map[string]ast.IntervalUnit{
+	"day": ast.IntervalDay, "days": ast.IntervalDay,
+	"week": ast.IntervalWeek, "weeks": ast.IntervalWeek,
+	"month": ast.IntervalMonth, "months": ast.IntervalMonth,
+	"quarter": ast.IntervalQuarter, "quarters": ast.IntervalQuarter,
+	"year": ast.IntervalYear, "years": ast.IntervalYear,
+}
+
+var periodWeekdays = map[string]bool{
+	"mon": true, "monday": true, "tue": true, "tuesday": true,
+	"wed": true, "wednesday": true, "thu": true, "thursday": true,
+	"fri": true, "friday": true, "sat": true, "saturday": true,
+	"sun": true, "sunday": true, "weekday": true, "weekendday": true,
+}
+
+var periodMonths = map[string]bool{
+	"jan": true, "january": true, "feb": true, "february": true,
+	"mar": true, "march": true, "apr": true, "april": true, "may": true,
+	"jun": true, "june": true, "jul": true, "july": true,
+	"aug": true, "august": true, "sep": true, "september": true,
+	"oct": true, "october": true, "nov": true, "november": true,
+	"dec": true, "december": true,
+}
+
+// parsePeriodExpr parses the subset of hledger period expressions used in
+// periodic transaction headers: an optional reporting interval followed by
+// an optional span ("from", "to", "in" or a bare date).
+func parsePeriodExpr(text string, rng ast.Range, defaultYear int) (ast.PeriodExpr, error) {
+	expr := ast.PeriodExpr{Text: text, Range: rng}
+	words := splitPeriodWords(text)
+
+	for i := 0; i < len(words); i++ {
+		w := strings.ToLower(words[i].text)
+
+		if interval, ok := periodIntervals[w]; ok {
+			expr.Interval = interval
+			continue
+		}
+
+		switch w {
+		case "every":
+			next, interval, err := parseEveryInterval(words, i+1)
+			if err != nil {
+				return expr, err
+			}
+			expr.Interval = interval
+			i = next - 1
+		case "from", "since":
+			if i+1 >= len(words) {
+				return expr, fmt.Errorf("expected date after %q", w)
+			}
+			i++
+			start, _, err := parsePeriodDate(words[i], text, rng.Start, defaultYear)
+			if err != nil {
+				return expr, err
+			}
+			expr.Start = start
+		case "to", "until":
+			if i+1 >= len(words) {
+				return expr, fmt.Errorf("expected date after %q", w)
+			}
+			i++
+			end, _, err := parsePeriodDate(words[i], text, rng.Start, defaultYear)
+			if err != nil {
+				return expr, err
+			}
+			expr.End = end
+		case "in":
+			if i+1 >= len(words) {
+				return expr, fmt.Errorf("expected date after %q", w)
+			}
+			i++
+			start, end, err := parsePeriodDate(words[i], text, rng.Start, defaultYear)
+			if err != nil {
+				return expr, err
+			}
+			expr.Start, expr.End = start, end
+		default:
+			if from, to, ok := strings.Cut(words[i].text, ".."); ok {
+				if from != "" {
+					start, _, err := parsePeriodDate(periodWord{text: from, offset: words[i].offset}, text, rng.Start, defaultYear)
+					if err != nil {
+						return expr, err
+					}
+					expr.Start = start
+				}
+				if to != "" {
+					toWord := periodWord{text: to, offset: words[i].offset + len(from) + 2}
+					end, _, err := parsePeriodDate(toWord, text, rng.Start, defaultYear)
+					if err != nil {
+						return expr, err
+					}
+					expr.End = end
+				}
+				continue
+			}
+			start, end, err := parsePeriodDate(words[i], text, rng.Start, defaultYear)
+			if err != nil {
+				return expr, fmt.Errorf("unexpected %q", words[i].text)
+			}
+			expr.Start, expr.End = start, end
+		}
+	}
+
+	return expr, nil
+}
+
+// parseEveryInterval handles "every N units", "every unit", "every 2nd day of
+// month", "every tuesday", "every 2nd monday of month", "every 15th march",
+// "every march 15th" and "every 12/31", each optionally followed by "of
+// month" or "of year" as hledger allows. It returns the index of the first
+// word after the interval.
+func parseEveryInterval(words []periodWord, i int) (int, ast.Interval, error) {
+	interval := ast.Interval{Count: 1}
+	ordinal := false
+
+	for ; i < len(words); i++ {
+		w := strings.ToLower(words[i].text)
+
+		if n, err := strconv.Atoi(w); err == nil && n > 0 {
+			interval.Count = n
+			continue
+		}
+		if isOrdinal(w) {
+			ordinal = true
+			continue
+		}
+		if unit, ok := periodUnits[w]; ok {
+			interval.Unit = unit
+			if i+2 < len(words) && strings.EqualFold(words[i+1].text, "of") {
+				if outer, ok := periodUnits[strings.ToLower(words[i+2].text)]; ok {
+					interval = ast.Interval{Unit: outer, Count: 1}
+					return i + 3, interval, nil
+				}
+			}
+			if ordinal && unit == ast.IntervalDay {
+				// "every 15th day" is a day of the month.
+				return i + 1, ast.Interval{Unit: ast.IntervalMonth, Count: 1}, nil
+			}
+			return i + 1, interval, nil
+		}
+		if periodWeekdays[w] {
+			if ordinal {
+				return skipPeriodOf(words, i+1, "month"), ast.Interval{Unit: ast.IntervalMonth, Count: 1}, nil
+			}
+			return i + 1, ast.Interval{Unit: ast.IntervalWeek, Count: 1}, nil
+		}
+		if periodMonths[w] {
+			next := i + 1
+			if !ordinal && next < len(words) && isOrdinal(strings.ToLower(words[next].text)) {
+				next++
+			}
+			return skipPeriodOf(words, next, "year"), ast.Interval{Unit: ast.IntervalYear, Count: 1}, nil
+		}
+		if !ordinal && isMonthDay(w) {
+			return skipPeriodOf(words, i+1, "year"), ast.Interval{Unit: ast.IntervalYear, Count: 1}, nil
+		}
+		break
+	}
+
+	return i, interval, fmt.Errorf("expected interval after \"every\"")
+}
+
+// skipPeriodOf returns the index after an "of unit" at words[i], or i when
+// there is none.
+func skipPeriodOf(words []periodWord, i int, unit string) int {
+	if i+1 < len(words) && strings.EqualFold(words[i].text, "of") && strings.EqualFold(words[i+1].text, unit) {
+		return i + 2
+	}
+	return i
+}
+
+// isMonthDay reports whether w is a month and day like 12/31 or 12-31.
+func isMonthDay(w string) bool {
+	for _, sep := range []string{"/", "-", "."} {
+		month, day, ok := strings.Cut(w, sep)
+		if !ok {
+			continue
+		}
+		m, errM := strconv.Atoi(month)
+		d, errD := strconv.Atoi(day)
+		return errM == nil && errD == nil && m >= 1 && m <= 12 && d >= 1 && d <= 31
+	}
+	return false
+}
+
+func isOrdinal(w string) bool {
+	if len(w) < 3 {
+		return false
+	}
+	switch w[len(w)-2:] {
+	case "st", "nd", "rd", "th":
+	default:
+		return false
+	}
+	_, err := strconv.Atoi(w[:len(w)-2])
+	return err == nil
+}
+
+// parsePeriodDate parses a (possibly partial) date inside a period expression
+// and returns the start of the span it denotes and the exclusive end.
+// "2024" spans a year, "2024-03" a month and "2024-03-15" a single day.
+// Month-day dates ("03-15") take their year from the Y directive.
+func parsePeriodDate(word periodWord, text string, base ast.Position, defaultYear int) (*ast.Date, *ast.Date, error) {
+	value := word.text
+	var sep string
+	for _, s := range []string{"-", "/", "."} {
+		if strings.Contains(value, s) {
+			sep = s
+			break
+		}
+	}
+
+	parts := []string{value}
+	if sep != "" {
+		parts = strings.Split(value, sep)
+	}
+
+	nums := make([]int, len(parts))
+	for i, part := range parts {
+		n, err := strconv.Atoi(part)
+		if err != nil {
+			return nil, nil, fmt.Errorf("invalid date: %s", value)
+		}
+		nums[i] = n
+	}
+
+	var start, end time.Time
+	switch {
+	case len(nums) == 1 && len(parts[0]) == 4:
+		start = time.Date(nums[0], time.January, 1, 0, 0, 0, 0, time.UTC)
+		end = start.AddDate(1, 0, 0)
+	case len(nums) == 2 && len(parts[0]) == 4:
+		if nums[1] < 1 || nums[1] > 12 {
+			return nil, nil, fmt.Errorf("invalid month: %s", value)
+		}
+		start = time.Date(nums[0], time.Month(nums[1]), 1, 0, 0, 0, 0, time.UTC)
+		end = start.AddDate(0, 1, 0)
+	case len(nums) == 2:
+		if defaultYear == 0 {
+			return nil, nil, fmt.Errorf("partial date requires Y directive: %s", value)
+		}
+		if nums[0] < 1 || nums[0] > 12 || nums[1] < 1 || nums[1] > 31 {
+			return nil, nil, fmt.Errorf("invalid date: %s", value)
+		}
+		start = time.Date(defaultYear, time.Month(nums[0]), nums[1], 0, 0, 0, 0, time.UTC)
+		end = start.AddDate(0, 0, 1)
+	case len(nums) == 3:
+		if nums[1] < 1 || nums[1] > 12 || nums[2] < 1 || nums[2] > 31 {
+			return nil, nil, fmt.Errorf("invalid date: %s", value)
+		}
+		start = time.Date(nums[0], time.Month(nums[1]), nums[2], 0, 0, 0, 0, time.UTC)
+		end = start.AddDate(0, 0, 1)
+	default:
+		return nil, nil, fmt.Errorf("invalid date: %s", value)
+	}
+
+	rng := periodWordRange(word, text, base)
+	return timeToDate(start, rng), timeToDate(end, rng), nil
+}
+
+func timeToDate(t time.Time, rng ast.Range) *ast.Date {
+	return &ast.Date{Year: t.Year(), Month: int(t.Month()), Day: t.Day(), Range: rng}
+}
+
+func periodWordRange(word periodWord, text string, base ast.Position) ast.Range {
+	startCol := base.Column + utf8.RuneCountInString(text[:word.offset])
+	return ast.Range{
+		Start: ast.Position{Line: base.Line, Column: startCol, Offset: base.Offset + word.offset},
+		End: ast.Position{
+			Line:   base.Line,
+			Column: startCol + utf8.RuneCountInString(word.text),
+			Offset: base.Offset + word.offset + len(word.text),
+		},
+	}
+}
+
+func splitPeriodWords(text string) []periodWord {
+	var words []periodWord
+	start := -1
+	for i := 0; i <= len(text); i++ {
+		if i == len(text) || text[i] == ' ' {
+			if start >= 0 {
+				words = append(words, periodWord{text: text[start:i], offset: start})
+				start = -1
+			}
+			continue
+		}
+		if start < 0 {
+			start = i
+		}
+	}
+	return words
+}
@@ -0,0 +1,242 @@
+package parser
+
+import (
+	"fmt"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/shopspring/decimal"
+
+	"github.com/juev/hledger-lsp/internal/ast"
+)
+
+type clockEntry struct {
+	code        byte
+	at          time.Time
+	date        ast.Date
+	account     ast.Account
+	description string
+	rng         ast.Range
+}
+
+// parseTimeclock reads a timeclock file: `i` (clock-in) and `o` (clock-out)
+// lines with a date, a time and, for clock-ins, an account and description.
+// Each in/out pair becomes a transaction with one unbalanced posting of the
+// session's hours to the account, one per day for a session that spans
+// midnight, as hledger does.
+func parseTimeclock(input string) (*ast.Journal, []ParseError) {
+	journal := &ast.Journal{}
+	var errs []ParseError
+	errorAt := func(code string, rng ast.Range, format string, args ...any) {
+		errs = append(errs, ParseError{
+			Code:    code,
+			Message: fmt.Sprintf(format, args...),
+			Pos:     Position{Line: rng.Start.Line, Column: rng.Start.Column, Offset: rng.Start.Offset},
+			End:     Position{Line: rng.End.Line, Column: rng.End.Column, Offset: rng.End.Offset},
+		})
+	}
+
+	var open *clockEntry
+	var lastOut time.Time
+	offset := 0
+	for i, line := range strings.Split(input, "\n") {
+		lineOffset := offset
+		offset += len(line) + 1
+		line = strings.TrimRight(line, "\r")
+
+		entry, err := parseClockLine(line, i+1, lineOffset)
+		if err != nil {
+			errorAt(err.code, err.rng, "%s", err.msg)
+			continue
+		}
+		if entry == nil {
+			continue
+		}
+
+		switch entry.code {
+		case 'i', 'I':
+			if open != nil {
+				errorAt("PARSE_UNMATCHED_CLOCK_IN", open.rng, "clock-in without a matching clock-out")
+			}
+			if entry.account.Name == "" {
+				errorAt("PARSE_EXPECTED_ACCOUNT", entry.rng, "expected account name")
+			}
+			if !lastOut.IsZero() && entry.at.Before(lastOut) {
+				errorAt("PARSE_OVERLAPPING_SESSION", entry.rng, "session overlaps the previous session")
+			}
+			open = entry
+		case 'o', 'O':
+			if open == nil {
+				errorAt("PARSE_UNMATCHED_CLOCK_OUT", entry.rng, "clock-out without a matching clock-in")
+				continue
+			}
+			if entry.at.Before(open.at) {
+				errorAt("PARSE_CLOCK_OUT_BEFORE_IN", entry.rng, "clock-out is before clock-in")
+				open = nil
+				continue
+			}
+			journal.Transactions = append(journal.Transactions, sessionTransactions(open, entry)...)
+			lastOut = entry.at
+			open = nil
+		}
+	}
+
+	if open != nil {
+		errorAt("PARSE_UNMATCHED_CLOCK_IN", open.rng, "clock-in without a matching clock-out")
+	}
+
+	return journal, errs
+}
+
+// sessionTransactions builds the transactions for a clock-in and its
+// clock-out: one per day the session covers, each with that day's hours.
+func sessionTransactions(in, out *clockEntry) []ast.Transaction {
+	var txs []ast.Transaction
+	date := in.date
+	for start := in.at; ; {
+		midnight := time.Date(start.Year(), start.Month(), start.Day()+1, 0, 0, 0, 0, time.UTC)
+		end := out.at
+		if midnight.Before(end) {
+			end = midnight
+		}
+		txs = append(txs, sessionTransaction(in, out, date, end.Sub(start)))
+		if !end.Before(out.at) {
+			return txs
+		}
+		start = end
+		date = ast.Date{Year: start.Year(), Month: int(start.Month()), Day: start.Day(), Range: in.date.Range}
+	}
+}
+
+// sessionTransaction builds the transaction for the part of a session on
+// date that lasted d.
+func sessionTransaction(in, out *clockEntry, date ast.Date, d time.Duration) ast.Transaction {
+	hours := decimal.NewFromFloat(d.Hours()).Round(2)
+
+	tx := ast.Transaction{
+		Date:        date,
+		Description: in.description,
+		Range:       ast.Range{Start: in.rng.Start, End: out.rng.End},
+	}
+	if out.code == 'O' {
+		tx.Status = ast.StatusCleared
+	}
+	tx.Postings = []ast.Posting{{
+		Account: in.account,
+		Amount: &ast.Amount{
+			Quantity:    hours,
+			RawQuantity: hours.StringFixed(2),
+			Commodity: ast.Commodity{
+				Symbol:   HoursCommodity,
+				Position: ast.CommodityRight,
+			},
+		},
+		Virtual: ast.VirtualUnbalanced,
+		Range:   in.rng,
+	}}
+	return tx
+}
+
+type clockLineError struct {
+	code string
+	msg  string
+	rng  ast.Range
+}
+
+// parseClockLine parses one line of a timeclock file. It returns nil for
+// blank and comment lines.
+func parseClockLine(line string, lineNum, lineOffset int) (*clockEntry, *clockLineError) {
+	if strings.TrimSpace(line) == "" || strings.ContainsRune(";#*", rune(line[0])) {
+		return nil, nil
+	}
+
+	pos := func(byteCol int) ast.Position {
+		return ast.Position{
+			Line:   lineNum,
+			Column: utf8.RuneCountInString(line[:byteCol]) + 1,
+			Offset: lineOffset + byteCol,
+		}
+	}
+	fail := func(code string, byteCol int, msg string) (*clockEntry, *clockLineError) {
+		return nil, &clockLineError{code: code, msg: msg, rng: ast.Range{Start: pos(byteCol), End: pos(len(line))}}
+	}
+
+	code := line[0]
+	if !strings.ContainsRune("iIoO", rune(code)) || (len(line) > 1 && line[1] != ' ' && line[1] != '\t') {
+		return fail("PARSE_EXPECTED_CLOCK_ENTRY", 0, "expected timeclock entry (i, o, I or O)")
+	}
+
+	col := skipBlanks(line, 1)
+	dateStr, next := nextField(line, col)
+	if dateStr == "" {
+		return fail("PARSE_EXPECTED_DATE", col, "expected date")
+	}
+	date, ok := parseTagDate(dateStr, 0)
+	if !ok || date.Year == 0 {
+		return fail("PARSE_INVALID_DATE", col, "invalid date: "+dateStr)
+	}
+	date.Range = ast.Range{Start: pos(col), End: pos(next)}
+
+	col = skipBlanks(line, next)
+	timeStr, next := nextField(line, col)
+	clock, ok := parseClockTime(timeStr)
+	if !ok {
+		return fail("PARSE_EXPECTED_TIME", col, "expected time HH:MM[:SS]")
+	}
+
+	entry := &clockEntry{
+		code: code,
+		at:   time.Date(date.Year, time.Month(date.Month), date.Day, 0, 0, 0, 0, time.UTC).Add(clock),
+		date: date,
+		rng:  ast.Range{Start: pos(0), End: pos(len(line))},
+	}
+
+	col = skipBlanks(line, next)
+	if code == 'i' || code == 'I' {
+		// The account ends at two spaces or a tab, like in a posting.
+		text := line[col:]
+		end := len(text)
+		if i := strings.Index(text, "  "); i >= 0 {
+			end = i
+		}
+		if i := strings.IndexByte(text, '\t'); i >= 0 && i < end {
+			end = i
+		}
+		account := strings.TrimRight(text[:end], " ")
+		if account != "" {
+			entry.account = ast.Account{
+				Name:  account,
+				Range: ast.Range{Start: pos(col), End: pos(col + len(account))},
+			}
+		}
+		entry.description = strings.TrimSpace(text[end:])
+	}
+
+	return entry, nil
+}
+
+func skipBlanks(line string, col int) int {
+	for col < len(line) && (line[col] == ' ' || line[col] == '\t') {
+		col++
+	}
+	return col
+}
+
+func nextField(line string, col int) (string, int) {
+	end := col
+	for end < len(line) && line[end] != ' ' && line[end] != '\t' {
+		end++
+	}
+	return line[col:end], end
+}
+
+// parseClockTime parses HH:MM or HH:MM:SS.
+func parseClockTime(s string) (time.Duration, bool) {
+	for _, layout := range []string{"15:04:05", "15:04"} {
+		if t, err := time.Parse(layout, s); err == nil {
+			return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute + time.Duration(t.Second())*time.Second, true
+		}
+	}
+	return 0, false
+}
@@ -0,0 +1,156 @@
+package parser
+
+import (
+	"testing"
+
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/juev/hledger-lsp/internal/ast"
+)
+
+func TestParseTimeclock_Sessions(t *testing.T) {
+	input := `; billable hours
+i 2024-01-15 09:00:00 client:acme  design review
+o 2024-01-15 12:30:00
+i 2024/01/16 13:00 client:globex
+O 2024/01/16 14:15
+`
+
+	journal, errs := ParseWithOptions(input, Options{Format: FormatTimeclock})
+	require.Empty(t, errs)
+	require.Len(t, journal.Transactions, 2)
+
+	tx := journal.Transactions[0]
+	assert.Equal(t, ast.Date{Year: 2024, Month: 1, Day: 15}, ast.Date{Year: tx.Date.Year, Month: tx.Date.Month, Day: tx.Date.Day})
+	assert.Equal(t, "design review", tx.Description)
+	assert.Equal(t, 2, tx.Range.Start.Line)
+	assert.Equal(t, 3, tx.Range.End.Line)
+	require.Len(t, tx.Postings, 1)
+
+	p := tx.Postings[0]
+	assert.Equal(t, "client:acme", p.Account.Name)
+	assert.Equal(t, 2, p.Account.Range.Start.Line)
+	assert.Equal(t, 23, p.Account.Range.Start.Column)
+	assert.Equal(t, 34, p.Account.Range.End.Column)
+	assert.Equal(t, ast.VirtualUnbalanced, p.Virtual)
+	require.NotNil(t, p.Amount)
+	assert.True(t, p.Amount.Quantity.Equal(decimal.RequireFromString("3.5")))
+	assert.Equal(t, HoursCommodity, p.Amount.Commodity.Symbol)
+
+	second := journal.Transactions[1]
+	assert.Equal(t, ast.StatusCleared, second.Status)
+	assert.Equal(t, "client:globex", second.Postings[0].Account.Name)
+	assert.True(t, second.Postings[0].Amount.Quantity.Equal(decimal.RequireFromString("1.25")))
+}
+
+func TestParseTimeclock_SessionOverMidnight(t *testing.T) {
+	input := `i 2024-01-15 22:00 client:acme  release
+o 2024-01-17 01:30
+`
+
+	journal, errs := ParseWithOptions(input, Options{Format: FormatTimeclock})
+	require.Empty(t, errs)
+	require.Len(t, journal.Transactions, 3)
+
+	for i, want := range []struct {
+		day   int
+		hours string
+	}{
+		{15, "2"},
+		{16, "24"},
+		{17, "1.5"},
+	} {
+		tx := journal.Transactions[i]
+		assert.Equal(t, want.day, tx.Date.Day, "session part %d", i)
+		assert.Equal(t, "release", tx.Description)
+		require.Len(t, tx.Postings, 1)
+		assert.True(t, tx.Postings[0].Amount.Quantity.Equal(decimal.RequireFromString(want.hours)),
+			"session part %d: got %s h", i, tx.Postings[0].Amount.Quantity)
+	}
+	assert.NotSame(t, &journal.Transactions[0].Postings[0], &journal.Transactions[1].Postings[0])
+}
+
+func TestParseTimeclock_Errors(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		err   string
+		line  int
+	}{
+		{
+			name:  "clock-in never closed",
+			input: "i 2024-01-15 09:00 client:acme\n",
+			err:   "clock-in without a matching clock-out",
+			line:  1,
+		},
+		{
+			name:  "clock-in while clocked in",
+			input: "i 2024-01-15 09:00 client:acme\ni 2024-01-15 10:00 client:acme\no 2024-01-15 11:00\n",
+			err:   "clock-in without a matching clock-out",
+			line:  1,
+		},
+		{
+			name:  "clock-out without clock-in",
+			input: "o 2024-01-15 11:00\n",
+			err:   "clock-out without a matching clock-in",
+			line:  1,
+		},
+		{
+			name:  "overlapping sessions",
+			input: "i 2024-01-15 09:00 client:acme\no 2024-01-15 11:00\ni 2024-01-15 10:30 client:acme\no 2024-01-15 12:00\n",
+			err:   "session overlaps the previous session",
+			line:  3,
+		},
+		{
+			name:  "clock-out before clock-in",
+			input: "i 2024-01-15 09:00 client:acme\no 2024-01-15 08:00\n",
+			err:   "clock-out is before clock-in",
+			line:  2,
+		},
+		{
+			name:  "bad time",
+			input: "i 2024-01-15 9am client:acme\n",
+			err:   "expected time",
+			line:  1,
+		},
+		{
+			name:  "unknown entry",
+			input: "x 2024-01-15 09:00\n",
+			err:   "expected timeclock entry",
+			line:  1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, errs := ParseWithOptions(tt.input, Options{Format: FormatTimeclock})
+			require.NotEmpty(t, errs)
+			assert.Contains(t, errs[0].Message, tt.err)
+			assert.Equal(t, tt.line, errs[0].Pos.Line)
+		})
+	}
+}
+
+func TestParser_IncludeFormatPrefix(t *testing.T) {
+	journal, errs := Parse("include timeclock:hours.txt\ninclude journal:other.j\ninclude plain.journal")
+	require.Empty(t, errs)
+	require.Len(t, journal.Includes, 3)
+
+	assert.Equal(t, "hours.txt", journal.Includes[0].Path)
+	assert.Equal(t, "timeclock", journal.Includes[0].Prefix)
+	assert.Equal(t, FormatTimeclock, FormatForInclude(journal.Includes[0], "hours.txt"))
+
+	assert.Equal(t, "other.j", journal.Includes[1].Path)
+	assert.Equal(t, FormatJournal, FormatForInclude(journal.Includes[1], "other.j"))
+
+	assert.Equal(t, "plain.journal", journal.Includes[2].Path)
+	assert.Empty(t, journal.Includes[2].Prefix)
+}
+
+func TestFormatForPath(t *testing.T) {
+	assert.Equal(t, FormatTimeclock, FormatForPath("/work/2024.timeclock"))
+	assert.Equal(t, FormatTimedot, FormatForPath("/work/2024.TIMEDOT"))
+	assert.Equal(t, FormatJournal, FormatForPath("/work/main.journal"))
+}
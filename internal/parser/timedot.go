@@ -0,0 +1,177 @@
+package parser
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/shopspring/decimal"
+
+	"github.com/juev/hledger-lsp/internal/ast"
+)
+
+// timedotUnits are the hours in one of each unit a timedot quantity may be
+// written in. A bare number is hours.
+var timedotUnits = map[string]decimal.Decimal{
+	"":   decimal.NewFromInt(1),
+	"s":  decimal.NewFromInt(1).Div(decimal.NewFromInt(3600)),
+	"m":  decimal.NewFromInt(1).Div(decimal.NewFromInt(60)),
+	"h":  decimal.NewFromInt(1),
+	"d":  decimal.NewFromInt(24),
+	"w":  decimal.NewFromInt(24 * 7),
+	"mo": decimal.NewFromInt(24 * 30),
+	"y":  decimal.NewFromInt(24 * 365),
+}
+
+var quarterHour = decimal.RequireFromString("0.25")
+
+// parseTimedot reads a timedot file: date lines, each followed by lines of an
+// account and the time spent on it that day, written as dots (a quarter hour
+// each) or as a number with an optional unit. Every entry becomes a
+// transaction with one unbalanced posting of its hours, as hledger does.
+// Partial dates take defaultYear.
+func parseTimedot(input string, defaultYear int) (*ast.Journal, []ParseError) {
+	journal := &ast.Journal{}
+	var errs []ParseError
+
+	var day *ast.Transaction
+	offset := 0
+	for i, line := range strings.Split(input, "\n") {
+		lineOffset := offset
+		offset += len(line) + 1
+		line = strings.TrimRight(line, "\r")
+
+		pos := func(byteCol int) ast.Position {
+			return ast.Position{
+				Line:   i + 1,
+				Column: utf8.RuneCountInString(line[:byteCol]) + 1,
+				Offset: lineOffset + byteCol,
+			}
+		}
+		errorAt := func(code string, byteCol int, format string, args ...any) {
+			start, end := pos(byteCol), pos(len(line))
+			errs = append(errs, ParseError{
+				Code:    code,
+				Message: fmt.Sprintf(format, args...),
+				Pos:     Position{Line: start.Line, Column: start.Column, Offset: start.Offset},
+				End:     Position{Line: end.Line, Column: end.Column, Offset: end.Offset},
+			})
+		}
+		comment := func(byteCol int) {
+			journal.Comments = append(journal.Comments, ast.Comment{
+				Text:  strings.TrimSpace(line[byteCol+1:]),
+				Range: ast.Range{Start: pos(byteCol), End: pos(len(line))},
+			})
+		}
+
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		if line[0] == '#' || line[0] == ';' {
+			comment(0)
+			continue
+		}
+
+		// A date line may be an org-mode heading, such as `* 2024-01-15`.
+		col := 0
+		if line[0] == '*' {
+			col = skipBlanks(line, len(line)-len(strings.TrimLeft(line, "*")))
+		}
+		if dateStr, next := nextField(line, col); startsWithDigit(dateStr) {
+			date, ok := parseTagDate(dateStr, defaultYear)
+			if !ok || date.Year == 0 {
+				errorAt("PARSE_INVALID_DATE", col, "invalid date: %s", dateStr)
+				day = nil
+				continue
+			}
+			date.Range = ast.Range{Start: pos(col), End: pos(next)}
+			rest, _, _ := strings.Cut(line[next:], ";")
+			day = &ast.Transaction{Date: date, Description: strings.TrimSpace(rest)}
+			continue
+		}
+		if line[0] == '*' {
+			comment(0)
+			continue
+		}
+
+		col = skipBlanks(line, 0)
+		text := line[col:]
+		end := len(text)
+		if n := strings.Index(text, "  "); n >= 0 {
+			end = n
+		}
+		if n := strings.IndexByte(text, '\t'); n >= 0 && n < end {
+			end = n
+		}
+		account := strings.TrimRight(text[:end], " ")
+		if day == nil {
+			errorAt("PARSE_EXPECTED_DATE", col, "expected a date line before time entries")
+			continue
+		}
+
+		qtyStart := skipBlanks(line, col+end)
+		qtyEnd := len(line)
+		if n := strings.IndexAny(line[qtyStart:], ";#"); n >= 0 {
+			qtyEnd = qtyStart + n
+			comment(qtyEnd)
+		}
+		qtyText := strings.TrimRight(line[qtyStart:qtyEnd], " \t")
+		hours, ok := parseTimedotQuantity(qtyText)
+		if !ok {
+			errorAt("PARSE_INVALID_AMOUNT", qtyStart, "invalid timedot quantity: %s", qtyText)
+			continue
+		}
+
+		tx := *day
+		tx.Range = ast.Range{Start: pos(0), End: pos(len(line))}
+		tx.Postings = []ast.Posting{{
+			Account: ast.Account{
+				Name:  account,
+				Range: ast.Range{Start: pos(col), End: pos(col + len(account))},
+			},
+			Amount: &ast.Amount{
+				Quantity:    hours,
+				RawQuantity: hours.StringFixed(2),
+				Commodity: ast.Commodity{
+					Symbol:   HoursCommodity,
+					Position: ast.CommodityRight,
+				},
+				Range: ast.Range{Start: pos(qtyStart), End: pos(qtyStart + len(qtyText))},
+			},
+			Virtual: ast.VirtualUnbalanced,
+			Range:   tx.Range,
+		}}
+		journal.Transactions = append(journal.Transactions, tx)
+	}
+
+	return journal, errs
+}
+
+// parseTimedotQuantity returns the hours a timedot quantity stands for:
+// dots, optionally grouped with spaces, or a number with an optional unit.
+// An empty quantity is zero hours.
+func parseTimedotQuantity(s string) (decimal.Decimal, bool) {
+	if strings.Trim(s, ". ") == "" {
+		return quarterHour.Mul(decimal.NewFromInt(int64(strings.Count(s, ".")))), true
+	}
+
+	numEnd := strings.IndexFunc(s, func(r rune) bool {
+		return (r < '0' || r > '9') && r != '.'
+	})
+	if numEnd < 0 {
+		numEnd = len(s)
+	}
+	unit, ok := timedotUnits[s[numEnd:]]
+	if numEnd == 0 || !ok {
+		return decimal.Zero, false
+	}
+	n, err := decimal.NewFromString(s[:numEnd])
+	if err != nil {
+		return decimal.Zero, false
+	}
+	return n.Mul(unit).Round(2), true
+}
+
+func startsWithDigit(s string) bool {
+	return s != "" && s[0] >= '0' && s[0] <= '9'
+}
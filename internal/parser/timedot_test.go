@@ -0,0 +1,139 @@
+package parser
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/juev/hledger-lsp/internal/ast"
+)
+
+func TestParseTimedot_Entries(t *testing.T) {
+	input := `# time log
+2024-01-15 sprint planning
+fos:hledger  .... ..
+fos:haskell  1.5
+biz:research  30m  ; reading
+
+* 2024-01-16
+inc:client1  .... .... ; billable
+`
+
+	journal, errs := ParseWithOptions(input, Options{Format: FormatTimedot})
+	require.Empty(t, errs)
+	require.Len(t, journal.Transactions, 4)
+
+	tests := []struct {
+		account string
+		hours   string
+		day     int
+		line    int
+	}{
+		{"fos:hledger", "1.5", 15, 3},
+		{"fos:haskell", "1.5", 15, 4},
+		{"biz:research", "0.5", 15, 5},
+		{"inc:client1", "2", 16, 8},
+	}
+	for i, tt := range tests {
+		tx := journal.Transactions[i]
+		require.Len(t, tx.Postings, 1)
+		p := tx.Postings[0]
+		assert.Equal(t, tt.account, p.Account.Name)
+		assert.Equal(t, tt.hours, p.Amount.Quantity.String())
+		assert.Equal(t, HoursCommodity, p.Amount.Commodity.Symbol)
+		assert.Equal(t, ast.VirtualUnbalanced, p.Virtual)
+		assert.Equal(t, tt.day, tx.Date.Day)
+		assert.Equal(t, tt.line, tx.Range.Start.Line)
+	}
+
+	first := journal.Transactions[0]
+	assert.Equal(t, "sprint planning", first.Description)
+	assert.Equal(t, ast.Range{
+		Start: ast.Position{Line: 3, Column: 14, Offset: 51},
+		End:   ast.Position{Line: 3, Column: 21, Offset: 58},
+	}, first.Postings[0].Amount.Range)
+	assert.Equal(t, 7, journal.Transactions[3].Date.Range.Start.Line)
+	assert.Equal(t, 3, journal.Transactions[3].Date.Range.Start.Column)
+
+	require.Len(t, journal.Comments, 3)
+	assert.Equal(t, "time log", journal.Comments[0].Text)
+	assert.Equal(t, "reading", journal.Comments[1].Text)
+	assert.Equal(t, "billable", journal.Comments[2].Text)
+}
+
+func TestParseTimedot_Quantities(t *testing.T) {
+	tests := []struct {
+		quantity string
+		hours    string
+	}{
+		{"", "0"},
+		{".", "0.25"},
+		{".... ....", "2"},
+		{"2", "2"},
+		{"2h", "2"},
+		{"90m", "1.5"},
+		{"1800s", "0.5"},
+		{"1d", "24"},
+		{"1w", "168"},
+		{"1mo", "720"},
+		{"1y", "8760"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.quantity, func(t *testing.T) {
+			hours, ok := parseTimedotQuantity(tt.quantity)
+			require.True(t, ok)
+			assert.Equal(t, tt.hours, hours.String())
+		})
+	}
+
+	for _, bad := range []string{"2x", "abc", ". 2"} {
+		_, ok := parseTimedotQuantity(bad)
+		assert.False(t, ok, bad)
+	}
+}
+
+func TestParseTimedot_DefaultYear(t *testing.T) {
+	journal, errs := ParseWithOptions("01/15\nfos:hledger  ..\n", Options{Format: FormatTimedot, DefaultYear: 2023})
+	require.Empty(t, errs)
+	require.Len(t, journal.Transactions, 1)
+	assert.Equal(t, 2023, journal.Transactions[0].Date.Year)
+}
+
+func TestParseTimedot_Errors(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		err   string
+		line  int
+	}{
+		{
+			name:  "entry before any date",
+			input: "fos:hledger  ..\n",
+			err:   "expected a date line before time entries",
+			line:  1,
+		},
+		{
+			name:  "bad quantity",
+			input: "2024-01-15\nfos:hledger  2x\n",
+			err:   "invalid timedot quantity: 2x",
+			line:  2,
+		},
+		{
+			name:  "bad date",
+			input: "2024-13-15\nfos:hledger  ..\n",
+			err:   "invalid date: 2024-13-15",
+			line:  1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, errs := ParseWithOptions(tt.input, Options{Format: FormatTimedot})
+			require.NotEmpty(t, errs)
+			assert.Equal(t, tt.err, errs[0].Message)
+			assert.Equal(t, tt.line, errs[0].Pos.Line)
+		})
+	}
+}
@@ -27,7 +27,15 @@ const (
 	TokenPipe
 	TokenColon
 	TokenSemicolon
-	TokenSign // + or - before commodity symbol
+	TokenSign         // + or - before commodity symbol
+	TokenTilde        // ~ starting a periodic transaction
+	TokenPeriod       // period expression after ~
+	TokenQuery        // query after = starting an auto posting rule
+	TokenCommentBlock // comment ... end comment block, spanning several lines
+	TokenLBrace       // { opening a lot cost
+	TokenRBrace       // }
+	TokenLDoubleBrace // {{ opening a total lot cost
+	TokenRDoubleBrace // }}
 )
 
 type Position struct {
@@ -49,7 +57,8 @@ func (t TokenType) String() string {
 		"Text", "Account", "Number", "Commodity", "Comment",
 		"Directive", "Tag", "At", "AtAt", "Equals", "DoubleEquals",
 		"LParen", "RParen", "LBracket", "RBracket", "Pipe", "Colon", "Semicolon",
-		"Sign",
+		"Sign", "Tilde", "Period", "Query", "CommentBlock",
+		"LBrace", "RBrace", "LDoubleBrace", "RDoubleBrace",
 	}
 	if int(t) < len(names) {
 		return names[t]
@@ -0,0 +1,539 @@
+package rules
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Entry is the journal transaction made from one CSV record.
+type Entry struct {
+	// Record is the one-based number of the CSV record, counting the
+	// skipped ones.
+	Record int
+	Date   string
+	Text   string
+}
+
+// maxPostings is the highest posting number a rules file can assign, as in
+// `account9`.
+const maxPostings = 9
+
+// Convert applies the rules to the records of a CSV file and returns a
+// transaction for each record that is not skipped, sorted by date. Records
+// that cannot be converted are reported as errors and left out.
+func (f *File) Convert(records [][]string) ([]Entry, []error) {
+	c := converter{file: f, fields: make(map[string]int), patterns: make(map[string]*regexp.Regexp)}
+	for _, field := range f.Fields {
+		c.fields[field.Name] = field.Column
+	}
+
+	skip := 0
+	if st, ok := f.Statement("skip"); ok {
+		skip = 1
+		if n, err := strconv.Atoi(st.Value); err == nil {
+			skip = n
+		}
+	}
+
+	var entries []Entry
+	var errs []error
+	for i := skip; i < len(records); i++ {
+		text, date, action, err := c.convert(records[i])
+		if err != nil {
+			errs = append(errs, fmt.Errorf("record %d: %w", i+1, err))
+			continue
+		}
+		if action == actionEnd {
+			break
+		}
+		if action == actionSkip {
+			continue
+		}
+		entries = append(entries, Entry{Record: i + 1, Date: date, Text: text})
+	}
+
+	if _, ok := f.Statement("newest-first"); ok {
+		reverseEntries(entries)
+	}
+	if _, ok := f.Statement("intra-day-reversed"); ok {
+		for start := 0; start < len(entries); {
+			end := start + 1
+			for end < len(entries) && entries[end].Date == entries[start].Date {
+				end++
+			}
+			reverseEntries(entries[start:end])
+			start = end
+		}
+	}
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].Date < entries[j].Date
+	})
+
+	return entries, errs
+}
+
+func reverseEntries(entries []Entry) {
+	for i, j := 0, len(entries)-1; i < j; i, j = i+1, j-1 {
+		entries[i], entries[j] = entries[j], entries[i]
+	}
+}
+
+type recordAction int
+
+const (
+	actionConvert recordAction = iota
+	actionSkip
+	actionEnd
+)
+
+type converter struct {
+	file     *File
+	fields   map[string]int
+	patterns map[string]*regexp.Regexp
+}
+
+// assignments returns the hledger fields assigned for a record. Fields the
+// `fields` directive names after hledger fields come first, then top-level
+// assignments, then those of matching `if` blocks, the last one winning.
+func (c *converter) assignments(record []string) (map[string]string, recordAction, error) {
+	assigned := make(map[string]string)
+	for _, field := range c.file.Fields {
+		if (Statement{Name: field.Name}).IsAssignment() {
+			assigned[field.Name] = "%" + field.Name
+		}
+	}
+	for _, st := range c.file.Statements {
+		if st.IsAssignment() {
+			assigned[st.Name] = st.Value
+		}
+	}
+
+	action := actionConvert
+	for _, block := range c.file.Blocks {
+		if block.Table {
+			for _, row := range block.Rows {
+				ok, err := c.matches([]Matcher{row.Matcher}, record)
+				if err != nil {
+					return nil, action, err
+				}
+				if !ok {
+					continue
+				}
+				for i, value := range row.Values {
+					if i < len(block.TableFields) {
+						assigned[block.TableFields[i]] = value
+					}
+				}
+			}
+			continue
+		}
+
+		ok, err := c.matches(block.Matchers, record)
+		if err != nil {
+			return nil, action, err
+		}
+		if !ok {
+			continue
+		}
+		for _, st := range block.Assignments {
+			switch {
+			case st.Name == "skip":
+				action = max(action, actionSkip)
+			case st.Name == "end":
+				action = actionEnd
+			case st.IsAssignment():
+				assigned[st.Name] = st.Value
+			}
+		}
+	}
+
+	for name, value := range assigned {
+		assigned[name] = strings.TrimSpace(c.interpolate(value, record))
+	}
+	return assigned, action, nil
+}
+
+// matches reports whether a record satisfies a block's matchers. Matchers
+// on separate lines are alternatives; one starting with `&` must hold
+// together with the one before it.
+func (c *converter) matches(matchers []Matcher, record []string) (bool, error) {
+	matched, group := false, true
+	for i, m := range matchers {
+		if i > 0 && !m.And {
+			matched = matched || group
+			group = true
+		}
+		ok, err := c.match(m, record)
+		if err != nil {
+			return false, err
+		}
+		group = group && ok
+	}
+	return len(matchers) > 0 && (matched || group), nil
+}
+
+// match tests a matcher's pattern, case-insensitively, against the field it
+// names or else the whole record.
+func (c *converter) match(m Matcher, record []string) (bool, error) {
+	re, ok := c.patterns[m.Pattern]
+	if !ok {
+		var err error
+		re, err = regexp.Compile("(?i)" + m.Pattern)
+		if err != nil {
+			return false, fmt.Errorf("invalid matcher %q: %w", m.Pattern, err)
+		}
+		c.patterns[m.Pattern] = re
+	}
+
+	text := strings.Join(record, ",")
+	if m.Field != "" {
+		text = c.field(m.Field, record)
+	}
+	return re.MatchString(text) != m.Negated, nil
+}
+
+// field returns the value of a named or numbered CSV field.
+func (c *converter) field(name string, record []string) string {
+	col, ok := c.fields[name]
+	if !ok {
+		n, err := strconv.Atoi(name)
+		if err != nil {
+			return ""
+		}
+		col = n - 1
+	}
+	if col < 0 || col >= len(record) {
+		return ""
+	}
+	return strings.TrimSpace(record[col])
+}
+
+// interpolate replaces the `%FIELD` references of a field assignment with
+// the values of the record. References to unknown names are kept.
+func (c *converter) interpolate(value string, record []string) string {
+	var sb strings.Builder
+	for i := 0; i < len(value); i++ {
+		name := ""
+		if value[i] == '%' {
+			name = referenceName.FindString(value[i+1:])
+		}
+		if _, named := c.fields[name]; name == "" || (!named && !isNumber(name)) {
+			sb.WriteByte(value[i])
+			continue
+		}
+		sb.WriteString(c.field(name, record))
+		i += len(name)
+	}
+	return sb.String()
+}
+
+type posting struct {
+	account string
+	amount  string
+	balance string
+	comment string
+}
+
+// convert makes the journal text of one record.
+func (c *converter) convert(record []string) (text, date string, action recordAction, err error) {
+	assigned, action, err := c.assignments(record)
+	if err != nil || action != actionConvert {
+		return "", "", action, err
+	}
+
+	date, err = c.date(assigned["date"])
+	if err != nil {
+		return "", "", action, err
+	}
+	date2 := ""
+	if assigned["date2"] != "" {
+		if date2, err = c.date(assigned["date2"]); err != nil {
+			return "", "", action, err
+		}
+	}
+
+	postings, err := c.postings(assigned)
+	if err != nil {
+		return "", "", action, err
+	}
+
+	var sb strings.Builder
+	sb.WriteString(date)
+	if date2 != "" {
+		sb.WriteString("=" + date2)
+	}
+	if status := assigned["status"]; status != "" {
+		sb.WriteString(" " + status)
+	}
+	if code := assigned["code"]; code != "" {
+		sb.WriteString(" (" + code + ")")
+	}
+	if description := assigned["description"]; description != "" {
+		sb.WriteString(" " + description)
+	}
+	if comment := assigned["comment"]; comment != "" {
+		sb.WriteString("  ; " + comment)
+	}
+	sb.WriteString("\n")
+
+	width := 0
+	for _, p := range postings {
+		width = max(width, len(p.account))
+	}
+	for _, p := range postings {
+		line := "    " + p.account
+		if p.amount != "" || p.balance != "" {
+			line += strings.Repeat(" ", width-len(p.account)+2) + p.amount
+		}
+		if p.balance != "" {
+			line += " = " + p.balance
+		}
+		if p.comment != "" {
+			line += "  ; " + p.comment
+		}
+		sb.WriteString(strings.TrimRight(line, " ") + "\n")
+	}
+
+	return sb.String(), date, action, nil
+}
+
+// postings makes the postings of a record from the numbered account,
+// amount, balance and comment fields. An unnumbered amount goes to the
+// first posting, and its negation to the second one, unless they have
+// amounts of their own. Postings without an account go to
+// `expenses:unknown`, or `income:unknown` for a negative amount.
+func (c *converter) postings(assigned map[string]string) ([]posting, error) {
+	var slots [maxPostings + 1]posting
+	for n := 1; n <= maxPostings; n++ {
+		suffix := strconv.Itoa(n)
+		amount, err := c.amount(assigned, "amount"+suffix)
+		if err != nil {
+			return nil, err
+		}
+		slots[n] = posting{
+			account: assigned["account"+suffix],
+			amount:  amount,
+			balance: c.cleanAmount(assigned["balance"+suffix]),
+			comment: assigned["comment"+suffix],
+		}
+	}
+	if slots[1].balance == "" {
+		slots[1].balance = c.cleanAmount(assigned["balance"])
+	}
+
+	amount, err := c.amount(assigned, "amount")
+	if err != nil {
+		return nil, err
+	}
+	if amount != "" && slots[1].amount == "" {
+		slots[1].amount = amount
+		if slots[2].amount == "" {
+			slots[2].amount = negate(amount)
+		}
+	}
+
+	var postings []posting
+	for n := 1; n <= maxPostings; n++ {
+		p := slots[n]
+		if p.account == "" && p.amount == "" && p.balance == "" {
+			continue
+		}
+		for _, amount := range []string{p.amount, p.balance} {
+			if amount != "" && !strings.ContainsAny(amount, "0123456789") {
+				return nil, fmt.Errorf("cannot parse amount %q", amount)
+			}
+		}
+		if p.account == "" {
+			p.account = "expenses:unknown"
+			if strings.HasPrefix(p.amount, "-") {
+				p.account = "income:unknown"
+			}
+		}
+
+		currency := assigned["currency"+strconv.Itoa(n)]
+		if currency == "" {
+			currency = assigned["currency"]
+		}
+		p.amount = withCurrency(p.amount, currency)
+		p.balance = withCurrency(p.balance, currency)
+		postings = append(postings, p)
+	}
+	return postings, nil
+}
+
+// amount returns the amount assigned to a field such as `amount1`, or the
+// non-zero one of its `-in` and `-out` variants, the latter negated.
+func (c *converter) amount(assigned map[string]string, name string) (string, error) {
+	if amount := c.cleanAmount(assigned[name]); amount != "" {
+		return amount, nil
+	}
+
+	in := c.cleanAmount(assigned[name+"-in"])
+	out := c.cleanAmount(assigned[name+"-out"])
+	switch {
+	case !isZero(in) && !isZero(out):
+		return "", fmt.Errorf("both %s-in and %s-out have a value: %s, %s", name, name, in, out)
+	case !isZero(in):
+		return in, nil
+	case !isZero(out):
+		return negate(out), nil
+	case in != "":
+		return in, nil
+	default:
+		return out, nil
+	}
+}
+
+// cleanAmount normalizes a CSV amount: parentheses and a double minus mean
+// a negative amount, a leading plus is dropped, and under a `decimal-mark ,`
+// directive the number is rewritten with a period.
+func (c *converter) cleanAmount(amount string) string {
+	amount = strings.TrimSpace(amount)
+	if strings.HasPrefix(amount, "(") && strings.HasSuffix(amount, ")") {
+		amount = negate(strings.TrimSpace(amount[1 : len(amount)-1]))
+	}
+	amount = strings.TrimPrefix(amount, "+")
+	if strings.HasPrefix(amount, "--") {
+		amount = amount[2:]
+	}
+	if st, ok := c.file.Statement("decimal-mark"); ok && st.Value == "," {
+		amount = strings.NewReplacer(".", "", " ", "", ",", ".").Replace(amount)
+	}
+	return amount
+}
+
+func negate(amount string) string {
+	if amount == "" {
+		return ""
+	}
+	if strings.HasPrefix(amount, "-") {
+		return amount[1:]
+	}
+	return "-" + amount
+}
+
+func isZero(amount string) bool {
+	return strings.Trim(amount, "-+0.,$€£ ") == ""
+}
+
+// withCurrency puts a currency before an amount, with a space when the
+// currency is a word such as `EUR`.
+func withCurrency(amount, currency string) string {
+	if amount == "" || currency == "" {
+		return amount
+	}
+	if r := currency[len(currency)-1]; (r >= 'A' && r <= 'Z') || (r >= 'a' && r <= 'z') {
+		return currency + " " + amount
+	}
+	return currency + amount
+}
+
+// date parses a CSV date with the layouts of the `date-format` directive,
+// or else as a year-first date, and returns it as YYYY-MM-DD.
+func (c *converter) date(value string) (string, error) {
+	if value == "" {
+		return "", fmt.Errorf("no date assigned")
+	}
+
+	formats := []string{"%Y-%m-%d", "%Y/%m/%d", "%Y.%m.%d"}
+	if st, ok := c.file.Statement("date-format"); ok && st.Value != "" {
+		formats = []string{st.Value}
+	}
+	for _, format := range formats {
+		if t, ok := parseDate(value, format); ok {
+			return t.Format("2006-01-02"), nil
+		}
+	}
+	return "", fmt.Errorf("cannot parse date %q", value)
+}
+
+var monthNames = []string{"jan", "feb", "mar", "apr", "may", "jun", "jul", "aug", "sep", "oct", "nov", "dec"}
+
+// parseDate reads a date in a strftime-style format. Only the year, month
+// and day are kept; time and time zone fields are read and ignored.
+func parseDate(value, format string) (time.Time, bool) {
+	year, month, day := 0, 1, 1
+	v := 0
+	for i := 0; i < len(format); i++ {
+		if format[i] != '%' || i+1 == len(format) {
+			if v >= len(value) || value[v] != format[i] {
+				return time.Time{}, false
+			}
+			v++
+			continue
+		}
+
+		i++
+		if format[i] == '-' && i+1 < len(format) {
+			i++
+		}
+		var n int
+		var ok bool
+		switch format[i] {
+		case 'Y':
+			year, v, ok = readNumber(value, v, 4)
+		case 'y':
+			n, v, ok = readNumber(value, v, 2)
+			year = 2000 + n
+			if n >= 69 {
+				year = 1900 + n
+			}
+		case 'm':
+			month, v, ok = readNumber(value, v, 2)
+		case 'd', 'e':
+			v = skipBlanks(value, v)
+			day, v, ok = readNumber(value, v, 2)
+		case 'b', 'h', 'B':
+			month, v, ok = readMonth(value, v)
+		case 'H', 'I', 'M', 'S':
+			_, v, ok = readNumber(value, v, 2)
+		case 'p', 'Z', 'z', 'a', 'A':
+			start := v
+			for v < len(value) && value[v] != ' ' && value[v] != '\t' {
+				v++
+			}
+			ok = v > start
+		case '%':
+			ok = v < len(value) && value[v] == '%'
+			v++
+		}
+		if !ok {
+			return time.Time{}, false
+		}
+	}
+	if v != len(value) || month < 1 || month > 12 {
+		return time.Time{}, false
+	}
+
+	t := time.Date(year, time.Month(month), day, 0, 0, 0, 0, time.UTC)
+	return t, t.Day() == day
+}
+
+// readNumber reads up to width digits at byte v.
+func readNumber(s string, v, width int) (int, int, bool) {
+	start := v
+	for v < len(s) && v-start < width && s[v] >= '0' && s[v] <= '9' {
+		v++
+	}
+	n, err := strconv.Atoi(s[start:v])
+	return n, v, err == nil
+}
+
+// readMonth reads an English month name, full or abbreviated, at byte v.
+func readMonth(s string, v int) (int, int, bool) {
+	start := v
+	for v < len(s) && ((s[v] >= 'A' && s[v] <= 'Z') || (s[v] >= 'a' && s[v] <= 'z')) {
+		v++
+	}
+	word := strings.ToLower(s[start:v])
+	for i, name := range monthNames {
+		if len(word) >= 3 && strings.HasPrefix(word, name) {
+			return i + 1, v, true
+		}
+	}
+	return 0, v, false
+}
@@ -0,0 +1,161 @@
+package rules
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func convert(t *testing.T, rules string, records [][]string) ([]Entry, []error) {
+	t.Helper()
+	f, errs := Parse(rules)
+	require.Empty(t, errs)
+	return f.Convert(records)
+}
+
+func TestConvert(t *testing.T) {
+	rules := `skip 1
+fields date, description, , amount, balance
+date-format %d/%m/%Y
+account1 assets:bank
+currency $
+
+if grocer
+    account2 expenses:food
+    comment  imported
+
+if %description ^fee
+    skip
+`
+	records := [][]string{
+		{"Date", "Description", "Ref", "Amount", "Balance"},
+		{"16/01/2024", "Grocer", "r1", "-12.50", "87.50"},
+		{"15/01/2024", "Salary", "r2", "100", "100"},
+		{"17/01/2024", "Fee", "r3", "-1", "86.50"},
+	}
+
+	entries, errs := convert(t, rules, records)
+	require.Empty(t, errs)
+	require.Len(t, entries, 2)
+
+	assert.Equal(t, 3, entries[0].Record)
+	assert.Equal(t, "2024-01-15", entries[0].Date)
+	assert.Equal(t, "2024-01-15 Salary\n"+
+		"    assets:bank     $100 = $100\n"+
+		"    income:unknown  $-100\n", entries[0].Text)
+
+	assert.Equal(t, "2024-01-16 Grocer  ; imported\n"+
+		"    assets:bank    $-12.50 = $87.50\n"+
+		"    expenses:food  $12.50\n", entries[1].Text)
+}
+
+func TestConvert_AmountInOut(t *testing.T) {
+	rules := `fields date, payee, in, out
+amount-in %in
+amount-out %out
+account1 assets:bank
+description %payee
+currency EUR
+`
+	entries, errs := convert(t, rules, [][]string{
+		{"2024-02-01", "Shop", "", "(5.00)"},
+		{"2024-02-02", "Refund", "3,00", "0"},
+		{"2024-02-03", "Both", "1", "1"},
+	})
+	require.Len(t, errs, 1)
+	assert.Contains(t, errs[0].Error(), "record 3: both amount-in and amount-out have a value")
+
+	require.Len(t, entries, 2)
+	assert.Contains(t, entries[0].Text, "    assets:bank     EUR 5.00\n")
+	assert.Contains(t, entries[0].Text, "    income:unknown  EUR -5.00\n")
+	assert.Contains(t, entries[1].Text, "    assets:bank     EUR 3,00\n")
+}
+
+func TestConvert_TableAndNumberedPostings(t *testing.T) {
+	rules := `fields date, description, amount
+decimal-mark ,
+account1 assets:bank
+amount1 %amount
+account2 assets:savings
+amount2 1,00
+account3 expenses:misc
+
+if,account3,comment3
+coffee,expenses:coffee,%description
+`
+	entries, errs := convert(t, rules, [][]string{{"2024/03/01", "Coffee bar", "-1.234,50"}})
+	require.Empty(t, errs)
+	require.Len(t, entries, 1)
+	assert.Equal(t, "2024-03-01 Coffee bar\n"+
+		"    assets:bank      -1234.50\n"+
+		"    assets:savings   1.00\n"+
+		"    expenses:coffee  ; Coffee bar\n", entries[0].Text)
+}
+
+func TestConvert_NewestFirstAndEnd(t *testing.T) {
+	rules := `fields date, description, amount
+newest-first
+
+if stop
+    end
+`
+	entries, errs := convert(t, rules, [][]string{
+		{"2024-01-02", "b", "1"},
+		{"2024-01-02", "a", "2"},
+		{"2024-01-01", "c", "3"},
+		{"2024-01-01", "stop", "4"},
+		{"2024-01-01", "never", "5"},
+	})
+	require.Empty(t, errs)
+
+	var order []int
+	for _, e := range entries {
+		order = append(order, e.Record)
+	}
+	assert.Equal(t, []int{3, 2, 1}, order)
+}
+
+func TestConvert_Matchers(t *testing.T) {
+	rules := `fields date, description, amount
+account1 assets:bank
+
+if coffee
+tea
+& !%amount ^-
+    account2 expenses:drinks
+`
+	entries, errs := convert(t, rules, [][]string{
+		{"2024-01-01", "Coffee", "-1"},
+		{"2024-01-02", "Tea", "-1"},
+		{"2024-01-03", "Tea", "1"},
+	})
+	require.Empty(t, errs)
+	require.Len(t, entries, 3)
+	assert.Contains(t, entries[0].Text, "expenses:drinks")
+	assert.NotContains(t, entries[1].Text, "expenses:drinks")
+	assert.Contains(t, entries[2].Text, "expenses:drinks")
+}
+
+func TestParseDate(t *testing.T) {
+	tests := []struct {
+		value  string
+		format string
+		want   string
+	}{
+		{"2024-01-15", "%Y-%m-%d", "2024-01-15"},
+		{"1/2/24", "%-m/%-d/%y", "2024-01-02"},
+		{"15 Mar 2024", "%d %b %Y", "2024-03-15"},
+		{"2024-01-15 13:45:00", "%Y-%m-%d %H:%M:%S", "2024-01-15"},
+	}
+	for _, tt := range tests {
+		got, ok := parseDate(tt.value, tt.format)
+		require.True(t, ok, tt.value)
+		assert.Equal(t, tt.want, got.Format("2006-01-02"))
+	}
+
+	_, ok := parseDate("31/02/2024", "%d/%m/%Y")
+	assert.False(t, ok)
+	_, ok = parseDate("2024-01-15x", "%Y-%m-%d")
+	assert.False(t, ok)
+}
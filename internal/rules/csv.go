@@ -0,0 +1,133 @@
+package rules
+
+import (
+	"encoding/csv"
+	"os"
+	"path/filepath"
+	"strings"
+	"unicode/utf8"
+)
+
+// CSVPath returns the CSV file a rules file at rulesPath converts: the one
+// named by its `source` directive, the newest match when that is a glob, or
+// else the rules path without its `.rules` extension, with `.csv` added
+// when nothing else is left, as in `bank.rules` for `bank.csv`.
+func (f *File) CSVPath(rulesPath string) string {
+	dir := filepath.Dir(rulesPath)
+
+	if st, ok := f.Statement("source"); ok && st.Value != "" {
+		source := st.Value
+		if strings.HasPrefix(source, "~/") {
+			if home, err := os.UserHomeDir(); err == nil {
+				source = filepath.Join(home, source[2:])
+			}
+		}
+		if !filepath.IsAbs(source) {
+			source = filepath.Join(dir, source)
+		}
+		return newestMatch(source)
+	}
+
+	base := strings.TrimSuffix(rulesPath, filepath.Ext(rulesPath))
+	if filepath.Ext(base) == "" {
+		base += ".csv"
+	}
+	return base
+}
+
+// newestMatch returns the most recently modified file matching pattern, or
+// pattern itself when nothing matches.
+func newestMatch(pattern string) string {
+	matches, err := filepath.Glob(pattern)
+	if err != nil || len(matches) == 0 {
+		return pattern
+	}
+
+	newest := pattern
+	var newestTime int64
+	for _, m := range matches {
+		info, err := os.Stat(m)
+		if err != nil {
+			continue
+		}
+		if t := info.ModTime().UnixNano(); newest == pattern || t > newestTime {
+			newest, newestTime = m, t
+		}
+	}
+	return newest
+}
+
+// Separator returns the field separator of the CSV file at csvPath: the one
+// set by the `separator` directive, or else the one its extension implies.
+func (f *File) Separator(csvPath string) rune {
+	if st, ok := f.Statement("separator"); ok {
+		switch strings.ToUpper(st.Value) {
+		case "TAB":
+			return '\t'
+		case "SPACE":
+			return ' '
+		}
+		if r, size := utf8.DecodeRuneInString(st.Value); size > 0 {
+			return r
+		}
+	}
+
+	switch strings.ToLower(filepath.Ext(csvPath)) {
+	case ".tsv":
+		return '\t'
+	case ".ssv":
+		return ';'
+	default:
+		return ','
+	}
+}
+
+// ReadHeader returns the cells of the first line of a CSV file.
+func ReadHeader(csvPath string, separator rune) ([]string, error) {
+	file, err := os.Open(csvPath)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	r := csv.NewReader(file)
+	r.Comma = separator
+	r.LazyQuotes = true
+	r.FieldsPerRecord = -1
+	return r.Read()
+}
+
+// ReadRecords returns the records of a CSV file, the header included.
+func ReadRecords(csvPath string, separator rune) ([][]string, error) {
+	file, err := os.Open(csvPath)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	r := csv.NewReader(file)
+	r.Comma = separator
+	r.LazyQuotes = true
+	r.FieldsPerRecord = -1
+	return r.ReadAll()
+}
+
+// FieldNameForHeader turns a CSV header cell into a name usable in the
+// `fields` directive: lower case, with runs of other characters than
+// letters, digits, `-` and `_` replaced by `-`.
+func FieldNameForHeader(header string) string {
+	var sb strings.Builder
+	dash := false
+	for _, r := range strings.ToLower(strings.TrimSpace(header)) {
+		if r == '-' || r == '_' || (r >= 'a' && r <= 'z') || (r >= '0' && r <= '9') {
+			sb.WriteRune(r)
+			dash = false
+			continue
+		}
+		if !dash && sb.Len() > 0 {
+			sb.WriteByte('-')
+			dash = true
+		}
+	}
+	return strings.TrimRight(sb.String(), "-")
+}
@@ -0,0 +1,444 @@
+// Package rules reads hledger CSV rules files, which describe how the
+// records of a CSV file become journal transactions.
+package rules
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/juev/hledger-lsp/internal/ast"
+)
+
+// File is a parsed rules file.
+type File struct {
+	// Statements are the top-level directives and field assignments, in
+	// the order they appear.
+	Statements []Statement
+	Blocks     []Block
+	// Fields are the names given to the CSV columns by the `fields`
+	// directive.
+	Fields []Field
+	// References are the `%FIELD` references in field assignments and
+	// matchers.
+	References []Reference
+	Comments   []ast.Range
+}
+
+// Statement is a directive or a field assignment: a name followed by the
+// rest of the line.
+type Statement struct {
+	Name       string
+	Value      string
+	NameRange  ast.Range
+	ValueRange ast.Range
+	Range      ast.Range
+}
+
+// IsAssignment reports whether the statement assigns an hledger field, as
+// opposed to being a directive such as `fields` or `skip`.
+func (s Statement) IsAssignment() bool {
+	return assignableField.MatchString(s.Name)
+}
+
+// IsAccountAssignment reports whether the statement assigns an account
+// field such as `account1`.
+func (s Statement) IsAccountAssignment() bool {
+	return accountField.MatchString(s.Name)
+}
+
+// Block is an `if` block: the matchers that select CSV records and the
+// assignments applied to the records they match. A table block, written
+// `if,FIELD,...`, has one row per line instead.
+type Block struct {
+	Matchers    []Matcher
+	Assignments []Statement
+	Table       bool
+	// TableFields are the fields a table block assigns, from its header.
+	TableFields  []string
+	Rows         []Row
+	KeywordRange ast.Range
+	Range        ast.Range
+}
+
+// Row is one line of a table block: a matcher and the values it assigns
+// to the fields of the table header, in order.
+type Row struct {
+	Matcher Matcher
+	Values  []string
+}
+
+// Matcher is one condition of an `if` block: a regular expression tested
+// against the whole record or, with `%FIELD`, against one field.
+type Matcher struct {
+	Field         string
+	Pattern       string
+	And           bool
+	Negated       bool
+	OperatorRange ast.Range
+	FieldRange    ast.Range
+	PatternRange  ast.Range
+	Range         ast.Range
+}
+
+// Field is a column name given by the `fields` directive. Column is the
+// zero-based position of the CSV column it names; columns left unnamed are
+// not listed.
+type Field struct {
+	Name   string
+	Column int
+	Range  ast.Range
+}
+
+// Reference is a `%FIELD` or `%N` reference. Its range includes the `%`.
+type Reference struct {
+	Name  string
+	Range ast.Range
+}
+
+// Error is a problem found while reading a rules file.
+type Error struct {
+	Message string
+	Range   ast.Range
+}
+
+// Directives are the directives a rules file may contain, besides field
+// assignments and `if` blocks.
+var Directives = []string{
+	"archive",
+	"balance-type",
+	"date-format",
+	"decimal-mark",
+	"encoding",
+	"end",
+	"fields",
+	"if",
+	"include",
+	"intra-day-reversed",
+	"newest-first",
+	"separator",
+	"skip",
+	"source",
+	"timezone",
+}
+
+// AssignableFields are the hledger fields a rules file can assign, with
+// the first two of the numbered ones.
+var AssignableFields = []string{
+	"account1",
+	"account2",
+	"amount",
+	"amount-in",
+	"amount-out",
+	"amount1",
+	"amount2",
+	"balance",
+	"balance1",
+	"balance2",
+	"code",
+	"comment",
+	"comment1",
+	"comment2",
+	"currency",
+	"currency1",
+	"currency2",
+	"date",
+	"date2",
+	"description",
+	"status",
+}
+
+var (
+	assignableField = regexp.MustCompile(`^(date2?|status|code|description|comment\d*|account\d+|amount\d*(-in|-out)?|currency\d*|balance\d*)$`)
+	accountField    = regexp.MustCompile(`^account\d+$`)
+	referenceName   = regexp.MustCompile(`^[A-Za-z0-9_-]+`)
+)
+
+func isDirective(name string) bool {
+	for _, d := range Directives {
+		if d == name {
+			return true
+		}
+	}
+	return false
+}
+
+// line is one line of a rules file with the helpers for positions in it.
+type line struct {
+	text   string
+	num    int
+	offset int
+}
+
+func (l line) pos(byteCol int) ast.Position {
+	return ast.Position{
+		Line:   l.num,
+		Column: utf8.RuneCountInString(l.text[:byteCol]) + 1,
+		Offset: l.offset + byteCol,
+	}
+}
+
+func (l line) span(start, end int) ast.Range {
+	return ast.Range{Start: l.pos(start), End: l.pos(end)}
+}
+
+// Parse reads a rules file. Unknown directives are reported as errors and
+// skipped.
+func Parse(content string) (*File, []Error) {
+	f := &File{}
+	var errs []Error
+
+	var block *Block
+	var separator byte
+	inAssignments := false
+	closeBlock := func() {
+		if block != nil {
+			f.Blocks = append(f.Blocks, *block)
+			block = nil
+		}
+	}
+
+	offset := 0
+	for i, text := range strings.Split(content, "\n") {
+		l := line{text: strings.TrimRight(text, "\r"), num: i + 1, offset: offset}
+		offset += len(text) + 1
+
+		start := len(l.text) - len(strings.TrimLeft(l.text, " \t"))
+		if start == len(l.text) {
+			closeBlock()
+			continue
+		}
+		if strings.ContainsRune("#;*", rune(l.text[start])) {
+			f.Comments = append(f.Comments, l.span(start, len(l.text)))
+			continue
+		}
+		indented := start > 0
+
+		if block != nil {
+			switch {
+			case block.Table:
+				if !indented {
+					block.Rows = append(block.Rows, f.parseRow(l, separator))
+					block.Range.End = l.pos(len(l.text))
+					continue
+				}
+			case indented:
+				st := f.parseStatement(l, start, true)
+				block.Assignments = append(block.Assignments, st)
+				block.Range.End = st.Range.End
+				inAssignments = true
+				continue
+			case !inAssignments:
+				m := f.parseMatcher(l, 0)
+				block.Matchers = append(block.Matchers, m)
+				block.Range.End = m.Range.End
+				continue
+			}
+			closeBlock()
+		}
+
+		word := l.text[start:]
+		if end := strings.IndexAny(word, " \t"); end >= 0 {
+			word = word[:end]
+		}
+		if word == "if" || strings.HasPrefix(word, "if,") {
+			block = &Block{
+				Table:        word != "if",
+				KeywordRange: l.span(start, start+2),
+				Range:        l.span(start, len(l.text)),
+			}
+			inAssignments = false
+			if block.Table {
+				separator = word[2]
+				for _, name := range strings.Split(strings.TrimRight(l.text[start+3:], " \t"), string(separator)) {
+					block.TableFields = append(block.TableFields, strings.TrimSpace(name))
+				}
+			} else {
+				if rest := skipBlanks(l.text, start+2); rest < len(l.text) {
+					block.Matchers = append(block.Matchers, f.parseMatcher(l, rest))
+				}
+			}
+			continue
+		}
+
+		st := f.parseStatement(l, start, false)
+		if !isDirective(st.Name) && !st.IsAssignment() {
+			errs = append(errs, Error{
+				Message: fmt.Sprintf("unknown rules directive: %s", st.Name),
+				Range:   st.NameRange,
+			})
+			continue
+		}
+		f.Statements = append(f.Statements, st)
+	}
+	closeBlock()
+
+	return f, errs
+}
+
+// parseStatement reads a name and value starting at byte start. Field
+// assignments have their `%FIELD` references recorded, and a `fields`
+// directive its names.
+func (f *File) parseStatement(l line, start int, inBlock bool) Statement {
+	nameEnd := start
+	for nameEnd < len(l.text) && l.text[nameEnd] != ' ' && l.text[nameEnd] != '\t' {
+		nameEnd++
+	}
+	valueStart := skipBlanks(l.text, nameEnd)
+	valueEnd := len(strings.TrimRight(l.text, " \t"))
+	if valueEnd < valueStart {
+		valueEnd = valueStart
+	}
+
+	st := Statement{
+		Name:       l.text[start:nameEnd],
+		Value:      l.text[valueStart:valueEnd],
+		NameRange:  l.span(start, nameEnd),
+		ValueRange: l.span(valueStart, valueEnd),
+		Range:      l.span(start, valueEnd),
+	}
+
+	switch {
+	case st.IsAssignment():
+		f.References = append(f.References, scanReferences(l, valueStart, valueEnd)...)
+	case st.Name == "fields" && !inBlock:
+		f.Fields = nil
+		for col, column := valueStart, 0; col <= valueEnd; column++ {
+			end := strings.IndexByte(l.text[col:valueEnd], ',')
+			if end < 0 {
+				end = valueEnd - col
+			}
+			nameStart := min(skipBlanks(l.text, col), col+end)
+			name := strings.TrimRight(l.text[nameStart:col+end], " \t")
+			if name != "" {
+				f.Fields = append(f.Fields, Field{Name: name, Column: column, Range: l.span(nameStart, nameStart+len(name))})
+			}
+			col += end + 1
+		}
+	}
+
+	return st
+}
+
+// parseMatcher reads a matcher starting at byte start: optional `&` and
+// `!` operators, an optional `%FIELD`, then the pattern.
+func (f *File) parseMatcher(l line, start int) Matcher {
+	m := Matcher{Range: l.span(start, len(strings.TrimRight(l.text, " \t")))}
+
+	col := start
+	if col < len(l.text) && l.text[col] == '&' {
+		m.And = true
+		m.OperatorRange = l.span(col, col+1)
+		col = skipBlanks(l.text, col+1)
+	}
+	if col < len(l.text) && l.text[col] == '!' {
+		m.Negated = true
+		if !m.And {
+			m.OperatorRange = l.span(col, col+1)
+		} else {
+			m.OperatorRange.End = l.pos(col + 1)
+		}
+		col = skipBlanks(l.text, col+1)
+	}
+	if col < len(l.text) && l.text[col] == '%' {
+		if name := referenceName.FindString(l.text[col+1:]); name != "" {
+			m.Field = name
+			m.FieldRange = l.span(col, col+1+len(name))
+			f.References = append(f.References, Reference{Name: name, Range: m.FieldRange})
+			col = skipBlanks(l.text, col+1+len(name))
+		}
+	}
+
+	m.Pattern = strings.TrimRight(l.text[col:], " \t")
+	m.PatternRange = l.span(col, col+len(m.Pattern))
+	return m
+}
+
+// parseRow reads a line of a table block, whose cells are split by the
+// separator that follows `if` in the block header.
+func (f *File) parseRow(l line, separator byte) Row {
+	cells := strings.Split(l.text, string(separator))
+	matcherLine := l
+	matcherLine.text = l.text[:len(cells[0])]
+
+	row := Row{Matcher: f.parseMatcher(matcherLine, 0), Values: cells[1:]}
+	f.References = append(f.References, scanReferences(l, len(cells[0]), len(l.text))...)
+	return row
+}
+
+// scanReferences returns the `%FIELD` references between bytes start and
+// end of a line.
+func scanReferences(l line, start, end int) []Reference {
+	var refs []Reference
+	for col := start; col < end; col++ {
+		if l.text[col] != '%' {
+			continue
+		}
+		name := referenceName.FindString(l.text[col+1 : end])
+		if name == "" {
+			continue
+		}
+		refs = append(refs, Reference{Name: name, Range: l.span(col, col+1+len(name))})
+		col += len(name)
+	}
+	return refs
+}
+
+func skipBlanks(s string, col int) int {
+	for col < len(s) && (s[col] == ' ' || s[col] == '\t') {
+		col++
+	}
+	return col
+}
+
+// Statement returns the last top-level statement with the given name.
+func (f *File) Statement(name string) (Statement, bool) {
+	for i := len(f.Statements) - 1; i >= 0; i-- {
+		if f.Statements[i].Name == name {
+			return f.Statements[i], true
+		}
+	}
+	return Statement{}, false
+}
+
+// FieldNames returns the names given by the `fields` directive.
+func (f *File) FieldNames() []string {
+	names := make([]string, len(f.Fields))
+	for i, field := range f.Fields {
+		names[i] = field.Name
+	}
+	return names
+}
+
+// UndefinedReferences returns the references to names the `fields`
+// directive does not define. Numeric references such as `%1` always refer
+// to a column. Nothing is undefined without a `fields` directive.
+func (f *File) UndefinedReferences() []Reference {
+	if len(f.Fields) == 0 {
+		return nil
+	}
+
+	defined := make(map[string]bool, len(f.Fields))
+	for _, field := range f.Fields {
+		defined[field.Name] = true
+	}
+
+	var undefined []Reference
+	for _, ref := range f.References {
+		if defined[ref.Name] || isNumber(ref.Name) {
+			continue
+		}
+		undefined = append(undefined, ref)
+	}
+	return undefined
+}
+
+func isNumber(s string) bool {
+	for _, r := range s {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return s != ""
+}
@@ -0,0 +1,148 @@
+package rules
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/juev/hledger-lsp/internal/ast"
+)
+
+const sampleRules = `# bank import
+skip 1
+fields date, description, , amount
+date-format %d/%m/%Y
+account1 assets:bank
+currency $
+
+if groceries
+& !%description refund
+    account2 expenses:food
+    comment  %memo
+
+if,account2,comment
+coffee,expenses:coffee,%description
+`
+
+func TestParse(t *testing.T) {
+	f, errs := Parse(sampleRules)
+	require.Empty(t, errs)
+
+	require.Len(t, f.Statements, 5)
+	assert.Equal(t, "skip", f.Statements[0].Name)
+	assert.Equal(t, "1", f.Statements[0].Value)
+	assert.True(t, f.Statements[3].IsAccountAssignment())
+	assert.Equal(t, "assets:bank", f.Statements[3].Value)
+	assert.Equal(t, ast.Range{
+		Start: ast.Position{Line: 5, Column: 10, Offset: 86},
+		End:   ast.Position{Line: 5, Column: 21, Offset: 97},
+	}, f.Statements[3].ValueRange)
+
+	assert.Equal(t, []string{"date", "description", "amount"}, f.FieldNames())
+	assert.Equal(t, 3, f.Fields[0].Range.Start.Line)
+	assert.Equal(t, 8, f.Fields[0].Range.Start.Column)
+	assert.Equal(t, 29, f.Fields[2].Range.Start.Column)
+
+	require.Len(t, f.Blocks, 2)
+	block := f.Blocks[0]
+	require.Len(t, block.Matchers, 2)
+	assert.Equal(t, "groceries", block.Matchers[0].Pattern)
+	second := block.Matchers[1]
+	assert.True(t, second.And)
+	assert.True(t, second.Negated)
+	assert.Equal(t, "description", second.Field)
+	assert.Equal(t, "refund", second.Pattern)
+	require.Len(t, block.Assignments, 2)
+	assert.Equal(t, "account2", block.Assignments[0].Name)
+	assert.Equal(t, 8, block.Range.Start.Line)
+	assert.Equal(t, 11, block.Range.End.Line)
+
+	table := f.Blocks[1]
+	assert.True(t, table.Table)
+	assert.Equal(t, 13, table.Range.Start.Line)
+	assert.Equal(t, 14, table.Range.End.Line)
+
+	var refs []string
+	for _, ref := range f.References {
+		refs = append(refs, ref.Name)
+	}
+	assert.Equal(t, []string{"description", "memo", "description"}, refs)
+	assert.Len(t, f.Comments, 1)
+}
+
+func TestParse_UnknownDirective(t *testing.T) {
+	f, errs := Parse("fields date, amount\nacount1 assets:bank\n")
+	require.Len(t, errs, 1)
+	assert.Equal(t, "unknown rules directive: acount1", errs[0].Message)
+	assert.Equal(t, 2, errs[0].Range.Start.Line)
+	assert.Len(t, f.Statements, 1)
+}
+
+func TestUndefinedReferences(t *testing.T) {
+	f, _ := Parse(sampleRules)
+	undefined := f.UndefinedReferences()
+	require.Len(t, undefined, 1)
+	assert.Equal(t, "memo", undefined[0].Name)
+	assert.Equal(t, 11, undefined[0].Range.Start.Line)
+
+	f, _ = Parse("fields date, \ndescription %2 %payee\n")
+	assert.Equal(t, []string{"date"}, f.FieldNames())
+	f, _ = Parse("description %2 %payee\n")
+	assert.Empty(t, f.UndefinedReferences())
+}
+
+func TestCSVPath(t *testing.T) {
+	dir := t.TempDir()
+
+	f, _ := Parse("")
+	assert.Equal(t, filepath.Join(dir, "bank.csv"), f.CSVPath(filepath.Join(dir, "bank.csv.rules")))
+	assert.Equal(t, filepath.Join(dir, "bank.csv"), f.CSVPath(filepath.Join(dir, "bank.rules")))
+
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "export-2024.csv"), []byte("a\n"), 0o644))
+	f, _ = Parse("source export-*.csv\n")
+	assert.Equal(t, filepath.Join(dir, "export-2024.csv"), f.CSVPath(filepath.Join(dir, "bank.rules")))
+}
+
+func TestReadHeader(t *testing.T) {
+	dir := t.TempDir()
+	csvPath := filepath.Join(dir, "bank.csv")
+	require.NoError(t, os.WriteFile(csvPath, []byte("\"Posting Date\";Payee;Amount (EUR)\n01/02/2024;Shop;-5\n"), 0o644))
+
+	f, _ := Parse("separator ;\n")
+	header, err := ReadHeader(csvPath, f.Separator(csvPath))
+	require.NoError(t, err)
+	assert.Equal(t, []string{"Posting Date", "Payee", "Amount (EUR)"}, header)
+
+	var names []string
+	for _, h := range header {
+		names = append(names, FieldNameForHeader(h))
+	}
+	assert.Equal(t, []string{"posting-date", "payee", "amount-eur"}, names)
+}
+
+func TestSeparator(t *testing.T) {
+	f, _ := Parse("separator TAB\n")
+	assert.Equal(t, '\t', f.Separator("bank.csv"))
+
+	f, _ = Parse("")
+	assert.Equal(t, ',', f.Separator("bank.csv"))
+	assert.Equal(t, '\t', f.Separator("bank.tsv"))
+	assert.Equal(t, ';', f.Separator("bank.ssv"))
+}
+
+func TestParse_TableBlock(t *testing.T) {
+	f, errs := Parse("if,account2, comment\n%payee coffee,expenses:coffee,%memo\nshop|x,expenses:shop\n")
+	require.Empty(t, errs)
+	require.Len(t, f.Blocks, 1)
+
+	block := f.Blocks[0]
+	assert.Equal(t, []string{"account2", "comment"}, block.TableFields)
+	require.Len(t, block.Rows, 2)
+	assert.Equal(t, "payee", block.Rows[0].Matcher.Field)
+	assert.Equal(t, "coffee", block.Rows[0].Matcher.Pattern)
+	assert.Equal(t, []string{"expenses:coffee", "%memo"}, block.Rows[0].Values)
+	assert.Equal(t, "shop|x", block.Rows[1].Matcher.Pattern)
+}
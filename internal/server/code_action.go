@@ -3,9 +3,15 @@ package server
 import (
 	"context"
 	"fmt"
+	"slices"
 	"strings"
 
 	"go.lsp.dev/protocol"
+
+	"github.com/juev/hledger-lsp/internal/analyzer"
+	"github.com/juev/hledger-lsp/internal/ast"
+	"github.com/juev/hledger-lsp/internal/lsputil"
+	"github.com/juev/hledger-lsp/internal/parser"
 )
 
 type hledgerCommand struct {
@@ -33,9 +39,86 @@ func (s *Server) CodeAction(ctx context.Context, params *protocol.CodeActionPara
 		result = append(result, a)
 	}
 
+	result = append(result, s.quickFixes(params.TextDocument.URI, params.Context.Diagnostics)...)
 	return result, nil
 }
 
+// quickFixes returns the fixes for the given diagnostics of a document.
+func (s *Server) quickFixes(uri protocol.DocumentURI, diagnostics []protocol.Diagnostic) []protocol.CodeAction {
+	content, ok := s.GetDocument(uri)
+	if !ok || isRulesDocument(uri) {
+		return nil
+	}
+
+	var journal *ast.Journal
+	var actions []protocol.CodeAction
+	for _, diag := range diagnostics {
+		if diag.Code != "DATE_OUT_OF_ORDER" {
+			continue
+		}
+		if journal == nil {
+			journal, _ = parser.ParseWithOptions(content, s.parseOptions(uri))
+		}
+		edits := moveToDateOrder(content, journal.Transactions, int(diag.Range.Start.Line)+1, s.getSettings().Diagnostics.Date2)
+		if edits == nil {
+			continue
+		}
+		actions = append(actions, protocol.CodeAction{
+			Title:       "Move transaction into date order",
+			Kind:        protocol.QuickFix,
+			Diagnostics: []protocol.Diagnostic{diag},
+			IsPreferred: true,
+			Edit: &protocol.WorkspaceEdit{
+				Changes: map[protocol.DocumentURI][]protocol.TextEdit{uri: edits},
+			},
+		})
+	}
+	return actions
+}
+
+// moveToDateOrder returns the edits that move the transaction starting on
+// line (1-based) above the first earlier transaction with a later date,
+// together with the blank line that separates it from the next one.
+func moveToDateOrder(content string, transactions []ast.Transaction, line int, useDate2 bool) []protocol.TextEdit {
+	i := slices.IndexFunc(transactions, func(tx ast.Transaction) bool {
+		return tx.Range.Start.Line == line
+	})
+	if i < 0 {
+		return nil
+	}
+	slot := analyzer.OrderedSlot(transactions, i, useDate2)
+	if slot == i {
+		return nil
+	}
+
+	start, end := transactions[i].Range.Start.Offset, min(transactions[i].Range.End.Offset, len(content))
+	block := content[start:end]
+	if !strings.HasSuffix(block, "\n") {
+		block += "\n"
+	}
+
+	// Take a blank line along, from below or, at the end of the file, from
+	// above, so the gaps between transactions stay as they were.
+	if strings.HasPrefix(content[end:], "\n") {
+		end++
+	} else if end == len(content) && strings.HasSuffix(content[:start], "\n\n") {
+		start--
+	}
+
+	mapper := lsputil.NewPositionMapper(content)
+	insertAt := mapper.ByteToLSP(transactions[slot].Range.Start.Offset)
+	return []protocol.TextEdit{
+		{
+			Range:   protocol.Range{Start: insertAt, End: insertAt},
+			NewText: block + "\n",
+		},
+		{
+			Range:   protocol.Range{Start: mapper.ByteToLSP(start), End: mapper.ByteToLSP(end)},
+			NewText: "",
+		},
+	}
+}
+
 func (s *Server) getCodeActions() []protocol.CodeAction {
 	settings := s.getSettings()
 	if s.cliClient == nil || !s.cliClient.Available() || !settings.CLI.Enabled {
@@ -63,7 +146,11 @@ func (s *Server) getCodeActions() []protocol.CodeAction {
 }
 
 func (s *Server) ExecuteCommand(ctx context.Context, params *protocol.ExecuteCommandParams) (any, error) {
-	if params.Command != "hledger.run" {
+	switch params.Command {
+	case "hledger.run":
+	case "hledger.previewImport":
+		return s.previewImport(params.Arguments)
+	default:
 		return nil, fmt.Errorf("unknown command: %s", params.Command)
 	}
 
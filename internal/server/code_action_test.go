@@ -1,11 +1,17 @@
 package server
 
 import (
+	"context"
 	"strings"
 	"testing"
 	"time"
 
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.lsp.dev/protocol"
+
 	"github.com/juev/hledger-lsp/internal/cli"
+	"github.com/juev/hledger-lsp/internal/parser"
 )
 
 func TestFormatOutputAsComment(t *testing.T) {
@@ -172,3 +178,66 @@ func TestFooterLine(t *testing.T) {
 		t.Errorf("footer length (%d) should match header length (%d)", len(footer), len(header))
 	}
 }
+
+func TestCodeAction_MoveToDateOrder(t *testing.T) {
+	srv := NewServer()
+	settings := defaultServerSettings()
+	settings.Diagnostics.OrderedDates = true
+	srv.setSettings(settings)
+
+	uri := protocol.DocumentURI("file:///test.journal")
+	content := `2024-01-01 a
+    expenses:food  $1
+    assets:cash
+
+2024-01-05 b
+    expenses:food  $1
+    assets:cash
+
+2024-01-03 c
+    expenses:food  $1
+    assets:cash
+`
+	srv.documents.Store(uri, content)
+
+	var diagnostics []protocol.Diagnostic
+	for _, diag := range srv.analyze("file:///test.journal", content, parser.Options{}, nil) {
+		if diag.Code == "DATE_OUT_OF_ORDER" {
+			diagnostics = append(diagnostics, diag)
+		}
+	}
+	require.Len(t, diagnostics, 1)
+	assert.Equal(t, uint32(8), diagnostics[0].Range.Start.Line)
+
+	actions, err := srv.CodeAction(context.Background(), &protocol.CodeActionParams{
+		TextDocument: protocol.TextDocumentIdentifier{URI: uri},
+		Context:      protocol.CodeActionContext{Diagnostics: diagnostics},
+	})
+	require.NoError(t, err)
+	require.Len(t, actions, 1)
+	assert.Equal(t, protocol.QuickFix, actions[0].Kind)
+
+	edits := actions[0].Edit.Changes[uri]
+	assert.Equal(t, `2024-01-01 a
+    expenses:food  $1
+    assets:cash
+
+2024-01-03 c
+    expenses:food  $1
+    assets:cash
+
+2024-01-05 b
+    expenses:food  $1
+    assets:cash
+`, applyTextEdits(content, edits))
+}
+
+func TestMoveToDateOrder_LastTransactionWithoutNewline(t *testing.T) {
+	content := "2024-01-05 b\n    expenses:food  $1\n    assets:cash\n\n2024-01-03 c\n    expenses:food  $1\n    assets:cash"
+	journal, errs := parser.Parse(content)
+	require.Empty(t, errs)
+
+	edits := moveToDateOrder(content, journal.Transactions, 5, false)
+	assert.Equal(t, "2024-01-03 c\n    expenses:food  $1\n    assets:cash\n\n2024-01-05 b\n    expenses:food  $1\n    assets:cash\n", applyTextEdits(content, edits))
+	assert.Nil(t, moveToDateOrder(content, journal.Transactions, 1, false))
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 	"sort"
+	"strconv"
 	"strings"
 	"time"
 
@@ -24,6 +25,7 @@ const (
 	ContextTagName
 	ContextTagValue
 	ContextDate
+	ContextPeriod
 )
 
 const (
@@ -37,18 +39,27 @@ func (s *Server) Completion(ctx context.Context, params *protocol.CompletionPara
 	if !ok {
 		return &protocol.CompletionList{Items: []protocol.CompletionItem{}}, nil
 	}
+	if isRulesDocument(params.TextDocument.URI) {
+		return s.rulesCompletion(params.TextDocument.URI, doc, params.Position), nil
+	}
 
 	var result *analyzer.AnalysisResult
+	opts := s.parseOptions(params.TextDocument.URI)
 
 	if resolved := s.getWorkspaceResolved(params.TextDocument.URI); resolved != nil {
 		result = s.analyzer.AnalyzeResolved(resolved)
 	} else {
-		journal, _ := parser.Parse(doc)
+		journal, _ := parser.ParseWithOptions(doc, opts)
 		result = s.analyzer.Analyze(journal)
 	}
 
 	settings := s.getSettings()
-	completionCtx := determineCompletionContext(doc, params.Position, params.Context)
+	var completionCtx CompletionContextType
+	if opts.Format == parser.FormatTimedot {
+		completionCtx = determineTimedotCompletionContext(doc, params.Position)
+	} else {
+		completionCtx = determineCompletionContext(doc, params.Position, params.Context)
+	}
 	counts := getCountsForContext(completionCtx, result)
 	items := s.generateCompletionItems(completionCtx, result, doc, params.Position, counts, settings.Completion)
 
@@ -156,6 +167,15 @@ func determineCompletionContext(content string, pos protocol.Position, ctx *prot
 		return determinePostingContext(line, pos)
 	}
 
+	if strings.HasPrefix(line, "~") {
+		descStart := periodicDescriptionStart(line)
+		byteCol := lsputil.UTF16OffsetToByteOffset(line, int(pos.Character))
+		if descStart != -1 && byteCol >= descStart {
+			return ContextPayee
+		}
+		return ContextPeriod
+	}
+
 	if len(line) > 0 && line[0] >= '0' && line[0] <= '9' {
 		return ContextPayee
 	}
@@ -163,6 +183,31 @@ func determineCompletionContext(content string, pos protocol.Position, ctx *prot
 	return ContextDate
 }
 
+// determineTimedotCompletionContext completes dates on empty lines and
+// accounts at the start of a timedot entry line, before the quantity.
+func determineTimedotCompletionContext(content string, pos protocol.Position) CompletionContextType {
+	lines := strings.Split(content, "\n")
+	if int(pos.Line) >= len(lines) {
+		return ContextDate
+	}
+
+	line := lines[pos.Line]
+	trimmed := strings.TrimLeft(line, " \t")
+	switch {
+	case trimmed == "":
+		return ContextDate
+	case trimmed[0] >= '0' && trimmed[0] <= '9', strings.ContainsRune("#;*", rune(trimmed[0])):
+		return ContextUnknown
+	}
+
+	byteCol := lsputil.UTF16OffsetToByteOffset(line, int(pos.Character))
+	indent := len(line) - len(trimmed)
+	if separatorIdx := findDoublespace(trimmed); separatorIdx != -1 && byteCol-indent > separatorIdx {
+		return ContextUnknown
+	}
+	return ContextAccount
+}
+
 func determinePostingContext(line string, pos protocol.Position) CompletionContextType {
 	byteCol := lsputil.UTF16OffsetToByteOffset(line, int(pos.Character))
 	parts := parsePosting(line)
@@ -188,6 +233,28 @@ func determinePostingContext(line string, pos protocol.Position) CompletionConte
 	return ContextCommodity
 }
 
+// periodicDescriptionStart returns the byte offset where the description of
+// a periodic transaction header ("~ monthly  rent") begins, or -1 if the
+// header has no description separator yet.
+func periodicDescriptionStart(line string) int {
+	rest := strings.TrimLeft(line[1:], " ")
+	exprStart := len(line) - len(rest)
+	sep := findDoublespace(rest)
+	if sep == -1 {
+		return -1
+	}
+	start := exprStart + sep
+	for start < len(line) && line[start] == ' ' {
+		start++
+	}
+	return start
+}
+
+var periodKeywords = []string{
+	"daily", "weekly", "biweekly", "monthly", "bimonthly", "quarterly", "yearly",
+	"every", "from", "to", "in",
+}
+
 func findDoublespace(s string) int {
 	for i := 0; i < len(s)-1; i++ {
 		if s[i] == ' ' && s[i+1] == ' ' {
@@ -304,7 +371,7 @@ func (s *Server) generateCompletionItems(ctxType CompletionContextType, result *
 			items = append(items, protocol.CompletionItem{
 				Label:  acc,
 				Kind:   protocol.CompletionItemKindVariable,
-				Detail: formatDetailWithCount("Account", acc, counts, settings.ShowCounts),
+				Detail: formatDetailWithCount(accountDetail(acc, result.AccountTypes), acc, counts, settings.ShowCounts),
 			})
 		}
 
@@ -355,12 +422,21 @@ func (s *Server) generateCompletionItems(ctxType CompletionContextType, result *
 	case ContextDate:
 		items = generateDateCompletionItems(result.Dates, content, int(pos.Line))
 
+	case ContextPeriod:
+		for _, keyword := range periodKeywords {
+			items = append(items, protocol.CompletionItem{
+				Label:  keyword,
+				Kind:   protocol.CompletionItemKindKeyword,
+				Detail: "Period expression",
+			})
+		}
+
 	default:
 		for _, acc := range result.Accounts.All {
 			items = append(items, protocol.CompletionItem{
 				Label:  acc,
 				Kind:   protocol.CompletionItemKindVariable,
-				Detail: formatDetailWithCount("Account", acc, counts, settings.ShowCounts),
+				Detail: formatDetailWithCount(accountDetail(acc, result.AccountTypes), acc, counts, settings.ShowCounts),
 			})
 		}
 	}
@@ -368,6 +444,15 @@ func (s *Server) generateCompletionItems(ctxType CompletionContextType, result *
 	return items
 }
 
+// accountDetail names an account completion item after the account's
+// type, like "Asset account".
+func accountDetail(account string, types *analyzer.AccountTypes) string {
+	if typ := types.Type(account); typ != analyzer.AccountTypeNone {
+		return typ.Name() + " account"
+	}
+	return "Account"
+}
+
 func formatDetailWithCount(baseDetail, label string, counts map[string]int, showCounts bool) string {
 	if !showCounts || counts == nil {
 		return baseDetail
@@ -456,14 +541,26 @@ func extractCurrentTagName(line string, pos int) string {
 
 // generateDateCompletionItems creates date suggestions with today/yesterday/tomorrow at top.
 // Tests check detail strings ("today" etc.) not specific dates, making them time-independent.
+// Partial dates are only offered for the year a Y directive sets at the cursor;
+// dates in other years keep their year so they still mean the same day.
 func generateDateCompletionItems(historicalDates []string, content string, cursorLine int) []protocol.CompletionItem {
 	var items []protocol.CompletionItem
 	now := time.Now()
 
 	format := detectDateFormat(content, cursorLine)
-	today := formatDateWithFormat(now, format)
-	yesterday := formatDateWithFormat(now.AddDate(0, 0, -1), format)
-	tomorrow := formatDateWithFormat(now.AddDate(0, 0, 1), format)
+	year := defaultYearAt(content, cursorLine)
+	formatDate := func(t time.Time) string {
+		if !format.HasYear && year != 0 && t.Year() != year {
+			f := format
+			f.HasYear = true
+			return formatDateWithFormat(t, f)
+		}
+		return formatDateWithFormat(t, format)
+	}
+
+	today := formatDate(now)
+	yesterday := formatDate(now.AddDate(0, 0, -1))
+	tomorrow := formatDate(now.AddDate(0, 0, 1))
 
 	items = append(items, protocol.CompletionItem{
 		Label:    today,
@@ -490,7 +587,10 @@ func generateDateCompletionItems(historicalDates []string, content string, curso
 
 	seen := map[string]bool{today: true, yesterday: true, tomorrow: true}
 	for i, date := range sortedDates {
-		reformatted := reformatDateString(date, format)
+		reformatted := date
+		if t, err := time.Parse("2006-01-02", date); err == nil {
+			reformatted = formatDate(t)
+		}
 		if seen[reformatted] {
 			continue
 		}
@@ -555,9 +655,33 @@ func detectDateFormat(content string, cursorLine int) DateFormat {
 		}
 	}
 
+	// A Y directive with no dated entries yet signals partial dates.
+	if defaultYearAt(content, cursorLine) != 0 {
+		return DateFormat{Separator: "-", HasYear: false, LeadingZeros: true}
+	}
+
 	return defaultDateFormat
 }
 
+// defaultYearAt returns the year set by the last Y (or year) directive
+// before cursorLine, or zero if there is none.
+func defaultYearAt(content string, cursorLine int) int {
+	year := 0
+	for i, line := range strings.Split(content, "\n") {
+		if i >= cursorLine {
+			break
+		}
+		fields := strings.Fields(line)
+		if len(fields) < 2 || (fields[0] != "Y" && fields[0] != "year") {
+			continue
+		}
+		if y, err := strconv.Atoi(fields[1]); err == nil && y > 0 && y <= 9999 {
+			year = y
+		}
+	}
+	return year
+}
+
 func parseDateFormat(line string) (DateFormat, bool) {
 	for _, sep := range []string{"-", "/", "."} {
 		if format, ok := tryParseDateWithSep(line, sep); ok {
@@ -625,14 +749,6 @@ func formatDateWithFormat(t time.Time, f DateFormat) string {
 	return monthStr + f.Separator + dayStr
 }
 
-func reformatDateString(dateStr string, f DateFormat) string {
-	t, err := time.Parse("2006-01-02", dateStr)
-	if err != nil {
-		return dateStr
-	}
-	return formatDateWithFormat(t, f)
-}
-
 func calculateTextEditRange(content string, pos protocol.Position, ctxType CompletionContextType) *protocol.Range {
 	lines := strings.Split(content, "\n")
 	if int(pos.Line) >= len(lines) {
@@ -662,6 +778,10 @@ func calculateTextEditRange(content string, pos protocol.Position, ctxType Compl
 			startByte = findCommodityStart(line, byteCol)
 		}
 	case ContextPayee:
+		if strings.HasPrefix(line, "~") {
+			startByte = periodicDescriptionStart(line)
+			break
+		}
 		spaceIdx := strings.Index(line[:byteCol], " ")
 		if spaceIdx != -1 {
 			startByte = spaceIdx + 1
@@ -721,6 +841,12 @@ func extractQueryText(content string, pos protocol.Position, ctxType CompletionC
 		return trimmed
 
 	case ContextPayee:
+		if strings.HasPrefix(beforeCursor, "~") {
+			if start := periodicDescriptionStart(line); start != -1 && start <= len(beforeCursor) {
+				return beforeCursor[start:]
+			}
+			return ""
+		}
 		_, after, found := strings.Cut(beforeCursor, " ")
 		if !found {
 			return ""
@@ -743,6 +869,9 @@ func extractQueryText(content string, pos protocol.Position, ctxType CompletionC
 		}
 		return strings.TrimLeft(afterAccount[amountEnd:], " ")
 
+	case ContextPeriod:
+		return beforeCursor[strings.LastIndex(beforeCursor, " ")+1:]
+
 	default:
 		return ""
 	}
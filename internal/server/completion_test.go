@@ -86,9 +86,38 @@ func TestCompletion_AccountsShowUsageCount(t *testing.T) {
 		}
 	}
 
-	assert.Equal(t, "Account (3)", foodDetail, "expenses:food used 3 times")
-	assert.Equal(t, "Account (2)", cashDetail, "assets:cash used 2 times")
-	assert.Equal(t, "Account (1)", bankDetail, "assets:bank used 1 time")
+	assert.Equal(t, "Expense account (3)", foodDetail, "expenses:food used 3 times")
+	assert.Equal(t, "Cash account (2)", cashDetail, "assets:cash used 2 times")
+	assert.Equal(t, "Cash account (1)", bankDetail, "assets:bank used 1 time")
+}
+
+func TestCompletion_AccountDetailShowsDeclaredType(t *testing.T) {
+	srv := NewServer()
+	content := `account business  ; type: R
+
+2024-01-15 invoice
+    assets:checking  $100
+    business:consulting  $-100
+
+2024-01-16 test
+    `
+
+	srv.documents.Store(protocol.DocumentURI("file:///test.journal"), content)
+
+	result, err := srv.Completion(context.Background(), &protocol.CompletionParams{
+		TextDocumentPositionParams: protocol.TextDocumentPositionParams{
+			TextDocument: protocol.TextDocumentIdentifier{URI: "file:///test.journal"},
+			Position:     protocol.Position{Line: 7, Character: 4},
+		},
+	})
+	require.NoError(t, err)
+
+	details := make(map[string]string)
+	for _, item := range result.Items {
+		details[item.Label] = item.Detail
+	}
+	assert.Equal(t, "Revenue account (1)", details["business:consulting"])
+	assert.Equal(t, "Cash account (1)", details["assets:checking"])
 }
 
 func TestCompletion_PayeesShowUsageCount(t *testing.T) {
@@ -1219,7 +1248,7 @@ include transactions.journal`
 		}
 	}
 
-	assert.Equal(t, "Account (4)", foodDetail,
+	assert.Equal(t, "Expense account (4)", foodDetail,
 		"expenses:food should show count 4 (3 from main + 1 from included), not just 1 from current file")
 }
 
@@ -2157,6 +2186,14 @@ func TestDetectDateFormat_FromCursorPosition(t *testing.T) {
 			cursorLine: 5,
 			wantYear:   false,
 		},
+		{
+			name: "Y directive without dated entries",
+			content: `Y 2026
+
+`,
+			cursorLine: 1,
+			wantYear:   false,
+		},
 		{
 			name: "cursor at beginning, only full dates",
 			content: `2026-01-01 opening
@@ -2176,3 +2213,115 @@ func TestDetectDateFormat_FromCursorPosition(t *testing.T) {
 		})
 	}
 }
+
+func TestGenerateDateCompletionItems_DefaultYear(t *testing.T) {
+	content := `Y 2020
+
+03-14 groceries
+    expenses:food  $10
+    assets:cash
+
+`
+	items := generateDateCompletionItems([]string{"2020-03-15", "2019-12-31"}, content, 6)
+
+	labels := make(map[string]string)
+	for _, item := range items {
+		labels[item.Label] = item.Detail
+	}
+
+	// History in the Y year is written partially, other years keep theirs.
+	assert.Equal(t, "from history", labels["03-15"])
+	assert.Equal(t, "from history", labels["2019-12-31"])
+
+	for _, item := range items {
+		if item.Detail == "today" {
+			assert.Regexp(t, `^\d{4}-\d{2}-\d{2}$`, item.Label, "today is outside Y 2020 and needs its year")
+		}
+	}
+}
+
+func TestDetermineContext_PeriodicHeader(t *testing.T) {
+	content := `~ month`
+
+	ctx := determineCompletionContext(content, protocol.Position{Line: 0, Character: 7}, nil)
+	assert.Equal(t, ContextPeriod, ctx)
+
+	content = `~ monthly  ren`
+	ctx = determineCompletionContext(content, protocol.Position{Line: 0, Character: 14}, nil)
+	assert.Equal(t, ContextPayee, ctx)
+}
+
+func TestCompletion_PeriodicTransaction(t *testing.T) {
+	srv := NewServer()
+	content := `~ monthly  rent
+    expenses:rent  $1000
+    assets:checking
+
+2024-01-15 landlord
+    expenses:`
+
+	srv.documents.Store(protocol.DocumentURI("file:///test.journal"), content)
+
+	params := &protocol.CompletionParams{
+		TextDocumentPositionParams: protocol.TextDocumentPositionParams{
+			TextDocument: protocol.TextDocumentIdentifier{URI: "file:///test.journal"},
+			Position:     protocol.Position{Line: 5, Character: 13},
+		},
+	}
+
+	result, err := srv.Completion(context.Background(), params)
+	require.NoError(t, err)
+	assert.Contains(t, extractLabels(result.Items), "expenses:rent")
+
+	params.Position = protocol.Position{Line: 0, Character: 6}
+	result, err = srv.Completion(context.Background(), params)
+	require.NoError(t, err)
+	labels := extractLabels(result.Items)
+	assert.Contains(t, labels, "monthly")
+	assert.NotContains(t, labels, "expenses:rent")
+}
+
+func TestDetermineTimedotCompletionContext(t *testing.T) {
+	content := "2024-01-15\nfos:hl\nfos:hledger  ....\n\n# note"
+
+	tests := []struct {
+		name string
+		pos  protocol.Position
+		want CompletionContextType
+	}{
+		{"date line", protocol.Position{Line: 0, Character: 4}, ContextUnknown},
+		{"account", protocol.Position{Line: 1, Character: 6}, ContextAccount},
+		{"account before quantity", protocol.Position{Line: 2, Character: 5}, ContextAccount},
+		{"quantity", protocol.Position{Line: 2, Character: 15}, ContextUnknown},
+		{"empty line", protocol.Position{Line: 3, Character: 0}, ContextDate},
+		{"comment", protocol.Position{Line: 4, Character: 3}, ContextUnknown},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, determineTimedotCompletionContext(content, tt.pos))
+		})
+	}
+}
+
+func TestCompletion_TimedotAccounts(t *testing.T) {
+	srv := NewServer()
+	content := "2024-01-15\nfos:hledger  ....\nfos:haskell  1\n\n2024-01-16\nfos:h"
+	uri := protocol.DocumentURI("file:///time.timedot")
+	srv.documents.Store(uri, content)
+
+	result, err := srv.Completion(context.Background(), &protocol.CompletionParams{
+		TextDocumentPositionParams: protocol.TextDocumentPositionParams{
+			TextDocument: protocol.TextDocumentIdentifier{URI: uri},
+			Position:     protocol.Position{Line: 5, Character: 5},
+		},
+	})
+	require.NoError(t, err)
+
+	var labels []string
+	for _, item := range result.Items {
+		labels = append(labels, item.Label)
+	}
+	assert.Contains(t, labels, "fos:hledger")
+	assert.Contains(t, labels, "fos:haskell")
+}
@@ -7,6 +7,7 @@ import (
 	"go.lsp.dev/protocol"
 	"go.lsp.dev/uri"
 
+	"github.com/juev/hledger-lsp/internal/analyzer"
 	"github.com/juev/hledger-lsp/internal/ast"
 	"github.com/juev/hledger-lsp/internal/include"
 	"github.com/juev/hledger-lsp/internal/parser"
@@ -19,6 +20,7 @@ const (
 	DefContextAccount
 	DefContextCommodity
 	DefContextPayee
+	DefContextTag
 )
 
 type definitionTarget struct {
@@ -29,11 +31,11 @@ type definitionTarget struct {
 
 func (s *Server) Definition(ctx context.Context, params *protocol.DefinitionParams) ([]protocol.Location, error) {
 	doc, ok := s.GetDocument(params.TextDocument.URI)
-	if !ok {
+	if !ok || isRulesDocument(params.TextDocument.URI) {
 		return nil, nil
 	}
 
-	journal, _ := parser.Parse(doc)
+	journal, _ := parser.ParseWithOptions(doc, s.parseOptions(params.TextDocument.URI))
 
 	target := findDefinitionTarget(journal, params.Position)
 	if target == nil || target.context == DefContextUnknown {
@@ -57,7 +59,7 @@ func findDefinitionTarget(journal *ast.Journal, pos protocol.Position) *definiti
 
 		payee := getPayeeOrDescription(tx)
 		if payee != "" {
-			payeeRange := estimatePayeeRange(tx, payee)
+			payeeRange := analyzer.EstimatePayeeRange(tx, payee)
 			if positionInRange(pos, payeeRange) {
 				return &definitionTarget{
 					context:     DefContextPayee,
@@ -67,9 +69,19 @@ func findDefinitionTarget(journal *ast.Journal, pos protocol.Position) *definiti
 			}
 		}
 
+		for _, c := range tx.Comments {
+			if target := findTagTarget(c.Tags, pos); target != nil {
+				return target
+			}
+		}
+
 		for j := range tx.Postings {
 			p := &tx.Postings[j]
 
+			if target := findTagTarget(p.Tags, pos); target != nil {
+				return target
+			}
+
 			accountRange := computeAccountRange(&p.Account)
 			if positionInRange(pos, accountRange) {
 				return &definitionTarget{
@@ -94,6 +106,19 @@ func findDefinitionTarget(journal *ast.Journal, pos protocol.Position) *definiti
 	return nil
 }
 
+func findTagTarget(tags []ast.Tag, pos protocol.Position) *definitionTarget {
+	for _, tag := range tags {
+		if positionInRange(pos, tag.Range) {
+			return &definitionTarget{
+				context:     DefContextTag,
+				name:        tag.Name,
+				symbolRange: astRangeToProtocol(tag.Range),
+			}
+		}
+	}
+	return nil
+}
+
 func findDefinitionLocation(target *definitionTarget, resolved *include.ResolvedJournal, currentPath string, currentJournal *ast.Journal) *protocol.Location {
 	switch target.context {
 	case DefContextAccount:
@@ -102,6 +127,8 @@ func findDefinitionLocation(target *definitionTarget, resolved *include.Resolved
 		return findCommodityDefinitionResolved(target.name, resolved, currentPath, currentJournal)
 	case DefContextPayee:
 		return findPayeeDefinitionResolved(target.name, resolved, currentPath, currentJournal)
+	case DefContextTag:
+		return findTagDefinitionResolved(target.name, resolved, currentPath, currentJournal)
 	default:
 		return nil
 	}
@@ -138,8 +165,9 @@ func findFirstAccountUsageResolved(name string, journals map[string]*ast.Journal
 			for j := range tx.Postings {
 				p := &tx.Postings[j]
 				if p.Account.Name == name {
-					if earliestDate == nil || compareDates(tx.Date, *earliestDate) < 0 {
-						earliestDate = &tx.Date
+					date := tx.PostingDate(p)
+					if earliestDate == nil || compareDates(date, *earliestDate) < 0 {
+						earliestDate = &date
 						earliest = &protocol.Location{
 							URI:   pathToURI(filePath),
 							Range: *astRangeToProtocol(computeAccountRange(&p.Account)),
@@ -184,8 +212,9 @@ func findFirstCommodityUsageResolved(symbol string, journals map[string]*ast.Jou
 			for j := range tx.Postings {
 				p := &tx.Postings[j]
 				if p.Amount != nil && p.Amount.Commodity.Symbol == symbol {
-					if earliestDate == nil || compareDates(tx.Date, *earliestDate) < 0 {
-						earliestDate = &tx.Date
+					date := tx.PostingDate(p)
+					if earliestDate == nil || compareDates(date, *earliestDate) < 0 {
+						earliestDate = &date
 						earliest = &protocol.Location{
 							URI:   pathToURI(filePath),
 							Range: *astRangeToProtocol(p.Amount.Commodity.Range),
@@ -202,6 +231,22 @@ func findFirstCommodityUsageResolved(symbol string, journals map[string]*ast.Jou
 func findPayeeDefinitionResolved(payee string, resolved *include.ResolvedJournal, currentPath string, currentJournal *ast.Journal) *protocol.Location {
 	journals := allJournalsWithPaths(resolved, currentPath, currentJournal)
 
+	for _, filePath := range sortedJournalPaths(journals) {
+		journal := journals[filePath]
+		for _, dir := range journal.Directives {
+			if pd, ok := dir.(ast.PayeeDirective); ok && pd.Name == payee {
+				return &protocol.Location{
+					URI:   pathToURI(filePath),
+					Range: *astRangeToProtocol(pd.Range),
+				}
+			}
+		}
+	}
+
+	return findFirstPayeeUsageResolved(payee, journals)
+}
+
+func findFirstPayeeUsageResolved(payee string, journals map[string]*ast.Journal) *protocol.Location {
 	var earliest *protocol.Location
 	var earliestDate *ast.Date
 
@@ -225,6 +270,24 @@ func findPayeeDefinitionResolved(payee string, resolved *include.ResolvedJournal
 	return earliest
 }
 
+func findTagDefinitionResolved(name string, resolved *include.ResolvedJournal, currentPath string, currentJournal *ast.Journal) *protocol.Location {
+	journals := allJournalsWithPaths(resolved, currentPath, currentJournal)
+
+	for _, filePath := range sortedJournalPaths(journals) {
+		journal := journals[filePath]
+		for _, dir := range journal.Directives {
+			if td, ok := dir.(ast.TagDirective); ok && td.Name == name {
+				return &protocol.Location{
+					URI:   pathToURI(filePath),
+					Range: *astRangeToProtocol(td.Range),
+				}
+			}
+		}
+	}
+
+	return nil
+}
+
 func allJournalsWithPaths(resolved *include.ResolvedJournal, currentPath string, currentJournal *ast.Journal) map[string]*ast.Journal {
 	result := make(map[string]*ast.Journal)
 
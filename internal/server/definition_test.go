@@ -67,6 +67,35 @@ func TestDefinition_AccountFallback(t *testing.T) {
 	assert.Equal(t, uint32(1), result[0].Range.Start.Line) // first usage on line 1
 }
 
+func TestDefinition_AccountFallbackUsesPostingDate(t *testing.T) {
+	srv := NewServer()
+	content := `2024-01-15 grocery
+    expenses:food  $50  ; date:2024-01-20
+    assets:cash
+
+2024-01-16 another
+    expenses:food  $30
+    assets:cash`
+
+	uri := protocol.DocumentURI("file:///test.journal")
+	srv.documents.Store(uri, content)
+
+	params := &protocol.DefinitionParams{
+		TextDocumentPositionParams: protocol.TextDocumentPositionParams{
+			TextDocument: protocol.TextDocumentIdentifier{
+				URI: uri,
+			},
+			Position: protocol.Position{Line: 1, Character: 6},
+		},
+	}
+
+	result, err := srv.Definition(context.Background(), params)
+	require.NoError(t, err)
+	require.Len(t, result, 1)
+
+	assert.Equal(t, uint32(5), result[0].Range.Start.Line) // earliest posting date
+}
+
 func TestDefinition_CommodityDirective(t *testing.T) {
 	srv := NewServer()
 	content := `commodity $
@@ -228,3 +257,60 @@ func TestDefinition_AccountBoundary(t *testing.T) {
 	require.Len(t, result, 1)
 	assert.Equal(t, uint32(0), result[0].Range.Start.Line)
 }
+
+func TestDefinition_PayeeDirective(t *testing.T) {
+	srv := NewServer()
+	content := `2024-01-10 Grocery Store
+    expenses:food  $20
+    assets:cash
+
+payee Grocery Store
+
+2024-01-15 Grocery Store
+    expenses:food  $50
+    assets:cash`
+
+	uri := protocol.DocumentURI("file:///test.journal")
+	srv.documents.Store(uri, content)
+
+	params := &protocol.DefinitionParams{
+		TextDocumentPositionParams: protocol.TextDocumentPositionParams{
+			TextDocument: protocol.TextDocumentIdentifier{URI: uri},
+			Position:     protocol.Position{Line: 6, Character: 15},
+		},
+	}
+
+	result, err := srv.Definition(context.Background(), params)
+	require.NoError(t, err)
+	require.Len(t, result, 1)
+	assert.Equal(t, uint32(4), result[0].Range.Start.Line)
+}
+
+func TestDefinition_TagDirective(t *testing.T) {
+	srv := NewServer()
+	content := `tag project
+
+2024-01-15 Grocery Store  ; project:home
+    expenses:food  $50  ; project:garden
+    assets:cash`
+
+	uri := protocol.DocumentURI("file:///test.journal")
+	srv.documents.Store(uri, content)
+
+	for _, pos := range []protocol.Position{
+		{Line: 2, Character: 29},
+		{Line: 3, Character: 26},
+	} {
+		params := &protocol.DefinitionParams{
+			TextDocumentPositionParams: protocol.TextDocumentPositionParams{
+				TextDocument: protocol.TextDocumentIdentifier{URI: uri},
+				Position:     pos,
+			},
+		}
+
+		result, err := srv.Definition(context.Background(), params)
+		require.NoError(t, err)
+		require.Len(t, result, 1, "position %v", pos)
+		assert.Equal(t, uint32(0), result[0].Range.Start.Line)
+	}
+}
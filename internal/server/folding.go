@@ -6,6 +6,7 @@ import (
 
 	"go.lsp.dev/protocol"
 
+	"github.com/juev/hledger-lsp/internal/ast"
 	"github.com/juev/hledger-lsp/internal/parser"
 )
 
@@ -18,29 +19,47 @@ func (s *Server) FoldingRanges(ctx context.Context, params *protocol.FoldingRang
 	if doc == "" {
 		return []protocol.FoldingRange{}, nil
 	}
+	if isRulesDocument(params.TextDocument.URI) {
+		return rulesFoldingRanges(doc), nil
+	}
+
+	journal, _ := parser.ParseWithOptions(doc, s.parseOptions(params.TextDocument.URI))
+	blockLines := commentBlockLines(journal)
 
 	var ranges []protocol.FoldingRange
 
-	ranges = append(ranges, findTransactionFolds(doc)...)
-	ranges = append(ranges, findDirectiveFolds(doc)...)
-	ranges = append(ranges, findCommentBlockFolds(doc)...)
+	ranges = append(ranges, findTransactionFolds(journal)...)
+	ranges = append(ranges, findDirectiveFolds(doc, blockLines)...)
+	ranges = append(ranges, findCommentBlockFolds(doc, journal, blockLines)...)
 
 	return ranges, nil
 }
 
-func findTransactionFolds(content string) []protocol.FoldingRange {
-	journal, _ := parser.Parse(content)
-	var ranges []protocol.FoldingRange
+// commentBlockLines returns the zero-based lines covered by comment blocks,
+// whose content must not be folded as journal entries.
+func commentBlockLines(journal *ast.Journal) map[int]bool {
+	lines := make(map[int]bool)
+	for _, c := range journal.Comments {
+		if !c.Block {
+			continue
+		}
+		for line := c.Range.Start.Line - 1; line <= c.Range.End.Line-1; line++ {
+			lines[line] = true
+		}
+	}
+	return lines
+}
 
-	for i := range journal.Transactions {
-		tx := &journal.Transactions[i]
+func findTransactionFolds(journal *ast.Journal) []protocol.FoldingRange {
+	var ranges []protocol.FoldingRange
 
-		if len(tx.Postings) == 0 {
-			continue
+	addFold := func(rng ast.Range, postingCount int) {
+		if postingCount == 0 {
+			return
 		}
 
-		startLine := uint32(tx.Range.Start.Line - 1)
-		endLine := uint32(tx.Range.End.Line - 1)
+		startLine := uint32(rng.Start.Line - 1)
+		endLine := uint32(rng.End.Line - 1)
 
 		if endLine > startLine {
 			ranges = append(ranges, protocol.FoldingRange{
@@ -51,17 +70,27 @@ func findTransactionFolds(content string) []protocol.FoldingRange {
 		}
 	}
 
+	for i := range journal.Transactions {
+		addFold(journal.Transactions[i].Range, len(journal.Transactions[i].Postings))
+	}
+	for i := range journal.PeriodicTransactions {
+		addFold(journal.PeriodicTransactions[i].Range, len(journal.PeriodicTransactions[i].Postings))
+	}
+	for i := range journal.AutoPostingRules {
+		addFold(journal.AutoPostingRules[i].Range, len(journal.AutoPostingRules[i].Postings))
+	}
+
 	return ranges
 }
 
-func findDirectiveFolds(content string) []protocol.FoldingRange {
+func findDirectiveFolds(content string, blockLines map[int]bool) []protocol.FoldingRange {
 	lines := strings.Split(content, "\n")
 	var ranges []protocol.FoldingRange
 
 	for i := 0; i < len(lines); i++ {
 		line := lines[i]
 
-		if !isDirectiveLine(line) {
+		if blockLines[i] || !isDirectiveLine(line) {
 			continue
 		}
 
@@ -106,15 +135,25 @@ func isDirectiveLine(line string) bool {
 	return false
 }
 
-func findCommentBlockFolds(content string) []protocol.FoldingRange {
+func findCommentBlockFolds(content string, journal *ast.Journal, blockLines map[int]bool) []protocol.FoldingRange {
 	lines := strings.Split(content, "\n")
 	var ranges []protocol.FoldingRange
 
+	for _, c := range journal.Comments {
+		if c.Block && c.Range.End.Line > c.Range.Start.Line {
+			ranges = append(ranges, protocol.FoldingRange{
+				StartLine: uint32(c.Range.Start.Line - 1),
+				EndLine:   uint32(c.Range.End.Line - 1),
+				Kind:      protocol.CommentFoldingRange,
+			})
+		}
+	}
+
 	i := 0
 	for i < len(lines) {
 		line := strings.TrimSpace(lines[i])
 
-		if !strings.HasPrefix(line, ";") && !strings.HasPrefix(line, "#") {
+		if blockLines[i] || (!strings.HasPrefix(line, ";") && !strings.HasPrefix(line, "#")) {
 			i++
 			continue
 		}
@@ -124,6 +163,9 @@ func findCommentBlockFolds(content string) []protocol.FoldingRange {
 
 		for j := i + 1; j < len(lines); j++ {
 			nextLine := strings.TrimSpace(lines[j])
+			if blockLines[j] {
+				break
+			}
 			if strings.HasPrefix(nextLine, ";") || strings.HasPrefix(nextLine, "#") {
 				endLine = j
 			} else {
@@ -136,3 +136,71 @@ func TestFoldingRanges_DocumentNotFound(t *testing.T) {
 	require.NoError(t, err)
 	assert.Nil(t, result)
 }
+
+func TestFoldingRanges_PeriodicTransaction(t *testing.T) {
+	srv := NewServer()
+	content := `~ monthly  rent
+    expenses:rent  $1000
+    assets:checking
+`
+
+	uri := protocol.DocumentURI("file:///test.journal")
+	srv.documents.Store(uri, content)
+
+	params := &protocol.FoldingRangeParams{
+		TextDocumentPositionParams: protocol.TextDocumentPositionParams{
+			TextDocument: protocol.TextDocumentIdentifier{URI: uri},
+		},
+	}
+
+	result, err := srv.FoldingRanges(context.Background(), params)
+	require.NoError(t, err)
+	require.Len(t, result, 1)
+	assert.Equal(t, uint32(0), result[0].StartLine)
+	assert.GreaterOrEqual(t, result[0].EndLine, uint32(2))
+	assert.Equal(t, protocol.RegionFoldingRange, result[0].Kind)
+}
+
+func TestFoldingRanges_CommentDirectiveBlock(t *testing.T) {
+	srv := NewServer()
+	content := `comment
+; parked
+2024-01-15 parked
+    expenses:food  $50
+account expenses:food
+    note parked
+end comment
+
+2024-01-16 rent
+    expenses:rent  $1000
+    assets:checking`
+
+	uri := protocol.DocumentURI("file:///test.journal")
+	srv.documents.Store(uri, content)
+
+	params := &protocol.FoldingRangeParams{
+		TextDocumentPositionParams: protocol.TextDocumentPositionParams{
+			TextDocument: protocol.TextDocumentIdentifier{URI: uri},
+		},
+	}
+
+	result, err := srv.FoldingRanges(context.Background(), params)
+	require.NoError(t, err)
+
+	var comments, regions []protocol.FoldingRange
+	for _, r := range result {
+		switch r.Kind {
+		case protocol.CommentFoldingRange:
+			comments = append(comments, r)
+		case protocol.RegionFoldingRange:
+			regions = append(regions, r)
+		}
+	}
+
+	require.Len(t, comments, 1)
+	assert.Equal(t, uint32(0), comments[0].StartLine)
+	assert.Equal(t, uint32(6), comments[0].EndLine)
+
+	require.Len(t, regions, 1)
+	assert.Equal(t, uint32(8), regions[0].StartLine)
+}
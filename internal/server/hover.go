@@ -3,13 +3,16 @@ package server
 import (
 	"context"
 	"fmt"
+	"path/filepath"
 	"sort"
 	"strings"
 
+	"github.com/shopspring/decimal"
 	"go.lsp.dev/protocol"
 
 	"github.com/juev/hledger-lsp/internal/analyzer"
 	"github.com/juev/hledger-lsp/internal/ast"
+	"github.com/juev/hledger-lsp/internal/include"
 	"github.com/juev/hledger-lsp/internal/lsputil"
 	"github.com/juev/hledger-lsp/internal/parser"
 )
@@ -25,6 +28,7 @@ const (
 	HoverDate
 	HoverTag
 	HoverTagValue
+	HoverBalanceAssignment
 )
 
 type hoverElement struct {
@@ -35,17 +39,20 @@ type hoverElement struct {
 	cost        *ast.Cost
 	payee       string
 	transaction *ast.Transaction
+	posting     *ast.Posting
 	tagName     string
 	tagValue    string
+	accountType analyzer.AccountType
 }
 
 func (s *Server) Hover(ctx context.Context, params *protocol.HoverParams) (*protocol.Hover, error) {
 	doc, ok := s.GetDocument(params.TextDocument.URI)
-	if !ok {
+	if !ok || isRulesDocument(params.TextDocument.URI) {
 		return nil, nil
 	}
 
-	journal, _ := parser.Parse(doc)
+	opts := s.parseOptions(params.TextDocument.URI)
+	journal, _ := parser.ParseWithOptions(doc, opts)
 
 	element := findElementAtPosition(journal, params.Position)
 	if element == nil || element.context == HoverUnknown {
@@ -54,19 +61,62 @@ func (s *Server) Hover(ctx context.Context, params *protocol.HoverParams) (*prot
 
 	var balances analyzer.AccountBalances
 	var allTransactions []ast.Transaction
+	var allDirectives []ast.Directive
+	var rules []ast.AutoPostingRule
+	var rulePaths []string
 
 	if resolved := s.getWorkspaceResolved(params.TextDocument.URI); resolved != nil {
 		allTransactions = resolved.AllTransactions()
-		balances = analyzer.CalculateAccountBalancesFromTransactions(allTransactions)
+		allDirectives = resolved.AllDirectives()
+		rules, rulePaths = autoPostingRulesWithPaths(resolved, s.primaryJournalPath(params.TextDocument.URI))
+		balances = analyzer.CalculateAccountBalancesFromTransactions(allTransactions, rules)
 	} else {
 		allTransactions = journal.Transactions
+		allDirectives = journal.Directives
+		rules = journal.AutoPostingRules
+		rulePaths = make([]string, len(rules))
+		for i := range rulePaths {
+			rulePaths[i] = uriToPath(params.TextDocument.URI)
+		}
 		balances = analyzer.CalculateAccountBalances(journal)
 	}
 
-	content := buildHoverContentWithTransactions(element, balances, allTransactions)
+	if element.context == HoverAccount {
+		element.accountType = analyzer.CollectAccountTypes(append(allDirectives, journal.Directives...)).Type(element.account.Name)
+	}
+
+	if element.context == HoverBalanceAssignment {
+		transactions := s.transactionsInParseOrder(params.TextDocument.URI, journal)
+		if transactions == nil {
+			transactions = journal.Transactions
+		}
+		if amount, ok := analyzer.ComputeBalanceAssignments(transactions, rules)[element.posting]; ok {
+			element.amount = &amount
+		}
+	}
+
+	var v *valuation
+	if commodity := s.getSettings().Hover.ValuationCommodity; commodity != "" && element.context == HoverAccount {
+		v = &valuation{
+			commodity: commodity,
+			prices:    analyzer.BuildPriceDB(allDirectives, allTransactions),
+			date:      element.transaction.Date,
+		}
+		if element.posting.Date != nil {
+			v.date = *element.posting.Date
+		}
+	}
+
+	content := buildHoverContentWithTransactions(element, balances, allTransactions, v)
+	if opts.Format == parser.FormatTimedot {
+		content = buildTimedotHover(element, content, journal.Transactions)
+	}
 	if content == "" {
 		return nil, nil
 	}
+	if element.posting != nil {
+		content += buildAutoPostingHover(element, rules, rulePaths)
+	}
 
 	return &protocol.Hover{
 		Contents: protocol.MarkupContent{
@@ -111,7 +161,7 @@ func findElementAtPosition(journal *ast.Journal, pos protocol.Position) *hoverEl
 
 		payee := getPayeeOrDescription(tx)
 		if payee != "" {
-			payeeRange := estimatePayeeRange(tx, payee)
+			payeeRange := analyzer.EstimatePayeeRange(tx, payee)
 			if positionInRange(pos, payeeRange) {
 				return &hoverElement{
 					context:     HoverPayee,
@@ -135,18 +185,42 @@ func findElementAtPosition(journal *ast.Journal, pos protocol.Position) *hoverEl
 			accountRange := computeAccountRange(&p.Account)
 			if positionInRange(pos, accountRange) {
 				return &hoverElement{
-					context: HoverAccount,
-					rng:     accountRange,
-					account: &p.Account,
+					context:     HoverAccount,
+					rng:         accountRange,
+					account:     &p.Account,
+					transaction: tx,
+					posting:     p,
+				}
+			}
+
+			if rng, ok := lotRangeAt(p, pos); ok {
+				return &hoverElement{
+					context:     HoverAmount,
+					rng:         rng,
+					amount:      p.Amount,
+					cost:        p.Cost,
+					transaction: tx,
+					posting:     p,
 				}
 			}
 
 			if p.Amount != nil && positionInRange(pos, p.Amount.Range) {
 				return &hoverElement{
-					context: HoverAmount,
-					rng:     p.Amount.Range,
-					amount:  p.Amount,
-					cost:    p.Cost,
+					context:     HoverAmount,
+					rng:         p.Amount.Range,
+					amount:      p.Amount,
+					cost:        p.Cost,
+					transaction: tx,
+					posting:     p,
+				}
+			}
+
+			if p.Amount == nil && p.BalanceAssertion != nil && positionInRange(pos, p.BalanceAssertion.Range) {
+				return &hoverElement{
+					context:     HoverBalanceAssignment,
+					rng:         p.BalanceAssertion.Range,
+					transaction: tx,
+					posting:     p,
 				}
 			}
 
@@ -175,31 +249,12 @@ func getPayeeOrDescription(tx *ast.Transaction) string {
 	return tx.Description
 }
 
-func estimatePayeeRange(tx *ast.Transaction, payee string) ast.Range {
-	startCol := tx.Date.Range.End.Column + 1
-	if tx.Status != ast.StatusNone {
-		startCol += 2
-	}
-
-	payeeLen := lsputil.UTF16Len(payee)
-	return ast.Range{
-		Start: ast.Position{
-			Line:   tx.Date.Range.Start.Line,
-			Column: startCol,
-		},
-		End: ast.Position{
-			Line:   tx.Date.Range.Start.Line,
-			Column: startCol + payeeLen,
-		},
-	}
-}
-
-func buildHoverContentWithTransactions(element *hoverElement, balances analyzer.AccountBalances, transactions []ast.Transaction) string {
+func buildHoverContentWithTransactions(element *hoverElement, balances analyzer.AccountBalances, transactions []ast.Transaction, v *valuation) string {
 	switch element.context {
 	case HoverAccount:
-		return buildAccountHoverWithTransactions(element.account.Name, balances, transactions)
+		return buildAccountHoverWithTransactions(element.account.Name, element.accountType, balances, transactions, v) + buildPostingDateHover(element.posting)
 	case HoverAmount:
-		return buildAmountHover(element.amount, element.cost)
+		return buildAmountHover(element.amount, element.cost) + buildLotHover(element.posting)
 	case HoverPayee:
 		return buildPayeeHoverWithTransactions(element.payee, transactions)
 	case HoverDate:
@@ -208,15 +263,28 @@ func buildHoverContentWithTransactions(element *hoverElement, balances analyzer.
 		return buildTagHover(element.tagName, transactions)
 	case HoverTagValue:
 		return buildTagValueHover(element.tagName, element.tagValue, transactions)
+	case HoverBalanceAssignment:
+		return buildBalanceAssignmentHover(element.posting, element.amount)
 	default:
 		return ""
 	}
 }
 
-func buildAccountHoverWithTransactions(accountName string, balances analyzer.AccountBalances, transactions []ast.Transaction) string {
+// valuation converts account balances into one commodity, at the latest
+// market prices and at those of a date.
+type valuation struct {
+	commodity string
+	prices    *analyzer.PriceDB
+	date      ast.Date
+}
+
+func buildAccountHoverWithTransactions(accountName string, accountType analyzer.AccountType, balances analyzer.AccountBalances, transactions []ast.Transaction, v *valuation) string {
 	var sb strings.Builder
 
 	fmt.Fprintf(&sb, "**Account:** `%s`\n\n", accountName)
+	if accountType != analyzer.AccountTypeNone {
+		fmt.Fprintf(&sb, "**Type:** %s (`%s`)\n\n", accountType.Name(), accountType)
+	}
 
 	if commodityBalances, ok := balances[accountName]; ok && len(commodityBalances) > 0 {
 		sb.WriteString("**Balance:**\n")
@@ -232,6 +300,10 @@ func buildAccountHoverWithTransactions(accountName string, balances analyzer.Acc
 			fmt.Fprintf(&sb, "- %s %s\n", bal.String(), c)
 		}
 		sb.WriteString("\n")
+
+		if v != nil {
+			sb.WriteString(buildValuationHover(commodities, commodityBalances, v))
+		}
 	}
 
 	postingCount := countPostingsForAccountInTransactions(accountName, transactions)
@@ -240,6 +312,108 @@ func buildAccountHoverWithTransactions(accountName string, balances analyzer.Acc
 	return sb.String()
 }
 
+// buildValuationHover shows each balance converted to the valuation
+// commodity, at the latest price and at the price on the valuation date,
+// and their total when every balance has a price.
+func buildValuationHover(commodities []string, balances map[string]decimal.Decimal, v *valuation) string {
+	var sb strings.Builder
+	date := fmt.Sprintf("%04d-%02d-%02d", v.date.Year, v.date.Month, v.date.Day)
+	fmt.Fprintf(&sb, "**Value in %s:**\n", v.commodity)
+
+	latestTotal, dateTotal := decimal.Zero, decimal.Zero
+	complete := true
+	for _, c := range commodities {
+		bal := balances[c]
+		latest, latestOK := v.prices.LatestRate(c, v.commodity)
+		onDate, dateOK := v.prices.Rate(c, v.commodity, v.date)
+		if !latestOK {
+			fmt.Fprintf(&sb, "- %s %s: no price\n", bal.String(), c)
+			complete = false
+			continue
+		}
+
+		latestValue := bal.Mul(latest).Round(2)
+		latestTotal = latestTotal.Add(latestValue)
+		fmt.Fprintf(&sb, "- %s %s: %s %s at latest price", bal.String(), c, latestValue.String(), v.commodity)
+		if dateOK {
+			dateValue := bal.Mul(onDate).Round(2)
+			dateTotal = dateTotal.Add(dateValue)
+			fmt.Fprintf(&sb, ", %s %s on %s", dateValue.String(), v.commodity, date)
+		} else {
+			complete = false
+		}
+		sb.WriteString("\n")
+	}
+	if complete && len(commodities) > 1 {
+		fmt.Fprintf(&sb, "\n**Total:** %s %s at latest price, %s %s on %s\n", latestTotal.String(), v.commodity, dateTotal.String(), v.commodity, date)
+	}
+	sb.WriteString("\n")
+	return sb.String()
+}
+
+// buildTimedotHover adds the hours logged on the hovered entry's day: per
+// account for a date, or for the account of an entry.
+func buildTimedotHover(element *hoverElement, content string, transactions []ast.Transaction) string {
+	if element.transaction == nil {
+		return content
+	}
+
+	day := element.transaction.Date
+	hours := make(map[string]decimal.Decimal)
+	for i := range transactions {
+		tx := &transactions[i]
+		if tx.Date.Year != day.Year || tx.Date.Month != day.Month || tx.Date.Day != day.Day {
+			continue
+		}
+		for _, p := range tx.Postings {
+			if p.Amount != nil {
+				hours[p.Account.Name] = hours[p.Account.Name].Add(p.Amount.Quantity)
+			}
+		}
+	}
+
+	date := fmt.Sprintf("%04d-%02d-%02d", day.Year, day.Month, day.Day)
+	switch element.context {
+	case HoverDate:
+		accounts := make([]string, 0, len(hours))
+		total := decimal.Zero
+		for account, h := range hours {
+			accounts = append(accounts, account)
+			total = total.Add(h)
+		}
+		sort.Strings(accounts)
+
+		var sb strings.Builder
+		fmt.Fprintf(&sb, "**Date:** %s\n\n**Hours:**\n", date)
+		for _, account := range accounts {
+			fmt.Fprintf(&sb, "- `%s` %s %s\n", account, hours[account].String(), parser.HoursCommodity)
+		}
+		fmt.Fprintf(&sb, "\n**Total:** %s %s", total.String(), parser.HoursCommodity)
+		return sb.String()
+	case HoverAccount:
+		return content + fmt.Sprintf("\n\n**Hours on %s:** %s %s", date, hours[element.account.Name].String(), parser.HoursCommodity)
+	default:
+		return content
+	}
+}
+
+// buildPostingDateHover shows the dates a posting's `date:` and `date2:`
+// tags give it.
+func buildPostingDateHover(posting *ast.Posting) string {
+	if posting == nil {
+		return ""
+	}
+
+	var sb strings.Builder
+	if d := posting.Date; d != nil {
+		fmt.Fprintf(&sb, "\n\n**Posting date:** %04d-%02d-%02d", d.Year, d.Month, d.Day)
+	}
+	if d := posting.Date2; d != nil {
+		fmt.Fprintf(&sb, "\n\n**Posting date2:** %04d-%02d-%02d", d.Year, d.Month, d.Day)
+	}
+	return sb.String()
+}
+
 func buildAmountHover(amount *ast.Amount, cost *ast.Cost) string {
 	var sb strings.Builder
 
@@ -256,6 +430,71 @@ func buildAmountHover(amount *ast.Amount, cost *ast.Cost) string {
 	return sb.String()
 }
 
+// buildBalanceAssignmentHover shows the balance a posting assigns and the
+// amount derived from the account's running balance.
+func buildBalanceAssignmentHover(posting *ast.Posting, amount *ast.Amount) string {
+	var sb strings.Builder
+
+	target := posting.BalanceAssertion.Amount
+	fmt.Fprintf(&sb, "**Balance assignment:** %s %s", target.Quantity.String(), target.Commodity.Symbol)
+	if amount != nil {
+		fmt.Fprintf(&sb, "\n\n**Assigned amount:** %s %s", amount.Quantity.String(), amount.Commodity.Symbol)
+	}
+
+	return sb.String()
+}
+
+// lotRangeAt returns the range of the posting's lot annotation under pos.
+func lotRangeAt(p *ast.Posting, pos protocol.Position) (ast.Range, bool) {
+	if p.Amount == nil {
+		return ast.Range{}, false
+	}
+	if p.LotCost != nil && positionInRange(pos, p.LotCost.Range) {
+		return p.LotCost.Range, true
+	}
+	if p.LotDate != nil && positionInRange(pos, p.LotDate.Range) {
+		return p.LotDate.Range, true
+	}
+	return ast.Range{}, false
+}
+
+// buildLotHover describes the lot a posting's amount belongs to: its cost
+// basis, acquisition date and, for a sale at a known price, the gain.
+func buildLotHover(posting *ast.Posting) string {
+	if posting == nil || posting.Amount == nil || (posting.LotCost == nil && posting.LotDate == nil) {
+		return ""
+	}
+
+	var sb strings.Builder
+	qty := posting.Amount.Quantity.Abs()
+
+	if lot := posting.LotCost; lot != nil {
+		symbol := lot.Amount.Commodity.Symbol
+		basis := lot.Amount.Quantity
+		if lot.IsTotal {
+			fmt.Fprintf(&sb, "\n\n**Lot cost:** {{%s %s}}", basis.String(), symbol)
+		} else {
+			fmt.Fprintf(&sb, "\n\n**Lot cost:** {%s %s}", basis.String(), symbol)
+			basis = basis.Mul(qty)
+		}
+		fmt.Fprintf(&sb, "\n\n**Cost basis:** %s %s", basis.String(), symbol)
+
+		if cost := posting.Cost; cost != nil && posting.Amount.Quantity.IsNegative() && cost.Amount.Commodity.Symbol == symbol {
+			proceeds := cost.Amount.Quantity
+			if !cost.IsTotal {
+				proceeds = proceeds.Mul(qty)
+			}
+			fmt.Fprintf(&sb, "\n\n**Gain:** %s %s", proceeds.Sub(basis).String(), symbol)
+		}
+	}
+
+	if date := posting.LotDate; date != nil {
+		fmt.Fprintf(&sb, "\n\n**Lot date:** %04d-%02d-%02d", date.Year, date.Month, date.Day)
+	}
+
+	return sb.String()
+}
+
 func buildPayeeHoverWithTransactions(payee string, transactions []ast.Transaction) string {
 	var sb strings.Builder
 
@@ -289,6 +528,63 @@ func buildDateHover(tx *ast.Transaction) string {
 	return sb.String()
 }
 
+// buildAutoPostingHover lists the postings that auto posting rules generate
+// for the hovered posting, with the location of each rule.
+func buildAutoPostingHover(element *hoverElement, rules []ast.AutoPostingRule, rulePaths []string) string {
+	if element.transaction == nil || len(rules) == 0 {
+		return ""
+	}
+
+	var sb strings.Builder
+	for _, g := range analyzer.NewAutoPoster(rules).Generate(element.transaction) {
+		if g.Matched != element.posting {
+			continue
+		}
+		if sb.Len() == 0 {
+			sb.WriteString("\n\n**Auto postings:**\n")
+		}
+		fmt.Fprintf(&sb, "- `%s`", g.Posting.Account.Name)
+		if g.Posting.Amount != nil {
+			fmt.Fprintf(&sb, " %s %s", g.Posting.Amount.Quantity.String(), g.Posting.Amount.Commodity.Symbol)
+		}
+		fmt.Fprintf(&sb, " — generated by rule at %s:%d\n", displayRulePath(rulePaths[g.RuleIndex]), rules[g.RuleIndex].Range.Start.Line)
+	}
+
+	return strings.TrimRight(sb.String(), "\n")
+}
+
+// autoPostingRulesWithPaths returns the rules of all resolved files in
+// include order, along with the file each rule is declared in.
+func autoPostingRulesWithPaths(resolved *include.ResolvedJournal, primaryPath string) ([]ast.AutoPostingRule, []string) {
+	var rules []ast.AutoPostingRule
+	var paths []string
+
+	add := func(path string, journal *ast.Journal) {
+		for _, rule := range journal.AutoPostingRules {
+			rules = append(rules, rule)
+			paths = append(paths, path)
+		}
+	}
+
+	if resolved.Primary != nil {
+		add(primaryPath, resolved.Primary)
+	}
+	for _, path := range resolved.FileOrder {
+		if j, ok := resolved.Files[path]; ok {
+			add(path, j)
+		}
+	}
+
+	return rules, paths
+}
+
+func displayRulePath(path string) string {
+	if path == "" {
+		return "<unknown>"
+	}
+	return filepath.Base(path)
+}
+
 func countPostingsForAccountInTransactions(accountName string, transactions []ast.Transaction) int {
 	count := 0
 	for i := range transactions {
@@ -121,6 +121,32 @@ func TestHover_Account(t *testing.T) {
 	assert.Contains(t, result.Contents.Value, "80")
 }
 
+func TestHover_AccountType(t *testing.T) {
+	srv := NewServer()
+	content := `account personal  ; type: Asset
+
+2024-01-15 grocery
+    expenses:food  $50
+    personal:wallet  $-50`
+
+	srv.documents.Store(protocol.DocumentURI("file:///test.journal"), content)
+
+	hover := func(line, character uint32) string {
+		result, err := srv.Hover(context.Background(), &protocol.HoverParams{
+			TextDocumentPositionParams: protocol.TextDocumentPositionParams{
+				TextDocument: protocol.TextDocumentIdentifier{URI: "file:///test.journal"},
+				Position:     protocol.Position{Line: line, Character: character},
+			},
+		})
+		require.NoError(t, err)
+		require.NotNil(t, result)
+		return result.Contents.Value
+	}
+
+	assert.Contains(t, hover(3, 10), "**Type:** Expense (`X`)")
+	assert.Contains(t, hover(4, 10), "**Type:** Asset (`A`)", "inherited from the declared parent")
+}
+
 func TestHover_Amount(t *testing.T) {
 	srv := NewServer()
 	content := `2024-01-15 test
@@ -584,3 +610,205 @@ func TestHover_PartialDateWithStatus(t *testing.T) {
 	assert.Contains(t, result.Contents.Value, "Payee")
 	assert.Contains(t, result.Contents.Value, "Магазин")
 }
+
+func TestHover_AutoPostingRuleBalances(t *testing.T) {
+	srv := NewServer()
+	content := `= expenses:food
+    liabilities:tax  *-0.25
+    assets:savings  *0.25
+
+2024-01-15 grocery
+    expenses:food  $40
+    assets:cash  $-40
+
+2024-01-16 tax payment
+    liabilities:tax  $5
+    assets:cash  $-5`
+
+	srv.documents.Store(protocol.DocumentURI("file:///test.journal"), content)
+
+	hover := func(line, character uint32) string {
+		params := &protocol.HoverParams{
+			TextDocumentPositionParams: protocol.TextDocumentPositionParams{
+				TextDocument: protocol.TextDocumentIdentifier{URI: "file:///test.journal"},
+				Position:     protocol.Position{Line: line, Character: character},
+			},
+		}
+		result, err := srv.Hover(context.Background(), params)
+		require.NoError(t, err)
+		require.NotNil(t, result)
+		return result.Contents.Value
+	}
+
+	taxHover := hover(9, 8)
+	assert.Contains(t, taxHover, "- -5 $")
+	assert.NotContains(t, taxHover, "Auto postings")
+
+	foodHover := hover(5, 8)
+	assert.Contains(t, foodHover, "generated by rule at test.journal:1")
+	assert.Contains(t, foodHover, "`liabilities:tax` -10 $")
+
+	amountHover := hover(5, 20)
+	assert.Contains(t, amountHover, "**Amount:** 40 $")
+	assert.Contains(t, amountHover, "`assets:savings` 10 $")
+
+	cashHover := hover(6, 8)
+	assert.NotContains(t, cashHover, "Auto postings")
+}
+
+func TestHover_LotCost(t *testing.T) {
+	srv := NewServer()
+	content := `2024-03-01 sell
+    assets:broker  -10 AAPL {150 USD} [2024-01-02] @ 180 USD
+    assets:cash  1800 USD
+    income:gains  -300 USD`
+
+	srv.documents.Store(protocol.DocumentURI("file:///test.journal"), content)
+
+	params := &protocol.HoverParams{
+		TextDocumentPositionParams: protocol.TextDocumentPositionParams{
+			TextDocument: protocol.TextDocumentIdentifier{
+				URI: "file:///test.journal",
+			},
+			Position: protocol.Position{Line: 1, Character: 30},
+		},
+	}
+
+	result, err := srv.Hover(context.Background(), params)
+	require.NoError(t, err)
+	require.NotNil(t, result)
+
+	assert.Contains(t, result.Contents.Value, "Cost basis:** 1500 USD")
+	assert.Contains(t, result.Contents.Value, "Gain:** 300 USD")
+	assert.Contains(t, result.Contents.Value, "Lot date:** 2024-01-02")
+}
+
+func TestHover_BalanceAssignment(t *testing.T) {
+	srv := NewServer()
+	content := `2024-01-15 deposit
+    assets:checking  $800
+    income:salary  $-800
+
+2024-01-20 reconcile
+    assets:checking  = $1000
+    income:interest`
+
+	srv.documents.Store(protocol.DocumentURI("file:///test.journal"), content)
+
+	params := &protocol.HoverParams{
+		TextDocumentPositionParams: protocol.TextDocumentPositionParams{
+			TextDocument: protocol.TextDocumentIdentifier{
+				URI: "file:///test.journal",
+			},
+			Position: protocol.Position{Line: 5, Character: 24},
+		},
+	}
+
+	result, err := srv.Hover(context.Background(), params)
+	require.NoError(t, err)
+	require.NotNil(t, result)
+
+	assert.Contains(t, result.Contents.Value, "Balance assignment:** 1000 $")
+	assert.Contains(t, result.Contents.Value, "Assigned amount:** 200 $")
+
+	params.Position = protocol.Position{Line: 5, Character: 8}
+	result, err = srv.Hover(context.Background(), params)
+	require.NoError(t, err)
+	require.NotNil(t, result)
+	assert.Contains(t, result.Contents.Value, "- 1000 $")
+}
+
+func TestHover_AccountWithPostingDate(t *testing.T) {
+	srv := NewServer()
+	content := `2024-01-30 purchase
+    expenses:food  $50
+    liabilities:card  $-50  ; date:2024-02-03`
+
+	srv.documents.Store(protocol.DocumentURI("file:///test.journal"), content)
+
+	params := &protocol.HoverParams{
+		TextDocumentPositionParams: protocol.TextDocumentPositionParams{
+			TextDocument: protocol.TextDocumentIdentifier{
+				URI: "file:///test.journal",
+			},
+			Position: protocol.Position{Line: 2, Character: 8},
+		},
+	}
+
+	result, err := srv.Hover(context.Background(), params)
+	require.NoError(t, err)
+	require.NotNil(t, result)
+
+	assert.Contains(t, result.Contents.Value, "**Posting date:** 2024-02-03")
+}
+
+func TestHover_TimedotTotals(t *testing.T) {
+	srv := NewServer()
+	content := `2024-01-15
+fos:hledger  .... ..
+fos:haskell  1.5
+fos:hledger  30m
+
+2024-01-16
+fos:hledger  ..`
+
+	uri := protocol.DocumentURI("file:///time.timedot")
+	srv.documents.Store(uri, content)
+
+	hover := func(line, char uint32) string {
+		result, err := srv.Hover(context.Background(), &protocol.HoverParams{
+			TextDocumentPositionParams: protocol.TextDocumentPositionParams{
+				TextDocument: protocol.TextDocumentIdentifier{URI: uri},
+				Position:     protocol.Position{Line: line, Character: char},
+			},
+		})
+		require.NoError(t, err)
+		require.NotNil(t, result)
+		return result.Contents.Value
+	}
+
+	day := hover(0, 3)
+	assert.Contains(t, day, "**Date:** 2024-01-15")
+	assert.Contains(t, day, "- `fos:haskell` 1.5 h")
+	assert.Contains(t, day, "- `fos:hledger` 2 h")
+	assert.Contains(t, day, "**Total:** 3.5 h")
+
+	account := hover(1, 3)
+	assert.Contains(t, account, "- 2.5 h")
+	assert.Contains(t, account, "**Hours on 2024-01-15:** 2 h")
+}
+
+func TestHover_AccountValuation(t *testing.T) {
+	srv := NewServer()
+	settings := srv.getSettings()
+	settings.Hover.ValuationCommodity = "$"
+	srv.setSettings(settings)
+
+	content := `P 2024-01-01 AAPL $100
+P 2024-03-01 AAPL $150
+
+2024-01-15 buy
+    assets:broker  10 AAPL @ $110
+    assets:broker  $5
+    assets:cash`
+
+	srv.documents.Store(protocol.DocumentURI("file:///test.journal"), content)
+
+	params := &protocol.HoverParams{
+		TextDocumentPositionParams: protocol.TextDocumentPositionParams{
+			TextDocument: protocol.TextDocumentIdentifier{
+				URI: "file:///test.journal",
+			},
+			Position: protocol.Position{Line: 4, Character: 8},
+		},
+	}
+
+	result, err := srv.Hover(context.Background(), params)
+	require.NoError(t, err)
+	require.NotNil(t, result)
+
+	assert.Contains(t, result.Contents.Value, "**Value in $:**")
+	assert.Contains(t, result.Contents.Value, "- 5 $: 5 $ at latest price, 5 $ on 2024-01-15")
+	assert.Contains(t, result.Contents.Value, "- 10 AAPL: 1500 $ at latest price, 1100 $ on 2024-01-15")
+	assert.Contains(t, result.Contents.Value, "**Total:** 1505 $ at latest price, 1105 $ on 2024-01-15")
+}
@@ -52,7 +52,7 @@ func (s *Server) InlineCompletion(_ context.Context, params json.RawMessage) (*I
 	}
 
 	content, ok := s.GetDocument(p.TextDocument.URI)
-	if !ok {
+	if !ok || isRulesDocument(p.TextDocument.URI) {
 		return &InlineCompletionList{Items: []InlineCompletionItem{}}, nil
 	}
 
@@ -1,6 +1,7 @@
 package server
 
 import (
+	"context"
 	"fmt"
 	"os"
 	"path/filepath"
@@ -349,3 +350,82 @@ func TestIntegration_ReferencesDeclarationInIncludedFile(t *testing.T) {
 	require.Len(t, resultExclude, 1) // only usage
 	assert.Contains(t, string(resultExclude[0].URI), "main.journal")
 }
+
+func TestIntegration_IncludeAutoPostingRuleInHover(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	rulesContent := `; tax set-aside
+
+= expenses:food
+    liabilities:tax  *-0.25
+    assets:savings  *0.25`
+
+	mainContent := `include rules.journal
+
+2024-01-15 grocery store
+    expenses:food  $40.00
+    assets:cash`
+
+	rulesPath := filepath.Join(tmpDir, "rules.journal")
+	mainPath := filepath.Join(tmpDir, "main.journal")
+
+	err := os.WriteFile(rulesPath, []byte(rulesContent), 0644)
+	require.NoError(t, err)
+	err = os.WriteFile(mainPath, []byte(mainContent), 0644)
+	require.NoError(t, err)
+
+	ts := newTestServer()
+	uri := protocol.DocumentURI(fmt.Sprintf("file://%s", mainPath))
+
+	_, err = ts.openAndWait(uri, mainContent)
+	require.NoError(t, err)
+
+	hover, err := ts.hover(uri, 3)
+	require.NoError(t, err)
+	require.NotNil(t, hover)
+
+	hoverContent := hover.Contents.Value
+	assert.Contains(t, hoverContent, "**Auto postings:**")
+	assert.Contains(t, hoverContent, "`liabilities:tax` -10 $ — generated by rule at rules.journal:3")
+	assert.Contains(t, hoverContent, "`assets:savings` 10 $ — generated by rule at rules.journal:3")
+}
+
+func TestIntegration_IncludeInheritsAliases(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	mainContent := `account assets:bank
+account equity:opening
+alias bank:old = assets:bank
+
+include child.journal
+`
+	childContent := `2024-01-15 opening
+    bank:old  $100.00
+    equity:opening
+`
+
+	mainPath := filepath.Join(tmpDir, "main.journal")
+	childPath := filepath.Join(tmpDir, "child.journal")
+	require.NoError(t, os.WriteFile(mainPath, []byte(mainContent), 0644))
+	require.NoError(t, os.WriteFile(childPath, []byte(childContent), 0644))
+
+	ts := newTestServer()
+	_, err := ts.Initialize(context.Background(), &protocol.InitializeParams{
+		RootURI: protocol.DocumentURI(fmt.Sprintf("file://%s", tmpDir)),
+	})
+	require.NoError(t, err)
+	require.NoError(t, ts.Initialized(context.Background(), &protocol.InitializedParams{}))
+
+	uri := protocol.DocumentURI(fmt.Sprintf("file://%s", childPath))
+	diagnostics, err := ts.openAndWait(uri, childContent)
+	require.NoError(t, err)
+	for _, d := range diagnostics {
+		assert.NotEqual(t, "UNDECLARED_ACCOUNT", d.Code, "unexpected diagnostic: %s", d.Message)
+	}
+
+	hover, err := ts.hover(uri, 1)
+	require.NoError(t, err)
+	require.NotNil(t, hover)
+	assert.Contains(t, hover.Contents.Value, "assets:bank")
+	assert.Contains(t, hover.Contents.Value, "100")
+}
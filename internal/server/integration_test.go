@@ -220,6 +220,36 @@ invalid line here
 	assert.Contains(t, labels, "expenses:rent")
 }
 
+func TestIntegration_BrokenPostingKeepsTransaction(t *testing.T) {
+	ts := newTestServer()
+	uri := protocol.DocumentURI("file:///test.journal")
+
+	content := `2024-01-15 grocery store
+    expenses:food  $50.00
+    assets:cash  $
+    expenses:misc  $5.00`
+
+	diagnostics, err := ts.openAndWait(uri, content)
+	require.NoError(t, err)
+	require.Len(t, diagnostics, 1, "only the parse error, no balance error")
+	assert.Equal(t, "PARSE_EXPECTED_AMOUNT", diagnostics[0].Code)
+	assert.Equal(t, protocol.Range{
+		Start: protocol.Position{Line: 2, Character: 17},
+		End:   protocol.Position{Line: 2, Character: 18},
+	}, diagnostics[0].Range)
+
+	hover, err := ts.hover(uri, 3)
+	require.NoError(t, err)
+	require.NotNil(t, hover)
+	assert.Contains(t, hover.Contents.Value, "expenses:misc")
+
+	symbols, err := ts.DocumentSymbol(context.Background(), &protocol.DocumentSymbolParams{
+		TextDocument: protocol.TextDocumentIdentifier{URI: uri},
+	})
+	require.NoError(t, err)
+	assert.NotEmpty(t, symbols)
+}
+
 func TestIntegration_MultipleErrorTypes(t *testing.T) {
 	ts := newTestServer()
 	uri := protocol.DocumentURI("file:///test.journal")
@@ -11,7 +11,7 @@ import (
 
 func (s *Server) DocumentLink(ctx context.Context, params *protocol.DocumentLinkParams) ([]protocol.DocumentLink, error) {
 	doc, ok := s.GetDocument(params.TextDocument.URI)
-	if !ok {
+	if !ok || isRulesDocument(params.TextDocument.URI) {
 		return nil, nil
 	}
 
@@ -19,7 +19,7 @@ func (s *Server) DocumentLink(ctx context.Context, params *protocol.DocumentLink
 		return []protocol.DocumentLink{}, nil
 	}
 
-	journal, _ := parser.Parse(doc)
+	journal, _ := parser.ParseWithOptions(doc, s.parseOptions(params.TextDocument.URI))
 	if journal == nil || len(journal.Includes) == 0 {
 		return []protocol.DocumentLink{}, nil
 	}
@@ -6,6 +6,7 @@ import (
 
 	"go.lsp.dev/protocol"
 
+	"github.com/juev/hledger-lsp/internal/analyzer"
 	"github.com/juev/hledger-lsp/internal/ast"
 	"github.com/juev/hledger-lsp/internal/include"
 	"github.com/juev/hledger-lsp/internal/parser"
@@ -13,11 +14,11 @@ import (
 
 func (s *Server) References(ctx context.Context, params *protocol.ReferenceParams) ([]protocol.Location, error) {
 	doc, ok := s.GetDocument(params.TextDocument.URI)
-	if !ok {
+	if !ok || isRulesDocument(params.TextDocument.URI) {
 		return nil, nil
 	}
 
-	journal, _ := parser.Parse(doc)
+	journal, _ := parser.ParseWithOptions(doc, s.parseOptions(params.TextDocument.URI))
 
 	target := findDefinitionTarget(journal, params.Position)
 	if target == nil || target.context == DefContextUnknown {
@@ -45,8 +46,20 @@ func findReferences(target *definitionTarget, resolved *include.ResolvedJournal,
 }
 
 func findAccountReferences(name string, resolved *include.ResolvedJournal, currentPath string, currentJournal *ast.Journal, includeDeclaration bool) []protocol.Location {
-	journals := allJournalsWithPaths(resolved, currentPath, currentJournal)
 	var locations []protocol.Location
+	forEachAccountReference(name, resolved, currentPath, currentJournal, includeDeclaration, func(filePath string, account *ast.Account) {
+		locations = append(locations, protocol.Location{
+			URI:   pathToURI(filePath),
+			Range: *astRangeToProtocol(computeAccountRange(account)),
+		})
+	})
+	return sortAndDedup(locations)
+}
+
+// forEachAccountReference calls fn for every account directive (when
+// includeDeclaration is set) and posting whose effective name is name.
+func forEachAccountReference(name string, resolved *include.ResolvedJournal, currentPath string, currentJournal *ast.Journal, includeDeclaration bool, fn func(filePath string, account *ast.Account)) {
+	journals := allJournalsWithPaths(resolved, currentPath, currentJournal)
 
 	for _, filePath := range sortedJournalPaths(journals) {
 		journal := journals[filePath]
@@ -55,10 +68,7 @@ func findAccountReferences(name string, resolved *include.ResolvedJournal, curre
 			for _, dir := range journal.Directives {
 				if ad, ok := dir.(ast.AccountDirective); ok {
 					if ad.Account.Name == name {
-						locations = append(locations, protocol.Location{
-							URI:   pathToURI(filePath),
-							Range: *astRangeToProtocol(computeAccountRange(&ad.Account)),
-						})
+						fn(filePath, &ad.Account)
 					}
 				}
 			}
@@ -69,16 +79,11 @@ func findAccountReferences(name string, resolved *include.ResolvedJournal, curre
 			for j := range tx.Postings {
 				p := &tx.Postings[j]
 				if p.Account.Name == name {
-					locations = append(locations, protocol.Location{
-						URI:   pathToURI(filePath),
-						Range: *astRangeToProtocol(computeAccountRange(&p.Account)),
-					})
+					fn(filePath, &p.Account)
 				}
 			}
 		}
 	}
-
-	return sortAndDedup(locations)
 }
 
 func findCommodityReferences(symbol string, resolved *include.ResolvedJournal, currentPath string, currentJournal *ast.Journal, includeDeclaration bool) []protocol.Location {
@@ -131,7 +136,7 @@ func findPayeeReferences(payee string, resolved *include.ResolvedJournal, curren
 			if txPayee == payee {
 				locations = append(locations, protocol.Location{
 					URI:   pathToURI(filePath),
-					Range: *astRangeToProtocol(estimatePayeeRange(tx, payee)),
+					Range: *astRangeToProtocol(analyzer.EstimatePayeeRange(tx, payee)),
 				})
 			}
 		}
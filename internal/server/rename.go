@@ -2,19 +2,23 @@ package server
 
 import (
 	"context"
+	"strings"
 
 	"go.lsp.dev/protocol"
 
+	"github.com/juev/hledger-lsp/internal/ast"
+	"github.com/juev/hledger-lsp/internal/include"
+	"github.com/juev/hledger-lsp/internal/lsputil"
 	"github.com/juev/hledger-lsp/internal/parser"
 )
 
 func (s *Server) PrepareRename(ctx context.Context, params *protocol.PrepareRenameParams) (*protocol.Range, error) {
 	doc, ok := s.GetDocument(params.TextDocument.URI)
-	if !ok {
+	if !ok || isRulesDocument(params.TextDocument.URI) {
 		return nil, nil
 	}
 
-	journal, _ := parser.Parse(doc)
+	journal, _ := parser.ParseWithOptions(doc, s.parseOptions(params.TextDocument.URI))
 	target := findDefinitionTarget(journal, params.Position)
 	if target == nil || target.context == DefContextUnknown {
 		return nil, nil
@@ -25,11 +29,11 @@ func (s *Server) PrepareRename(ctx context.Context, params *protocol.PrepareRena
 
 func (s *Server) Rename(ctx context.Context, params *protocol.RenameParams) (*protocol.WorkspaceEdit, error) {
 	doc, ok := s.GetDocument(params.TextDocument.URI)
-	if !ok {
+	if !ok || isRulesDocument(params.TextDocument.URI) {
 		return nil, nil
 	}
 
-	journal, _ := parser.Parse(doc)
+	journal, _ := parser.ParseWithOptions(doc, s.parseOptions(params.TextDocument.URI))
 	target := findDefinitionTarget(journal, params.Position)
 	if target == nil || target.context == DefContextUnknown {
 		return nil, nil
@@ -38,6 +42,10 @@ func (s *Server) Rename(ctx context.Context, params *protocol.RenameParams) (*pr
 	resolved := s.getWorkspaceResolved(params.TextDocument.URI)
 	currentPath := uriToPath(params.TextDocument.URI)
 
+	if target.context == DefContextAccount {
+		return renameAccount(target.name, params.NewName, resolved, currentPath, journal), nil
+	}
+
 	locations := findReferences(target, resolved, currentPath, journal, true)
 	if len(locations) == 0 {
 		return nil, nil
@@ -55,3 +63,117 @@ func (s *Server) Rename(ctx context.Context, params *protocol.RenameParams) (*pr
 		Changes: changes,
 	}, nil
 }
+
+// renameAccount renames an account by its effective name. Each edit writes
+// the new name the way the reference is written, so references under an
+// `apply account` prefix keep omitting it and references written through
+// a plain alias keep their aliased text.
+func renameAccount(name, newName string, resolved *include.ResolvedJournal, currentPath string, journal *ast.Journal) *protocol.WorkspaceEdit {
+	var locations []protocol.Location
+	newTexts := make(map[protocol.Location]string)
+	aliases := plainAliases(resolved, currentPath, journal)
+
+	forEachAccountReference(name, resolved, currentPath, journal, true, func(filePath string, account *ast.Account) {
+		loc := protocol.Location{
+			URI:   pathToURI(filePath),
+			Range: *astRangeToProtocol(computeAccountRange(account)),
+		}
+		newText := writtenAccountName(account, newName)
+		if alias, ok := aliasFor(account, aliases); ok {
+			rest := strings.TrimPrefix(account.Written(), alias.dir.Original)
+			switch {
+			case rest == "":
+				// The reference is the alias itself: renaming the
+				// alias target keeps the reference as written.
+				loc, newText = alias.replacementLocation(), newName
+			case strings.HasPrefix(newName, alias.dir.Replacement+":"):
+				newText = alias.dir.Original + strings.TrimPrefix(newName, alias.dir.Replacement)
+			}
+		}
+		if _, seen := newTexts[loc]; !seen {
+			locations = append(locations, loc)
+		}
+		newTexts[loc] = newText
+	})
+
+	locations = sortAndDedup(locations)
+	if len(locations) == 0 {
+		return nil
+	}
+
+	changes := make(map[protocol.DocumentURI][]protocol.TextEdit)
+	for _, loc := range locations {
+		changes[loc.URI] = append(changes[loc.URI], protocol.TextEdit{
+			Range:   loc.Range,
+			NewText: newTexts[loc],
+		})
+	}
+
+	return &protocol.WorkspaceEdit{Changes: changes}
+}
+
+// writtenAccountName returns how newName has to be written in place of
+// account so that it resolves to newName. The `apply account` prefix in
+// effect for account is dropped when newName still starts with it.
+func writtenAccountName(account *ast.Account, newName string) string {
+	written := account.Written()
+	if written == account.Name || !strings.HasSuffix(account.Name, ":"+written) {
+		return newName
+	}
+
+	prefix := strings.TrimSuffix(account.Name, written)
+	if rest, ok := strings.CutPrefix(newName, prefix); ok && rest != "" {
+		return rest
+	}
+	return newName
+}
+
+// pathAlias is a plain alias directive with the file it is written in.
+type pathAlias struct {
+	path string
+	dir  ast.AliasDirective
+}
+
+// replacementLocation returns the location of the replacement account
+// name, which ends the directive.
+func (a pathAlias) replacementLocation() protocol.Location {
+	end := a.dir.Range.End
+	start := ast.Position{
+		Line:   end.Line,
+		Column: end.Column - lsputil.UTF16Len(a.dir.Replacement),
+		Offset: end.Offset - len(a.dir.Replacement),
+	}
+	return protocol.Location{
+		URI:   pathToURI(a.path),
+		Range: *astRangeToProtocol(ast.Range{Start: start, End: end}),
+	}
+}
+
+func plainAliases(resolved *include.ResolvedJournal, currentPath string, journal *ast.Journal) []pathAlias {
+	var aliases []pathAlias
+	journals := allJournalsWithPaths(resolved, currentPath, journal)
+	for _, path := range sortedJournalPaths(journals) {
+		for _, dir := range journals[path].Directives {
+			if alias, ok := dir.(ast.AliasDirective); ok && !alias.IsRegex {
+				aliases = append(aliases, pathAlias{path: path, dir: alias})
+			}
+		}
+	}
+	return aliases
+}
+
+// aliasFor returns the plain alias that turns the written name of account
+// into its effective name, if any.
+func aliasFor(account *ast.Account, aliases []pathAlias) (pathAlias, bool) {
+	written := account.Written()
+	for _, alias := range aliases {
+		rest, ok := strings.CutPrefix(written, alias.dir.Original)
+		if !ok || (rest != "" && !strings.HasPrefix(rest, ":")) {
+			continue
+		}
+		if account.Name == alias.dir.Replacement+rest {
+			return alias, true
+		}
+	}
+	return pathAlias{}, false
+}
@@ -7,6 +7,8 @@ import (
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	"go.lsp.dev/protocol"
+
+	"github.com/juev/hledger-lsp/internal/ast"
 )
 
 func TestPrepareRename_Account(t *testing.T) {
@@ -202,3 +204,128 @@ func TestRename_IncludesDeclaration(t *testing.T) {
 	edits := changes[uri]
 	assert.Len(t, edits, 2)
 }
+
+func TestRename_AccountUnderApplyAccount(t *testing.T) {
+	srv := NewServer()
+	content := `2024-01-10 outside
+    business:expenses:food  $10
+    assets:cash
+
+apply account business
+2024-01-15 inside
+    expenses:food  $50
+    assets:cash
+end apply account`
+
+	uri := protocol.DocumentURI("file:///test.journal")
+	srv.documents.Store(uri, content)
+
+	params := &protocol.RenameParams{
+		TextDocumentPositionParams: protocol.TextDocumentPositionParams{
+			TextDocument: protocol.TextDocumentIdentifier{URI: uri},
+			Position:     protocol.Position{Line: 6, Character: 8},
+		},
+		NewName: "business:expenses:groceries",
+	}
+
+	result, err := srv.Rename(context.Background(), params)
+	require.NoError(t, err)
+	require.NotNil(t, result)
+
+	edits := result.Changes[uri]
+	require.Len(t, edits, 2)
+	assert.Equal(t, uint32(1), edits[0].Range.Start.Line)
+	assert.Equal(t, "business:expenses:groceries", edits[0].NewText)
+	assert.Equal(t, uint32(6), edits[1].Range.Start.Line)
+	assert.Equal(t, "expenses:groceries", edits[1].NewText)
+}
+
+func TestRename_AccountThroughAlias(t *testing.T) {
+	srv := NewServer()
+	content := `alias checking:old = assets:bank:checking
+
+2024-01-10 direct
+    assets:bank:checking  $10
+    income:salary
+
+2024-01-15 aliased
+    checking:old  $5
+    expenses:food
+
+2024-01-20 aliased child
+    checking:old:savings  $5
+    expenses:food`
+
+	uri := protocol.DocumentURI("file:///test.journal")
+	srv.documents.Store(uri, content)
+
+	params := &protocol.RenameParams{
+		TextDocumentPositionParams: protocol.TextDocumentPositionParams{
+			TextDocument: protocol.TextDocumentIdentifier{URI: uri},
+			Position:     protocol.Position{Line: 3, Character: 6},
+		},
+		NewName: "assets:bank:current",
+	}
+
+	result, err := srv.Rename(context.Background(), params)
+	require.NoError(t, err)
+	require.NotNil(t, result)
+
+	edits := result.Changes[uri]
+	require.Len(t, edits, 2)
+	assert.Equal(t, uint32(0), edits[0].Range.Start.Line)
+	assert.Equal(t, uint32(21), edits[0].Range.Start.Character)
+	assert.Equal(t, uint32(41), edits[0].Range.End.Character)
+	assert.Equal(t, "assets:bank:current", edits[0].NewText)
+	assert.Equal(t, uint32(3), edits[1].Range.Start.Line)
+	assert.Equal(t, "assets:bank:current", edits[1].NewText)
+}
+
+func TestRename_AccountUnderAlias(t *testing.T) {
+	srv := NewServer()
+	content := `alias bank = assets:bank
+
+2024-01-15 aliased
+    bank:checking  $5
+    expenses:food`
+
+	uri := protocol.DocumentURI("file:///test.journal")
+	srv.documents.Store(uri, content)
+
+	params := &protocol.RenameParams{
+		TextDocumentPositionParams: protocol.TextDocumentPositionParams{
+			TextDocument: protocol.TextDocumentIdentifier{URI: uri},
+			Position:     protocol.Position{Line: 3, Character: 6},
+		},
+		NewName: "assets:bank:current",
+	}
+
+	result, err := srv.Rename(context.Background(), params)
+	require.NoError(t, err)
+	require.NotNil(t, result)
+
+	edits := result.Changes[uri]
+	require.Len(t, edits, 1)
+	assert.Equal(t, uint32(3), edits[0].Range.Start.Line)
+	assert.Equal(t, "bank:current", edits[0].NewText)
+}
+
+func TestWrittenAccountName(t *testing.T) {
+	tests := []struct {
+		name    string
+		account ast.Account
+		newName string
+		want    string
+	}{
+		{"plain", ast.Account{Name: "expenses:food", RawName: "expenses:food"}, "expenses:meals", "expenses:meals"},
+		{"under prefix", ast.Account{Name: "biz:expenses:food", RawName: "expenses:food"}, "biz:expenses:meals", "expenses:meals"},
+		{"moved out of prefix", ast.Account{Name: "biz:expenses:food", RawName: "expenses:food"}, "personal:food", "personal:food"},
+		{"unmapped alias", ast.Account{Name: "assets:bank", RawName: "bank:old"}, "assets:checking", "assets:checking"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, writtenAccountName(&tt.account, tt.newName))
+		})
+	}
+}
@@ -0,0 +1,314 @@
+package server
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"go.lsp.dev/protocol"
+
+	"github.com/juev/hledger-lsp/internal/analyzer"
+	"github.com/juev/hledger-lsp/internal/ast"
+	"github.com/juev/hledger-lsp/internal/lsputil"
+	"github.com/juev/hledger-lsp/internal/parser"
+	"github.com/juev/hledger-lsp/internal/rules"
+)
+
+// isRulesDocument reports whether a document is an hledger CSV rules file.
+// Rules files are not journals; the server has a separate language mode for
+// them.
+func isRulesDocument(docURI protocol.DocumentURI) bool {
+	return strings.EqualFold(filepath.Ext(uriToPath(docURI)), ".rules")
+}
+
+// rulesDiagnostics reports unknown directives, and references to fields the
+// `fields` directive does not define.
+func rulesDiagnostics(content string) []protocol.Diagnostic {
+	f, errs := rules.Parse(content)
+
+	diagnostics := make([]protocol.Diagnostic, 0, len(errs))
+	for _, err := range errs {
+		diagnostics = append(diagnostics, protocol.Diagnostic{
+			Range:    *astRangeToProtocol(err.Range),
+			Severity: protocol.DiagnosticSeverityError,
+			Source:   "hledger-lsp",
+			Message:  err.Message,
+		})
+	}
+	for _, ref := range f.UndefinedReferences() {
+		diagnostics = append(diagnostics, protocol.Diagnostic{
+			Range:    *astRangeToProtocol(ref.Range),
+			Severity: protocol.DiagnosticSeverityWarning,
+			Source:   "hledger-lsp",
+			Message:  "field not defined by the fields directive: " + ref.Name,
+			Code:     "UNDEFINED_FIELD",
+		})
+	}
+	return diagnostics
+}
+
+// rulesCompletion completes a rules file: directive and field names at the
+// start of a line, CSV field names after `%` and in the `fields` directive,
+// and accounts in `accountN` assignments.
+func (s *Server) rulesCompletion(docURI protocol.DocumentURI, content string, pos protocol.Position) *protocol.CompletionList {
+	empty := &protocol.CompletionList{Items: []protocol.CompletionItem{}}
+
+	lines := strings.Split(content, "\n")
+	if int(pos.Line) >= len(lines) {
+		return empty
+	}
+	line := lines[pos.Line]
+	byteCol := min(lsputil.UTF16OffsetToByteOffset(line, int(pos.Character)), len(line))
+	before := line[:byteCol]
+
+	f, _ := rules.Parse(content)
+	settings := s.getSettings()
+
+	var items []protocol.CompletionItem
+	var counts map[string]int
+	start := byteCol
+
+	lineStart := len(before) - len(strings.TrimLeft(before, " \t"))
+	name, value, hasValue := strings.Cut(before[lineStart:], " ")
+
+	switch {
+	case strings.LastIndexByte(before, '%') > strings.LastIndexAny(before, " \t,"):
+		start = strings.LastIndexByte(before, '%') + 1
+		names := f.FieldNames()
+		if len(names) == 0 {
+			names = s.csvFieldNames(docURI, f)
+		}
+		items = fieldCompletionItems(names, "CSV field")
+
+	case !hasValue:
+		start = lineStart
+		for _, d := range rules.Directives {
+			items = append(items, protocol.CompletionItem{Label: d, Kind: protocol.CompletionItemKindKeyword, Detail: "Directive"})
+		}
+		for _, field := range rules.AssignableFields {
+			items = append(items, protocol.CompletionItem{Label: field, Kind: protocol.CompletionItemKindField, Detail: "hledger field"})
+		}
+
+	case name == "fields" && lineStart == 0:
+		start = byteCol - len(strings.TrimLeft(value[strings.LastIndexByte(value, ',')+1:], " \t"))
+		listed := make(map[string]bool)
+		for _, field := range f.Fields {
+			listed[field.Name] = true
+		}
+		var names []string
+		for _, n := range s.csvFieldNames(docURI, f) {
+			if !listed[n] {
+				names = append(names, n)
+			}
+		}
+		items = fieldCompletionItems(names, "CSV header")
+
+	case (rules.Statement{Name: name}).IsAccountAssignment():
+		start = byteCol - len(strings.TrimLeft(value, " \t"))
+		accounts := analyzer.NewAccountIndex()
+		if resolved := s.getWorkspaceResolved(docURI); resolved != nil {
+			result := s.analyzer.AnalyzeResolved(resolved)
+			accounts, counts = result.Accounts, result.AccountCounts
+		}
+		for _, acc := range getAccountsForPrefix(accounts, extractAccountPrefix(content, pos)) {
+			items = append(items, protocol.CompletionItem{
+				Label:  acc,
+				Kind:   protocol.CompletionItemKindVariable,
+				Detail: formatDetailWithCount("Account", acc, counts, settings.Completion.ShowCounts),
+			})
+		}
+
+	default:
+		return empty
+	}
+
+	editRange := protocol.Range{
+		Start: protocol.Position{Line: pos.Line, Character: uint32(lsputil.ByteOffsetToUTF16(line, start))},
+		End:   pos,
+	}
+	for i := range items {
+		items[i].TextEdit = &protocol.TextEdit{Range: editRange, NewText: items[i].Label}
+	}
+
+	query := line[start:byteCol]
+	scored := filterAndScoreFuzzyMatch(items, query, settings.Completion.FuzzyMatching)
+	items = rankCompletionItemsByScore(scored, counts, query)
+	if settings.Completion.MaxResults > 0 && len(items) > settings.Completion.MaxResults {
+		items = items[:settings.Completion.MaxResults]
+	}
+
+	return &protocol.CompletionList{IsIncomplete: true, Items: items}
+}
+
+// csvFieldNames returns field names made from the header of the CSV file
+// the rules file converts, or nil when the file cannot be read.
+func (s *Server) csvFieldNames(docURI protocol.DocumentURI, f *rules.File) []string {
+	csvPath := f.CSVPath(uriToPath(docURI))
+	header, err := rules.ReadHeader(csvPath, f.Separator(csvPath))
+	if err != nil {
+		return nil
+	}
+
+	var names []string
+	for _, cell := range header {
+		if name := rules.FieldNameForHeader(cell); name != "" {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+func fieldCompletionItems(names []string, detail string) []protocol.CompletionItem {
+	items := make([]protocol.CompletionItem, 0, len(names))
+	for _, name := range names {
+		items = append(items, protocol.CompletionItem{Label: name, Kind: protocol.CompletionItemKindField, Detail: detail})
+	}
+	return items
+}
+
+// tokenizeRulesForSemantics highlights directive and field names, matchers,
+// `%FIELD` references and the accounts of `accountN` assignments.
+func tokenizeRulesForSemantics(content string) []semanticToken {
+	f, _ := rules.Parse(content)
+
+	var tokens []semanticToken
+	add := func(rng ast.Range, tokenType, modifiers uint32) {
+		if rng.End.Line != rng.Start.Line || rng.End.Column <= rng.Start.Column {
+			return
+		}
+		tokens = append(tokens, semanticToken{
+			line:      uint32(rng.Start.Line - 1),
+			col:       uint32(rng.Start.Column - 1),
+			length:    uint32(rng.End.Column - rng.Start.Column),
+			tokenType: tokenType,
+			modifiers: modifiers,
+		})
+	}
+	statement := func(st rules.Statement) {
+		add(st.NameRange, TokenTypeDirective, 0)
+		if st.IsAccountAssignment() && !strings.Contains(st.Value, "%") {
+			add(st.ValueRange, TokenTypeAccount, 0)
+		}
+	}
+
+	for _, st := range f.Statements {
+		statement(st)
+	}
+	for _, field := range f.Fields {
+		add(field.Range, TokenTypeTag, 1<<ModifierDeclaration)
+	}
+	for _, block := range f.Blocks {
+		add(block.KeywordRange, TokenTypeDirective, 0)
+		for _, m := range block.Matchers {
+			add(m.OperatorRange, TokenTypeOperator, 0)
+			add(m.PatternRange, TokenTypeString, 0)
+		}
+		for _, st := range block.Assignments {
+			statement(st)
+		}
+	}
+	for _, ref := range f.References {
+		add(ref.Range, TokenTypeTag, 0)
+	}
+	for _, c := range f.Comments {
+		add(c, TokenTypeComment, 0)
+	}
+
+	sort.Slice(tokens, func(i, j int) bool {
+		if tokens[i].line != tokens[j].line {
+			return tokens[i].line < tokens[j].line
+		}
+		return tokens[i].col < tokens[j].col
+	})
+	return tokens
+}
+
+// rulesFoldingRanges folds each `if` block of a rules file.
+func rulesFoldingRanges(content string) []protocol.FoldingRange {
+	f, _ := rules.Parse(content)
+
+	var ranges []protocol.FoldingRange
+	for _, block := range f.Blocks {
+		if block.Range.End.Line > block.Range.Start.Line {
+			ranges = append(ranges, protocol.FoldingRange{
+				StartLine: uint32(block.Range.Start.Line - 1),
+				EndLine:   uint32(block.Range.End.Line - 1),
+				Kind:      protocol.RegionFoldingRange,
+			})
+		}
+	}
+	return ranges
+}
+
+// importPreview is the result of the hledger.previewImport command: the
+// transactions a rules file makes from its CSV file. Journal holds the new
+// ones, those the workspace does not already have, as journal text.
+type importPreview struct {
+	Journal      string                     `json:"journal"`
+	Transactions []importPreviewTransaction `json:"transactions"`
+	Errors       []string                   `json:"errors,omitempty"`
+}
+
+type importPreviewTransaction struct {
+	Record int    `json:"record"`
+	Text   string `json:"text"`
+	New    bool   `json:"new"`
+}
+
+// previewImport runs the rules file given as the command argument against
+// its CSV file.
+func (s *Server) previewImport(args []any) (*importPreview, error) {
+	if len(args) < 1 {
+		return nil, fmt.Errorf("missing rules file argument")
+	}
+	arg, ok := args[0].(string)
+	if !ok {
+		return nil, fmt.Errorf("invalid rules file argument type")
+	}
+
+	docURI := protocol.DocumentURI(arg)
+	path := uriToPath(docURI)
+	if path == "" {
+		return nil, fmt.Errorf("invalid rules file URI: %s", arg)
+	}
+	content, ok := s.GetDocument(docURI)
+	if !ok {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		content = string(data)
+	}
+
+	f, _ := rules.Parse(content)
+	csvPath := f.CSVPath(path)
+	records, err := rules.ReadRecords(csvPath, f.Separator(csvPath))
+	if err != nil {
+		return nil, err
+	}
+	entries, errs := f.Convert(records)
+
+	preview := &importPreview{Transactions: make([]importPreviewTransaction, 0, len(entries))}
+	var newEntries []string
+	for _, entry := range entries {
+		isNew := true
+		if journal, _ := parser.Parse(entry.Text); s.workspace != nil && len(journal.Transactions) > 0 {
+			isNew = len(s.workspace.MatchingTransactions(journal.Transactions[0])) == 0
+		}
+		if isNew {
+			newEntries = append(newEntries, entry.Text)
+		}
+		preview.Transactions = append(preview.Transactions, importPreviewTransaction{
+			Record: entry.Record,
+			Text:   entry.Text,
+			New:    isNew,
+		})
+	}
+	preview.Journal = strings.Join(newEntries, "\n")
+	for _, err := range errs {
+		preview.Errors = append(preview.Errors, err.Error())
+	}
+	return preview, nil
+}
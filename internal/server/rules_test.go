@@ -0,0 +1,242 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.lsp.dev/protocol"
+)
+
+func rulesCompletionLabels(t *testing.T, srv *Server, uri protocol.DocumentURI, content string, pos protocol.Position) []string {
+	t.Helper()
+	srv.documents.Store(uri, content)
+
+	result, err := srv.Completion(context.Background(), &protocol.CompletionParams{
+		TextDocumentPositionParams: protocol.TextDocumentPositionParams{
+			TextDocument: protocol.TextDocumentIdentifier{URI: uri},
+			Position:     pos,
+		},
+	})
+	require.NoError(t, err)
+
+	var labels []string
+	for _, item := range result.Items {
+		labels = append(labels, item.Label)
+	}
+	return labels
+}
+
+func TestRulesCompletion_Directives(t *testing.T) {
+	srv := NewServer()
+	uri := protocol.DocumentURI("file:///bank.csv.rules")
+
+	labels := rulesCompletionLabels(t, srv, uri, "skip 1\namo", protocol.Position{Line: 1, Character: 3})
+	assert.Contains(t, labels, "amount")
+	assert.Contains(t, labels, "amount-in")
+	assert.NotContains(t, labels, "skip")
+}
+
+func TestRulesCompletion_FieldsFromCSVHeader(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "bank.csv"), []byte("Date,Description,Amount\n2024-01-15,Shop,-5\n"), 0o644))
+	rulesPath := filepath.Join(dir, "bank.csv.rules")
+	uri := protocol.DocumentURI("file://" + rulesPath)
+	srv := NewServer()
+
+	labels := rulesCompletionLabels(t, srv, uri, "fields date, ", protocol.Position{Line: 0, Character: 13})
+	assert.Equal(t, []string{"description", "amount"}, labels)
+
+	labels = rulesCompletionLabels(t, srv, uri, "description %des", protocol.Position{Line: 0, Character: 16})
+	assert.Equal(t, []string{"description"}, labels)
+}
+
+func TestRulesCompletion_ReferencesUseFieldsDirective(t *testing.T) {
+	srv := NewServer()
+	uri := protocol.DocumentURI("file:///missing.csv.rules")
+
+	labels := rulesCompletionLabels(t, srv, uri, "fields date, payee, amount\ndescription %", protocol.Position{Line: 1, Character: 13})
+	assert.ElementsMatch(t, []string{"date", "payee", "amount"}, labels)
+}
+
+func TestRulesCompletion_Accounts(t *testing.T) {
+	dir := t.TempDir()
+	journal := "2024-01-15 Shop\n    expenses:food  $5\n    assets:bank\n"
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "main.journal"), []byte(journal), 0o644))
+	rulesPath := filepath.Join(dir, "bank.csv.rules")
+
+	srv := NewServer()
+	srv.SetClient(&mockClient{})
+	_, err := srv.Initialize(context.Background(), &protocol.InitializeParams{
+		RootURI: protocol.DocumentURI("file://" + dir),
+	})
+	require.NoError(t, err)
+	require.NoError(t, srv.workspace.Initialize())
+
+	uri := protocol.DocumentURI("file://" + rulesPath)
+	labels := rulesCompletionLabels(t, srv, uri, "if shop\n    account2 exp", protocol.Position{Line: 1, Character: 16})
+	assert.Equal(t, []string{"expenses:food"}, labels)
+}
+
+func TestRulesDiagnostics(t *testing.T) {
+	diagnostics := rulesDiagnostics("fields date, amount\ndescription %payee\nacount1 assets:bank\n")
+	require.Len(t, diagnostics, 2)
+
+	assert.Equal(t, "unknown rules directive: acount1", diagnostics[0].Message)
+	assert.Equal(t, protocol.DiagnosticSeverityError, diagnostics[0].Severity)
+	assert.Equal(t, uint32(2), diagnostics[0].Range.Start.Line)
+
+	assert.Equal(t, "UNDEFINED_FIELD", diagnostics[1].Code)
+	assert.Equal(t, protocol.Range{
+		Start: protocol.Position{Line: 1, Character: 12},
+		End:   protocol.Position{Line: 1, Character: 18},
+	}, diagnostics[1].Range)
+}
+
+func TestSemanticTokens_Rules(t *testing.T) {
+	srv := NewServer()
+	content := "fields date, amount\nif %date 2024\n    account2 expenses:food"
+	uri := protocol.DocumentURI("file:///bank.csv.rules")
+
+	tokens := srv.semanticTokens(uri, content)
+
+	want := []semanticToken{
+		{line: 0, col: 0, length: 6, tokenType: TokenTypeDirective},
+		{line: 0, col: 7, length: 4, tokenType: TokenTypeTag, modifiers: 1 << ModifierDeclaration},
+		{line: 0, col: 13, length: 6, tokenType: TokenTypeTag, modifiers: 1 << ModifierDeclaration},
+		{line: 1, col: 0, length: 2, tokenType: TokenTypeDirective},
+		{line: 1, col: 3, length: 5, tokenType: TokenTypeTag},
+		{line: 1, col: 9, length: 4, tokenType: TokenTypeString},
+		{line: 2, col: 4, length: 8, tokenType: TokenTypeDirective},
+		{line: 2, col: 13, length: 13, tokenType: TokenTypeAccount},
+	}
+	assert.Equal(t, want, tokens)
+}
+
+func TestFoldingRanges_Rules(t *testing.T) {
+	srv := NewServer()
+	content := "skip 1\n\nif groceries\n& %amount -\n    account2 expenses:food\n\nif coffee\n    account2 expenses:coffee\n"
+	uri := protocol.DocumentURI("file:///bank.csv.rules")
+	srv.documents.Store(uri, content)
+
+	ranges, err := srv.FoldingRanges(context.Background(), &protocol.FoldingRangeParams{
+		TextDocumentPositionParams: protocol.TextDocumentPositionParams{
+			TextDocument: protocol.TextDocumentIdentifier{URI: uri},
+		},
+	})
+	require.NoError(t, err)
+
+	assert.Equal(t, []protocol.FoldingRange{
+		{StartLine: 2, EndLine: 4, Kind: protocol.RegionFoldingRange},
+		{StartLine: 6, EndLine: 7, Kind: protocol.RegionFoldingRange},
+	}, ranges)
+}
+
+func TestJournalRequests_SkipRules(t *testing.T) {
+	srv := NewServer()
+	settings := srv.getSettings()
+	settings.Features.InlineCompletion = true
+	srv.setSettings(settings)
+	content := "include common.rules\n2024-01-15 grocer\n    expenses:food  $5\n    assets:bank\n"
+	uri := protocol.DocumentURI("file:///bank.csv.rules")
+	srv.documents.Store(uri, content)
+	pos := protocol.TextDocumentPositionParams{
+		TextDocument: protocol.TextDocumentIdentifier{URI: uri},
+		Position:     protocol.Position{Line: 2, Character: 6},
+	}
+
+	links, err := srv.DocumentLink(context.Background(), &protocol.DocumentLinkParams{
+		TextDocument: protocol.TextDocumentIdentifier{URI: uri},
+	})
+	require.NoError(t, err)
+	assert.Empty(t, links)
+
+	rng, err := srv.PrepareRename(context.Background(), &protocol.PrepareRenameParams{TextDocumentPositionParams: pos})
+	require.NoError(t, err)
+	assert.Nil(t, rng)
+
+	edit, err := srv.Rename(context.Background(), &protocol.RenameParams{TextDocumentPositionParams: pos, NewName: "expenses:groceries"})
+	require.NoError(t, err)
+	assert.Nil(t, edit)
+
+	params, err := json.Marshal(InlineCompletionParams{
+		TextDocument: pos.TextDocument,
+		Position:     protocol.Position{Line: 1, Character: 17},
+	})
+	require.NoError(t, err)
+	inline, err := srv.InlineCompletion(context.Background(), params)
+	require.NoError(t, err)
+	assert.Empty(t, inline.Items)
+}
+
+func TestExecuteCommand_PreviewImport(t *testing.T) {
+	dir := t.TempDir()
+	journal := "2024-01-15 Grocer\n    assets:bank    $-12.50\n    expenses:food  $12.50\n"
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "main.journal"), []byte(journal), 0o644))
+	csv := "Date,Description,Amount\n2024-01-15,Grocer,-12.50\n2024-01-16,Bakery,-3\n2024-01-17,Cafe,x\n"
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "bank.csv"), []byte(csv), 0o644))
+	rulesContent := "skip 1\nfields date, description, amount\naccount1 assets:bank\ncurrency $\n\nif grocer\n    account2 expenses:food"
+	rulesPath := filepath.Join(dir, "bank.csv.rules")
+	require.NoError(t, os.WriteFile(rulesPath, []byte(rulesContent), 0o644))
+
+	srv := NewServer()
+	srv.SetClient(&mockClient{})
+	_, err := srv.Initialize(context.Background(), &protocol.InitializeParams{
+		RootURI: protocol.DocumentURI("file://" + dir),
+	})
+	require.NoError(t, err)
+	require.NoError(t, srv.workspace.Initialize())
+
+	result, err := srv.ExecuteCommand(context.Background(), &protocol.ExecuteCommandParams{
+		Command:   "hledger.previewImport",
+		Arguments: []any{"file://" + rulesPath},
+	})
+	require.NoError(t, err)
+
+	preview, ok := result.(*importPreview)
+	require.True(t, ok)
+	require.Len(t, preview.Transactions, 2)
+	assert.False(t, preview.Transactions[0].New)
+	assert.Equal(t, 2, preview.Transactions[0].Record)
+	assert.True(t, preview.Transactions[1].New)
+	assert.Equal(t, "2024-01-16 Bakery\n    assets:bank       $-3\n    expenses:unknown  $3\n", preview.Journal)
+	assert.Equal(t, []string{`record 4: cannot parse amount "x"`}, preview.Errors)
+
+	_, err = srv.ExecuteCommand(context.Background(), &protocol.ExecuteCommandParams{Command: "hledger.previewImport"})
+	assert.EqualError(t, err, "missing rules file argument")
+}
+
+func TestExecuteCommand_PreviewImportMatchesElidedAmounts(t *testing.T) {
+	dir := t.TempDir()
+	journal := "2024-01-15 Grocer\n    expenses:food  $12.5\n    assets:bank\n"
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "main.journal"), []byte(journal), 0o644))
+	csv := "Date,Description,Amount\n2024-01-15,Grocer,-12.50\n2024-01-16,Grocer,-12.50\n"
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "bank.csv"), []byte(csv), 0o644))
+	rulesContent := "skip 1\nfields date, description, amount\naccount1 assets:bank\ncurrency $\n\nif grocer\n    account2 expenses:food"
+	rulesPath := filepath.Join(dir, "bank.csv.rules")
+	require.NoError(t, os.WriteFile(rulesPath, []byte(rulesContent), 0o644))
+
+	srv := NewServer()
+	srv.SetClient(&mockClient{})
+	_, err := srv.Initialize(context.Background(), &protocol.InitializeParams{
+		RootURI: protocol.DocumentURI("file://" + dir),
+	})
+	require.NoError(t, err)
+	require.NoError(t, srv.workspace.Initialize())
+
+	result, err := srv.ExecuteCommand(context.Background(), &protocol.ExecuteCommandParams{
+		Command:   "hledger.previewImport",
+		Arguments: []any{"file://" + rulesPath},
+	})
+	require.NoError(t, err)
+
+	preview, ok := result.(*importPreview)
+	require.True(t, ok)
+	require.Len(t, preview.Transactions, 2)
+	assert.False(t, preview.Transactions[0].New, "the journal copy leaves one amount to be inferred")
+	assert.True(t, preview.Transactions[1].New)
+}
@@ -2,6 +2,7 @@ package server
 
 import (
 	"context"
+	"sort"
 	"strconv"
 	"strings"
 	"sync"
@@ -9,6 +10,7 @@ import (
 
 	"go.lsp.dev/protocol"
 
+	"github.com/juev/hledger-lsp/internal/ast"
 	"github.com/juev/hledger-lsp/internal/lsputil"
 	"github.com/juev/hledger-lsp/internal/parser"
 )
@@ -163,7 +165,7 @@ func (s *Server) SemanticTokensFull(ctx context.Context, params *protocol.Semant
 		return &protocol.SemanticTokens{Data: []uint32{}}, nil
 	}
 
-	tokens := tokenizeForSemantics(doc)
+	tokens := s.semanticTokens(params.TextDocument.URI, doc)
 	data := encodeTokens(tokens)
 	resultID := tokenCache.set(params.TextDocument.URI, tokens, data)
 
@@ -183,7 +185,7 @@ func (s *Server) SemanticTokensRange(ctx context.Context, params *protocol.Seman
 		return &protocol.SemanticTokens{Data: []uint32{}}, nil
 	}
 
-	allTokens := tokenizeForSemantics(doc)
+	allTokens := s.semanticTokens(params.TextDocument.URI, doc)
 	filteredTokens := filterTokensByRange(allTokens, params.Range)
 	data := encodeTokens(filteredTokens)
 
@@ -202,7 +204,7 @@ func (s *Server) SemanticTokensFullDelta(ctx context.Context, params *protocol.S
 		return &protocol.SemanticTokens{Data: []uint32{}}, nil
 	}
 
-	tokens := tokenizeForSemantics(doc)
+	tokens := s.semanticTokens(params.TextDocument.URI, doc)
 	newData := encodeTokens(tokens)
 
 	cached, ok := tokenCache.get(params.TextDocument.URI)
@@ -264,6 +266,18 @@ type semanticToken struct {
 	modifiers uint32
 }
 
+// semanticTokens tokenizes a document in the format it is read in.
+func (s *Server) semanticTokens(docURI protocol.DocumentURI, content string) []semanticToken {
+	if isRulesDocument(docURI) {
+		return tokenizeRulesForSemantics(content)
+	}
+	opts := s.parseOptions(docURI)
+	if opts.Format == parser.FormatTimedot {
+		return tokenizeTimedotForSemantics(content, opts)
+	}
+	return tokenizeForSemantics(content)
+}
+
 func tokenizeForSemantics(content string) []semanticToken {
 	lexer := parser.NewLexer(content)
 	var tokens []semanticToken
@@ -279,12 +293,20 @@ func tokenizeForSemantics(content string) []semanticToken {
 			break
 		}
 
+		if tok.Type == parser.TokenCommentBlock {
+			tokens = append(tokens, commentBlockTokens(tok)...)
+			currentLine = tok.End.Line
+			inDirective = false
+			directiveType = ""
+			continue
+		}
+
 		if tok.Pos.Line != currentLine {
 			currentLine = tok.Pos.Line
 			if tok.Type == parser.TokenDirective {
 				inDirective = true
 				directiveType = tok.Value
-			} else if tok.Type == parser.TokenDate {
+			} else if tok.Type == parser.TokenDate || tok.Type == parser.TokenTilde {
 				inDirective = false
 				directiveType = ""
 				isPayee = true
@@ -337,6 +359,79 @@ func tokenizeForSemantics(content string) []semanticToken {
 	return tokens
 }
 
+// tokenizeTimedotForSemantics builds tokens from a parsed timedot file: the
+// dates of its day lines, and the account and quantity (dots or a number) of
+// each entry.
+func tokenizeTimedotForSemantics(content string, opts parser.Options) []semanticToken {
+	journal, _ := parser.ParseWithOptions(content, opts)
+
+	var tokens []semanticToken
+	add := func(rng ast.Range, tokenType uint32) {
+		if rng.Start.Line == 0 || rng.End.Column <= rng.Start.Column {
+			return
+		}
+		tokens = append(tokens, semanticToken{
+			line:      uint32(rng.Start.Line - 1),
+			col:       uint32(rng.Start.Column - 1),
+			length:    uint32(rng.End.Column - rng.Start.Column),
+			tokenType: tokenType,
+		})
+	}
+
+	dateLine := 0
+	for _, tx := range journal.Transactions {
+		if tx.Date.Range.Start.Line != dateLine {
+			dateLine = tx.Date.Range.Start.Line
+			add(tx.Date.Range, TokenTypeDate)
+		}
+		for _, p := range tx.Postings {
+			add(p.Account.Range, TokenTypeAccount)
+			if p.Amount != nil {
+				add(p.Amount.Range, TokenTypeAmount)
+			}
+		}
+	}
+	for _, c := range journal.Comments {
+		add(c.Range, TokenTypeComment)
+	}
+
+	sort.Slice(tokens, func(i, j int) bool {
+		if tokens[i].line != tokens[j].line {
+			return tokens[i].line < tokens[j].line
+		}
+		return tokens[i].col < tokens[j].col
+	})
+	return tokens
+}
+
+// commentBlockTokens splits a comment block into one token per line, since
+// semantic tokens may not span lines. The opening and closing lines are
+// directives, everything between them is comment.
+func commentBlockTokens(tok parser.Token) []semanticToken {
+	var tokens []semanticToken
+	lines := strings.Split(tok.Value, "\n")
+	for i, line := range lines {
+		trimmed := strings.TrimLeft(line, " \t")
+		text := strings.TrimRight(trimmed, " \t\r")
+		if text == "" {
+			continue
+		}
+
+		tokenType := uint32(TokenTypeComment)
+		if i == 0 || (i == len(lines)-1 && text == "end comment") {
+			tokenType = TokenTypeDirective
+		}
+
+		tokens = append(tokens, semanticToken{
+			line:      uint32(tok.Pos.Line - 1 + i),
+			col:       uint32(lsputil.UTF16Len(line[:len(line)-len(trimmed)])),
+			length:    uint32(lsputil.UTF16Len(text)),
+			tokenType: tokenType,
+		})
+	}
+	return tokens
+}
+
 func extractTagTokensFromComment(tok parser.Token) []semanticToken {
 	commentText := tok.Value
 	if !strings.Contains(commentText, ":") {
@@ -428,7 +523,7 @@ func isValidTagName(name string) bool {
 
 func mapTokenType(t parser.TokenType) (uint32, bool) {
 	switch t {
-	case parser.TokenDate:
+	case parser.TokenDate, parser.TokenPeriod:
 		return TokenTypeDate, true
 	case parser.TokenAccount:
 		return TokenTypeAccount, true
@@ -438,9 +533,9 @@ func mapTokenType(t parser.TokenType) (uint32, bool) {
 		return TokenTypeCommodity, true
 	case parser.TokenComment:
 		return TokenTypeComment, true
-	case parser.TokenAt, parser.TokenAtAt, parser.TokenEquals, parser.TokenDoubleEquals, parser.TokenPipe:
+	case parser.TokenAt, parser.TokenAtAt, parser.TokenEquals, parser.TokenDoubleEquals, parser.TokenPipe, parser.TokenTilde:
 		return TokenTypeOperator, true
-	case parser.TokenText:
+	case parser.TokenText, parser.TokenQuery:
 		return TokenTypeString, true
 	case parser.TokenCode:
 		return TokenTypeCode, true
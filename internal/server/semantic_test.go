@@ -511,3 +511,56 @@ func TestSemanticTokens_TagNameAndValueSeparate(t *testing.T) {
 		})
 	}
 }
+
+func TestSemanticTokens_CommentBlock(t *testing.T) {
+	content := `comment
+2024-01-15 parked
+  expenses:food  $50
+end comment
+2024-01-16 real`
+
+	tokens := tokenizeForSemantics(content)
+
+	byLine := make(map[uint32][]semanticToken)
+	for _, tok := range tokens {
+		byLine[tok.line] = append(byLine[tok.line], tok)
+	}
+
+	require.Len(t, byLine[0], 1)
+	assert.Equal(t, uint32(TokenTypeDirective), byLine[0][0].tokenType)
+	assert.Equal(t, uint32(7), byLine[0][0].length)
+
+	require.Len(t, byLine[1], 1)
+	assert.Equal(t, uint32(TokenTypeComment), byLine[1][0].tokenType)
+	assert.Equal(t, uint32(17), byLine[1][0].length)
+
+	require.Len(t, byLine[2], 1)
+	assert.Equal(t, uint32(TokenTypeComment), byLine[2][0].tokenType)
+	assert.Equal(t, uint32(2), byLine[2][0].col)
+
+	require.Len(t, byLine[3], 1)
+	assert.Equal(t, uint32(TokenTypeDirective), byLine[3][0].tokenType)
+
+	require.NotEmpty(t, byLine[4])
+	assert.Equal(t, uint32(TokenTypeDate), byLine[4][0].tokenType)
+}
+
+func TestSemanticTokens_Timedot(t *testing.T) {
+	srv := NewServer()
+	content := "# log\n2024-01-15\nfos:hledger  .... ..  ; note\nfos:haskell  1.5h"
+	uri := protocol.DocumentURI("file:///time.timedot")
+	srv.documents.Store(uri, content)
+
+	tokens := srv.semanticTokens(uri, content)
+
+	want := []semanticToken{
+		{line: 0, col: 0, length: 5, tokenType: TokenTypeComment},
+		{line: 1, col: 0, length: 10, tokenType: TokenTypeDate},
+		{line: 2, col: 0, length: 11, tokenType: TokenTypeAccount},
+		{line: 2, col: 13, length: 7, tokenType: TokenTypeAmount},
+		{line: 2, col: 22, length: 6, tokenType: TokenTypeComment},
+		{line: 3, col: 0, length: 11, tokenType: TokenTypeAccount},
+		{line: 3, col: 13, length: 4, tokenType: TokenTypeAmount},
+	}
+	assert.Equal(t, want, tokens)
+}
@@ -2,8 +2,10 @@ package server
 
 import (
 	"context"
+	"fmt"
 	"os"
 	"path/filepath"
+	"regexp"
 	"strings"
 	"sync"
 
@@ -11,6 +13,7 @@ import (
 	"go.lsp.dev/uri"
 
 	"github.com/juev/hledger-lsp/internal/analyzer"
+	"github.com/juev/hledger-lsp/internal/ast"
 	"github.com/juev/hledger-lsp/internal/cli"
 	"github.com/juev/hledger-lsp/internal/formatter"
 	"github.com/juev/hledger-lsp/internal/include"
@@ -124,10 +127,11 @@ func (s *Server) Initialize(ctx context.Context, params *protocol.InitializePara
 		caps.CodeActionProvider = &protocol.CodeActionOptions{
 			CodeActionKinds: []protocol.CodeActionKind{
 				"source.hledger",
+				protocol.QuickFix,
 			},
 		}
 		caps.ExecuteCommandProvider = &protocol.ExecuteCommandOptions{
-			Commands: []string{"hledger.run"},
+			Commands: []string{"hledger.run", "hledger.previewImport"},
 		}
 	}
 
@@ -239,6 +243,14 @@ func (s *Server) publishDiagnostics(ctx context.Context, docURI protocol.Documen
 		return
 	}
 
+	if isRulesDocument(docURI) {
+		_ = s.client.PublishDiagnostics(ctx, &protocol.PublishDiagnosticsParams{
+			URI:         docURI,
+			Diagnostics: rulesDiagnostics(content),
+		})
+		return
+	}
+
 	path := uriToPath(docURI)
 	if path == "" {
 		return
@@ -246,7 +258,7 @@ func (s *Server) publishDiagnostics(ctx context.Context, docURI protocol.Documen
 	resolved, loadErrors := s.loader.LoadFromContent(path, content)
 	s.resolved.Store(docURI, resolved)
 
-	diagnostics := s.analyze(content)
+	diagnostics := s.analyze(docURI, content, s.parseOptions(docURI), s.otherTransactions(docURI))
 
 	for _, err := range loadErrors {
 		severity := protocol.DiagnosticSeverityError
@@ -276,25 +288,17 @@ func (s *Server) publishDiagnostics(ctx context.Context, docURI protocol.Documen
 	})
 }
 
-func (s *Server) analyze(content string) []protocol.Diagnostic {
-	journal, parseErrs := parser.Parse(content)
+func (s *Server) analyze(docURI protocol.DocumentURI, content string, opts parser.Options, others []ast.Transaction) []protocol.Diagnostic {
+	journal, parseErrs := parser.ParseWithOptions(content, opts)
 
 	diagnostics := make([]protocol.Diagnostic, 0, len(parseErrs))
 	for _, err := range parseErrs {
 		diagnostics = append(diagnostics, protocol.Diagnostic{
-			Range: protocol.Range{
-				Start: protocol.Position{
-					Line:      uint32(err.Pos.Line - 1),
-					Character: uint32(err.Pos.Column - 1),
-				},
-				End: protocol.Position{
-					Line:      uint32(err.Pos.Line - 1),
-					Character: uint32(err.Pos.Column - 1),
-				},
-			},
+			Range:    *astRangeToProtocol(err.Range()),
 			Severity: protocol.DiagnosticSeverityError,
 			Source:   "hledger-lsp",
 			Message:  err.Message,
+			Code:     err.Code,
 		})
 	}
 
@@ -302,49 +306,216 @@ func (s *Server) analyze(content string) []protocol.Diagnostic {
 	if s.workspace != nil {
 		external.Accounts = s.workspace.GetDeclaredAccounts()
 		external.Commodities = s.workspace.GetDeclaredCommodities()
+		external.Payees = s.workspace.GetDeclaredPayees()
+		external.Tags = s.workspace.GetDeclaredTags()
+	}
+	external.Transactions = others
+	if others != nil {
+		external.ParseOrder = s.transactionsInParseOrder(docURI, journal)
 	}
 
+	settings := s.getSettings()
+	external.CheckPayees = settings.Diagnostics.UndeclaredPayees
+	external.CheckTags = settings.Diagnostics.UndeclaredTags
+
 	var result *analyzer.AnalysisResult
-	if external.Accounts != nil || external.Commodities != nil {
+	if external.Accounts != nil || external.Commodities != nil || external.Payees != nil || external.Tags != nil || external.Transactions != nil || external.CheckPayees || external.CheckTags {
 		result = s.analyzer.AnalyzeWithExternalDeclarations(journal, external)
 	} else {
 		result = s.analyzer.Analyze(journal)
 	}
 
-	settings := s.getSettings()
 	for _, diag := range result.Diagnostics {
 		if !s.shouldIncludeDiagnostic(diag.Code, settings.Diagnostics) {
 			continue
 		}
-		diagnostics = append(diagnostics, protocol.Diagnostic{
-			Range: protocol.Range{
-				Start: protocol.Position{
-					Line:      uint32(diag.Range.Start.Line - 1),
-					Character: uint32(diag.Range.Start.Column - 1),
-				},
-				End: protocol.Position{
-					Line:      uint32(diag.Range.End.Line - 1),
-					Character: uint32(diag.Range.End.Column - 1),
+		diagnostics = append(diagnostics, toProtocolDiagnostic(diag))
+	}
+
+	if settings.Diagnostics.OrderedDates {
+		for _, diag := range analyzer.CheckOrderedDates(journal.Transactions, settings.Diagnostics.Date2) {
+			diagnostics = append(diagnostics, toProtocolDiagnostic(diag))
+		}
+	}
+
+	if settings.Diagnostics.DuplicateTransactions && opts.Format == parser.FormatJournal {
+		diagnostics = append(diagnostics, s.duplicateDiagnostics(docURI, journal, settings.Diagnostics)...)
+	}
+
+	if settings.Diagnostics.UniqueLeafNames || settings.Diagnostics.SimilarAccounts {
+		accounts, counts := s.accountUsage(journal)
+		var diags []analyzer.Diagnostic
+		if settings.Diagnostics.UniqueLeafNames {
+			diags = append(diags, analyzer.CheckUniqueLeafNames(journal, accounts)...)
+		}
+		if settings.Diagnostics.SimilarAccounts {
+			diags = append(diags, analyzer.CheckSimilarAccounts(journal, counts)...)
+		}
+		for _, diag := range diags {
+			diagnostics = append(diagnostics, toProtocolDiagnostic(diag))
+		}
+	}
+
+	if settings.Diagnostics.RecentAssertions || settings.Diagnostics.PositiveIncome || settings.Diagnostics.MissingAssertions {
+		types := s.accountTypes(docURI, journal)
+		var diags []analyzer.Diagnostic
+		if settings.Diagnostics.RecentAssertions {
+			opts := recentAssertionsOptions(settings.Diagnostics)
+			opts.AccountTypes = types
+			diags = append(diags, analyzer.CheckRecentAssertions(journal.Transactions, others, opts)...)
+		}
+		if settings.Diagnostics.PositiveIncome {
+			diags = append(diags, analyzer.CheckPositiveIncome(journal.Transactions, types)...)
+		}
+		if settings.Diagnostics.MissingAssertions {
+			diags = append(diags, analyzer.CheckMissingAssertions(journal.Transactions, others, types)...)
+		}
+		for _, diag := range diags {
+			diagnostics = append(diagnostics, toProtocolDiagnostic(diag))
+		}
+	}
+
+	return diagnostics
+}
+
+// duplicateDiagnostics reports the transactions of the document that look
+// like a copy of another transaction of the document or of the workspace,
+// with the other copies as related information.
+func (s *Server) duplicateDiagnostics(docURI protocol.DocumentURI, journal *ast.Journal, settings diagnosticsSettings) []protocol.Diagnostic {
+	path := uriToPath(docURI)
+	opts := workspace.DuplicateOptions{
+		Days:              settings.DuplicateDays,
+		IgnoreDescription: settings.DuplicateIgnoreDescription,
+	}
+	var matches [][]workspace.TransactionEntry
+	if s.workspace != nil {
+		matches = s.workspace.PossibleDuplicates(path, journal, opts)
+	} else {
+		matches = workspace.NewWorkspaceIndex().PossibleDuplicates(path, journal, opts)
+	}
+
+	var diagnostics []protocol.Diagnostic
+	for i, entries := range matches {
+		if len(entries) == 0 {
+			continue
+		}
+		related := make([]protocol.DiagnosticRelatedInformation, 0, len(entries))
+		for _, entry := range entries {
+			related = append(related, protocol.DiagnosticRelatedInformation{
+				Location: protocol.Location{
+					URI:   entryURI(docURI, path, entry.FilePath),
+					Range: *astRangeToProtocol(entry.Range),
 				},
-			},
-			Severity: toProtocolSeverity(diag.Severity),
-			Source:   "hledger-lsp",
-			Message:  diag.Message,
-			Code:     diag.Code,
+				Message: "other copy",
+			})
+		}
+		message := fmt.Sprintf("possible duplicate of %d other transactions", len(entries))
+		if len(entries) == 1 {
+			message = fmt.Sprintf("possible duplicate of the transaction on line %d", entries[0].Range.Start.Line)
+			if entries[0].FilePath != path {
+				message += " of " + filepath.Base(entries[0].FilePath)
+			}
+		}
+		diag := toProtocolDiagnostic(analyzer.Diagnostic{
+			Range:    journal.Transactions[i].Date.Range,
+			Severity: analyzer.SeverityWarning,
+			Code:     "POSSIBLE_DUPLICATE",
+			Message:  message,
 		})
+		diag.RelatedInformation = related
+		diagnostics = append(diagnostics, diag)
 	}
-
 	return diagnostics
 }
 
+// accountUsage returns the accounts and posting counts that the account
+// name checks compare a document against: those of the workspace, or of
+// the document itself when there is no workspace index.
+func (s *Server) accountUsage(journal *ast.Journal) (*analyzer.AccountIndex, map[string]int) {
+	if s.workspace != nil {
+		if accounts, counts := s.workspace.AccountUsage(); accounts != nil {
+			return accounts, counts
+		}
+	}
+	return analyzer.CollectAccounts(journal), analyzer.CollectAccountCounts(journal)
+}
+
+// accountTypes resolves account types from the account directives of the
+// document and of the journal it belongs to.
+func (s *Server) accountTypes(docURI protocol.DocumentURI, journal *ast.Journal) *analyzer.AccountTypes {
+	var directives []ast.Directive
+	if resolved := s.getWorkspaceResolved(docURI); resolved != nil {
+		directives = resolved.AllDirectives()
+	}
+	if journal != nil {
+		directives = append(directives, journal.Directives...)
+	}
+	return analyzer.CollectAccountTypes(directives)
+}
+
+// recentAssertionsOptions reads the accounts covered by the recent
+// assertions check from settings. An invalid account pattern, which
+// setSettings warns about, matches no account, and unknown account types
+// are skipped.
+func recentAssertionsOptions(settings diagnosticsSettings) analyzer.RecentAssertionsOptions {
+	opts := analyzer.RecentAssertionsOptions{Days: settings.RecentAssertionsDays}
+	if settings.RecentAssertionsAccounts != "" {
+		if re, err := regexp.Compile("(?i)" + settings.RecentAssertionsAccounts); err == nil {
+			opts.Accounts = re
+		} else {
+			opts.Accounts = regexp.MustCompile(`$.^`)
+		}
+	}
+	for _, field := range strings.Split(settings.RecentAssertionsAccountTypes, ",") {
+		if typ, ok := analyzer.ParseAccountType(field); ok {
+			opts.Types = append(opts.Types, typ)
+		}
+	}
+	return opts
+}
+
+// entryURI returns the URI of the file an index entry comes from, keeping
+// the document's own URI for entries of the document.
+func entryURI(docURI protocol.DocumentURI, docPath, entryPath string) protocol.DocumentURI {
+	if entryPath == docPath {
+		return docURI
+	}
+	return pathToURI(entryPath)
+}
+
+func toProtocolDiagnostic(diag analyzer.Diagnostic) protocol.Diagnostic {
+	return protocol.Diagnostic{
+		Range: protocol.Range{
+			Start: protocol.Position{
+				Line:      uint32(diag.Range.Start.Line - 1),
+				Character: uint32(diag.Range.Start.Column - 1),
+			},
+			End: protocol.Position{
+				Line:      uint32(diag.Range.End.Line - 1),
+				Character: uint32(diag.Range.End.Column - 1),
+			},
+		},
+		Severity: toProtocolSeverity(diag.Severity),
+		Source:   "hledger-lsp",
+		Message:  diag.Message,
+		Code:     diag.Code,
+	}
+}
+
 func (s *Server) shouldIncludeDiagnostic(code string, settings diagnosticsSettings) bool {
 	switch code {
 	case "UNDECLARED_ACCOUNT":
 		return settings.UndeclaredAccounts
 	case "UNDECLARED_COMMODITY":
 		return settings.UndeclaredCommodities
+	case "UNDECLARED_PAYEE":
+		return settings.UndeclaredPayees
+	case "UNDECLARED_TAG":
+		return settings.UndeclaredTags
 	case "UNBALANCED", "MULTIPLE_INFERRED":
 		return settings.UnbalancedTransactions
+	case "BALANCE_ASSERTION_FAILED":
+		return settings.BalanceAssertions
 	default:
 		return true
 	}
@@ -380,7 +551,12 @@ func (s *Server) Format(ctx context.Context, params *protocol.DocumentFormatting
 		return nil, nil
 	}
 
-	journal, _ := parser.Parse(doc)
+	opts := s.parseOptions(params.TextDocument.URI)
+	if opts.Format != parser.FormatJournal || isRulesDocument(params.TextDocument.URI) {
+		return nil, nil
+	}
+
+	journal, _ := parser.ParseWithOptions(doc, opts)
 
 	var commodityFormats map[string]formatter.NumberFormat
 	if s.workspace != nil {
@@ -388,13 +564,13 @@ func (s *Server) Format(ctx context.Context, params *protocol.DocumentFormatting
 	}
 
 	settings := s.getSettings()
-	opts := formatter.Options{
+	formatOpts := formatter.Options{
 		IndentSize:         settings.Formatting.IndentSize,
 		AlignAmounts:       settings.Formatting.AlignAmounts,
 		MinAlignmentColumn: settings.Formatting.MinAlignmentColumn,
 	}
 
-	return formatter.FormatDocumentWithOptions(journal, doc, commodityFormats, opts), nil
+	return formatter.FormatDocumentWithOptions(journal, doc, commodityFormats, formatOpts), nil
 }
 
 func applyChange(content string, r protocol.Range, text string) string {
@@ -448,6 +624,72 @@ func (s *Server) getWorkspaceResolved(docURI protocol.DocumentURI) *include.Reso
 	return s.GetResolved(docURI)
 }
 
+// otherTransactions returns the transactions of the resolved journal other
+// than those of the document itself, which come from its live content. It
+// returns nil for a document that is not part of the resolved journal.
+func (s *Server) otherTransactions(docURI protocol.DocumentURI) []ast.Transaction {
+	resolved := s.getWorkspaceResolved(docURI)
+	if resolved == nil {
+		return nil
+	}
+	path := uriToPath(docURI)
+	primaryPath := s.primaryJournalPath(docURI)
+	if _, ok := resolved.Files[path]; !ok && primaryPath != path {
+		return nil
+	}
+
+	var result []ast.Transaction
+	if resolved.Primary != nil && primaryPath != path {
+		result = append(result, resolved.Primary.Transactions...)
+	}
+	for _, p := range resolved.FileOrder {
+		if j, ok := resolved.Files[p]; ok && p != path {
+			result = append(result, j.Transactions...)
+		}
+	}
+	return result
+}
+
+// transactionsInParseOrder returns the transactions of the resolved journal
+// in the order hledger reads them, with those of the document taken from
+// journal, its live content. It returns nil for a document that is not part
+// of the resolved journal.
+func (s *Server) transactionsInParseOrder(docURI protocol.DocumentURI, journal *ast.Journal) []ast.Transaction {
+	resolved := s.getWorkspaceResolved(docURI)
+	if resolved == nil {
+		return nil
+	}
+	path := uriToPath(docURI)
+	if _, ok := resolved.Files[path]; !ok && resolved.PrimaryPath != path {
+		return nil
+	}
+	return resolved.TransactionsInParseOrder(path, journal)
+}
+
+// parseOptions returns the parser state a document inherits from the
+// workspace journals that include it. Documents outside the workspace are
+// read in the format their extension implies.
+func (s *Server) parseOptions(docURI protocol.DocumentURI) parser.Options {
+	path := uriToPath(docURI)
+	if s.workspace != nil {
+		if resolved := s.workspace.GetResolved(); resolved != nil {
+			if opts, ok := resolved.Inherited[path]; ok {
+				return opts
+			}
+		}
+	}
+	return parser.Options{Format: parser.FormatForPath(path)}
+}
+
+// primaryJournalPath returns the path of the journal that
+// getWorkspaceResolved uses as its primary file.
+func (s *Server) primaryJournalPath(docURI protocol.DocumentURI) string {
+	if s.workspace != nil && s.workspace.GetResolved() != nil {
+		return s.workspace.RootJournalPath()
+	}
+	return uriToPath(docURI)
+}
+
 func (s *Server) RootURI() string {
 	return s.rootURI
 }
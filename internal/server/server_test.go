@@ -13,11 +13,13 @@ import (
 	"go.lsp.dev/protocol"
 
 	"github.com/juev/hledger-lsp/internal/analyzer"
+	"github.com/juev/hledger-lsp/internal/parser"
 )
 
 type mockClient struct {
 	mu          sync.Mutex
 	diagnostics []protocol.PublishDiagnosticsParams
+	messages    []protocol.ShowMessageParams
 }
 
 func (m *mockClient) Progress(ctx context.Context, params *protocol.ProgressParams) error {
@@ -40,6 +42,9 @@ func (m *mockClient) PublishDiagnostics(ctx context.Context, params *protocol.Pu
 }
 
 func (m *mockClient) ShowMessage(ctx context.Context, params *protocol.ShowMessageParams) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.messages = append(m.messages, *params)
 	return nil
 }
 
@@ -812,6 +817,240 @@ include transactions.journal`
 	assert.False(t, foundRUBWarning, "RUB should NOT trigger warning (declared in workspace)")
 }
 
+func TestServer_Diagnostics_BalanceAssertionAfterInclude(t *testing.T) {
+	t.Setenv("LEDGER_FILE", "")
+	t.Setenv("HLEDGER_JOURNAL", "")
+
+	tmpDir := t.TempDir()
+	mainPath := tmpDir + "/main.journal"
+	mainContent := `include opening.journal
+
+2024-01-01 check
+    assets:checking  $0 = $1000
+    equity:opening
+`
+	require.NoError(t, os.WriteFile(mainPath, []byte(mainContent), 0644))
+	require.NoError(t, os.WriteFile(tmpDir+"/opening.journal", []byte(`2024-01-01 opening balances
+    assets:checking  $1000
+    equity:opening
+`), 0644))
+
+	srv := NewServer()
+	srv.SetClient(&mockClient{})
+	_, err := srv.Initialize(context.Background(), &protocol.InitializeParams{
+		RootURI: protocol.DocumentURI("file://" + tmpDir),
+	})
+	require.NoError(t, err)
+	require.NoError(t, srv.workspace.Initialize())
+
+	uri := protocol.DocumentURI("file://" + mainPath)
+	for _, d := range srv.analyze(uri, mainContent, parser.Options{}, srv.otherTransactions(uri)) {
+		assert.NotEqual(t, "BALANCE_ASSERTION_FAILED", d.Code, d.Message)
+	}
+
+	failing := strings.Replace(mainContent, "= $1000", "= $900", 1)
+	var messages []string
+	for _, d := range srv.analyze(uri, failing, parser.Options{}, srv.otherTransactions(uri)) {
+		if d.Code == "BALANCE_ASSERTION_FAILED" {
+			messages = append(messages, d.Message)
+		}
+	}
+	assert.Equal(t, []string{"balance assertion failed for assets:checking: expected $900, actual $1000, difference $-100"}, messages)
+}
+
+func TestServer_Diagnostics_PossibleDuplicate(t *testing.T) {
+	t.Setenv("LEDGER_FILE", "")
+	t.Setenv("HLEDGER_JOURNAL", "")
+
+	tmpDir := t.TempDir()
+	mainPath := tmpDir + "/main.journal"
+	require.NoError(t, os.WriteFile(mainPath, []byte("include bank.journal\ninclude cash.journal\n"), 0644))
+	bankPath := tmpDir + "/bank.journal"
+	require.NoError(t, os.WriteFile(bankPath, []byte(`2024-01-15 Grocery Store
+    expenses:food  $50
+    assets:checking
+`), 0644))
+	cashPath := tmpDir + "/cash.journal"
+	cashContent := `2024-01-10 Coffee Shop
+    expenses:food  $3
+    assets:cash
+
+2024-01-15 Grocery Store
+    expenses:food  $50
+    assets:checking
+`
+	require.NoError(t, os.WriteFile(cashPath, []byte(cashContent), 0644))
+
+	srv := NewServer()
+	client := &mockClient{}
+	srv.SetClient(client)
+	_, err := srv.Initialize(context.Background(), &protocol.InitializeParams{
+		RootURI: protocol.DocumentURI("file://" + tmpDir),
+	})
+	require.NoError(t, err)
+	require.NoError(t, srv.workspace.Initialize())
+
+	settings := srv.getSettings()
+	settings.Diagnostics.DuplicateTransactions = true
+	srv.setSettings(settings)
+
+	uri := protocol.DocumentURI("file://" + cashPath)
+	var duplicates []protocol.Diagnostic
+	for _, d := range srv.analyze(uri, cashContent, parser.Options{}, nil) {
+		if d.Code == "POSSIBLE_DUPLICATE" {
+			duplicates = append(duplicates, d)
+		}
+	}
+	require.Len(t, duplicates, 1)
+	assert.Equal(t, uint32(4), duplicates[0].Range.Start.Line)
+	assert.Equal(t, protocol.DiagnosticSeverityWarning, duplicates[0].Severity)
+	assert.Equal(t, "possible duplicate of the transaction on line 1 of bank.journal", duplicates[0].Message)
+	require.Len(t, duplicates[0].RelatedInformation, 1)
+	related := duplicates[0].RelatedInformation[0]
+	assert.Equal(t, bankPath, uriToPath(related.Location.URI))
+	assert.Equal(t, uint32(0), related.Location.Range.Start.Line)
+
+	settings.Diagnostics.DuplicateTransactions = false
+	srv.setSettings(settings)
+	for _, d := range srv.analyze(uri, cashContent, parser.Options{}, nil) {
+		assert.NotEqual(t, "POSSIBLE_DUPLICATE", d.Code)
+	}
+}
+
+func TestServer_Diagnostics_AccountNames(t *testing.T) {
+	t.Setenv("LEDGER_FILE", "")
+	t.Setenv("HLEDGER_JOURNAL", "")
+
+	tmpDir := t.TempDir()
+	mainPath := tmpDir + "/main.journal"
+	require.NoError(t, os.WriteFile(mainPath, []byte(`include new.journal
+
+2024-01-01 market
+    expenses:groceries  $10
+    assets:bank:fees
+
+2024-01-02 market
+    expenses:groceries  $20
+    assets:bank:fees
+`), 0644))
+	newPath := tmpDir + "/new.journal"
+	newContent := `2024-01-03 market
+    expenses:grocery  $5
+    expenses:fees
+`
+	require.NoError(t, os.WriteFile(newPath, []byte(newContent), 0644))
+
+	srv := NewServer()
+	srv.SetClient(&mockClient{})
+	_, err := srv.Initialize(context.Background(), &protocol.InitializeParams{
+		RootURI: protocol.DocumentURI("file://" + tmpDir),
+	})
+	require.NoError(t, err)
+	require.NoError(t, srv.workspace.Initialize())
+
+	settings := srv.getSettings()
+	settings.Diagnostics.UniqueLeafNames = true
+	settings.Diagnostics.SimilarAccounts = true
+	srv.setSettings(settings)
+
+	uri := protocol.DocumentURI("file://" + newPath)
+	messages := make(map[string]string)
+	for _, d := range srv.analyze(uri, newContent, parser.Options{}, nil) {
+		if code, _ := d.Code.(string); code == "SIMILAR_ACCOUNT" || code == "NON_UNIQUE_LEAF_NAME" {
+			messages[code] = d.Message
+		}
+	}
+	assert.Equal(t, map[string]string{
+		"SIMILAR_ACCOUNT":      "account expenses:grocery looks like a misspelling of expenses:groceries (2 postings)",
+		"NON_UNIQUE_LEAF_NAME": `account leaf name "fees" is also used by assets:bank:fees`,
+	}, messages)
+
+	settings.Diagnostics.UniqueLeafNames = false
+	settings.Diagnostics.SimilarAccounts = false
+	srv.setSettings(settings)
+	for _, d := range srv.analyze(uri, newContent, parser.Options{}, nil) {
+		assert.NotEqual(t, "SIMILAR_ACCOUNT", d.Code)
+		assert.NotEqual(t, "NON_UNIQUE_LEAF_NAME", d.Code)
+	}
+}
+
+func TestServer_Diagnostics_RecentAssertions(t *testing.T) {
+	srv := NewServer()
+	settings := defaultServerSettings()
+	settings.Diagnostics.RecentAssertions = true
+	srv.setSettings(settings)
+
+	others, errs := parser.Parse(`2024-03-01 count
+    personal:wallet  $0 = $20
+    equity:adjustments
+`)
+	require.Empty(t, errs)
+	content := `account personal  ; type: C
+
+2024-03-12 lunch
+    expenses:food  $12
+    personal:wallet
+`
+	uri := protocol.DocumentURI("file:///test.journal")
+	stale := func() []protocol.Diagnostic {
+		var result []protocol.Diagnostic
+		for _, d := range srv.analyze(uri, content, parser.Options{}, others.Transactions) {
+			if d.Code == "STALE_BALANCE_ASSERTION" {
+				result = append(result, d)
+			}
+		}
+		return result
+	}
+
+	diags := stale()
+	require.Len(t, diags, 1)
+	assert.Equal(t, uint32(4), diags[0].Range.Start.Line)
+	assert.Equal(t, "account personal:wallet has postings 11 days after its latest balance assertion on 2024-03-01", diags[0].Message)
+
+	settings.Diagnostics.RecentAssertionsDays = 14
+	srv.setSettings(settings)
+	assert.Empty(t, stale())
+
+	settings.Diagnostics.RecentAssertionsDays = 7
+	settings.Diagnostics.RecentAssertionsAccountTypes = "Liability"
+	srv.setSettings(settings)
+	assert.Empty(t, stale())
+
+	settings.Diagnostics.RecentAssertionsAccounts = "^personal:wal"
+	srv.setSettings(settings)
+	assert.Len(t, stale(), 1)
+}
+
+func TestServer_Diagnostics_AccountTypeChecks(t *testing.T) {
+	srv := NewServer()
+	content := `account business  ; type: Revenue
+
+2024-01-15 invoice
+    assets:checking  $100
+    business:consulting  $100
+`
+	codes := func() map[string]bool {
+		result := make(map[string]bool)
+		for _, d := range srv.analyze("file:///test.journal", content, parser.Options{}, nil) {
+			if code, _ := d.Code.(string); code != "" {
+				result[code] = true
+			}
+		}
+		return result
+	}
+
+	settings := defaultServerSettings()
+	srv.setSettings(settings)
+	assert.False(t, codes()["POSITIVE_INCOME"])
+	assert.False(t, codes()["MISSING_BALANCE_ASSERTION"])
+
+	settings.Diagnostics.PositiveIncome = true
+	settings.Diagnostics.MissingAssertions = true
+	srv.setSettings(settings)
+	assert.True(t, codes()["POSITIVE_INCOME"])
+	assert.True(t, codes()["MISSING_BALANCE_ASSERTION"])
+}
+
 func TestServer_Format_WithWorkspaceCommodityFormat(t *testing.T) {
 	t.Setenv("LEDGER_FILE", "")
 	t.Setenv("HLEDGER_JOURNAL", "")
@@ -865,6 +1104,53 @@ include transactions.journal`
 	assert.True(t, foundFormatted, "Expected number formatted as 1.000,00 RUB from workspace commodity format, got: %v", edits)
 }
 
+func TestServer_Format_InheritedDecimalMark(t *testing.T) {
+	t.Setenv("LEDGER_FILE", "")
+	t.Setenv("HLEDGER_JOURNAL", "")
+
+	tmpDir := t.TempDir()
+
+	mainPath := tmpDir + "/main.journal"
+	mainContent := `decimal-mark ,
+commodity EUR
+  format 1.000,000 EUR
+
+include transactions.journal`
+	err := os.WriteFile(mainPath, []byte(mainContent), 0644)
+	require.NoError(t, err)
+
+	txPath := tmpDir + "/transactions.journal"
+	txContent := `2024-01-15 test
+    expenses:food  1,234 EUR
+    assets:cash`
+	err = os.WriteFile(txPath, []byte(txContent), 0644)
+	require.NoError(t, err)
+
+	srv := NewServer()
+
+	initParams := &protocol.InitializeParams{
+		RootURI: protocol.DocumentURI("file://" + tmpDir),
+	}
+	_, err = srv.Initialize(context.Background(), initParams)
+	require.NoError(t, err)
+
+	err = srv.workspace.Initialize()
+	require.NoError(t, err)
+
+	uri := protocol.DocumentURI("file://" + txPath)
+	srv.documents.Store(uri, txContent)
+
+	formatParams := &protocol.DocumentFormattingParams{
+		TextDocument: protocol.TextDocumentIdentifier{URI: uri},
+	}
+
+	edits, err := srv.Format(context.Background(), formatParams)
+	require.NoError(t, err)
+	require.NotEmpty(t, edits)
+	assert.Equal(t, "    expenses:food  1,234 EUR", edits[0].NewText,
+		"1,234 reads as 1.234 under the decimal mark inherited from main.journal")
+}
+
 func TestToProtocolSeverity(t *testing.T) {
 	tests := []struct {
 		name     string
@@ -1164,6 +1450,51 @@ func TestServer_DiagnosticsSettings(t *testing.T) {
 		}
 	})
 
+	t.Run("undeclared payees and tags are opt-in", func(t *testing.T) {
+		content := `payee Grocery Store
+tag project
+
+2024-01-15 Coffee Shop  ; client:acme
+    expenses:food  $5
+    assets:cash
+`
+		codes := func(enabled bool) map[string]bool {
+			client := &mockClient{}
+			srv := NewServer()
+			srv.SetClient(client)
+
+			settings := srv.getSettings()
+			settings.Diagnostics.UndeclaredPayees = enabled
+			settings.Diagnostics.UndeclaredTags = enabled
+			srv.setSettings(settings)
+
+			uri := protocol.DocumentURI("file:///test.journal")
+			err := srv.DidOpen(context.Background(), &protocol.DidOpenTextDocumentParams{
+				TextDocument: protocol.TextDocumentItem{URI: uri, Text: content},
+			})
+			require.NoError(t, err)
+			time.Sleep(100 * time.Millisecond)
+
+			found := make(map[string]bool)
+			for _, pub := range client.getDiagnostics() {
+				for _, d := range pub.Diagnostics {
+					if code, ok := d.Code.(string); ok {
+						found[code] = true
+					}
+				}
+			}
+			return found
+		}
+
+		disabled := codes(false)
+		assert.False(t, disabled["UNDECLARED_PAYEE"])
+		assert.False(t, disabled["UNDECLARED_TAG"])
+
+		enabled := codes(true)
+		assert.True(t, enabled["UNDECLARED_PAYEE"])
+		assert.True(t, enabled["UNDECLARED_TAG"])
+	})
+
 	t.Run("unbalanced transactions disabled", func(t *testing.T) {
 		client := &mockClient{}
 		srv := NewServer()
@@ -2,6 +2,8 @@ package server
 
 import (
 	"context"
+	"fmt"
+	"regexp"
 	"strconv"
 	"strings"
 	"time"
@@ -33,7 +35,41 @@ type completionSettings struct {
 type diagnosticsSettings struct {
 	UndeclaredAccounts     bool
 	UndeclaredCommodities  bool
+	UndeclaredPayees       bool
+	UndeclaredTags         bool
 	UnbalancedTransactions bool
+	BalanceAssertions      bool
+	OrderedDates           bool
+	// Date2 makes date checks compare secondary dates, like hledger's
+	// --date2 flag.
+	Date2 bool
+	// DuplicateTransactions reports transactions that look like a copy of
+	// another one. DuplicateDays and DuplicateIgnoreDescription loosen the
+	// match to dates that many days apart and to any payee.
+	DuplicateTransactions      bool
+	DuplicateDays              int
+	DuplicateIgnoreDescription bool
+	// UniqueLeafNames reports accounts sharing their leaf name with another
+	// account, like `hledger check uniqueleafnames`.
+	UniqueLeafNames bool
+	// SimilarAccounts reports accounts that look like a misspelling of a
+	// more used one.
+	SimilarAccounts bool
+	// RecentAssertions reports accounts posted to more than
+	// RecentAssertionsDays days after their latest balance assertion, like
+	// `hledger check recentassertions`. It covers the accounts matching the
+	// RecentAssertionsAccounts regular expression or of one of the
+	// comma-separated RecentAssertionsAccountTypes, like "A" or
+	// "Asset,Liability".
+	RecentAssertions             bool
+	RecentAssertionsDays         int
+	RecentAssertionsAccounts     string
+	RecentAssertionsAccountTypes string
+	// PositiveIncome reports positive amounts posted to revenue accounts.
+	PositiveIncome bool
+	// MissingAssertions reports asset accounts without any balance
+	// assertion.
+	MissingAssertions bool
 }
 
 type formattingSettings struct {
@@ -42,6 +78,13 @@ type formattingSettings struct {
 	MinAlignmentColumn int
 }
 
+type hoverSettings struct {
+	// ValuationCommodity is the commodity account balances are also shown
+	// in, converted with the journal's market prices. Empty turns
+	// valuation off.
+	ValuationCommodity string
+}
+
 type cliSettings struct {
 	Enabled bool
 	Path    string
@@ -53,6 +96,7 @@ type serverSettings struct {
 	Completion  completionSettings
 	Diagnostics diagnosticsSettings
 	Formatting  formattingSettings
+	Hover       hoverSettings
 	CLI         cliSettings
 	Limits      include.Limits
 }
@@ -77,9 +121,12 @@ func defaultServerSettings() serverSettings {
 			ShowCounts:    true,
 		},
 		Diagnostics: diagnosticsSettings{
-			UndeclaredAccounts:     true,
-			UndeclaredCommodities:  true,
-			UnbalancedTransactions: true,
+			UndeclaredAccounts:           true,
+			UndeclaredCommodities:        true,
+			UnbalancedTransactions:       true,
+			BalanceAssertions:            true,
+			RecentAssertionsDays:         7,
+			RecentAssertionsAccountTypes: "A",
 		},
 		Formatting: formattingSettings{
 			IndentSize:   4,
@@ -114,6 +161,12 @@ func normalizeServerSettings(settings serverSettings) serverSettings {
 	if settings.Limits.MaxIncludeDepth <= 0 {
 		settings.Limits.MaxIncludeDepth = defaults.Limits.MaxIncludeDepth
 	}
+	if settings.Diagnostics.DuplicateDays < 0 {
+		settings.Diagnostics.DuplicateDays = 0
+	}
+	if settings.Diagnostics.RecentAssertionsDays < 0 {
+		settings.Diagnostics.RecentAssertionsDays = defaults.Diagnostics.RecentAssertionsDays
+	}
 	return settings
 }
 
@@ -129,6 +182,23 @@ func (s *Server) setSettings(settings serverSettings) {
 	if oldSettings.CLI.Path != settings.CLI.Path || oldSettings.CLI.Timeout != settings.CLI.Timeout {
 		s.reinitCLI(settings.CLI)
 	}
+	if pattern := settings.Diagnostics.RecentAssertionsAccounts; pattern != oldSettings.Diagnostics.RecentAssertionsAccounts {
+		s.warnInvalidPattern("recentAssertionsAccounts", pattern)
+	}
+}
+
+// warnInvalidPattern tells the user that the regular expression of a
+// setting does not compile, since the setting then matches nothing.
+func (s *Server) warnInvalidPattern(name, pattern string) {
+	if s.client == nil || pattern == "" {
+		return
+	}
+	if _, err := regexp.Compile("(?i)" + pattern); err != nil {
+		_ = s.client.ShowMessage(context.Background(), &protocol.ShowMessageParams{
+			Type:    protocol.MessageTypeWarning,
+			Message: fmt.Sprintf("hledger.diagnostics.%s is not a valid regular expression and matches no account: %v", name, err),
+		})
+	}
 }
 
 func (s *Server) getSettings() serverSettings {
@@ -266,9 +336,57 @@ func applySettingsMap(settings serverSettings, raw map[string]interface{}) serve
 		if value, ok := toBool(diagnosticsRaw["undeclaredCommodities"]); ok {
 			settings.Diagnostics.UndeclaredCommodities = value
 		}
+		if value, ok := toBool(diagnosticsRaw["undeclaredPayees"]); ok {
+			settings.Diagnostics.UndeclaredPayees = value
+		}
+		if value, ok := toBool(diagnosticsRaw["undeclaredTags"]); ok {
+			settings.Diagnostics.UndeclaredTags = value
+		}
 		if value, ok := toBool(diagnosticsRaw["unbalancedTransactions"]); ok {
 			settings.Diagnostics.UnbalancedTransactions = value
 		}
+		if value, ok := toBool(diagnosticsRaw["balanceAssertions"]); ok {
+			settings.Diagnostics.BalanceAssertions = value
+		}
+		if value, ok := toBool(diagnosticsRaw["orderedDates"]); ok {
+			settings.Diagnostics.OrderedDates = value
+		}
+		if value, ok := toBool(diagnosticsRaw["date2"]); ok {
+			settings.Diagnostics.Date2 = value
+		}
+		if value, ok := toBool(diagnosticsRaw["duplicateTransactions"]); ok {
+			settings.Diagnostics.DuplicateTransactions = value
+		}
+		if value, ok := toInt(diagnosticsRaw["duplicateDays"]); ok {
+			settings.Diagnostics.DuplicateDays = value
+		}
+		if value, ok := toBool(diagnosticsRaw["duplicateIgnoreDescription"]); ok {
+			settings.Diagnostics.DuplicateIgnoreDescription = value
+		}
+		if value, ok := toBool(diagnosticsRaw["uniqueLeafNames"]); ok {
+			settings.Diagnostics.UniqueLeafNames = value
+		}
+		if value, ok := toBool(diagnosticsRaw["similarAccounts"]); ok {
+			settings.Diagnostics.SimilarAccounts = value
+		}
+		if value, ok := toBool(diagnosticsRaw["recentAssertions"]); ok {
+			settings.Diagnostics.RecentAssertions = value
+		}
+		if value, ok := toInt(diagnosticsRaw["recentAssertionsDays"]); ok {
+			settings.Diagnostics.RecentAssertionsDays = value
+		}
+		if value, ok := toString(diagnosticsRaw["recentAssertionsAccounts"]); ok {
+			settings.Diagnostics.RecentAssertionsAccounts = value
+		}
+		if value, ok := toString(diagnosticsRaw["recentAssertionsAccountTypes"]); ok {
+			settings.Diagnostics.RecentAssertionsAccountTypes = value
+		}
+		if value, ok := toBool(diagnosticsRaw["positiveIncome"]); ok {
+			settings.Diagnostics.PositiveIncome = value
+		}
+		if value, ok := toBool(diagnosticsRaw["missingAssertions"]); ok {
+			settings.Diagnostics.MissingAssertions = value
+		}
 	}
 	if value, ok := toBool(raw["diagnostics.undeclaredAccounts"]); ok {
 		settings.Diagnostics.UndeclaredAccounts = value
@@ -276,9 +394,57 @@ func applySettingsMap(settings serverSettings, raw map[string]interface{}) serve
 	if value, ok := toBool(raw["diagnostics.undeclaredCommodities"]); ok {
 		settings.Diagnostics.UndeclaredCommodities = value
 	}
+	if value, ok := toBool(raw["diagnostics.undeclaredPayees"]); ok {
+		settings.Diagnostics.UndeclaredPayees = value
+	}
+	if value, ok := toBool(raw["diagnostics.undeclaredTags"]); ok {
+		settings.Diagnostics.UndeclaredTags = value
+	}
 	if value, ok := toBool(raw["diagnostics.unbalancedTransactions"]); ok {
 		settings.Diagnostics.UnbalancedTransactions = value
 	}
+	if value, ok := toBool(raw["diagnostics.balanceAssertions"]); ok {
+		settings.Diagnostics.BalanceAssertions = value
+	}
+	if value, ok := toBool(raw["diagnostics.orderedDates"]); ok {
+		settings.Diagnostics.OrderedDates = value
+	}
+	if value, ok := toBool(raw["diagnostics.date2"]); ok {
+		settings.Diagnostics.Date2 = value
+	}
+	if value, ok := toBool(raw["diagnostics.duplicateTransactions"]); ok {
+		settings.Diagnostics.DuplicateTransactions = value
+	}
+	if value, ok := toInt(raw["diagnostics.duplicateDays"]); ok {
+		settings.Diagnostics.DuplicateDays = value
+	}
+	if value, ok := toBool(raw["diagnostics.duplicateIgnoreDescription"]); ok {
+		settings.Diagnostics.DuplicateIgnoreDescription = value
+	}
+	if value, ok := toBool(raw["diagnostics.uniqueLeafNames"]); ok {
+		settings.Diagnostics.UniqueLeafNames = value
+	}
+	if value, ok := toBool(raw["diagnostics.similarAccounts"]); ok {
+		settings.Diagnostics.SimilarAccounts = value
+	}
+	if value, ok := toBool(raw["diagnostics.recentAssertions"]); ok {
+		settings.Diagnostics.RecentAssertions = value
+	}
+	if value, ok := toInt(raw["diagnostics.recentAssertionsDays"]); ok {
+		settings.Diagnostics.RecentAssertionsDays = value
+	}
+	if value, ok := toString(raw["diagnostics.recentAssertionsAccounts"]); ok {
+		settings.Diagnostics.RecentAssertionsAccounts = value
+	}
+	if value, ok := toString(raw["diagnostics.recentAssertionsAccountTypes"]); ok {
+		settings.Diagnostics.RecentAssertionsAccountTypes = value
+	}
+	if value, ok := toBool(raw["diagnostics.positiveIncome"]); ok {
+		settings.Diagnostics.PositiveIncome = value
+	}
+	if value, ok := toBool(raw["diagnostics.missingAssertions"]); ok {
+		settings.Diagnostics.MissingAssertions = value
+	}
 
 	// Formatting
 	if formattingRaw, ok := raw["formatting"].(map[string]interface{}); ok {
@@ -302,6 +468,16 @@ func applySettingsMap(settings serverSettings, raw map[string]interface{}) serve
 		settings.Formatting.MinAlignmentColumn = value
 	}
 
+	// Hover
+	if hoverRaw, ok := raw["hover"].(map[string]interface{}); ok {
+		if value, ok := toString(hoverRaw["valuationCommodity"]); ok {
+			settings.Hover.ValuationCommodity = value
+		}
+	}
+	if value, ok := toString(raw["hover.valuationCommodity"]); ok {
+		settings.Hover.ValuationCommodity = value
+	}
+
 	// CLI
 	if cliRaw, ok := raw["cli"].(map[string]interface{}); ok {
 		if value, ok := toBool(cliRaw["enabled"]); ok {
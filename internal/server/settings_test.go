@@ -1,6 +1,7 @@
 package server
 
 import (
+	"strings"
 	"testing"
 	"time"
 
@@ -56,9 +57,24 @@ func TestDefaultServerSettings(t *testing.T) {
 	if !s.Diagnostics.UndeclaredCommodities {
 		t.Error("Diagnostics.UndeclaredCommodities should default to true")
 	}
+	if s.Diagnostics.UndeclaredPayees {
+		t.Error("Diagnostics.UndeclaredPayees should default to false")
+	}
+	if s.Diagnostics.UndeclaredTags {
+		t.Error("Diagnostics.UndeclaredTags should default to false")
+	}
 	if !s.Diagnostics.UnbalancedTransactions {
 		t.Error("Diagnostics.UnbalancedTransactions should default to true")
 	}
+	if !s.Diagnostics.BalanceAssertions {
+		t.Error("Diagnostics.BalanceAssertions should default to true")
+	}
+	if s.Diagnostics.DuplicateTransactions {
+		t.Error("Diagnostics.DuplicateTransactions should default to false")
+	}
+	if s.Diagnostics.SimilarAccounts {
+		t.Error("Diagnostics.SimilarAccounts should default to false")
+	}
 
 	// Formatting settings
 	if s.Formatting.IndentSize != 4 {
@@ -149,9 +165,25 @@ func TestParseSettingsFromRaw_Diagnostics(t *testing.T) {
 
 	raw := map[string]interface{}{
 		"diagnostics": map[string]interface{}{
-			"undeclaredAccounts":     false,
-			"undeclaredCommodities":  false,
-			"unbalancedTransactions": false,
+			"undeclaredAccounts":           false,
+			"undeclaredCommodities":        false,
+			"undeclaredPayees":             true,
+			"undeclaredTags":               true,
+			"unbalancedTransactions":       false,
+			"balanceAssertions":            false,
+			"orderedDates":                 true,
+			"date2":                        true,
+			"duplicateTransactions":        false,
+			"duplicateDays":                3,
+			"duplicateIgnoreDescription":   true,
+			"uniqueLeafNames":              true,
+			"similarAccounts":              false,
+			"recentAssertions":             true,
+			"recentAssertionsDays":         14,
+			"recentAssertionsAccounts":     "^assets:bank",
+			"recentAssertionsAccountTypes": "A,L",
+			"positiveIncome":               true,
+			"missingAssertions":            true,
 		},
 	}
 
@@ -163,9 +195,57 @@ func TestParseSettingsFromRaw_Diagnostics(t *testing.T) {
 	if result.Diagnostics.UndeclaredCommodities {
 		t.Error("Diagnostics.UndeclaredCommodities should be false")
 	}
+	if !result.Diagnostics.UndeclaredPayees {
+		t.Error("Diagnostics.UndeclaredPayees should be true")
+	}
+	if !result.Diagnostics.UndeclaredTags {
+		t.Error("Diagnostics.UndeclaredTags should be true")
+	}
 	if result.Diagnostics.UnbalancedTransactions {
 		t.Error("Diagnostics.UnbalancedTransactions should be false")
 	}
+	if result.Diagnostics.BalanceAssertions {
+		t.Error("Diagnostics.BalanceAssertions should be false")
+	}
+	if !result.Diagnostics.OrderedDates {
+		t.Error("Diagnostics.OrderedDates should be true")
+	}
+	if !result.Diagnostics.Date2 {
+		t.Error("Diagnostics.Date2 should be true")
+	}
+	if result.Diagnostics.DuplicateTransactions {
+		t.Error("Diagnostics.DuplicateTransactions should be false")
+	}
+	if result.Diagnostics.DuplicateDays != 3 {
+		t.Errorf("Diagnostics.DuplicateDays = %d, want 3", result.Diagnostics.DuplicateDays)
+	}
+	if !result.Diagnostics.DuplicateIgnoreDescription {
+		t.Error("Diagnostics.DuplicateIgnoreDescription should be true")
+	}
+	if !result.Diagnostics.UniqueLeafNames {
+		t.Error("Diagnostics.UniqueLeafNames should be true")
+	}
+	if result.Diagnostics.SimilarAccounts {
+		t.Error("Diagnostics.SimilarAccounts should be false")
+	}
+	if !result.Diagnostics.RecentAssertions {
+		t.Error("Diagnostics.RecentAssertions should be true")
+	}
+	if result.Diagnostics.RecentAssertionsDays != 14 {
+		t.Errorf("Diagnostics.RecentAssertionsDays = %d, want 14", result.Diagnostics.RecentAssertionsDays)
+	}
+	if result.Diagnostics.RecentAssertionsAccounts != "^assets:bank" {
+		t.Errorf("Diagnostics.RecentAssertionsAccounts = %q, want %q", result.Diagnostics.RecentAssertionsAccounts, "^assets:bank")
+	}
+	if result.Diagnostics.RecentAssertionsAccountTypes != "A,L" {
+		t.Errorf("Diagnostics.RecentAssertionsAccountTypes = %q, want %q", result.Diagnostics.RecentAssertionsAccountTypes, "A,L")
+	}
+	if !result.Diagnostics.PositiveIncome {
+		t.Error("Diagnostics.PositiveIncome should be true")
+	}
+	if !result.Diagnostics.MissingAssertions {
+		t.Error("Diagnostics.MissingAssertions should be true")
+	}
 }
 
 func TestParseSettingsFromRaw_Formatting(t *testing.T) {
@@ -216,6 +296,27 @@ func TestParseSettingsFromRaw_CLI(t *testing.T) {
 	}
 }
 
+func TestParseSettingsFromRaw_Hover(t *testing.T) {
+	base := defaultServerSettings()
+	if base.Hover.ValuationCommodity != "" {
+		t.Errorf("default Hover.ValuationCommodity = %q, want empty", base.Hover.ValuationCommodity)
+	}
+
+	result := parseSettingsFromRaw(base, map[string]interface{}{
+		"hover": map[string]interface{}{
+			"valuationCommodity": "EUR",
+		},
+	})
+	if result.Hover.ValuationCommodity != "EUR" {
+		t.Errorf("Hover.ValuationCommodity = %q, want %q", result.Hover.ValuationCommodity, "EUR")
+	}
+
+	result = parseSettingsFromRaw(base, map[string]interface{}{"hover.valuationCommodity": "$"})
+	if result.Hover.ValuationCommodity != "$" {
+		t.Errorf("Hover.ValuationCommodity = %q, want %q", result.Hover.ValuationCommodity, "$")
+	}
+}
+
 func TestParseSettingsFromRaw_FlatKeys(t *testing.T) {
 	base := defaultServerSettings()
 
@@ -311,3 +412,27 @@ func TestServer_SetSettings_UpdatesCLI(t *testing.T) {
 		t.Errorf("CLI.Timeout = %v, want %v", result.CLI.Timeout, 60*time.Second)
 	}
 }
+
+func TestServer_SetSettings_WarnsInvalidAccountPattern(t *testing.T) {
+	client := &mockClient{}
+	srv := NewServer()
+	srv.SetClient(client)
+
+	settings := srv.getSettings()
+	settings.Diagnostics.RecentAssertionsAccounts = "assets:(bank"
+	srv.setSettings(settings)
+	srv.setSettings(settings)
+
+	if len(client.messages) != 1 {
+		t.Fatalf("got %d messages, want 1: %v", len(client.messages), client.messages)
+	}
+	if !strings.Contains(client.messages[0].Message, "recentAssertionsAccounts") {
+		t.Errorf("message %q does not name the setting", client.messages[0].Message)
+	}
+
+	settings.Diagnostics.RecentAssertionsAccounts = "assets:bank"
+	srv.setSettings(settings)
+	if len(client.messages) != 1 {
+		t.Errorf("got %d messages for a valid pattern, want 1", len(client.messages))
+	}
+}
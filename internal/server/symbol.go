@@ -3,6 +3,7 @@ package server
 import (
 	"context"
 	"fmt"
+	"strings"
 
 	"go.lsp.dev/protocol"
 
@@ -15,11 +16,11 @@ func (s *Server) DocumentSymbol(
 	params *protocol.DocumentSymbolParams,
 ) ([]any, error) {
 	doc, ok := s.GetDocument(params.TextDocument.URI)
-	if !ok {
+	if !ok || isRulesDocument(params.TextDocument.URI) {
 		return nil, nil
 	}
 
-	journal, _ := parser.Parse(doc)
+	journal, _ := parser.ParseWithOptions(doc, s.parseOptions(params.TextDocument.URI))
 	if journal == nil {
 		return []any{}, nil
 	}
@@ -30,6 +31,14 @@ func (s *Server) DocumentSymbol(
 		symbols = append(symbols, transactionToSymbol(tx))
 	}
 
+	for _, ptx := range journal.PeriodicTransactions {
+		symbols = append(symbols, periodicTransactionToSymbol(ptx))
+	}
+
+	for _, rule := range journal.AutoPostingRules {
+		symbols = append(symbols, autoPostingRuleToSymbol(rule))
+	}
+
 	for _, dir := range journal.Directives {
 		symbols = append(symbols, directiveToSymbol(dir))
 	}
@@ -38,19 +47,33 @@ func (s *Server) DocumentSymbol(
 		symbols = append(symbols, includeToSymbol(inc))
 	}
 
+	for _, c := range journal.Comments {
+		if c.Block {
+			symbols = append(symbols, commentBlockToSymbol(c))
+		}
+	}
+
 	return symbols, nil
 }
 
 func includeToSymbol(inc ast.Include) protocol.DocumentSymbol {
 	rng := *astRangeToProtocol(inc.Range)
 	return protocol.DocumentSymbol{
-		Name:           "include " + inc.Path,
+		Name:           "include " + includeTarget(inc),
 		Kind:           protocol.SymbolKindModule,
 		Range:          rng,
 		SelectionRange: rng,
 	}
 }
 
+// includeTarget returns the include path as written, with its reader prefix.
+func includeTarget(inc ast.Include) string {
+	if inc.Prefix != "" {
+		return inc.Prefix + ":" + inc.Path
+	}
+	return inc.Path
+}
+
 func transactionToSymbol(tx ast.Transaction) protocol.DocumentSymbol {
 	name := formatTransactionName(tx)
 	rng := *astRangeToProtocol(tx.Range)
@@ -63,6 +86,50 @@ func transactionToSymbol(tx ast.Transaction) protocol.DocumentSymbol {
 	}
 }
 
+func periodicTransactionToSymbol(ptx ast.PeriodicTransaction) protocol.DocumentSymbol {
+	name := "~ " + ptx.Period.Text
+	if ptx.Description != "" {
+		name += " " + ptx.Description
+	}
+	rng := *astRangeToProtocol(ptx.Range)
+
+	return protocol.DocumentSymbol{
+		Name:           name,
+		Kind:           protocol.SymbolKindEvent,
+		Range:          rng,
+		SelectionRange: rng,
+	}
+}
+
+func autoPostingRuleToSymbol(rule ast.AutoPostingRule) protocol.DocumentSymbol {
+	rng := *astRangeToProtocol(rule.Range)
+
+	return protocol.DocumentSymbol{
+		Name:           "= " + rule.Query,
+		Kind:           protocol.SymbolKindOperator,
+		Range:          rng,
+		SelectionRange: rng,
+	}
+}
+
+func commentBlockToSymbol(c ast.Comment) protocol.DocumentSymbol {
+	name := "comment"
+	for _, line := range strings.Split(c.Text, "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			name += " " + line
+			break
+		}
+	}
+	rng := *astRangeToProtocol(c.Range)
+
+	return protocol.DocumentSymbol{
+		Name:           name,
+		Kind:           protocol.SymbolKindString,
+		Range:          rng,
+		SelectionRange: rng,
+	}
+}
+
 func formatTransactionName(tx ast.Transaction) string {
 	date := fmt.Sprintf("%04d-%02d-%02d", tx.Date.Year, tx.Date.Month, tx.Date.Day)
 	if tx.Description != "" {
@@ -89,6 +156,31 @@ func directiveToSymbol(dir ast.Directive) protocol.DocumentSymbol {
 		name = fmt.Sprintf("P %04d-%02d-%02d %s",
 			d.Date.Year, d.Date.Month, d.Date.Day, d.Commodity.Symbol)
 		kind = protocol.SymbolKindConstant
+	case ast.DecimalMarkDirective:
+		name = "decimal-mark " + string(d.Mark)
+		kind = protocol.SymbolKindProperty
+	case ast.PayeeDirective:
+		name = "payee " + d.Name
+		kind = protocol.SymbolKindString
+	case ast.TagDirective:
+		name = "tag " + d.Name
+		kind = protocol.SymbolKindKey
+	case ast.AliasDirective:
+		if d.IsRegex {
+			name = fmt.Sprintf("alias /%s/ = %s", d.Original, d.Replacement)
+		} else {
+			name = fmt.Sprintf("alias %s = %s", d.Original, d.Replacement)
+		}
+		kind = protocol.SymbolKindVariable
+	case ast.EndAliasesDirective:
+		name = "end aliases"
+		kind = protocol.SymbolKindVariable
+	case ast.ApplyAccountDirective:
+		name = "apply account " + d.Account
+		kind = protocol.SymbolKindNamespace
+	case ast.EndApplyAccountDirective:
+		name = "end apply account"
+		kind = protocol.SymbolKindNamespace
 	default:
 		name = "directive"
 		kind = protocol.SymbolKindVariable
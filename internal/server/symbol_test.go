@@ -254,3 +254,73 @@ func TestDocumentSymbol_RangeEndIsSet(t *testing.T) {
 		})
 	}
 }
+
+func TestDocumentSymbol_PeriodicTransaction(t *testing.T) {
+	srv := NewServer()
+	content := `~ monthly  rent
+    expenses:rent  $1000
+    assets:checking`
+
+	srv.documents.Store(protocol.DocumentURI("file:///test.journal"), content)
+
+	params := &protocol.DocumentSymbolParams{
+		TextDocument: protocol.TextDocumentIdentifier{
+			URI: "file:///test.journal",
+		},
+	}
+
+	result, err := srv.DocumentSymbol(context.Background(), params)
+	require.NoError(t, err)
+	require.Len(t, result, 1)
+
+	sym, ok := result[0].(protocol.DocumentSymbol)
+	require.True(t, ok)
+	assert.Equal(t, "~ monthly rent", sym.Name)
+	assert.Equal(t, protocol.SymbolKindEvent, sym.Kind)
+	assert.Equal(t, uint32(0), sym.Range.Start.Line)
+}
+
+func TestDocumentSymbol_CommentBlock(t *testing.T) {
+	srv := NewServer()
+	content := `comment
+
+2024-01-15 parked
+    expenses:food  $50
+end comment`
+
+	uri := protocol.DocumentURI("file:///test.journal")
+	srv.documents.Store(uri, content)
+
+	result, err := srv.DocumentSymbol(context.Background(), &protocol.DocumentSymbolParams{
+		TextDocument: protocol.TextDocumentIdentifier{URI: uri},
+	})
+	require.NoError(t, err)
+	require.Len(t, result, 1)
+
+	sym, ok := result[0].(protocol.DocumentSymbol)
+	require.True(t, ok)
+	assert.Equal(t, "comment 2024-01-15 parked", sym.Name)
+	assert.Equal(t, protocol.SymbolKindString, sym.Kind)
+	assert.Equal(t, uint32(0), sym.Range.Start.Line)
+	assert.Equal(t, uint32(4), sym.Range.End.Line)
+}
+
+func TestDocumentSymbol_Timeclock(t *testing.T) {
+	srv := NewServer()
+	content := `i 2024-01-15 09:00 client:acme  design review
+o 2024-01-15 12:30`
+
+	uri := protocol.DocumentURI("file:///hours.timeclock")
+	srv.documents.Store(uri, content)
+
+	result, err := srv.DocumentSymbol(context.Background(), &protocol.DocumentSymbolParams{
+		TextDocument: protocol.TextDocumentIdentifier{URI: uri},
+	})
+	require.NoError(t, err)
+	require.Len(t, result, 1, "the session reads as a transaction")
+
+	sym, ok := result[0].(protocol.DocumentSymbol)
+	require.True(t, ok)
+	assert.Equal(t, protocol.SymbolKindFunction, sym.Kind)
+	assert.Equal(t, uint32(0), sym.Range.Start.Line)
+}
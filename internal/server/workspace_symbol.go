@@ -6,6 +6,7 @@ import (
 
 	"go.lsp.dev/protocol"
 
+	"github.com/juev/hledger-lsp/internal/analyzer"
 	"github.com/juev/hledger-lsp/internal/ast"
 	"github.com/juev/hledger-lsp/internal/parser"
 )
@@ -19,7 +20,7 @@ func (s *Server) WorkspaceSymbol(ctx context.Context, params *protocol.Workspace
 		uri := key.(protocol.DocumentURI)
 		content := value.(string)
 
-		journal, _ := parser.Parse(content)
+		journal, _ := parser.ParseWithOptions(content, s.parseOptions(uri))
 		if journal == nil {
 			return true
 		}
@@ -73,7 +74,7 @@ func extractSymbols(journal *ast.Journal, uri protocol.DocumentURI, query string
 					Kind: protocol.SymbolKindFunction,
 					Location: protocol.Location{
 						URI:   uri,
-						Range: *astRangeToProtocol(estimatePayeeRange(tx, payee)),
+						Range: *astRangeToProtocol(analyzer.EstimatePayeeRange(tx, payee)),
 					},
 				})
 			}
@@ -6,6 +6,7 @@ import (
 	"testing"
 
 	"github.com/juev/hledger-lsp/internal/include"
+	"github.com/juev/hledger-lsp/internal/parser"
 	"github.com/juev/hledger-lsp/internal/testutil"
 )
 
@@ -18,32 +19,32 @@ var (
 
 func BenchmarkBuildFileIndex_Small(b *testing.B) {
 	for b.Loop() {
-		BuildFileIndexFromContent("test.journal", smallJournal)
+		BuildFileIndexFromContent("test.journal", smallJournal, parser.Options{})
 	}
 }
 
 func BenchmarkBuildFileIndex_Medium(b *testing.B) {
 	for b.Loop() {
-		BuildFileIndexFromContent("test.journal", mediumJournal)
+		BuildFileIndexFromContent("test.journal", mediumJournal, parser.Options{})
 	}
 }
 
 func BenchmarkBuildFileIndex_Large(b *testing.B) {
 	for b.Loop() {
-		BuildFileIndexFromContent("test.journal", largeJournal)
+		BuildFileIndexFromContent("test.journal", largeJournal, parser.Options{})
 	}
 }
 
 func BenchmarkBuildFileIndex_XLarge(b *testing.B) {
 	for b.Loop() {
-		BuildFileIndexFromContent("test.journal", xlargeJournal)
+		BuildFileIndexFromContent("test.journal", xlargeJournal, parser.Options{})
 	}
 }
 
 func BenchmarkBuildFileIndex_Large_Allocs(b *testing.B) {
 	b.ReportAllocs()
 	for b.Loop() {
-		BuildFileIndexFromContent("test.journal", largeJournal)
+		BuildFileIndexFromContent("test.journal", largeJournal, parser.Options{})
 	}
 }
 
@@ -5,6 +5,7 @@ import (
 	"path/filepath"
 	"sort"
 	"strings"
+	"time"
 
 	"github.com/bmatcuk/doublestar/v4"
 
@@ -15,7 +16,10 @@ import (
 )
 
 type TransactionEntry struct {
-	Key         string
+	Key string
+	// AmountsKey is Key without the payee, for duplicate checks that
+	// ignore descriptions.
+	AmountsKey  string
 	FilePath    string
 	Range       ast.Range
 	Date        ast.Date
@@ -66,29 +70,32 @@ type WorkspaceIndex struct {
 	tagCounts         map[string]int
 	tagValueCounts    map[string]map[string]int
 	transactionsByKey map[string][]TransactionEntry
-	dateCounts        map[string]int
-	payeeTemplates    map[string][]analyzer.PostingTemplate
-	accounts          *analyzer.AccountIndex
-	payees            []string
-	commodities       []string
-	tags              []string
-	tagValues         map[string][]string
-	dates             []string
+	// transactionsByAmounts holds the same entries keyed by AmountsKey.
+	transactionsByAmounts map[string][]TransactionEntry
+	dateCounts            map[string]int
+	payeeTemplates        map[string][]analyzer.PostingTemplate
+	accounts              *analyzer.AccountIndex
+	payees                []string
+	commodities           []string
+	tags                  []string
+	tagValues             map[string][]string
+	dates                 []string
 }
 
 func NewWorkspaceIndex() *WorkspaceIndex {
 	return &WorkspaceIndex{
-		fileIndexes:       make(map[string]*FileIndex),
-		accountCounts:     make(map[string]int),
-		payeeCounts:       make(map[string]int),
-		commodityCounts:   make(map[string]int),
-		tagCounts:         make(map[string]int),
-		tagValueCounts:    make(map[string]map[string]int),
-		transactionsByKey: make(map[string][]TransactionEntry),
-		dateCounts:        make(map[string]int),
-		payeeTemplates:    make(map[string][]analyzer.PostingTemplate),
-		accounts:          analyzer.NewAccountIndex(),
-		tagValues:         make(map[string][]string),
+		fileIndexes:           make(map[string]*FileIndex),
+		accountCounts:         make(map[string]int),
+		payeeCounts:           make(map[string]int),
+		commodityCounts:       make(map[string]int),
+		tagCounts:             make(map[string]int),
+		tagValueCounts:        make(map[string]map[string]int),
+		transactionsByKey:     make(map[string][]TransactionEntry),
+		transactionsByAmounts: make(map[string][]TransactionEntry),
+		dateCounts:            make(map[string]int),
+		payeeTemplates:        make(map[string][]analyzer.PostingTemplate),
+		accounts:              analyzer.NewAccountIndex(),
+		tagValues:             make(map[string][]string),
 	}
 }
 
@@ -110,6 +117,83 @@ func (idx *WorkspaceIndex) Snapshot() IndexSnapshot {
 	}
 }
 
+// MatchingTransactions returns the indexed transactions with the same date,
+// payee and postings as tx.
+func (idx *WorkspaceIndex) MatchingTransactions(tx ast.Transaction) []TransactionEntry {
+	return append([]TransactionEntry(nil), idx.transactionsByKey[buildTransactionKey(tx)]...)
+}
+
+// DuplicateOptions sets how loosely PossibleDuplicates matches
+// transactions. With the zero value only transactions with the same date,
+// payee and postings match.
+type DuplicateOptions struct {
+	// Days is how many days apart two matching transactions may be dated.
+	Days int
+	// IgnoreDescription matches transactions whatever their payee or
+	// description.
+	IgnoreDescription bool
+}
+
+// PossibleDuplicates returns, for each transaction of journal, the other
+// transactions that look like a copy of it: transactions of journal itself
+// and indexed transactions of files other than path. journal is the live
+// content of path, so the index entries of path are not used.
+func (idx *WorkspaceIndex) PossibleDuplicates(path string, journal *ast.Journal, opts DuplicateOptions) [][]TransactionEntry {
+	if journal == nil {
+		return nil
+	}
+	indexed := idx.transactionsByKey
+	if opts.IgnoreDescription {
+		indexed = idx.transactionsByAmounts
+	}
+	local := make(map[string][]TransactionEntry, len(journal.Transactions))
+	for _, entry := range collectTransactions(path, journal) {
+		key := entry.Key
+		if opts.IgnoreDescription {
+			key = entry.AmountsKey
+		}
+		local[key] = append(local[key], entry)
+	}
+
+	result := make([][]TransactionEntry, len(journal.Transactions))
+	for i, tx := range journal.Transactions {
+		if len(tx.Postings) == 0 || ast.HasInvalidPosting(tx.Postings) {
+			continue
+		}
+		for _, key := range duplicateKeys(tx, opts) {
+			for _, entry := range local[key] {
+				if entry.Range.Start.Offset != tx.Range.Start.Offset {
+					result[i] = append(result[i], entry)
+				}
+			}
+			for _, entry := range indexed[key] {
+				if entry.FilePath != path {
+					result[i] = append(result[i], entry)
+				}
+			}
+		}
+	}
+	return result
+}
+
+// duplicateKeys returns the keys a copy of tx may be indexed under: one
+// for each date at most opts.Days away from its own.
+func duplicateKeys(tx ast.Transaction, opts DuplicateOptions) []string {
+	payee := ""
+	if !opts.IgnoreDescription {
+		payee = transactionPayee(tx)
+	}
+	postings := buildPostingsKey(tx)
+	date := time.Date(tx.Date.Year, time.Month(tx.Date.Month), tx.Date.Day, 0, 0, 0, 0, time.UTC)
+	days := max(opts.Days, 0)
+	keys := make([]string, 0, 2*days+1)
+	for offset := -days; offset <= days; offset++ {
+		d := date.AddDate(0, 0, offset)
+		keys = append(keys, transactionKey(d.Year(), int(d.Month()), d.Day(), payee, postings))
+	}
+	return keys
+}
+
 func (idx *WorkspaceIndex) FileIndex(path string) *FileIndex {
 	if fi, ok := idx.fileIndexes[path]; ok {
 		return fi
@@ -157,6 +241,7 @@ func (idx *WorkspaceIndex) addFileIndex(path string, fi *FileIndex) {
 	}
 	for _, entry := range fi.Transactions {
 		idx.transactionsByKey[entry.Key] = append(idx.transactionsByKey[entry.Key], entry)
+		idx.transactionsByAmounts[entry.AmountsKey] = append(idx.transactionsByAmounts[entry.AmountsKey], entry)
 	}
 	for _, date := range fi.Dates {
 		idx.dateCounts[date]++
@@ -192,6 +277,11 @@ func (idx *WorkspaceIndex) removeFileIndex(path string, fi *FileIndex) {
 		if len(idx.transactionsByKey[entry.Key]) == 0 {
 			delete(idx.transactionsByKey, entry.Key)
 		}
+		entries = idx.transactionsByAmounts[entry.AmountsKey]
+		idx.transactionsByAmounts[entry.AmountsKey] = filterTransactions(entries, path)
+		if len(idx.transactionsByAmounts[entry.AmountsKey]) == 0 {
+			delete(idx.transactionsByAmounts, entry.AmountsKey)
+		}
 	}
 	for _, date := range fi.Dates {
 		idx.decrementBy(idx.dateCounts, date, 1)
@@ -348,8 +438,8 @@ func copyNestedIntMap(source map[string]map[string]int) map[string]map[string]in
 	return clone
 }
 
-func BuildFileIndexFromContent(path, content string) (*FileIndex, *ast.Journal, []string) {
-	journal, parseErrs := parser.Parse(content)
+func BuildFileIndexFromContent(path, content string, opts parser.Options) (*FileIndex, *ast.Journal, []string) {
+	journal, parseErrs := parser.ParseWithOptions(content, opts)
 	var errors []string
 	for _, err := range parseErrs {
 		errors = append(errors, err.Message)
@@ -438,9 +528,9 @@ func collectTransactions(path string, journal *ast.Journal) []TransactionEntry {
 	}
 	entries := make([]TransactionEntry, 0, len(journal.Transactions))
 	for _, tx := range journal.Transactions {
-		key := buildTransactionKey(tx)
 		entries = append(entries, TransactionEntry{
-			Key:         key,
+			Key:         buildTransactionKey(tx),
+			AmountsKey:  buildAmountsKey(tx),
 			FilePath:    path,
 			Range:       tx.Range,
 			Date:        tx.Date,
@@ -452,20 +542,38 @@ func collectTransactions(path string, journal *ast.Journal) []TransactionEntry {
 }
 
 func buildTransactionKey(tx ast.Transaction) string {
-	date := fmt.Sprintf("%04d-%02d-%02d", tx.Date.Year, tx.Date.Month, tx.Date.Day)
-	payee := tx.Payee
-	if payee == "" {
-		payee = tx.Description
+	return transactionKey(tx.Date.Year, tx.Date.Month, tx.Date.Day, transactionPayee(tx), buildPostingsKey(tx))
+}
+
+// buildAmountsKey is buildTransactionKey with an empty payee.
+func buildAmountsKey(tx ast.Transaction) string {
+	return transactionKey(tx.Date.Year, tx.Date.Month, tx.Date.Day, "", buildPostingsKey(tx))
+}
+
+func transactionKey(year, month, day int, payee, postings string) string {
+	return fmt.Sprintf("%04d-%02d-%02d|%s|%s", year, month, day, payee, postings)
+}
+
+func transactionPayee(tx ast.Transaction) string {
+	if tx.Payee != "" {
+		return tx.Payee
 	}
+	return tx.Description
+}
+
+// buildPostingsKey keys the postings of tx by account and amount. Amounts
+// are compared by value, with the amount of a posting written without one
+// inferred, so that `$5.00` and an elided posting match `$5` and `$-5`.
+func buildPostingsKey(tx ast.Transaction) string {
 	postings := make([]string, 0, len(tx.Postings))
-	for _, posting := range tx.Postings {
+	for _, posting := range analyzer.InferAmounts(tx.Postings) {
 		postingKey := buildPostingKey(posting)
 		if postingKey != "" {
 			postings = append(postings, postingKey)
 		}
 	}
 	sort.Strings(postings)
-	return fmt.Sprintf("%s|%s|%s", date, payee, strings.Join(postings, ";"))
+	return strings.Join(postings, ";")
 }
 
 func buildPostingKey(posting ast.Posting) string {
@@ -474,14 +582,11 @@ func buildPostingKey(posting ast.Posting) string {
 	}
 	amount := ""
 	if posting.Amount != nil {
-		raw := posting.Amount.RawQuantity
-		if raw == "" {
-			raw = posting.Amount.Quantity.String()
-		}
+		quantity := posting.Amount.Quantity.String()
 		if posting.Amount.Commodity.Symbol != "" {
-			amount = fmt.Sprintf("%s %s", raw, posting.Amount.Commodity.Symbol)
+			amount = fmt.Sprintf("%s %s", quantity, posting.Amount.Commodity.Symbol)
 		} else {
-			amount = raw
+			amount = quantity
 		}
 	}
 	if amount == "" {
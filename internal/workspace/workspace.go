@@ -4,10 +4,12 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"slices"
 	"sort"
 	"strings"
 	"sync"
 
+	"github.com/juev/hledger-lsp/internal/analyzer"
 	"github.com/juev/hledger-lsp/internal/ast"
 	"github.com/juev/hledger-lsp/internal/formatter"
 	"github.com/juev/hledger-lsp/internal/include"
@@ -27,6 +29,8 @@ type Workspace struct {
 	cachedFormats     map[string]formatter.NumberFormat
 	cachedCommodities map[string]bool
 	cachedAccounts    map[string]bool
+	cachedPayees      map[string]bool
+	cachedTags        map[string]bool
 	index             *WorkspaceIndex
 }
 
@@ -49,6 +53,8 @@ func (w *Workspace) Initialize() error {
 	w.cachedFormats = nil
 	w.cachedCommodities = nil
 	w.cachedAccounts = nil
+	w.cachedPayees = nil
+	w.cachedTags = nil
 	w.index = NewWorkspaceIndex()
 	w.includeGraph = make(map[string][]string)
 	w.reverseGraph = make(map[string][]string)
@@ -223,6 +229,51 @@ func (w *Workspace) IndexSnapshot() IndexSnapshot {
 	return w.index.Snapshot()
 }
 
+// MatchingTransactions returns the workspace transactions with the same
+// date, payee and postings as tx. Amounts match by value, with elided
+// amounts inferred, so an imported entry matches a hand-written copy.
+func (w *Workspace) MatchingTransactions(tx ast.Transaction) []TransactionEntry {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+	if w.index == nil {
+		return nil
+	}
+	return w.index.MatchingTransactions(tx)
+}
+
+// AccountUsage returns the accounts posted to across the workspace and
+// their posting counts, or nil before the workspace is indexed.
+func (w *Workspace) AccountUsage() (*analyzer.AccountIndex, map[string]int) {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+	if w.index == nil {
+		return nil, nil
+	}
+	return cloneAccountIndex(w.index.accounts), copyIntMap(w.index.accountCounts)
+}
+
+// PossibleDuplicates returns the possible duplicates of each transaction
+// of journal, the live content of path, among its own transactions and
+// those of the other workspace files. Timeclock and timedot sessions are
+// not compared: repeated sessions are expected there.
+func (w *Workspace) PossibleDuplicates(path string, journal *ast.Journal, opts DuplicateOptions) [][]TransactionEntry {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+	if w.index == nil {
+		return NewWorkspaceIndex().PossibleDuplicates(path, journal, opts)
+	}
+	if w.resolved.OptionsFor(path).Format != parser.FormatJournal {
+		return nil
+	}
+	matches := w.index.PossibleDuplicates(path, journal, opts)
+	for i := range matches {
+		matches[i] = slices.DeleteFunc(matches[i], func(entry TransactionEntry) bool {
+			return w.resolved.OptionsFor(entry.FilePath).Format != parser.FormatJournal
+		})
+	}
+	return matches
+}
+
 func (w *Workspace) UpdateFile(path, content string) {
 	if path == "" {
 		return
@@ -243,7 +294,7 @@ func (w *Workspace) UpdateFile(path, content string) {
 		oldIncludes = append([]string(nil), oldIndex.Includes...)
 	}
 
-	fileIndex, journal, _ := BuildFileIndexFromContent(path, content)
+	fileIndex, journal, _ := BuildFileIndexFromContent(path, content, w.resolved.OptionsFor(path))
 	w.index.SetFileIndex(path, fileIndex)
 	w.updateIncludeEdgesLocked(path, oldIncludes, fileIndex.Includes)
 	w.updateResolvedLocked(path, journal)
@@ -274,6 +325,7 @@ func (w *Workspace) buildIndexFromResolvedLocked() {
 func (w *Workspace) updateResolvedLocked(path string, journal *ast.Journal) {
 	if w.resolved == nil {
 		w.resolved = include.NewResolvedJournal(nil)
+		w.resolved.PrimaryPath = w.rootJournalPath
 	}
 	if path == w.rootJournalPath {
 		w.resolved.Primary = journal
@@ -354,11 +406,43 @@ func (w *Workspace) removeUnreachableLocked(reachable map[string]bool) {
 		delete(w.reverseGraph, path)
 		if w.resolved != nil {
 			delete(w.resolved.Files, path)
+			delete(w.resolved.Inherited, path)
 			w.resolved.FileOrder = removeString(w.resolved.FileOrder, path)
 		}
 	}
 }
 
+// inheritedOptionsLocked returns the parser options path inherits from the
+// first indexed file that includes it, as include.Loader computes them: the
+// state in effect at the include directive and the format it names.
+func (w *Workspace) inheritedOptionsLocked(path string) parser.Options {
+	for _, includer := range w.reverseGraph[path] {
+		journal := w.resolvedJournalLocked(includer)
+		if journal == nil {
+			continue
+		}
+		for _, inc := range journal.Includes {
+			if !slices.Contains(resolveIncludePaths(includer, []ast.Include{inc}), path) {
+				continue
+			}
+			opts := include.OptionsAt(w.resolved.OptionsFor(includer), journal.Directives, inc.Range.Start)
+			opts.Format = parser.FormatForInclude(inc, path)
+			return opts
+		}
+	}
+	return parser.Options{Format: parser.FormatForPath(path)}
+}
+
+func (w *Workspace) resolvedJournalLocked(path string) *ast.Journal {
+	if w.resolved == nil {
+		return nil
+	}
+	if path == w.rootJournalPath {
+		return w.resolved.Primary
+	}
+	return w.resolved.Files[path]
+}
+
 func (w *Workspace) addMissingReachableLocked(reachable map[string]bool) bool {
 	added := false
 	for path := range reachable {
@@ -369,10 +453,15 @@ func (w *Workspace) addMissingReachableLocked(reachable map[string]bool) bool {
 		if err != nil {
 			continue
 		}
-		fileIndex, journal, _ := BuildFileIndexFromContent(path, string(content))
+		opts := w.inheritedOptionsLocked(path)
+		fileIndex, journal, _ := BuildFileIndexFromContent(path, string(content), opts)
 		w.index.SetFileIndex(path, fileIndex)
 		w.updateIncludeEdgesLocked(path, nil, fileIndex.Includes)
 		w.updateResolvedLocked(path, journal)
+		if w.resolved.Inherited == nil {
+			w.resolved.Inherited = make(map[string]parser.Options)
+		}
+		w.resolved.Inherited[path] = opts
 		added = true
 	}
 	if added {
@@ -398,6 +487,8 @@ func (w *Workspace) clearCachesLocked() {
 	w.cachedFormats = nil
 	w.cachedCommodities = nil
 	w.cachedAccounts = nil
+	w.cachedPayees = nil
+	w.cachedTags = nil
 }
 
 func sameStringSlice(a, b []string) bool {
@@ -460,7 +551,7 @@ func (w *Workspace) GetCommodityFormats() map[string]formatter.NumberFormat {
 	for _, dir := range w.resolved.AllDirectives() {
 		if cd, ok := dir.(ast.CommodityDirective); ok {
 			if cd.Format != "" {
-				formats[cd.Commodity.Symbol] = formatter.ParseNumberFormat(cd.Format)
+				formats[cd.Commodity.Symbol] = formatter.ParseNumberFormatWithMark(cd.Format, cd.DecimalMark)
 			}
 		}
 	}
@@ -526,3 +617,61 @@ func (w *Workspace) GetDeclaredAccounts() map[string]bool {
 	w.cachedAccounts = declared
 	return declared
 }
+
+func (w *Workspace) GetDeclaredPayees() map[string]bool {
+	w.mu.RLock()
+	if w.cachedPayees != nil {
+		defer w.mu.RUnlock()
+		return w.cachedPayees
+	}
+	w.mu.RUnlock()
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.cachedPayees != nil {
+		return w.cachedPayees
+	}
+
+	if w.resolved == nil {
+		return nil
+	}
+
+	declared := make(map[string]bool)
+	for _, dir := range w.resolved.AllDirectives() {
+		if pd, ok := dir.(ast.PayeeDirective); ok {
+			declared[pd.Name] = true
+		}
+	}
+	w.cachedPayees = declared
+	return declared
+}
+
+func (w *Workspace) GetDeclaredTags() map[string]bool {
+	w.mu.RLock()
+	if w.cachedTags != nil {
+		defer w.mu.RUnlock()
+		return w.cachedTags
+	}
+	w.mu.RUnlock()
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.cachedTags != nil {
+		return w.cachedTags
+	}
+
+	if w.resolved == nil {
+		return nil
+	}
+
+	declared := make(map[string]bool)
+	for _, dir := range w.resolved.AllDirectives() {
+		if td, ok := dir.(ast.TagDirective); ok {
+			declared[td.Name] = true
+		}
+	}
+	w.cachedTags = declared
+	return declared
+}
@@ -410,6 +410,43 @@ func TestWorkspace_IndexSnapshot_IncludeChange(t *testing.T) {
 	assert.NotContains(t, snapshot.Accounts.All, "expenses:food")
 }
 
+func TestWorkspace_IndexSnapshot_IncludeChangeInheritsOptions(t *testing.T) {
+	t.Setenv("LEDGER_FILE", "")
+	t.Setenv("HLEDGER_JOURNAL", "")
+
+	tmpDir := t.TempDir()
+
+	mainPath := filepath.Join(tmpDir, "main.journal")
+	require.NoError(t, os.WriteFile(mainPath, []byte("alias bank:old = assets:bank\n"), 0644))
+
+	hoursPath := filepath.Join(tmpDir, "hours.txt")
+	hoursContent := `i 2024-01-15 09:00 client:acme
+o 2024-01-15 12:30
+`
+	require.NoError(t, os.WriteFile(hoursPath, []byte(hoursContent), 0644))
+
+	oldPath := filepath.Join(tmpDir, "old.journal")
+	oldContent := `2024-01-16 Deposit
+    bank:old  $5
+    income:salary
+`
+	require.NoError(t, os.WriteFile(oldPath, []byte(oldContent), 0644))
+
+	ws := NewWorkspace(tmpDir, include.NewLoader())
+	require.NoError(t, ws.Initialize())
+
+	ws.UpdateFile(mainPath, "alias bank:old = assets:bank\ninclude timeclock:hours.txt\ninclude old.journal\n")
+
+	snapshot := ws.IndexSnapshot()
+	assert.Contains(t, snapshot.Accounts.All, "client:acme", "hours.txt is read as timeclock")
+	assert.Contains(t, snapshot.Accounts.All, "assets:bank", "old.journal inherits the alias")
+	assert.NotContains(t, snapshot.Accounts.All, "bank:old")
+
+	resolved := ws.GetResolved()
+	assert.Equal(t, parser.FormatTimeclock, resolved.OptionsFor(hoursPath).Format)
+	assert.Len(t, resolved.OptionsFor(oldPath).Aliases, 1)
+}
+
 func TestWorkspace_TransactionIndexKeys(t *testing.T) {
 	t.Setenv("LEDGER_FILE", "")
 	t.Setenv("HLEDGER_JOURNAL", "")
@@ -436,6 +473,34 @@ func TestWorkspace_TransactionIndexKeys(t *testing.T) {
 	assert.Equal(t, mainPath, entries[0].FilePath)
 }
 
+func TestWorkspace_MatchingTransactions(t *testing.T) {
+	t.Setenv("LEDGER_FILE", "")
+	t.Setenv("HLEDGER_JOURNAL", "")
+
+	tmpDir := t.TempDir()
+	mainPath := filepath.Join(tmpDir, "main.journal")
+	content := `2024-03-01 Coffee Shop
+    expenses:food  $3
+    assets:cash
+`
+	require.NoError(t, os.WriteFile(mainPath, []byte(content), 0644))
+
+	ws := NewWorkspace(tmpDir, include.NewLoader())
+	require.NoError(t, ws.Initialize())
+
+	journal, errs := parser.Parse(content)
+	require.Empty(t, errs)
+	require.Len(t, journal.Transactions, 1)
+
+	matches := ws.MatchingTransactions(journal.Transactions[0])
+	require.Len(t, matches, 1)
+	assert.Equal(t, mainPath, matches[0].FilePath)
+
+	other, errs := parser.Parse("2024-03-02 Coffee Shop\n    expenses:food  $3\n    assets:cash\n")
+	require.Empty(t, errs)
+	assert.Empty(t, ws.MatchingTransactions(other.Transactions[0]), "a different date does not match")
+}
+
 func TestWorkspace_IndexSnapshot_TagValues_SingleFile(t *testing.T) {
 	t.Setenv("LEDGER_FILE", "")
 	t.Setenv("HLEDGER_JOURNAL", "")
@@ -687,3 +752,95 @@ func TestWorkspace_IndexSnapshot_PayeeTemplates(t *testing.T) {
 	assert.Equal(t, "expenses:food", groceryPostings[0].Account)
 	assert.Equal(t, "assets:cash", groceryPostings[1].Account)
 }
+
+func TestWorkspace_PossibleDuplicates(t *testing.T) {
+	t.Setenv("LEDGER_FILE", "")
+	t.Setenv("HLEDGER_JOURNAL", "")
+
+	tmpDir := t.TempDir()
+	mainPath := filepath.Join(tmpDir, "main.journal")
+	bankPath := filepath.Join(tmpDir, "bank.journal")
+	hoursPath := filepath.Join(tmpDir, "hours.timeclock")
+	require.NoError(t, os.WriteFile(mainPath, []byte("include bank.journal\ninclude hours.timeclock\n"), 0644))
+	hoursContent := `i 2024-03-01 09:00 client:acme
+o 2024-03-01 10:00
+i 2024-03-01 11:00 client:acme
+o 2024-03-01 12:00
+`
+	require.NoError(t, os.WriteFile(hoursPath, []byte(hoursContent), 0644))
+	bankContent := `2024-03-01 Coffee Shop
+    expenses:food  $3
+    assets:cash
+
+2024-03-05 Grocery Store
+    expenses:food  $40
+    assets:cash
+`
+	require.NoError(t, os.WriteFile(bankPath, []byte(bankContent), 0644))
+
+	ws := NewWorkspace(tmpDir, include.NewLoader())
+	require.NoError(t, ws.Initialize())
+
+	content := `2024-03-01 Coffee Shop
+    assets:cash  $-3.00
+    expenses:food  $3
+
+2024-03-01 Coffee Shop
+    expenses:food  $3
+    assets:cash
+
+2024-03-06 Grocery Store
+    expenses:food  $40
+    assets:cash
+
+2024-03-05 Supermarket
+    expenses:food  $40
+    assets:cash
+`
+	journal, errs := parser.Parse(content)
+	require.Empty(t, errs)
+
+	matches := ws.PossibleDuplicates(mainPath, journal, DuplicateOptions{})
+	require.Len(t, matches, 4)
+	require.Len(t, matches[0], 2, "amounts are compared by value, elided ones inferred")
+	assert.Equal(t, mainPath, matches[0][0].FilePath)
+	assert.Equal(t, 5, matches[0][0].Range.Start.Line)
+	assert.Equal(t, bankPath, matches[0][1].FilePath)
+	require.Len(t, matches[1], 2)
+	assert.Equal(t, mainPath, matches[1][0].FilePath)
+	assert.Equal(t, 1, matches[1][0].Range.Start.Line)
+	assert.Equal(t, bankPath, matches[1][1].FilePath)
+	assert.Equal(t, 1, matches[1][1].Range.Start.Line)
+	assert.Empty(t, matches[2])
+	assert.Empty(t, matches[3])
+
+	matches = ws.PossibleDuplicates(mainPath, journal, DuplicateOptions{Days: 1})
+	require.Len(t, matches[2], 1)
+	assert.Equal(t, bankPath, matches[2][0].FilePath)
+	assert.Equal(t, 5, matches[2][0].Range.Start.Line)
+	assert.Empty(t, matches[3])
+
+	matches = ws.PossibleDuplicates(mainPath, journal, DuplicateOptions{Days: 1, IgnoreDescription: true})
+	require.Len(t, matches[2], 2)
+	assert.Equal(t, mainPath, matches[2][0].FilePath)
+	assert.Equal(t, 13, matches[2][0].Range.Start.Line)
+	assert.Equal(t, bankPath, matches[2][1].FilePath)
+	require.Len(t, matches[3], 2)
+
+	// The indexed copy of a file is replaced by its live content.
+	bank, errs := parser.Parse(bankContent)
+	require.Empty(t, errs)
+	matches = ws.PossibleDuplicates(bankPath, bank, DuplicateOptions{})
+	assert.Equal(t, [][]TransactionEntry{nil, nil}, matches)
+
+	// Repeated timeclock sessions are not duplicates.
+	hours, errs := parser.ParseWithOptions(hoursContent, parser.Options{Format: parser.FormatTimeclock})
+	require.Empty(t, errs)
+	assert.Nil(t, ws.PossibleDuplicates(hoursPath, hours, DuplicateOptions{IgnoreDescription: true}))
+	matches = ws.PossibleDuplicates(mainPath, hours, DuplicateOptions{IgnoreDescription: true})
+	for _, m := range matches {
+		for _, entry := range m {
+			assert.NotEqual(t, hoursPath, entry.FilePath)
+		}
+	}
+}